@@ -145,7 +145,7 @@ func (h *GraphHandler) GenerateSuggestions(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	suggestions, err := h.service.GenerateSuggestions(r.Context(), projectID)
+	suggestions, err := h.service.GenerateWritingSuggestions(r.Context(), projectID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -9,6 +9,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/zibianqu/novel-study/internal/ai"
+	"github.com/zibianqu/novel-study/internal/ai/collaboration"
+	"github.com/zibianqu/novel-study/internal/ai/fixture"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/ai/openai"
+	"github.com/zibianqu/novel-study/internal/ai/prompt"
 	"github.com/zibianqu/novel-study/internal/ai/rag"
 	"github.com/zibianqu/novel-study/internal/config"
 	"github.com/zibianqu/novel-study/internal/handler"
@@ -32,7 +37,7 @@ func main() {
 		log.Fatalf("数据库连接失败: %v", err)
 	}
 	defer db.Close()
-	
+
 	// 配置连接池
 	db.SetMaxOpenConns(25)
 	db.SetMaxIdleConns(5)
@@ -50,7 +55,7 @@ func main() {
 	// 初始化 Redis
 	var redisClient *repository.RedisClient
 	var cacheService *service.CacheService
-	
+
 	if cfg.CacheEnabled {
 		redisClient, err = repository.NewRedisClient(
 			cfg.RedisHost,
@@ -68,12 +73,31 @@ func main() {
 		}
 	}
 
-	// 初始化 AI 引擎
-	aiEngine := ai.NewEngine(cfg)
-	log.Printf("✅ AI 引擎初始化完成，已注册 %d 个 Agent", len(aiEngine.ListAgents()))
+	// 初始化模型提供方
+	var llmProvider llm.LLMProvider
+	var embedder rag.Embedder
+	if client := openai.NewClientWithBaseURL(cfg.OpenAIAPIKey, cfg.OpenAIBaseURL); client != nil {
+		llmProvider = client
+		embedder = client
+	} else {
+		log.Println("⚠️ 未配置 OPENAI_API_KEY，仅设置了自己 API 密钥的用户可以使用 AI 功能")
+	}
+
+	// 额外的提供方与按提供方的熔断器，模型名形如 "local:qwen2.5" 时路由到对应提供方
+	llmRouter := llm.NewRouter(llmProvider)
+	for _, p := range cfg.LLMProviders {
+		llmRouter.Register(p.Name, openai.NewClientWithBaseURL(p.APIKey, p.BaseURL))
+		log.Printf("✅ 已注册模型提供方: %s", p.Name)
+	}
+
+	var engineProvider llm.LLMProvider = llmRouter
+	if cfg.LLMFixtureDir != "" {
+		engineProvider = fixture.NewProvider(cfg.LLMFixtureDir, llmRouter, fixture.Mode(cfg.LLMFixtureMode), cfg.LLMFixtureStrict)
+		log.Printf("⚠️ 模型调用录制回放已启用: %s (mode=%s, strict=%v)", cfg.LLMFixtureDir, cfg.LLMFixtureMode, cfg.LLMFixtureStrict)
+	}
 
 	// 初始化 RAG 系统
-	embeddingService := rag.NewEmbeddingService(cfg.OpenAIAPIKey)
+	embeddingService := rag.NewEmbeddingService(embedder)
 	vectorStore := rag.NewVectorStore(db)
 	retriever := rag.NewRetriever(embeddingService, vectorStore)
 	log.Println("✅ RAG 系统初始化完成")
@@ -82,15 +106,48 @@ func main() {
 	projectRepo := repository.NewProjectRepository(db)
 	chapterRepo := repository.NewChapterRepository(db)
 	agentRepo := repository.NewAgentRepository(db)
+	chatSessionRepo := repository.NewChatSessionRepository(db)
+	usageRepo := repository.NewUsageRepository(db)
+	budgetRepo := repository.NewBudgetRepository(db)
+	userRepo := repository.NewUserRepository(db)
 	knowledgeRepo := repository.NewKnowledgeRepository(db)
 	neo4jRepo := repository.NewNeo4jRepository(neo4jDriver)
+	storylineRepo := repository.NewStorylineRepository(db)
+	summaryRepo := repository.NewSummaryRepository(db)
+	promptTemplateRepo := repository.NewPromptTemplateRepository(db)
+	workflowRunRepo := repository.NewWorkflowRunRepository(db)
+	workflowTemplateRepo := repository.NewWorkflowTemplateRepository(db)
+
+	// 初始化 AI 引擎
+	aiEngine := ai.NewEngine(cfg, db, engineProvider, retriever, agentRepo, projectRepo, chapterRepo, storylineRepo, neo4jRepo)
+	log.Printf("✅ AI 引擎初始化完成，已注册 %d 个 Agent", len(aiEngine.ListAgents()))
 
 	// 初始化 Service
 	projectService := service.NewProjectService(projectRepo)
 	chapterService := service.NewChapterService(chapterRepo, projectRepo)
+	summaryService := service.NewSummaryService(aiEngine, summaryRepo, chapterRepo)
+	chapterService.SetSummaryService(summaryService)
+	promptService := prompt.NewPromptService(cfg.PromptMaxTokens)
 	aiService := service.NewAIService(aiEngine, agentRepo, projectRepo)
+	aiService.SetPromptInspection(promptService, retriever, summaryService)
+	agentService := service.NewAgentService(aiEngine, agentRepo, projectRepo)
+	chatSessionService := service.NewChatSessionService(aiEngine, chatSessionRepo, projectRepo)
+	usageService := service.NewUsageService(usageRepo, projectRepo)
+	budgetService := service.NewBudgetService(cfg, budgetRepo, usageRepo, projectRepo)
+	aiEngine.SetBudgetGuard(budgetService)
+	apiKeyService := service.NewAPIKeyService(cfg, userRepo)
+	aiEngine.SetProviderResolver(apiKeyService)
+	promptTemplateService := service.NewPromptTemplateService(promptTemplateRepo, projectRepo)
+	aiEngine.SetPromptTemplates(promptTemplateService)
 	knowledgeService := service.NewKnowledgeService(knowledgeRepo, projectRepo, retriever)
 	graphService := service.NewGraphService(neo4jRepo, projectRepo)
+	workflowScheduler := collaboration.NewScheduler(aiEngine.WorkflowExecutor())
+	workflowService := service.NewWorkflowService(workflowScheduler, collaboration.NewWorkflowRegistry(), workflowRunRepo, workflowTemplateRepo, agentRepo, projectRepo)
+	if resumed, err := workflowService.ResumeUnfinished(); err != nil {
+		log.Printf("⚠️ 恢复未完成的工作流失败: %v", err)
+	} else if resumed > 0 {
+		log.Printf("🔁 已恢复 %d 个未完成的工作流", resumed)
+	}
 
 	// 初始化登录限流器
 	loginLimiter := middleware.NewLoginLimiter(
@@ -103,8 +160,17 @@ func main() {
 	projectHandler := handler.NewProjectHandler(projectService)
 	chapterHandler := handler.NewChapterHandler(chapterService)
 	aiHandler := handler.NewAIHandler(aiService)
+	aiStreamHandler := handler.NewAIStreamHandler(aiEngine, projectRepo)
+	aiStreamHandler.SetLongRangeMemory(summaryService, promptService)
+	agentHandler := handler.NewAgentHandler(agentService)
+	chatSessionHandler := handler.NewChatSessionHandler(chatSessionService)
+	usageHandler := handler.NewUsageHandler(usageService)
+	budgetHandler := handler.NewBudgetHandler(budgetService)
+	promptTemplateHandler := handler.NewPromptTemplateHandler(promptTemplateService)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService)
 	knowledgeHandler := handler.NewKnowledgeHandler(knowledgeService)
 	graphHandler := handler.NewGraphHandler(graphService)
+	workflowHandler := handler.NewWorkflowHandler(workflowService)
 	storylineHandler := handler.NewStorylineHandler(db)
 	healthHandler := handler.NewHealthHandler(db, neo4jDriver)
 
@@ -115,13 +181,13 @@ func main() {
 	router := gin.New() // 使用New()而不是Default()
 
 	// ✨ 全局中间件
-	router.Use(middleware.RequestLogger())    // 请求日志
-	router.Use(middleware.Recovery())         // 恢复中间件
-	router.Use(middleware.ErrorHandler())     // 错误处理
-	router.Use(middleware.CORS())             // CORS
-	router.Use(middleware.SanitizeInput())    // XSS防护
-	router.Use(middleware.TimeoutByPath())    // 超时控制
-	router.Use(middleware.RateLimitByPath())  // 限流
+	router.Use(middleware.RequestLogger())   // 请求日志
+	router.Use(middleware.Recovery())        // 恢复中间件
+	router.Use(middleware.ErrorHandler())    // 错误处理
+	router.Use(middleware.CORS())            // CORS
+	router.Use(middleware.SanitizeInput())   // XSS防护
+	router.Use(middleware.TimeoutByPath())   // 超时控制
+	router.Use(middleware.RateLimitByPath()) // 限流
 
 	// 静态文件服务
 	router.Static("/css", "./frontend/css")
@@ -157,6 +223,12 @@ func main() {
 		protected := api.Group("")
 		protected.Use(middleware.JWTAuth(cfg.JWTSecret))
 		{
+			// 用户自带 API 密钥
+			protected.GET("/user/api-key", apiKeyHandler.GetAPIKey)
+			protected.PUT("/user/api-key", apiKeyHandler.SetAPIKey)
+			protected.POST("/user/api-key/test", apiKeyHandler.TestAPIKey)
+			protected.DELETE("/user/api-key", apiKeyHandler.DeleteAPIKey)
+
 			// 项目管理
 			protected.GET("/projects", projectHandler.GetProjects)
 			protected.POST("/projects", projectHandler.CreateProject)
@@ -173,11 +245,72 @@ func main() {
 
 			// AI 功能
 			protected.GET("/ai/agents", aiHandler.GetAgents)
+			protected.GET("/ai/tools", aiHandler.GetTools)
 			protected.POST("/ai/chat", aiHandler.Chat)
 			protected.POST("/ai/chat/stream", middleware.SSE(), aiHandler.ChatStream)
+			protected.POST("/ai/estimate", aiHandler.EstimateChat)
+			protected.POST("/ai/inspect-prompt", aiHandler.InspectPrompt)
 			protected.POST("/ai/generate/chapter", aiHandler.GenerateChapter)
 			protected.POST("/ai/check/quality", aiHandler.CheckQuality)
 
+			// AI 流式生成 (SSE)
+			protected.POST("/ai/stream/continue", aiStreamHandler.ContinueWrite)
+			protected.POST("/ai/stream/polish", aiStreamHandler.Polish)
+			protected.POST("/ai/stream/rewrite", aiStreamHandler.Rewrite)
+			protected.POST("/ai/stream/chat", aiStreamHandler.Chat)
+
+			// 用户扩展 Agent
+			protected.GET("/agents", agentHandler.GetAgents)
+			protected.POST("/agents", agentHandler.CreateAgent)
+			protected.GET("/agents/:id", agentHandler.GetAgent)
+			protected.PUT("/agents/:id", agentHandler.UpdateAgent)
+			protected.DELETE("/agents/:id", agentHandler.DeleteAgent)
+			protected.POST("/agents/:id/run", agentHandler.RunAgent)
+
+			// 多轮对话会话
+			protected.GET("/chat/sessions/project/:projectId", chatSessionHandler.GetProjectSessions)
+			protected.POST("/chat/sessions", chatSessionHandler.CreateSession)
+			protected.GET("/chat/sessions/:id", chatSessionHandler.GetSession)
+			protected.PUT("/chat/sessions/:id", chatSessionHandler.RenameSession)
+			protected.DELETE("/chat/sessions/:id", chatSessionHandler.DeleteSession)
+			protected.POST("/chat/sessions/:id/fork", chatSessionHandler.ForkSession)
+			protected.POST("/chat/sessions/:id/messages", chatSessionHandler.SendMessage)
+			protected.POST("/chat/sessions/:id/messages/stream", chatSessionHandler.SendMessageStream)
+
+			// Token 用量
+			protected.GET("/usage", usageHandler.GetUsage)
+
+			// AI 预算
+			protected.GET("/budget", budgetHandler.GetBudget)
+			protected.GET("/projects/:id/budget", budgetHandler.GetProjectBudget)
+			protected.PUT("/projects/:id/budget", budgetHandler.UpdateProjectBudget)
+
+			// 项目覆盖的提示词模板
+			protected.GET("/projects/:id/prompt-templates", promptTemplateHandler.ListTemplates)
+			protected.POST("/projects/:id/prompt-templates", promptTemplateHandler.CreateTemplate)
+			protected.GET("/projects/:id/prompt-templates/:templateId", promptTemplateHandler.GetTemplate)
+			protected.POST("/projects/:id/prompt-templates/:templateId/versions", promptTemplateHandler.CreateVersion)
+			protected.POST("/projects/:id/prompt-templates/:templateId/rollback", promptTemplateHandler.Rollback)
+			protected.DELETE("/projects/:id/prompt-templates/:templateId", promptTemplateHandler.DeleteTemplate)
+
+			// 工作流模板 (用户级与项目级)
+			protected.GET("/workflow-templates", workflowHandler.ListTemplates)
+			protected.POST("/workflow-templates", workflowHandler.CreateTemplate)
+			protected.GET("/workflow-templates/:templateId", workflowHandler.GetTemplate)
+			protected.PUT("/workflow-templates/:templateId", workflowHandler.UpdateTemplate)
+			protected.DELETE("/workflow-templates/:templateId", workflowHandler.DeleteTemplate)
+			protected.GET("/projects/:id/workflow-templates", workflowHandler.ListTemplates)
+			protected.POST("/projects/:id/workflow-templates", workflowHandler.CreateTemplate)
+
+			// 工作流运行
+			protected.GET("/projects/:id/workflow-runs", workflowHandler.ListRuns)
+			protected.POST("/projects/:id/workflow-runs", workflowHandler.StartRun)
+			protected.GET("/projects/:id/workflow-runs/:runId", workflowHandler.GetRun)
+			protected.POST("/projects/:id/workflow-runs/:runId/cancel", workflowHandler.CancelRun)
+			protected.GET("/projects/:id/workflow-runs/:runId/stream", middleware.SSE(), workflowHandler.StreamRun)
+			protected.GET("/projects/:id/workflow-approvals", workflowHandler.ListApprovals)
+			protected.POST("/projects/:id/workflow-runs/:runId/approvals/:taskId", workflowHandler.ResolveApproval)
+
 			// 知识库
 			protected.GET("/knowledge/project/:projectId", knowledgeHandler.GetProjectKnowledge)
 			protected.POST("/knowledge", knowledgeHandler.CreateKnowledge)
@@ -194,6 +327,21 @@ func main() {
 			protected.GET("/storylines/project/:projectId", storylineHandler.GetProjectStorylines)
 			protected.POST("/storylines", storylineHandler.CreateStoryline)
 		}
+
+		// 管理接口
+		admin := api.Group("/admin")
+		admin.Use(middleware.JWTAuth(cfg.JWTSecret), middleware.RequireAdmin(cfg.AdminUserIDs))
+		{
+			admin.POST("/agents/reload", aiHandler.ReloadAgents)
+			admin.GET("/usage", usageHandler.GetAllUsage)
+			admin.GET("/budgets/users/:id", budgetHandler.GetUserBudget)
+			admin.PUT("/budgets/users/:id", budgetHandler.UpdateUserBudget)
+			admin.GET("/prompt-templates", promptTemplateHandler.ListTemplates)
+			admin.POST("/prompt-templates", promptTemplateHandler.CreateTemplate)
+			admin.GET("/prompt-templates/:templateId", promptTemplateHandler.GetTemplate)
+			admin.POST("/prompt-templates/:templateId/versions", promptTemplateHandler.CreateVersion)
+			admin.POST("/prompt-templates/:templateId/rollback", promptTemplateHandler.Rollback)
+		}
 	}
 
 	// 启动服务器
@@ -204,20 +352,20 @@ func main() {
 	log.Println("")
 	log.Println("✨ ========================================")
 	log.Printf("🚀 NovelForge AI 服务器启动成功")
-	log.Printf("🎬 7 个核心 Agent 已就绪")
+	log.Printf("🎬 %d 个 Agent 已就绪", len(aiEngine.ListAgents()))
 	log.Printf("🧠 RAG 知识库系统已启用")
 	log.Printf("🕸️ Neo4j 知识图谱已连接")
-	
+
 	if cacheService != nil {
 		log.Printf("📦 Redis 缓存系统已启用")
 	}
-	
+
 	log.Printf("✅ 安全增强:")
 	log.Printf("   - 密码策略: 最少8位 + 字母 + 数字")
 	log.Printf("   - 登录限流: %d次/%v", cfg.MaxLoginAttempts, cfg.LoginBlockDuration)
 	log.Printf("   - API加密: AES-256-GCM")
 	log.Printf("   - 输入验证: XSS防护 + SQL注入防护")
-	
+
 	log.Printf("✅ 中间件: CORS + 超时 + 限流 + 日志 + 错误处理")
 	log.Printf("🔗 前端: http://localhost:%s", port)
 	log.Printf("📚 API: http://localhost:%s/api/v1", port)
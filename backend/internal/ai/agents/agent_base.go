@@ -3,35 +3,49 @@ package agents
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
+	"strings"
 	"time"
 
-	"github.com/zibianqu/novel-study/internal/ai"
+	"github.com/zibianqu/novel-study/internal/ai/guard"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/ai/prompt"
+	"github.com/zibianqu/novel-study/internal/ai/tokenizer"
 	"github.com/zibianqu/novel-study/internal/ai/tools"
 )
 
+// defaultMaxToolSteps 默认的工具调用轮数上限
+const defaultMaxToolSteps = 5
+
+// defaultHistoryTokenBudget 默认的历史消息 Token 预算
+const defaultHistoryTokenBudget = 4000
+
+// toolOutputDetector 检查工具输出中的提示词注入特征
+var toolOutputDetector = guard.NewDetector()
+
 // BaseAgent 基础Agent实现
 type BaseAgent struct {
-	config       *ai.AgentConfig
-	apiKey       string
+	config       *llm.AgentConfig
+	provider     llm.LLMProvider
 	toolRegistry *tools.ToolRegistry
 	agentID      int // 用于工具调用日志
 }
 
 // NewBaseAgent 创建基础Agent
-func NewBaseAgent(config *ai.AgentConfig, apiKey string, toolRegistry *tools.ToolRegistry, agentID int) *BaseAgent {
+func NewBaseAgent(config *llm.AgentConfig, provider llm.LLMProvider, toolRegistry *tools.ToolRegistry, agentID int) *BaseAgent {
 	return &BaseAgent{
 		config:       config,
-		apiKey:       apiKey,
+		provider:     provider,
 		toolRegistry: toolRegistry,
 		agentID:      agentID,
 	}
 }
 
 // GetConfig 获取配置
-func (a *BaseAgent) GetConfig() *ai.AgentConfig {
+func (a *BaseAgent) GetConfig() *llm.AgentConfig {
 	return a.config
 }
 
@@ -57,20 +71,22 @@ func (a *BaseAgent) CanUseTool(toolName string) bool {
 
 // CallTool 调用工具
 func (a *BaseAgent) CallTool(ctx context.Context, toolName string, params map[string]interface{}) (interface{}, error) {
-	if !a.CanUseTool(toolName) {
-		return nil, fmt.Errorf("agent %s is not authorized to use tool: %s", a.config.Name, toolName)
-	}
-
 	if a.toolRegistry == nil {
 		return nil, fmt.Errorf("tool registry not initialized")
 	}
 
+	if !a.CanUseTool(toolName) {
+		err := fmt.Errorf("agent %s is not authorized to use tool: %s", a.config.Name, toolName)
+		a.toolRegistry.LogCall(a.agentID, toolName, params, nil, err, 0)
+		return nil, err
+	}
+
 	log.Printf("[%s] 调用工具: %s", a.config.Name, toolName)
 	return a.toolRegistry.Execute(ctx, a.agentID, toolName, params)
 }
 
 // Execute 执行Agent
-func (a *BaseAgent) Execute(ctx context.Context, req *ai.AgentRequest) (*ai.AgentResponse, error) {
+func (a *BaseAgent) Execute(ctx context.Context, req *llm.AgentRequest) (*llm.AgentResponse, error) {
 	start := time.Now()
 
 	// 参数验证
@@ -78,103 +94,508 @@ func (a *BaseAgent) Execute(ctx context.Context, req *ai.AgentRequest) (*ai.Agen
 		return nil, fmt.Errorf("prompt cannot be empty")
 	}
 
-	// 构建消息
-	messages := []ai.ChatMessage{
-		{Role: "system", Content: a.config.SystemPrompt},
-		{Role: "user", Content: req.Prompt},
+	log.Printf("[%s] Executing request: %s", a.config.Name, req.Prompt)
+
+	// ✨ 调用模型，按需循环执行工具调用
+	messages := a.BuildMessages(req)
+	resp, toolCalls, err := a.runToolLoop(ctx, messages, req, nil)
+	if err != nil {
+		return nil, fmt.Errorf("OpenAI API call failed: %w", err)
+	}
+
+	return a.finishResponse(ctx, messages, req, resp, toolCalls, start)
+}
+
+// finishResponse 声明了输出 Schema 时校验 (必要时修正) 输出，再整理为Agent响应
+func (a *BaseAgent) finishResponse(ctx context.Context, messages []llm.ChatMessage, req *llm.AgentRequest, resp *llm.CompletionResponse, toolCalls []tools.ToolCallResult, start time.Time) (*llm.AgentResponse, error) {
+	var structured map[string]interface{}
+	if schema := a.outputSchema(req); schema != nil {
+		var err error
+		resp, structured, err = a.enforceOutputSchema(ctx, messages, req, resp, schema)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// 添加上下文信息
-	if req.Context != nil && len(req.Context) > 0 {
+	agentResp := buildAgentResponse(resp, toolCalls, time.Since(start))
+	agentResp.Structured = structured
+	return agentResp, nil
+}
+
+// buildAgentResponse 将模型响应整理为Agent响应
+func buildAgentResponse(resp *llm.CompletionResponse, toolCalls []tools.ToolCallResult, duration time.Duration) *llm.AgentResponse {
+	metadata := map[string]interface{}{
+		"model":             resp.Model,
+		"finish_reason":     resp.FinishReason,
+		"prompt_tokens":     resp.Usage.PromptTokens,
+		"completion_tokens": resp.Usage.CompletionTokens,
+	}
+	if len(toolCalls) > 0 {
+		metadata["tool_calls"] = toolCalls
+	}
+
+	return &llm.AgentResponse{
+		Content:    resp.Content,
+		TokensUsed: resp.Usage.TotalTokens,
+		DurationMs: duration.Milliseconds(),
+		Model:      resp.Model,
+		Usage:      resp.Usage,
+		Metadata:   metadata,
+	}
+}
+
+// BuildMessages 构建初始消息列表：系统提示词、历史对话、当前用户消息
+// 调试 Prompt 时也使用它，保证展示的消息与发送给模型的一致
+func (a *BaseAgent) BuildMessages(req *llm.AgentRequest) []llm.ChatMessage {
+	systemPrompt := a.config.SystemPrompt
+	if req.SystemPrompt != "" {
+		systemPrompt = req.SystemPrompt
+	}
+	if schema := a.outputSchema(req); schema != nil {
+		systemPrompt += structuredOutputInstruction(schema)
+	}
+
+	userMsg := llm.ChatMessage{Role: "user", Content: req.Prompt}
+
+	// 添加上下文信息，其中的大纲、标题等来自用户，包装为数据块
+	if len(req.Context) > 0 {
 		contextJSON, _ := json.Marshal(req.Context)
-		contextMsg := fmt.Sprintf("\n\n上下文信息: %s", string(contextJSON))
-		messages[1].Content += contextMsg
+		userMsg.Content += "\n\n上下文信息:\n" + guard.WrapUserContent("context", string(contextJSON))
+	}
+	if guard.ContainsDataBlock(userMsg.Content) {
+		systemPrompt += guard.DataBlockInstruction
 	}
 
-	// 添加工具信息
-	if a.toolRegistry != nil && len(a.config.Tools) > 0 {
-		toolsInfo := a.buildToolsInfo()
-		messages[0].Content += toolsInfo
+	messages := []llm.ChatMessage{{Role: "system", Content: systemPrompt}}
+	messages = append(messages, trimHistory(req.History, req.HistoryTokenBudget, prompt.CounterForModel(a.config.Model))...)
+	return append(messages, userMsg)
+}
+
+// trimHistory 从最近的消息开始保留历史对话，直到用完 Token 预算
+// 只回放 user/assistant 消息，且保证第一条保留的是用户消息
+func trimHistory(history []llm.ChatMessage, budget int, counter prompt.TokenCounter) []llm.ChatMessage {
+	if len(history) == 0 {
+		return nil
+	}
+	if budget <= 0 {
+		budget = defaultHistoryTokenBudget
 	}
 
-	log.Printf("[%s] Executing request: %s", a.config.Name, req.Prompt)
+	start := len(history)
+	used := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		msg := history[i]
+		if msg.Role != "user" && msg.Role != "assistant" {
+			continue
+		}
+		used += counter.Count(msg.Content)
+		if used > budget {
+			break
+		}
+		start = i
+	}
 
-	// ✨ 调用 OpenAI API (带重试)
-	content, tokensUsed, err := a.callOpenAIWithRetry(ctx, messages, 3)
-	if err != nil {
-		return nil, fmt.Errorf("OpenAI API call failed: %w", err)
+	// 丢弃开头孤立的 assistant 回复，避免上下文从半轮对话开始
+	for start < len(history) && history[start].Role != "user" {
+		start++
+	}
+
+	trimmed := make([]llm.ChatMessage, 0, len(history)-start)
+	for _, msg := range history[start:] {
+		if msg.Role == "user" || msg.Role == "assistant" {
+			trimmed = append(trimmed, llm.ChatMessage{Role: msg.Role, Content: msg.Content})
+		}
 	}
+	return trimmed
+}
 
-	duration := time.Since(start).Milliseconds()
+// 按 OpenAI 的计费方式，每条消息有固定的格式开销，回复前另有引导 Token
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+)
+
+// EstimateTokens 实现 llm.TokenEstimator，在调用模型前预估输入 Token 数与输出上限
+// 不包含工具调用产生的额外轮次
+func (a *BaseAgent) EstimateTokens(req *llm.AgentRequest) *llm.TokenEstimate {
+	completionReq := a.buildCompletionRequest(a.BuildMessages(req), req)
+	counter := prompt.CounterForModel(completionReq.Model)
 
-	return &ai.AgentResponse{
-		Content:    content,
-		TokensUsed: tokensUsed,
-		DurationMs: duration,
-		Metadata:   make(map[string]interface{}),
-	}, nil
+	promptTokens := tokensPerReply
+	for _, msg := range completionReq.Messages {
+		promptTokens += tokensPerMessage + counter.Count(msg.Role) + counter.Count(msg.Content)
+	}
+	if toolDefs := a.buildToolDefinitions(req); len(toolDefs) > 0 {
+		data, _ := json.Marshal(toolDefs)
+		promptTokens += counter.Count(string(data))
+	}
+
+	_, estimated := counter.(*tokenizer.Estimator)
+	return &llm.TokenEstimate{
+		Model:               completionReq.Model,
+		Encoding:            tokenizer.EncodingForModel(completionReq.Model),
+		PromptTokens:        promptTokens,
+		MaxCompletionTokens: completionReq.MaxTokens,
+		Exact:               !estimated,
+	}
 }
 
-// buildToolsInfo 构建工具信息
-func (a *BaseAgent) buildToolsInfo() string {
-	if len(a.config.Tools) == 0 {
-		return ""
+// buildCompletionRequest 构建模型请求，请求级参数优先于Agent配置
+func (a *BaseAgent) buildCompletionRequest(messages []llm.ChatMessage, req *llm.AgentRequest) *llm.CompletionRequest {
+	completionReq := &llm.CompletionRequest{
+		Model:       a.config.Model,
+		Messages:    messages,
+		Temperature: a.config.Temperature,
+		MaxTokens:   a.config.MaxTokens,
+	}
+
+	if req.Temperature > 0 {
+		completionReq.Temperature = req.Temperature
+	}
+	if req.MaxTokens > 0 {
+		completionReq.MaxTokens = req.MaxTokens
+	}
+	if a.outputSchema(req) != nil {
+		completionReq.ResponseFormat = llm.ResponseFormatJSON
+	}
+
+	return completionReq
+}
+
+// runToolLoop 调用模型并执行其请求的工具，直到得到最终回答或达到步数上限
+// onDelta 不为空时以流式方式调用模型并实时输出文本
+// 返回的响应中 Usage 为所有轮次的累计用量
+func (a *BaseAgent) runToolLoop(ctx context.Context, messages []llm.ChatMessage, req *llm.AgentRequest, onDelta func(string)) (*llm.CompletionResponse, []tools.ToolCallResult, error) {
+	toolDefs := a.buildToolDefinitions(req)
+	maxSteps := a.config.MaxToolSteps
+	if maxSteps <= 0 {
+		maxSteps = defaultMaxToolSteps
+	}
+
+	var usage llm.TokenUsage
+	var toolCalls []tools.ToolCallResult
+
+	for step := 0; ; step++ {
+		completionReq := a.buildCompletionRequest(messages, req)
+
+		// 达到步数上限后不再提供工具，要求模型直接给出最终回答
+		if step < maxSteps {
+			completionReq.Tools = toolDefs
+		}
+
+		resp, err := a.complete(ctx, completionReq, onDelta)
+		if err != nil {
+			return nil, toolCalls, err
+		}
+		usage.Add(resp.Usage)
+
+		if len(resp.ToolCalls) == 0 || step >= maxSteps {
+			resp.Usage = usage
+			return resp, toolCalls, nil
+		}
+
+		// 保留模型的工具调用请求，再逐个返回工具结果
+		messages = append(messages, llm.ChatMessage{
+			Role:      "assistant",
+			Content:   resp.Content,
+			ToolCalls: resp.ToolCalls,
+		})
+
+		for _, call := range resp.ToolCalls {
+			result := a.executeToolCall(ctx, call, req)
+			content := formatToolResult(result)
+
+			// 工具输出 (检索到的知识、章节正文等) 可能含有用户写入的文本，命中注入特征后禁用本次请求后续的写入工具
+			if findings := toolOutputDetector.Scan(content); len(findings) > 0 {
+				result.InjectionFindings = findings
+				if !req.ReadOnlyTools {
+					log.Printf("⚠️ [%s] 工具 %s 的输出疑似提示词注入: %s，禁用后续的写入工具", a.config.Name, call.Name, findings[0].Pattern)
+					readOnly := *req
+					readOnly.ReadOnlyTools = true
+					req = &readOnly
+					toolDefs = a.buildToolDefinitions(req)
+				}
+			}
+			toolCalls = append(toolCalls, result)
+
+			messages = append(messages, llm.ChatMessage{
+				Role:       "tool",
+				Content:    guard.WrapUserContent("tool_"+call.Name, content),
+				ToolCallID: call.ID,
+			})
+		}
+		messages = withDataBlockInstruction(messages)
+	}
+}
+
+// withDataBlockInstruction 系统提示词中还没有数据块说明时追加 (工具输出以数据块返回)
+// 返回新的消息列表，不修改调用方持有的消息
+func withDataBlockInstruction(messages []llm.ChatMessage) []llm.ChatMessage {
+	if len(messages) == 0 || messages[0].Role != "system" || strings.Contains(messages[0].Content, guard.DataBlockInstruction) {
+		return messages
+	}
+	system := messages[0]
+	system.Content += guard.DataBlockInstruction
+	return append([]llm.ChatMessage{system}, messages[1:]...)
+}
+
+// executeToolCall 解析模型给出的参数并执行工具
+func (a *BaseAgent) executeToolCall(ctx context.Context, call llm.ToolCall, req *llm.AgentRequest) tools.ToolCallResult {
+	start := time.Now()
+	result := tools.ToolCallResult{ToolName: call.Name}
+
+	params := make(map[string]interface{})
+	if call.Arguments != "" {
+		if err := json.Unmarshal([]byte(call.Arguments), &params); err != nil {
+			result.Error = fmt.Sprintf("invalid tool arguments: %v", err)
+			a.toolRegistry.LogCall(a.agentID, call.Name, nil, nil, errors.New(result.Error), 0)
+			return result
+		}
+	}
+	// 参数为 "null" 时解析结果为 nil map
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+
+	// 工具只能访问当前请求所属的项目
+	if req.ProjectID > 0 && a.toolAcceptsParam(call.Name, "project_id") {
+		params["project_id"] = req.ProjectID
+	}
+	result.Params = params
+
+	// 请求内容疑似提示词注入时，即使模型仍请求写入工具也拒绝执行
+	if req.ReadOnlyTools && a.isWriteTool(call.Name) {
+		err := fmt.Errorf("tool %s is disabled for this request: user content looks like a prompt injection", call.Name)
+		a.toolRegistry.LogCall(a.agentID, call.Name, params, nil, err, 0)
+		result.Error = err.Error()
+		return result
+	}
+
+	output, err := a.CallTool(ctx, call.Name, params)
+	result.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
 	}
 
-	var toolsDesc string
-	toolsDesc = "\n\n你可以使用以下工具：\n"
+	result.Success = true
+	result.Result = output
+	return result
+}
 
+// buildToolDefinitions 构建提供给模型的工具定义，请求要求只读时不提供写入工具
+func (a *BaseAgent) buildToolDefinitions(req *llm.AgentRequest) []llm.ToolDefinition {
+	if a.toolRegistry == nil || len(a.config.Tools) == 0 {
+		return nil
+	}
+
+	definitions := make([]llm.ToolDefinition, 0, len(a.config.Tools))
 	for _, toolName := range a.config.Tools {
 		tool, err := a.toolRegistry.Get(toolName)
-		if err == nil {
-			toolsDesc += fmt.Sprintf("- %s: %s\n", toolName, tool.GetDescription())
+		if err != nil || (req.ReadOnlyTools && tools.IsWriteTool(tool)) {
+			continue
 		}
+
+		definitions = append(definitions, llm.ToolDefinition{
+			Name:        toolName,
+			Description: tool.GetDescription(),
+			Parameters:  tool.GetParameters(),
+		})
 	}
 
-	toolsDesc += "\n如果需要使用工具，请在响应中明确说明需要调用的工具和参数。"
+	return definitions
+}
 
-	return toolsDesc
+// isWriteTool 判断工具是否会修改项目数据
+func (a *BaseAgent) isWriteTool(toolName string) bool {
+	if a.toolRegistry == nil {
+		return false
+	}
+	tool, err := a.toolRegistry.Get(toolName)
+	return err == nil && tools.IsWriteTool(tool)
+}
+
+// toolAcceptsParam 判断工具的参数定义中是否包含指定参数
+func (a *BaseAgent) toolAcceptsParam(toolName, param string) bool {
+	if a.toolRegistry == nil {
+		return false
+	}
+	tool, err := a.toolRegistry.Get(toolName)
+	if err != nil || tool.GetParameters() == nil {
+		return false
+	}
+	_, ok := tool.GetParameters().Properties[param]
+	return ok
 }
 
-// ExecuteStream 流式执行
-func (a *BaseAgent) ExecuteStream(ctx context.Context, req *ai.AgentRequest, callback func(string)) error {
+// formatToolResult 将工具结果序列化为 tool 消息内容
+func formatToolResult(result tools.ToolCallResult) string {
+	if !result.Success {
+		return fmt.Sprintf(`{"error": %q}`, result.Error)
+	}
+
+	data, err := json.Marshal(result.Result)
+	if err != nil {
+		return fmt.Sprintf(`{"error": %q}`, "failed to encode tool result: "+err.Error())
+	}
+	return string(data)
+}
+
+// ExecuteStream 流式执行，callback 按模型输出顺序接收文本增量
+// 返回的响应包含完整内容与累计用量
+func (a *BaseAgent) ExecuteStream(ctx context.Context, req *llm.AgentRequest, callback func(string)) (*llm.AgentResponse, error) {
+	start := time.Now()
+
 	// 参数验证
 	if req.Prompt == "" {
-		return fmt.Errorf("prompt cannot be empty")
+		return nil, fmt.Errorf("prompt cannot be empty")
 	}
+	if callback == nil {
+		callback = func(string) {}
+	}
+
+	log.Printf("[%s] Executing stream request: %s", a.config.Name, req.Prompt)
 
-	// 构建消息
-	messages := []ai.ChatMessage{
-		{Role: "system", Content: a.config.SystemPrompt},
-		{Role: "user", Content: req.Prompt},
+	// 结构化输出需要先校验，不符合 Schema 的首轮输出不能推送给调用方，校验 (必要时修正) 后整体输出
+	onDelta := callback
+	if a.outputSchema(req) != nil {
+		onDelta = nil
 	}
 
-	if req.Context != nil && len(req.Context) > 0 {
-		contextJSON, _ := json.Marshal(req.Context)
-		contextMsg := fmt.Sprintf("\n\n上下文信息: %s", string(contextJSON))
-		messages[1].Content += contextMsg
+	messages := a.BuildMessages(req)
+	resp, toolCalls, err := a.runToolLoop(ctx, messages, req, onDelta)
+	if err != nil {
+		return nil, fmt.Errorf("OpenAI API call failed: %w", err)
 	}
 
-	// 添加工具信息
-	if a.toolRegistry != nil && len(a.config.Tools) > 0 {
-		toolsInfo := a.buildToolsInfo()
-		messages[0].Content += toolsInfo
+	agentResp, err := a.finishResponse(ctx, messages, req, resp, toolCalls, start)
+	if err != nil {
+		return nil, err
+	}
+	if onDelta == nil {
+		callback(agentResp.Content)
 	}
+	return agentResp, nil
+}
 
-	log.Printf("[%s] Executing stream request: %s", a.config.Name, req.Prompt)
+// complete 调用模型完成一轮对话
+// 主模型失败 (重试耗尽、熔断或模型不可用) 时按配置的备用模型依次尝试；请求本身有误时不切换
+// 流式调用需要 provider 支持 llm.StreamingProvider，否则退化为整段输出；已输出内容后不再切换模型
+func (a *BaseAgent) complete(ctx context.Context, req *llm.CompletionRequest, onDelta func(string)) (*llm.CompletionResponse, error) {
+	emitted := false
+	var emit func(string)
+	if onDelta != nil {
+		emit = func(delta string) {
+			emitted = true
+			onDelta(delta)
+		}
+	}
+
+	var lastErr error
+	for i, model := range a.candidateModels(req.Model) {
+		route, err := a.route(ctx, model)
+		if err != nil {
+			lastErr = fmt.Errorf("model %s: %w", model, err)
+			continue
+		}
 
-	// 调用流式 API
-	return a.callOpenAIStream(ctx, messages, callback)
+		attempt := *req
+		attempt.Model = route.Model
+		resp, err := a.completeWith(ctx, route, &attempt, emit)
+		if err == nil {
+			if i > 0 {
+				log.Printf("[%s] 已切换到备用模型 %s", a.config.Name, model)
+			}
+			return resp, nil
+		}
+
+		lastErr = fmt.Errorf("model %s: %w", model, err)
+		if ctx.Err() != nil || emitted || llm.IsBadRequest(err) {
+			return nil, lastErr
+		}
+		log.Printf("[%s] 模型 %s 调用失败: %v", a.config.Name, model, err)
+	}
+
+	return nil, lastErr
+}
+
+// candidateModels 按顺序返回主模型与备用模型 (去重)
+func (a *BaseAgent) candidateModels(primary string) []string {
+	models := []string{primary}
+	seen := map[string]bool{primary: true}
+	for _, model := range a.config.FallbackModels {
+		if model != "" && !seen[model] {
+			seen[model] = true
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// route 为模型选择提供方，provider 实现 llm.ModelRouter 时支持 "提供方:模型" 形式的模型名
+func (a *BaseAgent) route(ctx context.Context, model string) (*llm.Route, error) {
+	provider := a.providerFor(ctx)
+	if provider == nil {
+		return nil, llm.ErrProviderNotConfigured
+	}
+	if router, ok := provider.(llm.ModelRouter); ok {
+		return router.Route(model)
+	}
+	return &llm.Route{Provider: llm.DefaultProviderName, Client: provider, Model: model}, nil
+}
+
+// completeWith 使用指定的提供方调用模型
+func (a *BaseAgent) completeWith(ctx context.Context, route *llm.Route, req *llm.CompletionRequest, onDelta func(string)) (*llm.CompletionResponse, error) {
+	if onDelta == nil {
+		return a.callOpenAIWithRetry(ctx, route, req, 3)
+	}
+
+	if _, ok := route.Client.(llm.StreamingProvider); ok {
+		return a.callOpenAIStream(ctx, route, req, onDelta, 3)
+	}
+
+	resp, err := a.callOpenAIWithRetry(ctx, route, req, 3)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Content != "" {
+		onDelta(resp.Content)
+	}
+	return resp, nil
 }
 
 // callOpenAIWithRetry 带重试的 OpenAI API 调用
-func (a *BaseAgent) callOpenAIWithRetry(ctx context.Context, messages []ai.ChatMessage, maxRetries int) (string, int, error) {
+func (a *BaseAgent) callOpenAIWithRetry(ctx context.Context, route *llm.Route, req *llm.CompletionRequest, maxRetries int) (*llm.CompletionResponse, error) {
+	return a.withRetry(ctx, route, maxRetries, func() (*llm.CompletionResponse, bool, error) {
+		resp, err := a.callOpenAI(ctx, route, req)
+		return resp, true, err
+	})
+}
+
+// maxRetryAfter 服务端要求等待超过该时间时不再重试，直接切换备用模型
+const maxRetryAfter = 30 * time.Second
+
+// withRetry 按错误类型重试模型调用，call 返回 false 表示本次失败不可重试
+// 只重试 429、5xx 与网络错误，等待时间取指数退避与 Retry-After 中的较大值
+// 每次调用前检查提供方熔断器，熔断中直接返回 llm.ErrCircuitOpen
+func (a *BaseAgent) withRetry(ctx context.Context, route *llm.Route, maxRetries int, call func() (*llm.CompletionResponse, bool, error)) (*llm.CompletionResponse, error) {
 	var lastErr error
 
 	for i := 0; i < maxRetries; i++ {
-		content, tokensUsed, err := a.callOpenAI(ctx, messages)
+		if route.Breaker != nil && !route.Breaker.Allow() {
+			if lastErr != nil {
+				return nil, fmt.Errorf("%w (provider %s): %v", llm.ErrCircuitOpen, route.Provider, lastErr)
+			}
+			return nil, fmt.Errorf("%w (provider %s)", llm.ErrCircuitOpen, route.Provider)
+		}
+
+		resp, retryable, err := call()
+		a.recordOutcome(ctx, route, err)
 		if err == nil {
-			return content, tokensUsed, nil
+			return resp, nil
+		}
+		if !retryable || !llm.IsRetryable(err) || ctx.Err() != nil {
+			return nil, err
 		}
 
 		lastErr = err
@@ -182,8 +603,13 @@ func (a *BaseAgent) callOpenAIWithRetry(ctx context.Context, messages []ai.ChatM
 
 		// 最后一次失败不等待
 		if i < maxRetries-1 {
-			// 指数退避: 1s, 2s, 4s
+			// 指数退避: 1s, 2s, 4s，服务端指定了 Retry-After 时以其为准
 			waitTime := time.Duration(math.Pow(2, float64(i))) * time.Second
+			if retryAfter := llm.RetryAfterOf(err); retryAfter > maxRetryAfter {
+				return nil, fmt.Errorf("retry after %v exceeds limit: %w", retryAfter, err)
+			} else if retryAfter > waitTime {
+				waitTime = retryAfter
+			}
 			log.Printf("[%s] Retrying in %v...", a.config.Name, waitTime)
 
 			select {
@@ -191,53 +617,65 @@ func (a *BaseAgent) callOpenAIWithRetry(ctx context.Context, messages []ai.ChatM
 				// 继续重试
 			case <-ctx.Done():
 				// Context 取消
-				return "", 0, ctx.Err()
+				return nil, ctx.Err()
 			}
 		}
 	}
 
-	return "", 0, fmt.Errorf("all retries failed: %w", lastErr)
+	return nil, fmt.Errorf("all retries failed: %w", lastErr)
+}
+
+// recordOutcome 更新提供方熔断器，只有 5xx 与网络错误计为失败，调用方取消不计入
+func (a *BaseAgent) recordOutcome(ctx context.Context, route *llm.Route, err error) {
+	if route.Breaker == nil || ctx.Err() != nil {
+		return
+	}
+	if llm.IsProviderFailure(err) {
+		route.Breaker.Failure()
+	} else {
+		route.Breaker.Success()
+	}
 }
 
-// callOpenAI 调用OpenAI API
-func (a *BaseAgent) callOpenAI(ctx context.Context, messages []ai.ChatMessage) (string, int, error) {
-	// TODO: 实际集成 OpenAI API
-	// 这里先返回模拟响应
-	if len(messages) > 0 {
-		lastMsg := messages[len(messages)-1]
-		content := fmt.Sprintf("%s 处理结果: %s", a.config.Name, lastMsg.Content)
-		return content, 100, nil // 模拟 100 tokens
+// providerFor 获取本次调用使用的模型提供方，上下文中指定的提供方 (如用户自己的 API 密钥) 优先
+func (a *BaseAgent) providerFor(ctx context.Context) llm.LLMProvider {
+	if provider := llm.ProviderFromContext(ctx); provider != nil {
+		return provider
 	}
-	return "模拟响应", 50, nil
+	return a.provider
 }
 
-// callOpenAIStream 流式调用OpenAI API
-func (a *BaseAgent) callOpenAIStream(ctx context.Context, messages []ai.ChatMessage, callback func(string)) error {
-	// TODO: 实现流式输出
-	// 临时实现：模拟流式输出
-	content, _, err := a.callOpenAI(ctx, messages)
+// callOpenAI 通过 LLMProvider 调用模型
+func (a *BaseAgent) callOpenAI(ctx context.Context, route *llm.Route, req *llm.CompletionRequest) (*llm.CompletionResponse, error) {
+	resp, err := route.Client.CreateCompletion(ctx, req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// 模拟分段输出
-	words := []rune(content)
-	chunkSize := 10
-	for i := 0; i < len(words); i += chunkSize {
-		// 检查 context 是否取消
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
+	log.Printf("[%s] Tokens used: prompt=%d, completion=%d, model=%s",
+		a.config.Name, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Model)
+
+	return resp, nil
+}
 
-		end := i + chunkSize
-		if end > len(words) {
-			end = len(words)
+// callOpenAIStream 流式调用模型
+// 已经向调用方输出内容后不再重试，避免重复输出；流中途出错直接返回错误而不是截断
+func (a *BaseAgent) callOpenAIStream(ctx context.Context, route *llm.Route, req *llm.CompletionRequest, onDelta func(string), maxRetries int) (*llm.CompletionResponse, error) {
+	provider := route.Client.(llm.StreamingProvider)
+
+	emitted := false
+	return a.withRetry(ctx, route, maxRetries, func() (*llm.CompletionResponse, bool, error) {
+		resp, err := provider.CreateCompletionStream(ctx, req, func(delta string) {
+			emitted = true
+			onDelta(delta)
+		})
+		if err != nil {
+			return nil, !emitted, err
 		}
-		callback(string(words[i:end]))
-		time.Sleep(50 * time.Millisecond) // 模拟延迟
-	}
 
-	return nil
+		log.Printf("[%s] Tokens used: prompt=%d, completion=%d, model=%s (stream)",
+			a.config.Name, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Model)
+
+		return resp, true, nil
+	})
 }
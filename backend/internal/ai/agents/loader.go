@@ -0,0 +1,101 @@
+package agents
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/ai/tools"
+	"github.com/zibianqu/novel-study/internal/model"
+)
+
+// NewAgentFromModel 根据 agents 表记录创建Agent
+func NewAgentFromModel(m *model.Agent, provider llm.LLMProvider, toolRegistry *tools.ToolRegistry) (*BaseAgent, error) {
+	config, err := ConfigFromModel(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBaseAgent(config, provider, toolRegistry, m.ID), nil
+}
+
+// ConfigFromModel 将 agents 表记录转换为Agent配置
+func ConfigFromModel(m *model.Agent) (*llm.AgentConfig, error) {
+	if m.SystemPrompt == "" {
+		return nil, fmt.Errorf("agent %s has empty system_prompt", m.AgentKey)
+	}
+
+	var toolNames []string
+	if m.Tools != "" {
+		if err := json.Unmarshal([]byte(m.Tools), &toolNames); err != nil {
+			return nil, fmt.Errorf("invalid tools for agent %s: %w", m.AgentKey, err)
+		}
+	}
+
+	var fallbackModels []string
+	if m.FallbackModels != "" {
+		if err := json.Unmarshal([]byte(m.FallbackModels), &fallbackModels); err != nil {
+			return nil, fmt.Errorf("invalid fallback_models for agent %s: %w", m.AgentKey, err)
+		}
+	}
+
+	outputSchema, err := parseOutputSchema(m.OutputSchema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output_schema for agent %s: %w", m.AgentKey, err)
+	}
+
+	var permissions model.AgentPermissions
+	if m.Permissions != "" {
+		if err := json.Unmarshal([]byte(m.Permissions), &permissions); err != nil {
+			return nil, fmt.Errorf("invalid permissions for agent %s: %w", m.AgentKey, err)
+		}
+	}
+
+	return &llm.AgentConfig{
+		AgentKey:     m.AgentKey,
+		Name:         m.Name,
+		Description:  m.Description,
+		SystemPrompt: m.SystemPrompt,
+		Model:        m.Model,
+		Temperature:  m.Temperature,
+		MaxTokens:    m.MaxTokens,
+		Tools:        toolNames,
+		MaxToolSteps: permissions.MaxToolSteps,
+
+		FallbackModels: fallbackModels,
+		OutputSchema:   outputSchema,
+	}, nil
+}
+
+// parseOutputSchema 解析 output_schema，空对象表示不要求结构化输出
+func parseOutputSchema(raw string) (*tools.Schema, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "{}" || raw == "null" {
+		return nil, nil
+	}
+
+	var schema tools.Schema
+	if err := json.Unmarshal([]byte(raw), &schema); err != nil {
+		return nil, err
+	}
+	if schema.Type != "object" {
+		return nil, fmt.Errorf("root type must be object, got %q", schema.Type)
+	}
+	return &schema, nil
+}
+
+// CoreAgentNumber 从核心Agent的 key (如 agent_3_quality) 解析Agent编号
+func CoreAgentNumber(agentKey string) (int, bool) {
+	parts := strings.SplitN(agentKey, "_", 3)
+	if len(parts) < 2 || parts[0] != "agent" {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(parts[1])
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,73 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/ai/tools"
+)
+
+// maxOutputRepairs 输出不符合 Schema 时最多要求模型修正的次数
+const maxOutputRepairs = 2
+
+// outputSchema 本次请求要求的输出 Schema，请求要求自由文本时为空
+func (a *BaseAgent) outputSchema(req *llm.AgentRequest) *tools.Schema {
+	if req.RawOutput {
+		return nil
+	}
+	return a.config.OutputSchema
+}
+
+// structuredOutputInstruction 追加到系统提示词的输出要求
+// json_object 模式要求消息中出现 "JSON" 字样
+func structuredOutputInstruction(schema *tools.Schema) string {
+	data, _ := json.MarshalIndent(schema, "", "  ")
+	return "\n\n请只输出一个 JSON 对象，不要输出其他内容。JSON 必须符合以下 JSON Schema：\n" + string(data)
+}
+
+// enforceOutputSchema 校验模型输出，不符合 Schema 时将错误反馈给模型要求修正
+// 返回的响应 Content 为校验后对象的 JSON，Usage 包含修正轮次的用量
+func (a *BaseAgent) enforceOutputSchema(ctx context.Context, messages []llm.ChatMessage, req *llm.AgentRequest, resp *llm.CompletionResponse, schema *tools.Schema) (*llm.CompletionResponse, map[string]interface{}, error) {
+	usage := resp.Usage
+
+	for attempt := 0; ; attempt++ {
+		structured, err := ParseStructuredOutput(resp.Content, schema)
+		if err == nil {
+			data, _ := json.Marshal(structured)
+			resp.Content = string(data)
+			resp.Usage = usage
+			return resp, structured, nil
+		}
+		if attempt >= maxOutputRepairs {
+			return nil, nil, fmt.Errorf("%w: %v", llm.ErrInvalidStructuredOutput, err)
+		}
+
+		log.Printf("[%s] 输出不符合 Schema，要求模型修正 (%d/%d): %v", a.config.Name, attempt+1, maxOutputRepairs, err)
+		messages = append(messages,
+			llm.ChatMessage{Role: "assistant", Content: resp.Content},
+			llm.ChatMessage{Role: "user", Content: fmt.Sprintf("你的输出不符合要求：%v\n请修正后重新输出完整的 JSON 对象，只输出 JSON。", err)},
+		)
+
+		resp, err = a.complete(ctx, a.buildCompletionRequest(messages, req), nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("OpenAI API call failed: %w", err)
+		}
+		usage.Add(resp.Usage)
+	}
+}
+
+// ParseStructuredOutput 从模型输出中提取 JSON 对象并按 Schema 校验、转换类型
+func ParseStructuredOutput(content string, schema *tools.Schema) (map[string]interface{}, error) {
+	object, _ := llm.ExtractJSONObject(content)
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(object), &obj); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("expected JSON object")
+	}
+	return schema.Validate(obj)
+}
@@ -0,0 +1,92 @@
+package collaboration
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TaskTypeApproval 审批任务：上游任务完成后暂停运行，等待人工处理后继续执行下游任务
+// 审批任务没有 Agent，只依赖一个上游任务，Input 为展示给审批人的说明
+const TaskTypeApproval = "approval"
+
+// 审批操作
+const (
+	ApprovalApprove = "approve" // 通过，下游任务使用上游输出
+	ApprovalEdit    = "edit"    // 修改上游输出后通过
+	ApprovalReject  = "reject"  // 驳回，上游任务根据反馈重新执行后再次等待审批
+)
+
+// ErrApprovalNotPending 审批任务不在等待处理的状态
+var ErrApprovalNotPending = errors.New("approval task is not awaiting a decision")
+
+// ApprovalDecision 审批人的处理结果
+type ApprovalDecision struct {
+	Action   string
+	Content  string // edit 时替换上游输出的内容
+	Feedback string // reject 时发送给上游 Agent 的修改意见
+}
+
+// ResolveApproval 处理等待中的审批任务，返回被修改的任务 (审批任务，以及修改或驳回时的上游任务)
+// 调用方保存这些任务后重新执行工作流；驳回时不经过审批任务的其他下游任务不会重新执行
+func (w *Workflow) ResolveApproval(taskID string, decision *ApprovalDecision) ([]*AgentTask, error) {
+	byID := make(map[string]*AgentTask, len(w.Tasks))
+	for _, task := range w.Tasks {
+		byID[task.ID] = task
+	}
+
+	task, ok := byID[taskID]
+	if !ok {
+		return nil, fmt.Errorf("task %s not found", taskID)
+	}
+	if task.Type != TaskTypeApproval {
+		return nil, fmt.Errorf("task %s is not an approval task", taskID)
+	}
+	if task.Status != TaskAwaitingApproval {
+		return nil, fmt.Errorf("%w: task %s is %s", ErrApprovalNotPending, taskID, task.Status)
+	}
+	if len(task.DependsOn) != 1 {
+		return nil, fmt.Errorf("approval task %s must depend on exactly one task", taskID)
+	}
+	upstream := byID[task.DependsOn[0]]
+
+	switch decision.Action {
+	case ApprovalApprove:
+		task.Result = upstream.Result
+	case ApprovalEdit:
+		if strings.TrimSpace(decision.Content) == "" {
+			return nil, fmt.Errorf("edited content is required")
+		}
+		upstream.Result = decision.Content
+		task.Result = decision.Content
+	case ApprovalReject:
+		if strings.TrimSpace(decision.Feedback) == "" {
+			return nil, fmt.Errorf("feedback is required to reject")
+		}
+		if upstream.OriginalInput == "" {
+			upstream.OriginalInput = upstream.Input
+		}
+		upstream.Input = rejectionInput(upstream.OriginalInput, upstream.Result, decision.Feedback)
+		upstream.Status = TaskPending
+		upstream.Result = ""
+		task.Status = TaskPending
+		task.Result = ""
+		return []*AgentTask{task, upstream}, nil
+	default:
+		return nil, fmt.Errorf("unknown approval action %q", decision.Action)
+	}
+
+	task.Status = TaskCompleted
+	task.EndTime = time.Now()
+	if decision.Action == ApprovalEdit {
+		return []*AgentTask{task, upstream}, nil
+	}
+	return []*AgentTask{task}, nil
+}
+
+// rejectionInput 构建驳回后上游任务的输入：原始任务、上一版内容与审批意见
+// 总是基于原始输入构建，多次驳回时不会层层嵌套
+func rejectionInput(original, content, feedback string) string {
+	return fmt.Sprintf("%s\n\n请根据以下审批意见修改内容\n\n原内容: %s\n\n审批意见: %s\n", original, content, feedback)
+}
@@ -0,0 +1,327 @@
+package collaboration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 工作流定义的格式
+const (
+	DefinitionJSON = "json"
+	DefinitionYAML = "yaml"
+)
+
+// 审核循环的默认值与上限
+const (
+	defaultReviewIterations = 3
+	defaultReviewMinScore   = 80.0
+	maxReviewIterations     = 10
+	maxDefinitionTasks      = 50
+)
+
+// WorkflowDefinition 声明式工作流定义，以 JSON 或 YAML 保存
+//
+// 任务的 input 是输入模板，可引用 {{input}} (启动时的输入) 与 {{tasks.<id>.output}} (上游任务的输出)，
+// 引用的任务自动加入依赖。input 为空时，没有依赖的任务使用 {{input}}，其余任务从上下文的 dependency_<id> 读取上游输出
+//
+// type 为 approval 的任务是审批关卡：不指定 agent，只依赖一个上游任务，运行到此处暂停等待人工处理，
+// input 为展示给审批人的说明
+type WorkflowDefinition struct {
+	Name          string           `json:"name" yaml:"name"`
+	Description   string           `json:"description,omitempty" yaml:"description,omitempty"`
+	FailurePolicy FailurePolicy    `json:"failure_policy,omitempty" yaml:"failure_policy,omitempty"`
+	Tasks         []TaskDefinition `json:"tasks" yaml:"tasks"`
+}
+
+// TaskDefinition 工作流定义中的任务
+type TaskDefinition struct {
+	ID        string            `json:"id" yaml:"id"`
+	Agent     string            `json:"agent,omitempty" yaml:"agent,omitempty"` // Agent 标识 (agent_key)，审批任务为空
+	Type      string            `json:"type,omitempty" yaml:"type,omitempty"`
+	Input     string            `json:"input,omitempty" yaml:"input,omitempty"`
+	DependsOn []string          `json:"depends_on,omitempty" yaml:"depends_on,omitempty"`
+	Review    *ReviewDefinition `json:"review,omitempty" yaml:"review,omitempty"`
+}
+
+// ReviewDefinition 任务完成后的审核-修改循环，由 reviewer 审核、任务的 Agent 修改
+type ReviewDefinition struct {
+	Reviewer      string  `json:"reviewer" yaml:"reviewer"`
+	MaxIterations int     `json:"max_iterations,omitempty" yaml:"max_iterations,omitempty"` // 默认 3
+	MinScore      float64 `json:"min_score,omitempty" yaml:"min_score,omitempty"`           // 默认 80
+}
+
+// AgentResolver 校验定义中的 Agent 标识，返回执行任务所用的 agent_key
+type AgentResolver func(agentKey string) (string, error)
+
+var (
+	taskIDPattern      = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]{0,63}$`)
+	placeholderPattern = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+	taskOutputPattern  = regexp.MustCompile(`^tasks\.([A-Za-z][A-Za-z0-9_-]*)\.output$`)
+)
+
+// ParseWorkflowDefinition 解析并校验工作流定义，format 为空时根据内容判断 JSON 或 YAML
+// 未知字段视为错误，避免拼写错误的字段被静默忽略
+func ParseWorkflowDefinition(source, format string) (*WorkflowDefinition, error) {
+	def := &WorkflowDefinition{}
+	switch DefinitionFormat(source, format) {
+	case DefinitionJSON:
+		decoder := json.NewDecoder(strings.NewReader(source))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(def); err != nil {
+			return nil, fmt.Errorf("invalid JSON definition: %w", err)
+		}
+	case DefinitionYAML:
+		decoder := yaml.NewDecoder(bytes.NewReader([]byte(source)))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(def); err != nil {
+			return nil, fmt.Errorf("invalid YAML definition: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported definition format %q", format)
+	}
+
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// DefinitionFormat 返回定义的格式，format 为空时以 "{" 开头的视为 JSON，其余视为 YAML
+func DefinitionFormat(source, format string) string {
+	if format != "" {
+		return format
+	}
+	if strings.HasPrefix(strings.TrimSpace(source), "{") {
+		return DefinitionJSON
+	}
+	return DefinitionYAML
+}
+
+// Validate 校验任务 ID、依赖、输入模板引用、审核配置，以及依赖关系中没有循环
+// Agent 是否存在由调用方通过 AgentKeys 另行校验
+func (d *WorkflowDefinition) Validate() error {
+	if strings.TrimSpace(d.Name) == "" {
+		return fmt.Errorf("workflow name is required")
+	}
+	if len(d.Tasks) == 0 {
+		return fmt.Errorf("workflow must have at least one task")
+	}
+	if len(d.Tasks) > maxDefinitionTasks {
+		return fmt.Errorf("workflow has %d tasks, at most %d allowed", len(d.Tasks), maxDefinitionTasks)
+	}
+	switch d.FailurePolicy {
+	case "", FailFast, ContinueOnError:
+	default:
+		return fmt.Errorf("unknown failure_policy %q", d.FailurePolicy)
+	}
+
+	ids := make(map[string]bool, len(d.Tasks))
+	for _, task := range d.Tasks {
+		if !taskIDPattern.MatchString(task.ID) {
+			return fmt.Errorf("invalid task id %q: must start with a letter and contain only letters, digits, _ or -", task.ID)
+		}
+		if ids[task.ID] {
+			return fmt.Errorf("duplicate task id %s", task.ID)
+		}
+		ids[task.ID] = true
+	}
+
+	for _, task := range d.Tasks {
+		deps, err := task.dependencies()
+		if err != nil {
+			return fmt.Errorf("task %s: %w", task.ID, err)
+		}
+		if task.Type == TaskTypeApproval {
+			if err := task.validateApproval(deps); err != nil {
+				return err
+			}
+		} else if strings.TrimSpace(task.Agent) == "" {
+			return fmt.Errorf("task %s: agent is required", task.ID)
+		}
+		for _, depID := range deps {
+			if depID == task.ID {
+				return fmt.Errorf("task %s depends on itself", task.ID)
+			}
+			if !ids[depID] {
+				return fmt.Errorf("task %s depends on unknown task %s", task.ID, depID)
+			}
+		}
+		if review := task.Review; review != nil {
+			if strings.TrimSpace(review.Reviewer) == "" {
+				return fmt.Errorf("task %s: review.reviewer is required", task.ID)
+			}
+			if review.MaxIterations < 0 || review.MaxIterations > maxReviewIterations {
+				return fmt.Errorf("task %s: review.max_iterations must not exceed %d", task.ID, maxReviewIterations)
+			}
+			if review.MinScore < 0 || review.MinScore > 100 {
+				return fmt.Errorf("task %s: review.min_score must be between 0 and 100", task.ID)
+			}
+		}
+	}
+
+	// 不解析 Agent 构建一次，检查循环依赖
+	workflow, err := d.build("", "", nil, func(key string) (string, error) { return key, nil })
+	if err != nil {
+		return err
+	}
+	_, err = workflow.TopologicalOrder()
+	return err
+}
+
+// AgentKeys 返回定义中引用的全部 Agent 标识 (包括审核者)，按首次出现顺序去重
+func (d *WorkflowDefinition) AgentKeys() []string {
+	seen := make(map[string]bool)
+	var keys []string
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, task := range d.Tasks {
+		if task.Type != TaskTypeApproval {
+			add(task.Agent)
+		}
+		if task.Review != nil {
+			add(task.Review.Reviewer)
+		}
+	}
+	return keys
+}
+
+// Build 根据定义创建可由 Scheduler 执行的工作流，{{input}} 在此时替换，上游输出在任务开始前替换
+func (d *WorkflowDefinition) Build(input string, context map[string]interface{}, resolve AgentResolver) (*Workflow, error) {
+	return d.build("wf_custom_"+generateID(), input, context, resolve)
+}
+
+func (d *WorkflowDefinition) build(id, input string, context map[string]interface{}, resolve AgentResolver) (*Workflow, error) {
+	workflow := NewWorkflow(id, d.Name, d.Description)
+	workflow.FailurePolicy = d.FailurePolicy
+
+	for _, def := range d.Tasks {
+		agentKey := ""
+		if def.Type != TaskTypeApproval {
+			var err error
+			if agentKey, err = resolve(def.Agent); err != nil {
+				return nil, fmt.Errorf("task %s: %w", def.ID, err)
+			}
+		}
+		deps, err := def.dependencies()
+		if err != nil {
+			return nil, fmt.Errorf("task %s: %w", def.ID, err)
+		}
+
+		task := &AgentTask{
+			ID:        def.ID,
+			AgentKey:  agentKey,
+			Type:      def.Type,
+			Input:     renderInput(def.Input, input),
+			Context:   context,
+			Status:    TaskPending,
+			DependsOn: deps,
+		}
+		if task.Type == "" {
+			task.Type = "generate"
+		}
+		if def.Input == "" && len(deps) == 0 {
+			task.Input = input
+		}
+
+		if def.Review != nil {
+			reviewerKey, err := resolve(def.Review.Reviewer)
+			if err != nil {
+				return nil, fmt.Errorf("task %s review: %w", def.ID, err)
+			}
+			task.Review = &TaskReview{
+				ReviewerKey:   reviewerKey,
+				MaxIterations: def.Review.MaxIterations,
+				MinScore:      def.Review.MinScore,
+			}
+			if task.Review.MaxIterations == 0 {
+				task.Review.MaxIterations = defaultReviewIterations
+			}
+			if task.Review.MinScore == 0 {
+				task.Review.MinScore = defaultReviewMinScore
+			}
+		}
+
+		workflow.AddTask(task)
+	}
+	return workflow, nil
+}
+
+// validateApproval 审批任务不指定 Agent 与审核配置，且只依赖一个上游任务
+func (t *TaskDefinition) validateApproval(deps []string) error {
+	if strings.TrimSpace(t.Agent) != "" {
+		return fmt.Errorf("task %s: approval task must not specify an agent", t.ID)
+	}
+	if t.Review != nil {
+		return fmt.Errorf("task %s: approval task must not have a review", t.ID)
+	}
+	if len(deps) != 1 {
+		return fmt.Errorf("task %s: approval task must depend on exactly one task", t.ID)
+	}
+	return nil
+}
+
+// dependencies 返回显式依赖与输入模板引用的任务，去重并保持顺序
+func (t *TaskDefinition) dependencies() ([]string, error) {
+	seen := make(map[string]bool)
+	var deps []string
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			deps = append(deps, id)
+		}
+	}
+
+	for _, id := range t.DependsOn {
+		add(id)
+	}
+	for _, match := range placeholderPattern.FindAllStringSubmatch(t.Input, -1) {
+		name := match[1]
+		if name == "input" {
+			continue
+		}
+		ref := taskOutputPattern.FindStringSubmatch(name)
+		if ref == nil {
+			return nil, fmt.Errorf("unknown placeholder {{%s}}, use {{input}} or {{tasks.<id>.output}}", name)
+		}
+		add(ref[1])
+	}
+	return deps, nil
+}
+
+// renderInput 替换输入模板中的 {{input}}
+func renderInput(template, input string) string {
+	return placeholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		if placeholderPattern.FindStringSubmatch(placeholder)[1] == "input" {
+			return input
+		}
+		return placeholder
+	})
+}
+
+// renderTaskOutputs 替换输入模板中依赖任务的 {{tasks.<id>.output}}
+func renderTaskOutputs(input string, task *AgentTask, byID map[string]*AgentTask) string {
+	if !strings.Contains(input, "{{") {
+		return input
+	}
+	return placeholderPattern.ReplaceAllStringFunc(input, func(placeholder string) string {
+		ref := taskOutputPattern.FindStringSubmatch(placeholderPattern.FindStringSubmatch(placeholder)[1])
+		if ref == nil {
+			return placeholder
+		}
+		for _, depID := range task.DependsOn {
+			if depID == ref[1] {
+				return byID[depID].Result
+			}
+		}
+		return placeholder
+	})
+}
@@ -0,0 +1,75 @@
+package collaboration
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// 运行事件类型
+const (
+	EventTaskStatus = "task"   // 任务状态变化
+	EventTaskOutput = "output" // Agent 的部分输出
+	EventReview     = "review" // 审核-修改循环的一轮审核结果
+)
+
+// RunEvent 工作流运行中的事件，用于向客户端推送进度
+type RunEvent struct {
+	Type       string `json:"type"`
+	WorkflowID string `json:"workflow_id"`
+	TaskID     string `json:"task_id"`
+	AgentID    int    `json:"agent_id,omitempty"`
+	AgentKey   string `json:"agent_key,omitempty"` // 自定义模板的任务按 agent_key 引用 Agent
+
+	// EventTaskStatus
+	Status     string `json:"status,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Finished   int    `json:"finished,omitempty"` // 已结束 (完成、失败或跳过) 的任务数
+	Total      int    `json:"total,omitempty"`
+	TokensUsed int    `json:"tokens_used,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+
+	// EventTaskOutput
+	Chunk string `json:"chunk,omitempty"`
+
+	// EventReview
+	Iteration int      `json:"iteration,omitempty"`
+	Score     float64  `json:"score,omitempty"`
+	Approved  bool     `json:"approved,omitempty"`
+	Issues    []string `json:"issues,omitempty"`
+}
+
+// RunObserver 接收运行事件，调用发生在任务所在的 goroutine 中，不应阻塞
+type RunObserver interface {
+	OnRunEvent(event *RunEvent)
+}
+
+type outputCallbackKey struct{}
+
+// WithOutputCallback 在上下文中设置 Agent 部分输出的回调
+func WithOutputCallback(ctx context.Context, callback func(chunk string)) context.Context {
+	return context.WithValue(ctx, outputCallbackKey{}, callback)
+}
+
+// OutputCallback 返回上下文中的部分输出回调，AgentExecutor 据此决定是否流式执行
+func OutputCallback(ctx context.Context) func(chunk string) {
+	callback, _ := ctx.Value(outputCallbackKey{}).(func(chunk string))
+	return callback
+}
+
+type taskUsageKey struct{}
+
+// taskUsage 任务执行期间 (包括审核-修改循环) 累计的 Token 用量
+type taskUsage struct {
+	tokens int64
+}
+
+func withTaskUsage(ctx context.Context, usage *taskUsage) context.Context {
+	return context.WithValue(ctx, taskUsageKey{}, usage)
+}
+
+// RecordUsage 由 AgentExecutor 调用，将一次 Agent 调用的 Token 用量计入当前任务
+func RecordUsage(ctx context.Context, tokens int) {
+	if usage, ok := ctx.Value(taskUsageKey{}).(*taskUsage); ok {
+		atomic.AddInt64(&usage.tokens, int64(tokens))
+	}
+}
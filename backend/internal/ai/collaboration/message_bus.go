@@ -1,6 +1,7 @@
 package collaboration
 
 import (
+	"fmt"
 	"sync"
 	"time"
 )
@@ -227,5 +228,3 @@ func generateMessageID() string {
 	messageCounter++
 	return fmt.Sprintf("msg_%d_%d", time.Now().Unix(), messageCounter)
 }
-
-import "fmt"
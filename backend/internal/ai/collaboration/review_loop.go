@@ -2,19 +2,63 @@ package collaboration
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
+
+	"github.com/zibianqu/novel-study/internal/ai/llm"
 )
 
 // ReviewFeedback 审核反馈
 type ReviewFeedback struct {
 	Approved    bool
-	Score       float64 // 0-100
+	Score       float64            // 0-100
+	Dimensions  map[string]float64 // 各维度得分
 	Issues      []string
 	Suggestions []string
 	Comments    string
 }
 
+// QualityReview 审核导演的结构化输出 (agents.output_schema)
+type QualityReview struct {
+	TotalScore    *float64           `json:"total_score"`
+	Dimensions    map[string]float64 `json:"dimensions"`
+	Passed        bool               `json:"passed"`
+	Issues        []string           `json:"issues"`
+	Suggestions   []string           `json:"suggestions"`
+	RevisionGuide string             `json:"revision_guide"`
+}
+
+// ParseQualityReview 解析审核结果，允许前后带有代码块标记等多余文字
+func ParseQualityReview(content string) (*QualityReview, error) {
+	object, ok := llm.ExtractJSONObject(content)
+	if !ok {
+		return nil, fmt.Errorf("review result is not a JSON object")
+	}
+
+	var review QualityReview
+	if err := json.Unmarshal([]byte(object), &review); err != nil {
+		return nil, fmt.Errorf("invalid review result: %w", err)
+	}
+	if review.TotalScore == nil {
+		return nil, fmt.Errorf("review result missing total_score")
+	}
+	return &review, nil
+}
+
+// Feedback 转换为审核反馈
+func (r *QualityReview) Feedback() *ReviewFeedback {
+	return &ReviewFeedback{
+		Approved:    r.Passed,
+		Score:       *r.TotalScore,
+		Dimensions:  r.Dimensions,
+		Issues:      r.Issues,
+		Suggestions: r.Suggestions,
+		Comments:    r.RevisionGuide,
+	}
+}
+
 // RevisionResult 修改结果
 type RevisionResult struct {
 	Content      string
@@ -29,6 +73,7 @@ type ReviewLoopConfig struct {
 	MinScore        float64 // 最低分数要求
 	Timeout         time.Duration
 	AutoApprove     bool // 超过迭代次数后自动通过
+	OnIteration     func(iteration *ReviewIteration) // 每轮审核后调用，可为空
 }
 
 // ReviewLoop 审核-修改循环
@@ -63,10 +108,10 @@ func NewReviewLoop(
 // Execute 执行审核-修改循环
 func (rl *ReviewLoop) Execute(
 	ctx context.Context,
-	generatorAgentID int,
-	reviewerAgentID int,
+	generator AgentRef,
+	reviewer AgentRef,
 	initialContent string,
-	context map[string]interface{},
+	taskContext map[string]interface{},
 ) (*ReviewLoopResult, error) {
 	startTime := time.Now()
 
@@ -88,7 +133,7 @@ func (rl *ReviewLoop) Execute(
 		iterStartTime := time.Now()
 
 		// 1. 审核阶段
-		feedback, err := rl.review(ctxWithTimeout, reviewerAgentID, currentContent, context)
+		feedback, err := rl.review(ctxWithTimeout, reviewer, currentContent, taskContext)
 		if err != nil {
 			return nil, fmt.Errorf("review failed: %w", err)
 		}
@@ -103,8 +148,12 @@ func (rl *ReviewLoop) Execute(
 		}
 
 		// 3. 检查是否通过
-		if feedback.Approved || feedback.Score >= rl.config.MinScore {
-			iteration.Approved = true
+		approved := feedback.Approved || feedback.Score >= rl.config.MinScore
+		iteration.Approved = approved
+		if rl.config.OnIteration != nil {
+			rl.config.OnIteration(iteration)
+		}
+		if approved {
 			iterations = append(iterations, iteration)
 
 			return &ReviewLoopResult{
@@ -117,7 +166,7 @@ func (rl *ReviewLoop) Execute(
 		}
 
 		// 4. 修改阶段
-		revision, err := rl.revise(ctxWithTimeout, generatorAgentID, currentContent, feedback, context)
+		revision, err := rl.revise(ctxWithTimeout, generator, currentContent, feedback, taskContext)
 		if err != nil {
 			return nil, fmt.Errorf("revision failed: %w", err)
 		}
@@ -134,7 +183,7 @@ func (rl *ReviewLoop) Execute(
 		}
 
 		// 6. 发送消息
-		rl.sendIterationMessage(generatorAgentID, reviewerAgentID, i+1, feedback, revision)
+		rl.sendIterationMessage(generator.ID, reviewer.ID, i+1, feedback, revision)
 	}
 
 	// 超过迭代次数
@@ -161,17 +210,18 @@ func (rl *ReviewLoop) Execute(
 // review 执行审核
 func (rl *ReviewLoop) review(
 	ctx context.Context,
-	reviewerAgentID int,
+	reviewer AgentRef,
 	content string,
-	context map[string]interface{},
+	taskContext map[string]interface{},
 ) (*ReviewFeedback, error) {
 	// 构建审核任务
 	task := &AgentTask{
-		ID:      fmt.Sprintf("review_%d", time.Now().Unix()),
-		AgentID: reviewerAgentID,
-		Type:    "review",
-		Input:   content,
-		Context: context,
+		ID:       fmt.Sprintf("review_%d", time.Now().Unix()),
+		AgentID:  reviewer.ID,
+		AgentKey: reviewer.Key,
+		Type:     "review",
+		Input:    content,
+		Context:  taskContext,
 	}
 
 	// 执行审核
@@ -179,44 +229,38 @@ func (rl *ReviewLoop) review(
 		return nil, err
 	}
 
-	// 解析审核结果 (简化处理，实际应解析 JSON)
-	feedback := &ReviewFeedback{
-		Approved: false,
-		Score:    75.0, // 示例分数
-		Issues: []string{
-			"部分描写不够生动",
-		},
-		Suggestions: []string{
-			"增加环境细节描写",
-		},
-		Comments: task.Result,
+	// 审核导演声明了输出 Schema，结果已由引擎校验为 JSON
+	review, err := ParseQualityReview(task.Result)
+	if err != nil {
+		return nil, err
 	}
 
-	return feedback, nil
+	return review.Feedback(), nil
 }
 
 // revise 执行修改
 func (rl *ReviewLoop) revise(
 	ctx context.Context,
-	generatorAgentID int,
+	generator AgentRef,
 	content string,
 	feedback *ReviewFeedback,
-	context map[string]interface{},
+	taskContext map[string]interface{},
 ) (*RevisionResult, error) {
 	// 构建修改任务
 	reviseContext := make(map[string]interface{})
-	for k, v := range context {
+	for k, v := range taskContext {
 		reviseContext[k] = v
 	}
 	reviseContext["original_content"] = content
 	reviseContext["feedback"] = feedback
 
 	task := &AgentTask{
-		ID:      fmt.Sprintf("revise_%d", time.Now().Unix()),
-		AgentID: generatorAgentID,
-		Type:    "revise",
-		Input:   fmt.Sprintf("请根据以下反馈修改内容\n\n原内容: %s\n\n反馈: %v", content, feedback.Issues),
-		Context: reviseContext,
+		ID:       fmt.Sprintf("revise_%d", time.Now().Unix()),
+		AgentID:  generator.ID,
+		AgentKey: generator.Key,
+		Type:     "revise",
+		Input:    revisionInput(content, feedback),
+		Context:  reviseContext,
 	}
 
 	// 执行修改
@@ -234,6 +278,22 @@ func (rl *ReviewLoop) revise(
 	return revision, nil
 }
 
+// revisionInput 构建修改任务的输入：原内容、问题、修改建议与修改指导
+func revisionInput(content string, feedback *ReviewFeedback) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("请根据以下反馈修改内容\n\n原内容: %s\n\n审核得分: %.0f\n", content, feedback.Score))
+	if len(feedback.Issues) > 0 {
+		b.WriteString("\n问题:\n- " + strings.Join(feedback.Issues, "\n- ") + "\n")
+	}
+	if len(feedback.Suggestions) > 0 {
+		b.WriteString("\n修改建议:\n- " + strings.Join(feedback.Suggestions, "\n- ") + "\n")
+	}
+	if feedback.Comments != "" {
+		b.WriteString("\n修改指导: " + feedback.Comments + "\n")
+	}
+	return b.String()
+}
+
 // sendIterationMessage 发送迭代消息
 func (rl *ReviewLoop) sendIterationMessage(
 	generatorID, reviewerID, iteration int,
@@ -4,89 +4,266 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // AgentTask Agent 任务
 type AgentTask struct {
-	ID          string
-	AgentID     int
-	Type        string                 // "generate", "review", "revise", "analyze"
-	Input       string                 // 输入内容
-	Context     map[string]interface{} // 上下文
-	Status      string                 // "pending", "running", "completed", "failed"
-	Result      string                 // 输出结果
-	Error       error
-	StartTime   time.Time
-	EndTime     time.Time
-	DependsOn   []string // 依赖的任务 ID
+	ID            string
+	AgentID       int                    // 核心 Agent 编号 (内置模板)
+	AgentKey      string                 // Agent 标识 (自定义模板)，非空时按标识执行
+	Type          string                 // "generate", "review", "revise", "analyze", "approval"
+	Input         string                 // 输入内容
+	OriginalInput string                 // 驳回前的原始输入，驳回后 Input 由它与审批意见重新构建
+	Context       map[string]interface{} // 上下文
+	Status        string                 // "pending", "running", "completed", "failed", "skipped", "awaiting_approval"
+	Result        string                 // 输出结果
+	Error         error
+	StartTime     time.Time
+	EndTime       time.Time
+	DependsOn     []string    // 依赖的任务 ID
+	Review        *TaskReview // 非空时任务完成后进入审核-修改循环
+	TokensUsed    int         // 执行器通过 RecordUsage 上报的 Token 用量
 }
 
+// Duration 任务的执行时长，未结束时为 0
+func (t *AgentTask) Duration() time.Duration {
+	if t.StartTime.IsZero() || t.EndTime.Before(t.StartTime) {
+		return 0
+	}
+	return t.EndTime.Sub(t.StartTime)
+}
+
+// Agent 返回执行任务的 Agent
+func (t *AgentTask) Agent() AgentRef {
+	return AgentRef{ID: t.AgentID, Key: t.AgentKey}
+}
+
+// TaskReview 任务的审核-修改循环配置
+type TaskReview struct {
+	ReviewerID    int     `json:"reviewer_id"`
+	ReviewerKey   string  `json:"reviewer_key,omitempty"`
+	MaxIterations int     `json:"max_iterations"`
+	MinScore      float64 `json:"min_score"`
+}
+
+// Reviewer 返回审核者
+func (r *TaskReview) Reviewer() AgentRef {
+	return AgentRef{ID: r.ReviewerID, Key: r.ReviewerKey}
+}
+
+// AgentRef 执行任务的 Agent：内置模板按核心 Agent 编号引用，自定义模板按 agent_key 引用 (可以是扩展 Agent)
+type AgentRef struct {
+	ID  int
+	Key string // 非空时优先于 ID
+}
+
+// String 返回 Agent 的可读标识
+func (r AgentRef) String() string {
+	if r.Key != "" {
+		return r.Key
+	}
+	return fmt.Sprintf("agent_%d", r.ID)
+}
+
+// reviewTimeout 单个任务审核-修改循环的最长时间
+const reviewTimeout = 10 * time.Minute
+
+// 任务状态
+const (
+	TaskPending   = "pending"
+	TaskRunning   = "running"
+	TaskCompleted = "completed"
+	TaskFailed    = "failed"
+	TaskSkipped   = "skipped" // 依赖任务未成功或工作流已取消
+
+	TaskAwaitingApproval = "awaiting_approval" // 审批任务等待人工处理
+)
+
+// FailurePolicy 任务失败时的处理方式
+type FailurePolicy string
+
+const (
+	// FailFast 任一任务失败即取消其余任务 (默认)
+	FailFast FailurePolicy = "fail_fast"
+	// ContinueOnError 继续执行不依赖失败任务的任务
+	ContinueOnError FailurePolicy = "continue_on_error"
+)
+
+// defaultMaxConcurrency 默认同时执行的任务数
+const defaultMaxConcurrency = 4
+
 // WorkflowResult 工作流结果
 type WorkflowResult struct {
 	Success      bool
 	FinalContent string
 	Tasks        []*AgentTask
+	Paused       bool // 有审批任务等待处理，依赖它的任务保持 pending
 	TotalTime    time.Duration
 	Metadata     map[string]interface{}
 }
 
 // AgentExecutor Agent 执行器接口
 type AgentExecutor interface {
-	Execute(ctx context.Context, agentID int, input string, context map[string]interface{}) (string, error)
+	Execute(ctx context.Context, agent AgentRef, input string, context map[string]interface{}) (string, error)
+}
+
+// AgentExecutorFunc 将函数适配为 AgentExecutor
+type AgentExecutorFunc func(ctx context.Context, agent AgentRef, input string, context map[string]interface{}) (string, error)
+
+// Execute 实现 AgentExecutor
+func (f AgentExecutorFunc) Execute(ctx context.Context, agent AgentRef, input string, context map[string]interface{}) (string, error) {
+	return f(ctx, agent, input, context)
+}
+
+// RunRecorder 记录任务状态变化，用于持久化工作流运行并在重启后恢复
+type RunRecorder interface {
+	RecordTask(workflowID string, task *AgentTask)
 }
 
 // Scheduler Agent 协作调度器
 type Scheduler struct {
-	executor  AgentExecutor
-	mu        sync.RWMutex
-	tasks     map[string]*AgentTask
-	workflows map[string]*Workflow
+	executor       AgentExecutor
+	recorder       RunRecorder
+	observer       RunObserver
+	maxConcurrency int
+	mu             sync.RWMutex
+	tasks          map[string]*AgentTask // 运行中工作流的任务，按 taskKey(工作流 ID, 任务 ID) 索引
+	workflows      map[string]*Workflow  // 运行中的工作流，ExecuteWorkflow 返回时移除
 }
 
 // NewScheduler 创建调度器
 func NewScheduler(executor AgentExecutor) *Scheduler {
 	return &Scheduler{
-		executor:  executor,
-		tasks:     make(map[string]*AgentTask),
-		workflows: make(map[string]*Workflow),
+		executor:       executor,
+		maxConcurrency: defaultMaxConcurrency,
+		tasks:          make(map[string]*AgentTask),
+		workflows:      make(map[string]*Workflow),
 	}
 }
 
-// ExecuteWorkflow 执行工作流
+// SetRecorder 设置任务状态记录器，任务开始、完成、失败或跳过时调用
+func (s *Scheduler) SetRecorder(recorder RunRecorder) {
+	s.recorder = recorder
+}
+
+// SetObserver 设置运行事件的接收者 (任务状态、部分输出与审核结果)
+func (s *Scheduler) SetObserver(observer RunObserver) {
+	s.observer = observer
+}
+
+// SetMaxConcurrency 设置每个工作流同时执行的任务数上限
+func (s *Scheduler) SetMaxConcurrency(n int) {
+	s.maxConcurrency = n
+}
+
+// ExecuteWorkflow 按依赖关系并发执行工作流
+// 任务在所有依赖完成后开始，同时运行的任务数不超过 maxConcurrency
+// 任务失败时按工作流的 FailurePolicy 取消其余任务或继续执行不受影响的任务
+// 已完成的任务 (如从数据库恢复的运行) 不再执行，直接使用其结果
+// 审批任务等待处理时，依赖它的任务不执行，返回 Paused 的结果；处理审批后再次调用以继续执行
 func (s *Scheduler) ExecuteWorkflow(ctx context.Context, workflow *Workflow) (*WorkflowResult, error) {
 	startTime := time.Now()
 
-	// 注册工作流
-	s.mu.Lock()
-	s.workflows[workflow.ID] = workflow
-	s.mu.Unlock()
+	order, err := workflow.TopologicalOrder()
+	if err != nil {
+		return nil, err
+	}
 
-	// 按顺序执行任务
-	for _, task := range workflow.Tasks {
-		// 检查上下文是否取消
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		default:
+	// 上次中断时未完成的任务重新执行
+	for _, task := range order {
+		if task.Status != TaskCompleted {
+			task.Status = TaskPending
+			task.Error = nil
 		}
+	}
 
-		// 等待依赖任务完成
-		if err := s.waitForDependencies(ctx, task); err != nil {
-			return nil, err
-		}
+	// 注册工作流，返回时移除，调度器在服务生命周期内复用，不保留已结束的运行
+	s.register(workflow)
+	defer s.unregister(workflow)
 
-		// 执行任务
-		if err := s.executeTask(ctx, task); err != nil {
-			return &WorkflowResult{
-				Success:   false,
-				Tasks:     workflow.Tasks,
-				TotalTime: time.Since(startTime),
-				Metadata: map[string]interface{}{
-					"error": err.Error(),
-				},
-			}, err
-		}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 每个任务结束 (完成、失败或跳过) 时关闭对应的通道，通知依赖它的任务
+	done := make(map[string]chan struct{}, len(order))
+	byID := make(map[string]*AgentTask, len(order))
+	for _, task := range order {
+		done[task.ID] = make(chan struct{})
+		byID[task.ID] = task
+	}
+
+	limit := s.maxConcurrency
+	if limit <= 0 {
+		limit = defaultMaxConcurrency
+	}
+	slots := make(chan struct{}, limit)
+
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	for _, task := range order {
+		wg.Add(1)
+		go func(task *AgentTask) {
+			defer wg.Done()
+			defer close(done[task.ID])
+			if task.Status == TaskCompleted {
+				return
+			}
+
+			err := s.runTask(runCtx, workflow.ID, task, byID, done, slots)
+			if err == nil {
+				return
+			}
+
+			errMu.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			errMu.Unlock()
+
+			if workflow.FailurePolicy != ContinueOnError {
+				cancel()
+			}
+		}(task)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	failed, skipped := s.collectUnfinished(workflow.Tasks)
+	if len(failed) > 0 {
+		return &WorkflowResult{
+			Success:      false,
+			FinalContent: s.getFinalContent(workflow.Tasks),
+			Tasks:        workflow.Tasks,
+			TotalTime:    time.Since(startTime),
+			Metadata: map[string]interface{}{
+				"workflow_id":   workflow.ID,
+				"error":         firstErr.Error(),
+				"failed_tasks":  failed,
+				"skipped_tasks": skipped,
+			},
+		}, firstErr
+	}
+
+	if awaiting := s.collectAwaiting(workflow.Tasks); len(awaiting) > 0 {
+		return &WorkflowResult{
+			Success:      false,
+			FinalContent: s.getFinalContent(workflow.Tasks),
+			Tasks:        workflow.Tasks,
+			Paused:       true,
+			TotalTime:    time.Since(startTime),
+			Metadata: map[string]interface{}{
+				"workflow_id":       workflow.ID,
+				"awaiting_approval": awaiting,
+			},
+		}, nil
 	}
 
 	// 构建结果
@@ -104,77 +281,258 @@ func (s *Scheduler) ExecuteWorkflow(ctx context.Context, workflow *Workflow) (*W
 	}, nil
 }
 
-// executeTask 执行单个任务
-func (s *Scheduler) executeTask(ctx context.Context, task *AgentTask) error {
-	task.Status = "running"
-	task.StartTime = time.Now()
+// runTask 等待依赖结束并占用并发名额后执行任务
+// 依赖未成功完成或工作流已取消时跳过任务，返回 nil；只有任务本身执行失败时返回错误
+func (s *Scheduler) runTask(
+	ctx context.Context,
+	workflowID string,
+	task *AgentTask,
+	byID map[string]*AgentTask,
+	done map[string]chan struct{},
+	slots chan struct{},
+) error {
+	for _, depID := range task.DependsOn {
+		select {
+		case <-done[depID]:
+		case <-ctx.Done():
+			s.skipTask(workflowID, task, ctx.Err())
+			return nil
+		}
 
+		if dep := byID[depID]; dep.Status != TaskCompleted {
+			// 上游在等待审批 (或因此未执行) 时保持 pending，审批后继续执行
+			if dep.Status == TaskAwaitingApproval || dep.Status == TaskPending {
+				return nil
+			}
+			s.skipTask(workflowID, task, fmt.Errorf("dependency task %s %s", depID, dep.Status))
+			return nil
+		}
+	}
+
+	if task.Type == TaskTypeApproval {
+		if ctx.Err() != nil {
+			s.skipTask(workflowID, task, ctx.Err())
+		} else {
+			s.awaitApproval(workflowID, task)
+		}
+		return nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		defer func() { <-slots }()
+	case <-ctx.Done():
+		s.skipTask(workflowID, task, ctx.Err())
+		return nil
+	}
+	if ctx.Err() != nil {
+		s.skipTask(workflowID, task, ctx.Err())
+		return nil
+	}
+
+	// 任务之间可能共用同一个上下文 map，复制后再加入依赖任务的结果
+	// 任务字段可能同时被状态查询读取，只在持有锁时修改
 	s.mu.Lock()
-	s.tasks[task.ID] = task
+	taskContext := make(map[string]interface{}, len(task.Context)+len(task.DependsOn))
+	for k, v := range task.Context {
+		taskContext[k] = v
+	}
+	for _, depID := range task.DependsOn {
+		taskContext[fmt.Sprintf("dependency_%s", depID)] = byID[depID].Result
+	}
+	task.Context = taskContext
+	task.Input = renderTaskOutputs(task.Input, task, byID)
 	s.mu.Unlock()
 
-	// 执行 Agent
-	result, err := s.executor.Execute(ctx, task.AgentID, task.Input, task.Context)
+	if err := s.runAgentTask(ctx, workflowID, task); err != nil {
+		// 其他任务失败导致工作流取消时，被中断的任务记为跳过
+		if ctx.Err() != nil {
+			s.skipTask(workflowID, task, ctx.Err())
+			return nil
+		}
+		return err
+	}
+	return nil
+}
 
+// skipTask 将任务标记为跳过
+func (s *Scheduler) skipTask(workflowID string, task *AgentTask, reason error) {
+	s.mu.Lock()
+	task.Status = TaskSkipped
+	task.Error = reason
 	task.EndTime = time.Now()
+	s.mu.Unlock()
 
-	if err != nil {
-		task.Status = "failed"
-		task.Error = err
-		return fmt.Errorf("task %s failed: %w", task.ID, err)
-	}
+	s.record(workflowID, task)
+}
 
-	task.Status = "completed"
-	task.Result = result
+// awaitApproval 将审批任务标记为等待处理，不占用并发名额
+func (s *Scheduler) awaitApproval(workflowID string, task *AgentTask) {
+	s.mu.Lock()
+	task.Status = TaskAwaitingApproval
+	task.StartTime = time.Now()
+	s.mu.Unlock()
 
-	return nil
+	s.record(workflowID, task)
 }
 
-// waitForDependencies 等待依赖任务完成
-func (s *Scheduler) waitForDependencies(ctx context.Context, task *AgentTask) error {
-	if len(task.DependsOn) == 0 {
-		return nil
+// runAgentTask 执行工作流中的任务，并在开始与结束时记录状态
+func (s *Scheduler) runAgentTask(ctx context.Context, workflowID string, task *AgentTask) error {
+	s.mu.Lock()
+	task.Status = TaskRunning
+	task.StartTime = time.Now()
+	task.TokensUsed = 0
+	s.mu.Unlock()
+	s.record(workflowID, task)
+
+	usage := &taskUsage{}
+	ctx = withTaskUsage(ctx, usage)
+	if s.observer != nil {
+		ctx = WithOutputCallback(ctx, func(chunk string) {
+			s.observer.OnRunEvent(&RunEvent{
+				Type:       EventTaskOutput,
+				WorkflowID: workflowID,
+				TaskID:     task.ID,
+				AgentID:    task.AgentID,
+				AgentKey:   task.AgentKey,
+				Chunk:      chunk,
+			})
+		})
 	}
 
-	// 检查所有依赖
-	for _, depID := range task.DependsOn {
-		s.mu.RLock()
-		depTask, ok := s.tasks[depID]
-		s.mu.RUnlock()
+	err := s.executeTask(ctx, task)
+	if err == nil && task.Review != nil {
+		err = s.reviewTask(ctx, workflowID, task)
+	}
 
-		if !ok {
-			return fmt.Errorf("dependency task %s not found", depID)
-		}
+	s.mu.Lock()
+	task.TokensUsed = int(atomic.LoadInt64(&usage.tokens))
+	s.mu.Unlock()
+	s.record(workflowID, task)
+	return err
+}
 
-		// 等待依赖任务完成
-		for {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
+// reviewTask 对任务结果执行审核-修改循环，结果替换为最终通过 (或达到迭代上限) 的内容
+func (s *Scheduler) reviewTask(ctx context.Context, workflowID string, task *AgentTask) error {
+	loop := NewReviewLoop(s, NewMessageBus(), &ReviewLoopConfig{
+		MaxIterations: task.Review.MaxIterations,
+		MinScore:      task.Review.MinScore,
+		Timeout:       reviewTimeout,
+		AutoApprove:   true,
+		OnIteration: func(iteration *ReviewIteration) {
+			if s.observer == nil {
+				return
 			}
+			s.observer.OnRunEvent(&RunEvent{
+				Type:       EventReview,
+				WorkflowID: workflowID,
+				TaskID:     task.ID,
+				AgentID:    task.Review.ReviewerID,
+				AgentKey:   task.Review.ReviewerKey,
+				Iteration:  iteration.Iteration,
+				Score:      iteration.Feedback.Score,
+				Approved:   iteration.Approved,
+				Issues:     iteration.Feedback.Issues,
+			})
+		},
+	})
+	result, err := loop.Execute(ctx, task.Agent(), task.Review.Reviewer(), task.Result, task.Context)
 
-			s.mu.RLock()
-			status := depTask.Status
-			s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task.EndTime = time.Now()
+	if err != nil {
+		task.Status = TaskFailed
+		task.Error = err
+		return fmt.Errorf("task %s review failed: %w", task.ID, err)
+	}
+	task.Result = result.FinalContent
+	return nil
+}
 
-			if status == "completed" {
-				break
-			}
+// record 通知记录器与事件接收者任务状态变化
+func (s *Scheduler) record(workflowID string, task *AgentTask) {
+	if s.recorder != nil {
+		s.recorder.RecordTask(workflowID, task)
+	}
+	if s.observer == nil {
+		return
+	}
 
-			if status == "failed" {
-				return fmt.Errorf("dependency task %s failed", depID)
+	s.mu.RLock()
+	event := &RunEvent{
+		Type:       EventTaskStatus,
+		WorkflowID: workflowID,
+		TaskID:     task.ID,
+		AgentID:    task.AgentID,
+		AgentKey:   task.AgentKey,
+		Status:     task.Status,
+	}
+	if task.Error != nil {
+		event.Error = task.Error.Error()
+	}
+	if task.Status != TaskRunning {
+		event.TokensUsed = task.TokensUsed
+		event.DurationMs = task.Duration().Milliseconds()
+	}
+	if workflow, ok := s.workflows[workflowID]; ok {
+		event.Total = len(workflow.Tasks)
+		for _, t := range workflow.Tasks {
+			if t.Status == TaskCompleted || t.Status == TaskFailed || t.Status == TaskSkipped {
+				event.Finished++
 			}
+		}
+	}
+	s.mu.RUnlock()
 
-			time.Sleep(100 * time.Millisecond)
+	s.observer.OnRunEvent(event)
+}
+
+// collectUnfinished 返回失败与被跳过的任务 ID
+func (s *Scheduler) collectUnfinished(tasks []*AgentTask) (failed, skipped []string) {
+	for _, task := range tasks {
+		switch task.Status {
+		case TaskFailed:
+			failed = append(failed, task.ID)
+		case TaskSkipped:
+			skipped = append(skipped, task.ID)
 		}
+	}
+	return failed, skipped
+}
 
-		// 将依赖任务的结果添加到上下文
-		if task.Context == nil {
-			task.Context = make(map[string]interface{})
+// collectAwaiting 返回等待审批的任务 ID
+func (s *Scheduler) collectAwaiting(tasks []*AgentTask) []string {
+	var awaiting []string
+	for _, task := range tasks {
+		if task.Status == TaskAwaitingApproval {
+			awaiting = append(awaiting, task.ID)
 		}
-		task.Context[fmt.Sprintf("dependency_%s", depID)] = depTask.Result
 	}
+	return awaiting
+}
+
+// executeTask 执行单个任务，运行状态由调用方 (runAgentTask) 设置
+func (s *Scheduler) executeTask(ctx context.Context, task *AgentTask) error {
+	s.mu.RLock()
+	agent, input, taskContext := task.Agent(), task.Input, task.Context
+	s.mu.RUnlock()
+
+	// 执行 Agent
+	result, err := s.executor.Execute(ctx, agent, input, taskContext)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task.EndTime = time.Now()
+
+	if err != nil {
+		task.Status = TaskFailed
+		task.Error = err
+		return fmt.Errorf("task %s failed: %w", task.ID, err)
+	}
+
+	task.Status = TaskCompleted
+	task.Result = result
 
 	return nil
 }
@@ -195,20 +553,45 @@ func (s *Scheduler) getFinalContent(tasks []*AgentTask) string {
 	return ""
 }
 
-// GetTaskStatus 获取任务状态
-func (s *Scheduler) GetTaskStatus(taskID string) (*AgentTask, error) {
+// register 登记运行中的工作流及其任务
+func (s *Scheduler) register(workflow *Workflow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workflows[workflow.ID] = workflow
+	for _, task := range workflow.Tasks {
+		s.tasks[taskKey(workflow.ID, task.ID)] = task
+	}
+}
+
+// unregister 移除已结束 (完成、失败、暂停或取消) 的工作流及其任务
+func (s *Scheduler) unregister(workflow *Workflow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.workflows, workflow.ID)
+	for _, task := range workflow.Tasks {
+		delete(s.tasks, taskKey(workflow.ID, task.ID))
+	}
+}
+
+// taskKey 任务 ID 只在工作流内唯一 (自定义模板常用 draft、review 等 ID)，与工作流 ID 组合后索引
+func taskKey(workflowID, taskID string) string {
+	return workflowID + "/" + taskID
+}
+
+// GetTaskStatus 获取运行中工作流的任务状态
+func (s *Scheduler) GetTaskStatus(workflowID, taskID string) (*AgentTask, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	task, ok := s.tasks[taskID]
+	task, ok := s.tasks[taskKey(workflowID, taskID)]
 	if !ok {
-		return nil, fmt.Errorf("task %s not found", taskID)
+		return nil, fmt.Errorf("task %s not found in workflow %s", taskID, workflowID)
 	}
 
 	return task, nil
 }
 
-// GetWorkflowStatus 获取工作流状态
+// GetWorkflowStatus 获取运行中工作流的状态
 func (s *Scheduler) GetWorkflowStatus(workflowID string) (*Workflow, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -223,11 +606,12 @@ func (s *Scheduler) GetWorkflowStatus(workflowID string) (*Workflow, error) {
 
 // Workflow 工作流定义
 type Workflow struct {
-	ID          string
-	Name        string
-	Description string
-	Tasks       []*AgentTask
-	CreatedAt   time.Time
+	ID            string
+	Name          string
+	Description   string
+	Tasks         []*AgentTask
+	FailurePolicy FailurePolicy // 为空时按 FailFast 处理
+	CreatedAt     time.Time
 }
 
 // NewWorkflow 创建工作流
@@ -245,3 +629,59 @@ func NewWorkflow(id, name, description string) *Workflow {
 func (w *Workflow) AddTask(task *AgentTask) {
 	w.Tasks = append(w.Tasks, task)
 }
+
+// TopologicalOrder 按依赖关系排序任务，依赖在前；同一层的任务保持添加顺序
+// 任务 ID 重复、依赖不存在或存在循环依赖时返回错误
+func (w *Workflow) TopologicalOrder() ([]*AgentTask, error) {
+	byID := make(map[string]*AgentTask, len(w.Tasks))
+	for _, task := range w.Tasks {
+		if _, ok := byID[task.ID]; ok {
+			return nil, fmt.Errorf("duplicate task id %s", task.ID)
+		}
+		byID[task.ID] = task
+	}
+
+	indegree := make(map[string]int, len(w.Tasks))
+	dependents := make(map[string][]string)
+	for _, task := range w.Tasks {
+		for _, depID := range task.DependsOn {
+			if _, ok := byID[depID]; !ok {
+				return nil, fmt.Errorf("task %s depends on unknown task %s", task.ID, depID)
+			}
+			indegree[task.ID]++
+			dependents[depID] = append(dependents[depID], task.ID)
+		}
+	}
+
+	queue := make([]string, 0, len(w.Tasks))
+	for _, task := range w.Tasks {
+		if indegree[task.ID] == 0 {
+			queue = append(queue, task.ID)
+		}
+	}
+
+	order := make([]*AgentTask, 0, len(w.Tasks))
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		order = append(order, byID[id])
+
+		for _, next := range dependents[id] {
+			indegree[next]--
+			if indegree[next] == 0 {
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	if len(order) < len(w.Tasks) {
+		var cyclic []string
+		for _, task := range w.Tasks {
+			if indegree[task.ID] > 0 {
+				cyclic = append(cyclic, task.ID)
+			}
+		}
+		return nil, fmt.Errorf("workflow %s has a dependency cycle among tasks %v", w.ID, cyclic)
+	}
+	return order, nil
+}
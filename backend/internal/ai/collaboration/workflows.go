@@ -2,6 +2,9 @@ package collaboration
 
 import (
 	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
 )
 
 // WorkflowTemplate 工作流模板
@@ -261,7 +264,8 @@ func BuildStorylinePlanningWorkflow(input string, context map[string]interface{}
 
 var idCounter uint64
 
+// generateID 生成工作流 ID，运行会持久化，需在重启后仍不重复
 func generateID() string {
-	idCounter++
-	return fmt.Sprintf("%d", idCounter)
+	n := atomic.AddUint64(&idCounter, 1)
+	return fmt.Sprintf("%s%d", strconv.FormatInt(time.Now().UnixNano(), 36), n)
 }
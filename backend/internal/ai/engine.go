@@ -3,27 +3,38 @@ package ai
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/zibianqu/novel-study/internal/ai/agents"
+	"github.com/zibianqu/novel-study/internal/ai/guard"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
 	"github.com/zibianqu/novel-study/internal/ai/rag"
 	"github.com/zibianqu/novel-study/internal/ai/tools"
 	"github.com/zibianqu/novel-study/internal/config"
+	"github.com/zibianqu/novel-study/internal/model"
 	"github.com/zibianqu/novel-study/internal/repository"
 )
 
 // Engine AI引擎
 type Engine struct {
 	config        *config.Config
-	agents        map[string]Agent
-	agentsByID    map[int]Agent // Agent ID 索引
-	apiKey        string
+	agents        map[string]llm.Agent
+	agentsByID    map[int]llm.Agent // Agent ID 索引
+	provider      llm.LLMProvider
+	budget        BudgetGuard
+	providers     ProviderResolver
+	templates     PromptTemplateResolver
+	detector      *guard.Detector
 	mu            sync.RWMutex // 保护并发访问
 	toolRegistry  *tools.ToolRegistry
 	retriever     *rag.Retriever
+	agentRepo     *repository.AgentRepository
 	projectRepo   *repository.ProjectRepository
 	chapterRepo   *repository.ChapterRepository
 	storylineRepo *repository.StorylineRepository
@@ -34,23 +45,30 @@ type Engine struct {
 func NewEngine(
 	cfg *config.Config,
 	db *sql.DB,
+	provider llm.LLMProvider,
 	retriever *rag.Retriever,
+	agentRepo *repository.AgentRepository,
 	projectRepo *repository.ProjectRepository,
 	chapterRepo *repository.ChapterRepository,
 	storylineRepo *repository.StorylineRepository,
 	neo4jRepo *repository.Neo4jRepository,
 ) *Engine {
-	// 初始化工具注册表
-	toolLogger := tools.NewDBToolCallLogger(db)
+	// 初始化工具注册表，没有数据库连接时不记录工具调用日志
+	var toolLogger tools.ToolCallLogger
+	if db != nil {
+		toolLogger = tools.NewDBToolCallLogger(db)
+	}
 	toolRegistry := tools.NewToolRegistry(toolLogger)
 
 	engine := &Engine{
 		config:        cfg,
-		agents:        make(map[string]Agent),
-		agentsByID:    make(map[int]Agent),
-		apiKey:        cfg.OpenAIAPIKey,
+		agents:        make(map[string]llm.Agent),
+		agentsByID:    make(map[int]llm.Agent),
+		provider:      provider,
+		detector:      guard.NewDetector(),
 		toolRegistry:  toolRegistry,
 		retriever:     retriever,
+		agentRepo:     agentRepo,
 		projectRepo:   projectRepo,
 		chapterRepo:   chapterRepo,
 		storylineRepo: storylineRepo,
@@ -60,10 +78,12 @@ func NewEngine(
 	// 注册工具
 	engine.RegisterTools()
 
-	// 注册Agents
-	engine.RegisterCoreAgents()
-
-	fmt.Println("✅ AI 引擎初始化完成，已注册 7 个 Agent")
+	// 从 agents 表加载Agent定义
+	if count, err := engine.LoadAgents(); err != nil {
+		log.Printf("⚠️ 加载 Agent 定义失败: %v", err)
+	} else {
+		fmt.Printf("✅ 已从数据库加载 %d 个 Agent\n", count)
+	}
 	fmt.Printf("✅ 工具系统初始化完成，已注册 %d 个工具\n", len(engine.toolRegistry.ListTools()))
 
 	return engine
@@ -87,32 +107,115 @@ func (e *Engine) RegisterTools() {
 	e.toolRegistry.Register(tools.NewCreateStorylineTool(e.storylineRepo))
 }
 
-// RegisterCoreAgents 注册核心Agent
-func (e *Engine) RegisterCoreAgents() {
-	// Agent 0: 总导演
-	e.RegisterAgent("agent_0_director", 0, agents.NewDirectorAgent(e.apiKey, e.toolRegistry))
+// LoadAgents 从 agents 表加载核心Agent与用户扩展Agent定义，并整体替换当前注册的Agent
+// is_active=false 的Agent不会被注册；任一定义无效时保留原有Agent不变
+func (e *Engine) LoadAgents() (int, error) {
+	if e.agentRepo == nil {
+		return 0, errors.New("agent repository not configured")
+	}
+
+	rows, err := e.agentRepo.ListCoreAgents()
+	if err != nil {
+		return 0, fmt.Errorf("failed to load agents: %w", err)
+	}
+
+	extensions, err := e.agentRepo.ListActiveExtensionAgents()
+	if err != nil {
+		return 0, fmt.Errorf("failed to load extension agents: %w", err)
+	}
+	rows = append(rows, extensions...)
+
+	loaded := make(map[string]llm.Agent, len(rows))
+	loadedByID := make(map[int]llm.Agent, len(rows))
+	for _, row := range rows {
+		if !row.IsActive {
+			continue
+		}
+
+		agent, err := e.buildAgent(row)
+		if err != nil {
+			// 单个扩展Agent配置错误不影响其他Agent加载
+			if row.Type == "extension" {
+				log.Printf("⚠️ 跳过无法加载的扩展Agent %s: %v", row.AgentKey, err)
+				continue
+			}
+			return 0, err
+		}
+
+		loaded[row.AgentKey] = agent
+		if row.Type == "core" {
+			if n, ok := agents.CoreAgentNumber(row.AgentKey); ok {
+				loadedByID[n] = agent
+			}
+		}
+	}
+
+	e.mu.Lock()
+	e.agents = loaded
+	e.agentsByID = loadedByID
+	e.mu.Unlock()
+
+	return len(loaded), nil
+}
+
+// RegisterAgentModel 根据单条 agents 表记录注册或更新Agent（用于扩展Agent的增删改）
+// 记录已停用时从注册表中移除
+func (e *Engine) RegisterAgentModel(row *model.Agent) error {
+	if !row.IsActive {
+		e.UnregisterAgent(row.AgentKey)
+		return nil
+	}
+
+	agent, err := e.buildAgent(row)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.agents[row.AgentKey] = agent
+	return nil
+}
 
-	// Agent 1: 旁白叙述者
-	e.RegisterAgent("agent_1_narrator", 1, agents.NewNarratorAgent(e.apiKey, e.toolRegistry))
+// ValidateAgentModel 校验 agents 表记录能否创建Agent，不注册
+func (e *Engine) ValidateAgentModel(row *model.Agent) error {
+	_, err := e.buildAgent(row)
+	return err
+}
 
-	// Agent 2: 角色扮演者
-	e.RegisterAgent("agent_2_character", 2, agents.NewCharacterAgent(e.apiKey, e.toolRegistry))
+// UnregisterAgent 移除Agent（线程安全）
+func (e *Engine) UnregisterAgent(key string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 
-	// Agent 3: 审核导演
-	e.RegisterAgent("agent_3_quality", 3, agents.NewQualityAgent(e.apiKey, e.toolRegistry))
+	if agent, ok := e.agents[key]; ok {
+		for id, a := range e.agentsByID {
+			if a == agent {
+				delete(e.agentsByID, id)
+			}
+		}
+		delete(e.agents, key)
+	}
+}
 
-	// Agent 4: 天线掌控者
-	e.RegisterAgent("agent_4_skyline", 4, agents.NewSkylineAgent(e.apiKey, e.toolRegistry))
+// buildAgent 根据 agents 表记录创建Agent
+func (e *Engine) buildAgent(row *model.Agent) (llm.Agent, error) {
+	agent, err := agents.NewAgentFromModel(row, e.provider, e.toolRegistry)
+	if err != nil {
+		return nil, err
+	}
 
-	// Agent 5: 地线掌控者
-	e.RegisterAgent("agent_5_groundline", 5, agents.NewGroundlineAgent(e.apiKey, e.toolRegistry))
+	for _, toolName := range agent.GetConfig().Tools {
+		if _, err := e.toolRegistry.Get(toolName); err != nil {
+			log.Printf("⚠️ Agent %s 配置了未注册的工具: %s", row.AgentKey, toolName)
+		}
+	}
 
-	// Agent 6: 剧情线掌控者
-	e.RegisterAgent("agent_6_plotline", 6, agents.NewPlotlineAgent(e.apiKey, e.toolRegistry))
+	return agent, nil
 }
 
 // RegisterAgent 注册Agent（线程安全）
-func (e *Engine) RegisterAgent(key string, id int, agent Agent) {
+func (e *Engine) RegisterAgent(key string, id int, agent llm.Agent) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	e.agents[key] = agent
@@ -120,7 +223,7 @@ func (e *Engine) RegisterAgent(key string, id int, agent Agent) {
 }
 
 // GetAgent 获取Agent（线程安全）
-func (e *Engine) GetAgent(key string) (Agent, error) {
+func (e *Engine) GetAgent(key string) (llm.Agent, error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
@@ -132,7 +235,7 @@ func (e *Engine) GetAgent(key string) (Agent, error) {
 }
 
 // GetAgentByID 根据ID获取Agent
-func (e *Engine) GetAgentByID(id int) (Agent, error) {
+func (e *Engine) GetAgentByID(id int) (llm.Agent, error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
@@ -143,13 +246,334 @@ func (e *Engine) GetAgentByID(id int) (Agent, error) {
 	return agent, nil
 }
 
+// GetProvider 获取模型提供方
+func (e *Engine) GetProvider() llm.LLMProvider {
+	return e.provider
+}
+
 // GetToolRegistry 获取工具注册表
 func (e *Engine) GetToolRegistry() *tools.ToolRegistry {
 	return e.toolRegistry
 }
 
+// SetBudgetGuard 设置预算检查，每次执行Agent前都会检查
+func (e *Engine) SetBudgetGuard(guard BudgetGuard) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.budget = guard
+}
+
+// SetProviderResolver 设置按用户选择模型提供方的方式，用于让用户使用自己的 API 密钥
+func (e *Engine) SetProviderResolver(resolver ProviderResolver) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.providers = resolver
+}
+
+// SetPromptTemplates 设置提示词模板来源，设置后Agent的系统提示词优先使用模板
+func (e *Engine) SetPromptTemplates(resolver PromptTemplateResolver) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.templates = resolver
+}
+
+// withPromptTemplate 渲染Agent的系统提示词模板，返回带有模板内容的请求副本
+// 没有模板或解析失败时使用Agent配置中的系统提示词
+func (e *Engine) withPromptTemplate(agentKey string, req *llm.AgentRequest) *llm.AgentRequest {
+	e.mu.RLock()
+	resolver := e.templates
+	e.mu.RUnlock()
+
+	if resolver == nil || req.SystemPrompt != "" {
+		return req
+	}
+
+	resolved, err := resolver.ResolveAgentPrompt(agentKey, req.ProjectID, req.Context)
+	if err != nil {
+		log.Printf("⚠️ 解析 Agent %s 的提示词模板失败，使用默认提示词: %v", agentKey, err)
+		return req
+	}
+	if resolved == nil {
+		return req
+	}
+
+	withTemplate := *req
+	withTemplate.SystemPrompt = resolved.Content
+	withTemplate.PromptTemplateVersionID = resolved.VersionID
+	return &withTemplate
+}
+
+// withInjectionGuard 检查请求中用户提供的内容，疑似提示词注入时禁用写入工具并记录
+// 返回命中的特征与 (可能被修改的) 请求副本
+func (e *Engine) withInjectionGuard(agentKey string, agent llm.Agent, req *llm.AgentRequest) (*llm.AgentRequest, []guard.Finding) {
+	findings := e.detector.ScanAll(userTexts(req)...)
+	if len(findings) == 0 {
+		return req, nil
+	}
+
+	blocked := e.writeToolsOf(agent)
+	log.Printf("⚠️ Agent %s 的请求疑似提示词注入 (user=%d, project=%d): %s，禁用写入工具 %v",
+		agentKey, req.UserID, req.ProjectID, findings[0].Pattern, blocked)
+	e.logInjectionIncident(agentKey, req, findings, blocked)
+
+	guarded := *req
+	guarded.ReadOnlyTools = true
+	return &guarded, findings
+}
+
+// checkToolOutputs 记录工具输出中命中的注入特征 (Agent 在命中后已禁用后续的写入工具)
+// 返回请求与工具输出中命中的全部特征
+func (e *Engine) checkToolOutputs(agentKey string, agent llm.Agent, req *llm.AgentRequest, resp *llm.AgentResponse, findings []guard.Finding) []guard.Finding {
+	toolCalls, _ := resp.Metadata["tool_calls"].([]tools.ToolCallResult)
+
+	var toolFindings []guard.Finding
+	for _, call := range toolCalls {
+		toolFindings = append(toolFindings, call.InjectionFindings...)
+	}
+	if len(toolFindings) == 0 {
+		return findings
+	}
+
+	blocked := e.writeToolsOf(agent)
+	log.Printf("⚠️ Agent %s 的工具输出疑似提示词注入 (user=%d, project=%d): %s，已禁用写入工具 %v",
+		agentKey, req.UserID, req.ProjectID, toolFindings[0].Pattern, blocked)
+	e.logInjectionIncident(agentKey, req, toolFindings, blocked)
+	return append(findings, toolFindings...)
+}
+
+// logInjectionIncident 将疑似提示词注入写入 prompt_injection_incidents
+func (e *Engine) logInjectionIncident(agentKey string, req *llm.AgentRequest, findings []guard.Finding, blocked []string) {
+	if e.agentRepo == nil {
+		return
+	}
+
+	incident := &model.PromptInjectionIncident{
+		UserID:       req.UserID,
+		AgentKey:     agentKey,
+		ActionType:   req.ActionType,
+		BlockedTools: blocked,
+	}
+	if incident.ActionType == "" {
+		incident.ActionType = "agent"
+	}
+	if req.ProjectID > 0 {
+		projectID := req.ProjectID
+		incident.ProjectID = &projectID
+	}
+	for _, f := range findings {
+		incident.Findings = append(incident.Findings, model.InjectionFinding{Pattern: f.Pattern, Excerpt: f.Excerpt})
+	}
+	if err := e.agentRepo.LogInjectionIncident(incident); err != nil {
+		log.Printf("⚠️ 记录提示词注入事件失败: %v", err)
+	}
+}
+
+// userTexts 请求中来自用户的文本：提示词、上下文中的字符串 (包括嵌套的对象与数组) 与历史用户消息
+func userTexts(req *llm.AgentRequest) []string {
+	texts := []string{req.Prompt}
+	for _, v := range req.Context {
+		texts = appendStrings(texts, v)
+	}
+	for _, msg := range req.History {
+		if msg.Role == "user" {
+			texts = append(texts, msg.Content)
+		}
+	}
+	return texts
+}
+
+// appendStrings 递归收集值中的全部字符串；其他类型 (如结构体) 按 JSON 转换后收集
+func appendStrings(texts []string, v interface{}) []string {
+	switch val := v.(type) {
+	case nil:
+	case string:
+		texts = append(texts, val)
+	case []string:
+		texts = append(texts, val...)
+	case map[string]string:
+		for _, s := range val {
+			texts = append(texts, s)
+		}
+	case map[string]interface{}:
+		for _, item := range val {
+			texts = appendStrings(texts, item)
+		}
+	case []interface{}:
+		for _, item := range val {
+			texts = appendStrings(texts, item)
+		}
+	case bool, int, int64, float64:
+	default:
+		data, err := json.Marshal(val)
+		if err != nil {
+			return texts
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(data, &decoded); err == nil {
+			texts = appendStrings(texts, decoded)
+		}
+	}
+	return texts
+}
+
+// writeToolsOf Agent可用的工具中会修改项目数据的工具
+func (e *Engine) writeToolsOf(agent llm.Agent) []string {
+	configured, ok := agent.(interface{ GetConfig() *llm.AgentConfig })
+	if !ok {
+		return nil
+	}
+
+	var names []string
+	for _, name := range configured.GetConfig().Tools {
+		if tool, err := e.toolRegistry.Get(name); err == nil && tools.IsWriteTool(tool) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// userProvider 获取用户自己的模型提供方，用户未配置 API 密钥时返回 nil
+func (e *Engine) userProvider(userID int) (llm.LLMProvider, error) {
+	e.mu.RLock()
+	resolver := e.providers
+	e.mu.RUnlock()
+
+	if resolver == nil || userID <= 0 {
+		return nil, nil
+	}
+
+	provider, err := resolver.ProviderFor(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user API key: %w", err)
+	}
+	return provider, nil
+}
+
+// withUserProvider 用户配置了自己的 API 密钥时，让本次调用使用该密钥
+func (e *Engine) withUserProvider(ctx context.Context, userID int) (context.Context, error) {
+	provider, err := e.userProvider(userID)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return ctx, nil
+	}
+	// 保留其他已注册的提供方与熔断状态 (以及录制回放等包装)，只替换默认提供方
+	if router, ok := e.provider.(llm.DefaultRouter); ok {
+		provider = router.WithDefault(provider)
+	}
+	return llm.WithProvider(ctx, provider), nil
+}
+
+// CheckBudget 检查用户与项目预算，供流式接口在建立连接前提前校验
+// 预算只限制系统密钥的用量，用户使用自己的 API 密钥时不检查
+func (e *Engine) CheckBudget(userID, projectID int) ([]string, error) {
+	provider, err := e.userProvider(userID)
+	if err != nil {
+		return nil, err
+	}
+	if provider != nil {
+		return nil, nil
+	}
+	return e.checkBudget(userID, projectID)
+}
+
+// checkBudget 调用预算检查，未配置预算服务时不限制
+func (e *Engine) checkBudget(userID, projectID int) ([]string, error) {
+	e.mu.RLock()
+	guard := e.budget
+	e.mu.RUnlock()
+
+	if guard == nil {
+		return nil, nil
+	}
+	return guard.CheckBudget(userID, projectID)
+}
+
+// EstimateAgent 在调用模型前预估Agent本次请求的 Token 用量与费用上限
+func (e *Engine) EstimateAgent(agentKey string, req *llm.AgentRequest) (*llm.TokenEstimate, error) {
+	agent, err := e.GetAgent(agentKey)
+	if err != nil {
+		return nil, err
+	}
+
+	estimator, ok := agent.(llm.TokenEstimator)
+	if !ok {
+		return nil, fmt.Errorf("agent %s does not support token estimation", agentKey)
+	}
+
+	estimate := estimator.EstimateTokens(e.withPromptTemplate(agentKey, req))
+	estimate.EstimatedCost = EstimateCost(estimate.Model, llm.TokenUsage{
+		PromptTokens:     estimate.PromptTokens,
+		CompletionTokens: estimate.MaxCompletionTokens,
+	})
+	return estimate, nil
+}
+
+// AgentPrompt 返回Agent处理该请求时实际使用的系统提示词与模型，不调用模型
+// 系统提示词优先使用提示词模板，与执行时一致
+func (e *Engine) AgentPrompt(agentKey string, req *llm.AgentRequest) (*AgentPromptInfo, error) {
+	agent, err := e.GetAgent(agentKey)
+	if err != nil {
+		return nil, err
+	}
+
+	configured, ok := agent.(interface{ GetConfig() *llm.AgentConfig })
+	if !ok {
+		return nil, fmt.Errorf("agent %s does not expose its config", agentKey)
+	}
+	config := configured.GetConfig()
+
+	resolved := e.withPromptTemplate(agentKey, req)
+	info := &AgentPromptInfo{
+		SystemPrompt:            config.SystemPrompt,
+		Model:                   config.Model,
+		PromptTemplateVersionID: resolved.PromptTemplateVersionID,
+	}
+	if resolved.SystemPrompt != "" {
+		info.SystemPrompt = resolved.SystemPrompt
+	}
+	return info, nil
+}
+
+// AgentMessages 返回Agent处理该请求时发送给模型的初始消息，不调用模型
+// 与执行时一样先应用提示词模板，消息由Agent自身构建 (含输出 Schema 说明、数据块说明与上下文)
+func (e *Engine) AgentMessages(agentKey string, req *llm.AgentRequest) ([]llm.ChatMessage, error) {
+	agent, err := e.GetAgent(agentKey)
+	if err != nil {
+		return nil, err
+	}
+
+	builder, ok := agent.(interface {
+		BuildMessages(req *llm.AgentRequest) []llm.ChatMessage
+	})
+	if !ok {
+		return nil, fmt.Errorf("agent %s does not expose its messages", agentKey)
+	}
+	return builder.BuildMessages(e.withPromptTemplate(agentKey, req)), nil
+}
+
 // ExecuteAgent 执行Agent
-func (e *Engine) ExecuteAgent(ctx context.Context, agentKey string, req *AgentRequest) (*AgentResponse, error) {
+func (e *Engine) ExecuteAgent(ctx context.Context, agentKey string, req *llm.AgentRequest) (*llm.AgentResponse, error) {
+	agent, err := e.GetAgent(agentKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.execute(ctx, agentKey, agent, req)
+}
+
+// ExecuteAgentByID 根据ID执行Agent
+func (e *Engine) ExecuteAgentByID(ctx context.Context, agentID int, req *llm.AgentRequest) (*llm.AgentResponse, error) {
+	agent, err := e.GetAgentByID(agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.execute(ctx, agentKeyOf(agent), agent, req)
+}
+
+func (e *Engine) execute(ctx context.Context, agentKey string, agent llm.Agent, req *llm.AgentRequest) (*llm.AgentResponse, error) {
 	// 检查上下文是否已取消
 	select {
 	case <-ctx.Done():
@@ -157,10 +581,20 @@ func (e *Engine) ExecuteAgent(ctx context.Context, agentKey string, req *AgentRe
 	default:
 	}
 
-	agent, err := e.GetAgent(agentKey)
+	ctx, err := e.withUserProvider(ctx, req.UserID)
 	if err != nil {
 		return nil, err
 	}
+	// 使用用户自己的 API 密钥时不受预算限制
+	var warnings []string
+	if llm.ProviderFromContext(ctx) == nil {
+		warnings, err = e.checkBudget(req.UserID, req.ProjectID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	req = e.withPromptTemplate(agentKey, req)
+	req, findings := e.withInjectionGuard(agentKey, agent, req)
 
 	startTime := time.Now()
 	resp, err := agent.Execute(ctx, req)
@@ -169,11 +603,34 @@ func (e *Engine) ExecuteAgent(ctx context.Context, agentKey string, req *AgentRe
 	}
 
 	resp.DurationMs = time.Since(startTime).Milliseconds()
+	e.recordUsage(ctx, agentKey, req, resp)
+	attachBudgetWarnings(resp, warnings)
+	attachInjectionFindings(resp, e.checkToolOutputs(agentKey, agent, req, resp, findings))
 	return resp, nil
 }
 
-// ExecuteAgentByID 根据ID执行Agent
-func (e *Engine) ExecuteAgentByID(ctx context.Context, agentID int, req *AgentRequest) (*AgentResponse, error) {
+// ExecuteAgentStream 流式执行Agent，callback 实时接收生成的文本
+// 返回的响应包含完整内容与 Token 用量，ctx 取消时中止生成
+func (e *Engine) ExecuteAgentStream(ctx context.Context, agentKey string, req *llm.AgentRequest, callback func(string)) (*llm.AgentResponse, error) {
+	agent, err := e.GetAgent(agentKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.executeStream(ctx, agentKey, agent, req, callback)
+}
+
+// ExecuteAgentStreamByID 根据ID流式执行Agent
+func (e *Engine) ExecuteAgentStreamByID(ctx context.Context, agentID int, req *llm.AgentRequest, callback func(string)) (*llm.AgentResponse, error) {
+	agent, err := e.GetAgentByID(agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.executeStream(ctx, agentKeyOf(agent), agent, req, callback)
+}
+
+func (e *Engine) executeStream(ctx context.Context, agentKey string, agent llm.Agent, req *llm.AgentRequest, callback func(string)) (*llm.AgentResponse, error) {
 	// 检查上下文是否已取消
 	select {
 	case <-ctx.Done():
@@ -181,41 +638,112 @@ func (e *Engine) ExecuteAgentByID(ctx context.Context, agentID int, req *AgentRe
 	default:
 	}
 
-	agent, err := e.GetAgentByID(agentID)
+	ctx, err := e.withUserProvider(ctx, req.UserID)
 	if err != nil {
 		return nil, err
 	}
+	// 使用用户自己的 API 密钥时不受预算限制
+	var warnings []string
+	if llm.ProviderFromContext(ctx) == nil {
+		warnings, err = e.checkBudget(req.UserID, req.ProjectID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	req = e.withPromptTemplate(agentKey, req)
+	req, findings := e.withInjectionGuard(agentKey, agent, req)
 
 	startTime := time.Now()
-	resp, err := agent.Execute(ctx, req)
+	resp, err := agent.ExecuteStream(ctx, req, callback)
 	if err != nil {
 		return nil, fmt.Errorf("agent execution failed: %w", err)
 	}
 
 	resp.DurationMs = time.Since(startTime).Milliseconds()
+	e.recordUsage(ctx, agentKey, req, resp)
+	attachBudgetWarnings(resp, warnings)
+	attachInjectionFindings(resp, e.checkToolOutputs(agentKey, agent, req, resp, findings))
 	return resp, nil
 }
 
-// ExecuteAgentStream 流式执行Agent
-func (e *Engine) ExecuteAgentStream(ctx context.Context, agentID int, req *AgentRequest, callback func(string)) error {
-	// 检查上下文是否已取消
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
+// recordUsage 将一次Agent调用的 Token 用量写入 ai_interaction_logs
+// 用量来自模型响应，包含工具调用产生的所有轮次，并记录使用的是系统密钥还是用户自己的密钥
+func (e *Engine) recordUsage(ctx context.Context, agentKey string, req *llm.AgentRequest, resp *llm.AgentResponse) {
+	if e.agentRepo == nil {
+		return
 	}
 
-	agent, err := e.GetAgentByID(agentID)
-	if err != nil {
-		return err
+	actionType := req.ActionType
+	if actionType == "" {
+		actionType = "agent"
 	}
 
-	return agent.ExecuteStream(ctx, req, callback)
+	entry := &model.AIInteractionLog{
+		UserID:         req.UserID,
+		AgentKey:       agentKey,
+		ActionType:     actionType,
+		InputPrompt:    req.Prompt,
+		OutputResponse: resp.Content,
+		TokensInput:    resp.Usage.PromptTokens,
+		TokensOutput:   resp.Usage.CompletionTokens,
+		Cost:           EstimateCost(resp.Model, resp.Usage),
+		KeySource:      model.KeySourcePlatform,
+		Model:          resp.Model,
+		DurationMs:     int(resp.DurationMs),
+	}
+	if req.ProjectID > 0 {
+		projectID := req.ProjectID
+		entry.ProjectID = &projectID
+	}
+	if llm.ProviderFromContext(ctx) != nil {
+		entry.KeySource = model.KeySourceUser
+	}
+	if req.PromptTemplateVersionID > 0 {
+		versionID := req.PromptTemplateVersionID
+		entry.PromptTemplateVersionID = &versionID
+	}
+
+	if err := e.agentRepo.LogInteraction(entry); err != nil {
+		log.Printf("⚠️ 记录 Agent %s 用量失败: %v", agentKey, err)
+	}
+}
+
+// attachBudgetWarnings 将预算提醒附加到响应元数据
+func attachBudgetWarnings(resp *llm.AgentResponse, warnings []string) {
+	if len(warnings) == 0 {
+		return
+	}
+	if resp.Metadata == nil {
+		resp.Metadata = make(map[string]interface{})
+	}
+	resp.Metadata["budget_warnings"] = warnings
 }
 
-// ExecuteTool 执行工具
-func (e *Engine) ExecuteTool(ctx context.Context, agentID int, toolName string, params map[string]interface{}) (interface{}, error) {
-	return e.toolRegistry.Execute(ctx, agentID, toolName, params)
+// attachInjectionFindings 将命中的注入特征名称附加到响应元数据
+func attachInjectionFindings(resp *llm.AgentResponse, findings []guard.Finding) {
+	if len(findings) == 0 {
+		return
+	}
+	if resp.Metadata == nil {
+		resp.Metadata = make(map[string]interface{})
+	}
+	seen := make(map[string]bool, len(findings))
+	patterns := make([]string, 0, len(findings))
+	for _, f := range findings {
+		if !seen[f.Pattern] {
+			seen[f.Pattern] = true
+			patterns = append(patterns, f.Pattern)
+		}
+	}
+	resp.Metadata["prompt_injection"] = patterns
+}
+
+// agentKeyOf 获取Agent的 key，用于按编号调用时记录用量
+func agentKeyOf(agent llm.Agent) string {
+	if configured, ok := agent.(interface{ GetConfig() *llm.AgentConfig }); ok {
+		return configured.GetConfig().AgentKey
+	}
+	return agent.GetName()
 }
 
 // ListAgents 获取所有Agent列表（线程安全）
@@ -227,6 +755,7 @@ func (e *Engine) ListAgents() []string {
 	for key := range e.agents {
 		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 	return keys
 }
 
@@ -234,31 +763,3 @@ func (e *Engine) ListAgents() []string {
 func (e *Engine) ListTools() []tools.ToolInfo {
 	return e.toolRegistry.ListTools()
 }
-
-// ChatCompletion 通用聊天完成
-func (e *Engine) ChatCompletion(ctx context.Context, messages []ChatMessage, model string, temperature float64, maxTokens int) (string, error) {
-	if e.apiKey == "" {
-		return "", errors.New("OpenAI API key not configured")
-	}
-
-	// 检查上下文
-	select {
-	case <-ctx.Done():
-		return "", ctx.Err()
-	default:
-	}
-
-	// TODO: 实际集成 OpenAI API
-	// 这里先返回模拟响应
-	return e.mockChatCompletion(messages), nil
-}
-
-// mockChatCompletion 模拟聊天完成（用于测试）
-func (e *Engine) mockChatCompletion(messages []ChatMessage) string {
-	if len(messages) == 0 {
-		return "这是一个模拟响应。"
-	}
-
-	lastMsg := messages[len(messages)-1]
-	return fmt.Sprintf("模拟AI响应: 收到您的消息 '%s'", lastMsg.Content)
-}
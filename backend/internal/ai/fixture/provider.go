@@ -0,0 +1,322 @@
+// Package fixture 录制与回放模型调用，使 Agent、审核循环与工作流可以在没有网络的情况下确定性地测试
+package fixture
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+)
+
+// Mode 录制回放模式
+type Mode string
+
+const (
+	// ModeReplay 优先回放已录制的响应，未录制的请求在非严格模式下调用真实提供方并录制
+	ModeReplay Mode = "replay"
+	// ModeRecord 总是调用真实提供方并覆盖已有录制
+	ModeRecord Mode = "record"
+)
+
+// ErrFixtureNotFound 请求没有对应的录制
+var ErrFixtureNotFound = errors.New("llm fixture not found")
+
+// Fixture 一次模型调用的录制内容
+type Fixture struct {
+	Hash     string                  `json:"hash"`
+	Request  *llm.CompletionRequest  `json:"request"`          // 归一化后的请求，便于审阅
+	Response *llm.CompletionResponse `json:"response"`         // 汇总后的完整响应
+	Chunks   []string                `json:"chunks,omitempty"` // 流式调用的文本增量，回放时按原顺序输出
+}
+
+// Provider 录制回放模型提供方，实现 llm.LLMProvider 与 llm.StreamingProvider
+// 上游为模型路由时同时实现 llm.DefaultRouter，路由选中的提供方与用户自己的 API 密钥仍经过录制回放
+// 录制文件以归一化请求的哈希命名，存放在 dir 目录下
+type Provider struct {
+	dir      string
+	upstream llm.LLMProvider
+	mode     Mode
+	strict   bool
+	prefix   string // 路由选中的非默认提供方名称，录制按路由前的 "提供方:模型" 归档
+	mu       *sync.Mutex
+}
+
+// NewProvider 创建录制回放提供方
+// upstream 为真实提供方，纯回放时可以为空；strict 为 true 时未录制的请求直接失败，不会访问网络
+func NewProvider(dir string, upstream llm.LLMProvider, mode Mode, strict bool) *Provider {
+	if mode == "" {
+		mode = ModeReplay
+	}
+	return &Provider{
+		dir:      dir,
+		upstream: upstream,
+		mode:     mode,
+		strict:   strict,
+		mu:       &sync.Mutex{},
+	}
+}
+
+// Route 实现 llm.ModelRouter，返回的 Client 是以选中的提供方为上游的录制回放提供方，熔断器来自上游路由
+func (p *Provider) Route(model string) (*llm.Route, error) {
+	router, ok := p.upstream.(llm.ModelRouter)
+	if !ok {
+		return &llm.Route{Provider: llm.DefaultProviderName, Client: p, Model: model}, nil
+	}
+
+	route, err := router.Route(model)
+	if err != nil {
+		return nil, err
+	}
+	routed := *route
+	routed.Client = p.withUpstream(route.Client, route.Provider)
+	return &routed, nil
+}
+
+// WithDefault 实现 llm.DefaultRouter，替换上游路由的默认提供方，录制回放保持不变
+func (p *Provider) WithDefault(provider llm.LLMProvider) llm.LLMProvider {
+	if router, ok := p.upstream.(llm.DefaultRouter); ok {
+		return p.withUpstream(router.WithDefault(provider), p.prefix)
+	}
+	return p.withUpstream(provider, p.prefix)
+}
+
+// withUpstream 返回使用同一录制目录的副本
+func (p *Provider) withUpstream(upstream llm.LLMProvider, providerName string) *Provider {
+	clone := *p
+	clone.upstream = upstream
+	clone.prefix = ""
+	if providerName != llm.DefaultProviderName {
+		clone.prefix = providerName
+	}
+	return &clone
+}
+
+// normalize 归一化请求，路由后的请求还原路由前的模型名，与直接调用时的录制一致
+func (p *Provider) normalize(req *llm.CompletionRequest) *llm.CompletionRequest {
+	normalized := Normalize(req)
+	if p.prefix != "" {
+		normalized.Model = p.prefix + ":" + normalized.Model
+	}
+	return normalized
+}
+
+// CreateCompletion 实现 LLMProvider
+func (p *Provider) CreateCompletion(ctx context.Context, req *llm.CompletionRequest) (*llm.CompletionResponse, error) {
+	normalized := p.normalize(req)
+	hash := Hash(normalized)
+
+	if fixture, err := p.lookup(hash); err != nil || fixture != nil {
+		if err != nil {
+			return nil, err
+		}
+		return cloneResponse(fixture.Response), nil
+	}
+
+	upstream, err := p.upstreamFor(hash, normalized)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := upstream.CreateCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.save(&Fixture{Hash: hash, Request: normalized, Response: resp}); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// CreateCompletionStream 实现 StreamingProvider，回放时按录制的增量顺序输出
+func (p *Provider) CreateCompletionStream(ctx context.Context, req *llm.CompletionRequest, onDelta func(string)) (*llm.CompletionResponse, error) {
+	normalized := p.normalize(req)
+	hash := Hash(normalized)
+
+	if fixture, err := p.lookup(hash); err != nil || fixture != nil {
+		if err != nil {
+			return nil, err
+		}
+		chunks := fixture.Chunks
+		if len(chunks) == 0 && fixture.Response.Content != "" {
+			chunks = []string{fixture.Response.Content}
+		}
+		for _, chunk := range chunks {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			onDelta(chunk)
+		}
+		return cloneResponse(fixture.Response), nil
+	}
+
+	upstream, err := p.upstreamFor(hash, normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []string
+	record := func(delta string) {
+		chunks = append(chunks, delta)
+		onDelta(delta)
+	}
+
+	var resp *llm.CompletionResponse
+	if streaming, ok := upstream.(llm.StreamingProvider); ok {
+		resp, err = streaming.CreateCompletionStream(ctx, req, record)
+	} else if resp, err = upstream.CreateCompletion(ctx, req); err == nil && resp.Content != "" {
+		record(resp.Content)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.save(&Fixture{Hash: hash, Request: normalized, Response: resp, Chunks: chunks}); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// lookup 回放模式下读取录制，未录制时返回 nil
+func (p *Provider) lookup(hash string) (*Fixture, error) {
+	if p.mode == ModeRecord {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(p.path(hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read llm fixture %s: %w", hash, err)
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("invalid llm fixture %s: %w", hash, err)
+	}
+	if fixture.Response == nil {
+		return nil, fmt.Errorf("invalid llm fixture %s: missing response", hash)
+	}
+	return &fixture, nil
+}
+
+// upstreamFor 未录制的请求需要调用真实提供方，严格模式或没有真实提供方时返回 ErrFixtureNotFound
+func (p *Provider) upstreamFor(hash string, req *llm.CompletionRequest) (llm.LLMProvider, error) {
+	if p.upstream == nil || (p.strict && p.mode != ModeRecord) {
+		return nil, fmt.Errorf("%w: %s (model=%s, last message=%q)", ErrFixtureNotFound, hash, req.Model, lastMessage(req))
+	}
+	return p.upstream, nil
+}
+
+// save 写入录制文件
+func (p *Provider) save(fixture *Fixture) error {
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode llm fixture: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := os.MkdirAll(p.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create fixture dir: %w", err)
+	}
+	if err := os.WriteFile(p.path(fixture.Hash), append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write llm fixture %s: %w", fixture.Hash, err)
+	}
+	return nil
+}
+
+func (p *Provider) path(hash string) string {
+	return filepath.Join(p.dir, hash+".json")
+}
+
+// Normalize 归一化请求，去掉不影响模型输出的差异 (换行符、首尾空白、工具顺序、浮点误差)
+func Normalize(req *llm.CompletionRequest) *llm.CompletionRequest {
+	normalized := &llm.CompletionRequest{
+		Model:       strings.TrimSpace(req.Model),
+		Temperature: math.Round(req.Temperature*100) / 100,
+		MaxTokens:   req.MaxTokens,
+		Messages:    make([]llm.ChatMessage, 0, len(req.Messages)),
+
+		ResponseFormat: req.ResponseFormat,
+	}
+
+	for _, msg := range req.Messages {
+		m := llm.ChatMessage{
+			Role:       msg.Role,
+			Content:    normalizeText(msg.Content),
+			ToolCallID: msg.ToolCallID,
+		}
+		for _, call := range msg.ToolCalls {
+			m.ToolCalls = append(m.ToolCalls, llm.ToolCall{
+				ID:        call.ID,
+				Name:      call.Name,
+				Arguments: normalizeJSON(call.Arguments),
+			})
+		}
+		normalized.Messages = append(normalized.Messages, m)
+	}
+
+	if len(req.Tools) > 0 {
+		normalized.Tools = append([]llm.ToolDefinition(nil), req.Tools...)
+		sort.Slice(normalized.Tools, func(i, j int) bool {
+			return normalized.Tools[i].Name < normalized.Tools[j].Name
+		})
+	}
+	return normalized
+}
+
+// Hash 计算归一化请求的哈希，作为录制文件名
+func Hash(normalized *llm.CompletionRequest) string {
+	// map 的键在编码时已排序，结果与字段顺序无关
+	data, _ := json.Marshal(normalized)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeText(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// normalizeJSON 重新编码 JSON 参数，使空白与键顺序一致，非 JSON 时原样返回
+func normalizeJSON(s string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func lastMessage(req *llm.CompletionRequest) string {
+	if len(req.Messages) == 0 {
+		return ""
+	}
+	content := []rune(req.Messages[len(req.Messages)-1].Content)
+	if len(content) > 40 {
+		return string(content[:40]) + "..."
+	}
+	return string(content)
+}
+
+func cloneResponse(resp *llm.CompletionResponse) *llm.CompletionResponse {
+	clone := *resp
+	clone.ToolCalls = append([]llm.ToolCall(nil), resp.ToolCalls...)
+	return &clone
+}
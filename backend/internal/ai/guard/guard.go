@@ -0,0 +1,91 @@
+package guard
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Finding 命中的注入特征
+type Finding struct {
+	Pattern string `json:"pattern"` // 特征名称
+	Excerpt string `json:"excerpt"` // 命中位置附近的原文
+}
+
+// pattern 注入特征，按名称记录命中情况
+type pattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// defaultPatterns 常见的提示词注入与越狱写法 (中英文)
+// 小说正文中也可能出现类似对白，命中只用于限制写入工具与记录，不拒绝请求
+var defaultPatterns = []pattern{
+	{"ignore_instructions", regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override)\b.{0,20}\b(previous|prior|above|earlier|all|system|your)\b.{0,20}\b(instructions?|prompts?|rules?|directions?)`)},
+	{"ignore_instructions_zh", regexp.MustCompile(`(忽略|无视|忘记|忘掉|覆盖|不要理会|不用理会).{0,12}(之前|以上|上面|前面|先前|所有|全部|系统|原有|原来).{0,8}(指令|指示|提示词|提示|规则|设定|要求|命令)`)},
+	{"role_override", regexp.MustCompile(`(?i)\b(you are now|from now on,? you (are|will)|pretend (to be|you are)|new instructions?:)`)},
+	{"role_override_zh", regexp.MustCompile(`(从现在(开始|起)，?你(是|将|要|必须)|你现在(是|扮演|的身份是)|你的新(身份|任务|指令)|新的指令[:：])`)},
+	{"system_prompt_leak", regexp.MustCompile(`(?i)(reveal|print|show|repeat|output)\b.{0,20}\b(system prompt|hidden instructions?|initial instructions?)`)},
+	{"system_prompt_leak_zh", regexp.MustCompile(`(输出|显示|打印|复述|泄露|告诉我).{0,10}(系统提示词|系统提示|系统指令|初始指令|隐藏指令)`)},
+	{"jailbreak", regexp.MustCompile(`(?i)\b(jailbreak|DAN mode|do anything now|developer mode|no restrictions)\b|越狱模式|开发者模式|解除(所有|一切)(安全)?限制`)},
+	{"fake_role_marker", regexp.MustCompile(`(?im)(<\|im_start\|>|<\|im_end\|>|<\|system\|>|^\s*#{1,6}\s*system\b|^\s*\[(system|assistant)\]|^\s*(system|assistant)\s*[:：])`)},
+	{"tool_invocation", regexp.MustCompile(`(?i)(call|invoke|use|execute)\s+(the\s+)?(tool|function)\s*[:：]?\s*(update_storyline|create_storyline)|(调用|执行|使用).{0,6}(update_storyline|create_storyline|更新三线|创建三线)`)},
+}
+
+// excerptRadius 摘录命中位置前后的字符数
+const excerptRadius = 30
+
+// Detector 提示词注入检测器
+type Detector struct {
+	patterns []pattern
+}
+
+// NewDetector 创建使用默认特征的检测器
+func NewDetector() *Detector {
+	return &Detector{patterns: defaultPatterns}
+}
+
+// Scan 检查文本中的注入特征，每个特征最多返回一处
+func (d *Detector) Scan(text string) []Finding {
+	if text == "" {
+		return nil
+	}
+
+	var findings []Finding
+	for _, p := range d.patterns {
+		loc := p.re.FindStringIndex(text)
+		if loc == nil {
+			continue
+		}
+		findings = append(findings, Finding{Pattern: p.name, Excerpt: excerpt(text, loc[0], loc[1])})
+	}
+	return findings
+}
+
+// ScanAll 检查多段文本，同一特征只记录第一次命中
+func (d *Detector) ScanAll(texts ...string) []Finding {
+	seen := make(map[string]bool)
+	var findings []Finding
+	for _, text := range texts {
+		for _, f := range d.Scan(text) {
+			if seen[f.Pattern] {
+				continue
+			}
+			seen[f.Pattern] = true
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// excerpt 截取命中位置附近的原文，按字符截断以免切开多字节字符
+func excerpt(text string, start, end int) string {
+	before := []rune(text[:start])
+	after := []rune(text[end:])
+	if len(before) > excerptRadius {
+		before = before[len(before)-excerptRadius:]
+	}
+	if len(after) > excerptRadius {
+		after = after[:excerptRadius]
+	}
+	return strings.TrimSpace(string(before) + text[start:end] + string(after))
+}
@@ -0,0 +1,95 @@
+package llm
+
+import (
+	"sync"
+	"time"
+)
+
+// 熔断器状态
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// CircuitBreaker 模型提供方熔断器
+// 连续失败达到阈值后熔断，冷却期内直接失败；冷却结束后放行一次试探请求，成功则恢复
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     string
+	openedAt  time.Time
+	probeAt   time.Time // 半开状态下试探请求的开始时间
+}
+
+// NewCircuitBreaker 创建熔断器
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		threshold = 1
+	}
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     CircuitClosed,
+	}
+}
+
+// Allow 判断是否允许发起请求
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case CircuitOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.probeAt = now
+		return true
+	case CircuitHalfOpen:
+		// 试探请求未返回结果 (如被取消) 超过冷却时间后，允许新的试探
+		if now.Sub(b.probeAt) < b.cooldown {
+			return false
+		}
+		b.probeAt = now
+		return true
+	default:
+		return true
+	}
+}
+
+// Success 记录请求成功，恢复为闭合状态
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.state = CircuitClosed
+}
+
+// Failure 记录请求失败，试探失败或连续失败达到阈值时熔断
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		b.state = CircuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// State 获取当前状态
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.cooldown {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
@@ -0,0 +1,15 @@
+package llm
+
+import "strings"
+
+// ExtractJSONObject 去掉模型常加的 ```json 代码块与前后说明文字，返回第一个 { 到最后一个 } 之间的内容
+// 没有找到 JSON 对象时返回去掉首尾空白的原文与 false
+func ExtractJSONObject(content string) (string, bool) {
+	content = strings.TrimSpace(content)
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return content, false
+	}
+	return content[start : end+1], true
+}
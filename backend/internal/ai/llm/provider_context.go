@@ -0,0 +1,17 @@
+package llm
+
+import "context"
+
+type providerContextKey struct{}
+
+// WithProvider 返回使用指定模型提供方的上下文，Agent 优先使用上下文中的提供方
+// 用于让调用方使用自己的 API 密钥
+func WithProvider(ctx context.Context, provider LLMProvider) context.Context {
+	return context.WithValue(ctx, providerContextKey{}, provider)
+}
+
+// ProviderFromContext 获取上下文中指定的模型提供方，未指定时返回 nil
+func ProviderFromContext(ctx context.Context) LLMProvider {
+	provider, _ := ctx.Value(providerContextKey{}).(LLMProvider)
+	return provider
+}
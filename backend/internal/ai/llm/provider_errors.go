@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrProviderNotConfigured 未配置模型提供方
+	ErrProviderNotConfigured = errors.New("LLM provider not configured")
+	// ErrCircuitOpen 提供方熔断中，直接失败不再请求
+	ErrCircuitOpen = errors.New("LLM provider circuit open")
+)
+
+// ProviderError 模型服务返回的错误
+type ProviderError struct {
+	StatusCode int           // HTTP 状态码，0 表示未收到响应
+	Code       string        // 服务端错误码，如 insufficient_quota
+	RetryAfter time.Duration // 服务端要求的等待时间 (Retry-After)
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable 判断模型调用错误是否值得重试
+// 429、408、5xx 与网络错误可重试；其余 4xx、额度用尽、熔断与上下文取消不可重试
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrProviderNotConfigured) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) {
+		return true
+	}
+
+	switch {
+	case providerErr.Code == "insufficient_quota":
+		return false
+	case providerErr.StatusCode == 0,
+		providerErr.StatusCode == http.StatusTooManyRequests,
+		providerErr.StatusCode == http.StatusRequestTimeout,
+		providerErr.StatusCode >= 500:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsProviderFailure 判断错误是否说明提供方本身不可用 (5xx 或网络错误)，用于熔断计数
+// 4xx 说明服务正常响应，不计入
+func IsProviderFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) {
+		return true
+	}
+	return providerErr.StatusCode == 0 || providerErr.StatusCode >= 500
+}
+
+// IsBadRequest 判断是否为请求本身的错误 (400/422)，更换模型重试也无法成功
+func IsBadRequest(err error) bool {
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) {
+		return false
+	}
+	return providerErr.StatusCode == http.StatusBadRequest ||
+		providerErr.StatusCode == http.StatusUnprocessableEntity
+}
+
+// RetryAfterOf 获取错误中服务端要求的等待时间，未指定时返回 0
+func RetryAfterOf(err error) time.Duration {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.RetryAfter
+	}
+	return 0
+}
@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// DefaultProviderName 默认模型提供方的名称
+const DefaultProviderName = "default"
+
+// 熔断器默认配置
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// Route 一次模型调用的路由结果
+type Route struct {
+	Provider string          // 提供方名称
+	Client   LLMProvider     // 实际调用的提供方
+	Model    string          // 去掉提供方前缀后的模型名
+	Breaker  *CircuitBreaker // 提供方熔断器，可能为空
+}
+
+// ModelRouter 按模型名选择提供方
+type ModelRouter interface {
+	Route(model string) (*Route, error)
+}
+
+// DefaultRouter 可以替换默认提供方的模型路由
+// 包装 Router 的提供方 (如录制回放) 实现并转发该接口，用户自己的 API 密钥仍经过包装与熔断器
+type DefaultRouter interface {
+	ModelRouter
+	WithDefault(provider LLMProvider) LLMProvider
+}
+
+// Router 管理多个 OpenAI 兼容的模型提供方，并为每个提供方维护熔断器
+// 模型名形如 "local:qwen2.5" 时使用名为 local 的提供方，否则使用默认提供方
+// 提供方需在开始处理请求前注册完毕
+type Router struct {
+	providers map[string]LLMProvider
+	breakers  map[string]*CircuitBreaker
+}
+
+// NewRouter 创建模型路由，defaultProvider 可以为空 (此时只能使用其他已注册的提供方)
+func NewRouter(defaultProvider LLMProvider) *Router {
+	r := &Router{
+		providers: make(map[string]LLMProvider),
+		breakers:  make(map[string]*CircuitBreaker),
+	}
+	r.Register(DefaultProviderName, defaultProvider)
+	return r
+}
+
+// Register 注册提供方
+func (r *Router) Register(name string, provider LLMProvider) {
+	if provider != nil {
+		r.providers[name] = provider
+	}
+	if _, ok := r.breakers[name]; !ok {
+		r.breakers[name] = NewCircuitBreaker(defaultBreakerThreshold, defaultBreakerCooldown)
+	}
+}
+
+// WithDefault 返回替换了默认提供方的路由 (如使用用户自己的 API 密钥)
+// 新路由与原路由共享熔断器，同一服务不可用时对所有用户生效
+func (r *Router) WithDefault(provider LLMProvider) LLMProvider {
+	clone := &Router{
+		providers: make(map[string]LLMProvider, len(r.providers)),
+		breakers:  r.breakers,
+	}
+	for name, p := range r.providers {
+		clone.providers[name] = p
+	}
+	clone.providers[DefaultProviderName] = provider
+	return clone
+}
+
+// Route 根据模型名选择提供方
+func (r *Router) Route(model string) (*Route, error) {
+	name, modelName := DefaultProviderName, model
+	if prefix, rest, ok := strings.Cut(model, ":"); ok && prefix != DefaultProviderName {
+		if _, registered := r.breakers[prefix]; registered {
+			name, modelName = prefix, rest
+		}
+	}
+
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, ErrProviderNotConfigured
+	}
+	return &Route{
+		Provider: name,
+		Client:   provider,
+		Model:    modelName,
+		Breaker:  r.breakers[name],
+	}, nil
+}
+
+// BreakerStates 获取各提供方的熔断状态
+func (r *Router) BreakerStates() map[string]string {
+	states := make(map[string]string, len(r.breakers))
+	for name, breaker := range r.breakers {
+		states[name] = breaker.State()
+	}
+	return states
+}
+
+// CreateCompletion 实现 LLMProvider，按请求的模型选择提供方
+func (r *Router) CreateCompletion(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	route, err := r.Route(req.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	routed := *req
+	routed.Model = route.Model
+	return route.Client.CreateCompletion(ctx, &routed)
+}
+
+// CreateCompletionStream 实现 StreamingProvider，提供方不支持流式输出时整段输出
+func (r *Router) CreateCompletionStream(ctx context.Context, req *CompletionRequest, onDelta func(string)) (*CompletionResponse, error) {
+	route, err := r.Route(req.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	routed := *req
+	routed.Model = route.Model
+	if streaming, ok := route.Client.(StreamingProvider); ok {
+		return streaming.CreateCompletionStream(ctx, &routed, onDelta)
+	}
+
+	resp, err := route.Client.CreateCompletion(ctx, &routed)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Content != "" {
+		onDelta(resp.Content)
+	}
+	return resp, nil
+}
@@ -0,0 +1,176 @@
+// Package llm 定义Agent与模型提供方之间的接口与数据类型，以及模型路由与熔断
+// ai (引擎) 与 agents (Agent实现) 都依赖此包
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/zibianqu/novel-study/internal/ai/tools"
+)
+
+var (
+	// ErrNoStructuredOutput Agent没有声明输出 Schema
+	ErrNoStructuredOutput = errors.New("agent has no structured output")
+	// ErrInvalidStructuredOutput 模型多次修正后仍未输出符合 Schema 的 JSON
+	ErrInvalidStructuredOutput = errors.New("invalid structured output")
+)
+
+// Agent 接口定义
+type Agent interface {
+	Execute(ctx context.Context, req *AgentRequest) (*AgentResponse, error)
+	ExecuteStream(ctx context.Context, req *AgentRequest, callback func(string)) (*AgentResponse, error)
+	GetName() string
+	GetDescription() string
+}
+
+// AgentConfig Agent配置
+type AgentConfig struct {
+	AgentKey     string   `json:"agent_key"`
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	SystemPrompt string   `json:"system_prompt"`
+	Model        string   `json:"model"`
+	Temperature  float64  `json:"temperature"`
+	MaxTokens    int      `json:"max_tokens"`
+	Tools        []string `json:"tools"`
+	MaxToolSteps int      `json:"max_tool_steps"` // 单次执行最多的工具调用轮数, 0 使用默认值
+	// FallbackModels 主模型不可用时依次尝试的备用模型，"提供方:模型" 使用其他已注册的提供方
+	FallbackModels []string `json:"fallback_models"`
+	// OutputSchema 不为空时要求模型输出符合该 Schema 的 JSON 对象，不符合时要求模型修正
+	OutputSchema *tools.Schema `json:"output_schema,omitempty"`
+}
+
+// AgentRequest Agent请求
+type AgentRequest struct {
+	Prompt      string                 `json:"prompt"`
+	Context     map[string]interface{} `json:"context"` // 修复: string -> map
+	ProjectID   int                    `json:"project_id"`
+	UserID      int                    `json:"user_id"`
+	Metadata    map[string]interface{} `json:"metadata"`
+	MaxTokens   int                    `json:"max_tokens"`
+	Temperature float64                `json:"temperature"`
+	ActionType  string                 `json:"action_type,omitempty"` // 用于用量统计的操作类型，如 chat、generate_chapter
+	History     []ChatMessage          `json:"history,omitempty"`     // 之前的对话轮次 (user/assistant)，按时间顺序
+	// HistoryTokenBudget 回放历史消息的 Token 预算，0 使用默认值
+	HistoryTokenBudget int `json:"history_token_budget,omitempty"`
+	// SystemPrompt 由提示词模板渲染得到，非空时替代Agent配置中的系统提示词
+	SystemPrompt string `json:"-"`
+	// PromptTemplateVersionID 本次使用的模板版本，记录到 ai_interaction_logs
+	PromptTemplateVersionID int `json:"-"`
+	// RawOutput 忽略Agent声明的输出 Schema，按自由文本输出
+	RawOutput bool `json:"-"`
+	// ReadOnlyTools 禁用会修改项目数据的工具，请求内容疑似提示词注入时由引擎设置
+	ReadOnlyTools bool `json:"-"`
+}
+
+// AgentResponse Agent响应
+type AgentResponse struct {
+	Content    string                 `json:"content"`
+	TokensUsed int                    `json:"tokens_used"`
+	DurationMs int64                  `json:"duration_ms"`
+	Model      string                 `json:"model"` // 实际使用的模型
+	Usage      TokenUsage             `json:"usage"` // 所有模型调用轮次的累计用量
+	Metadata   map[string]interface{} `json:"metadata"`
+	// Structured Agent声明了输出 Schema 时为校验后的 JSON 对象，Content 为其规范化的 JSON 文本
+	Structured map[string]interface{} `json:"structured,omitempty"`
+}
+
+// DecodeStructured 将结构化输出解码为具体类型
+func (r *AgentResponse) DecodeStructured(v interface{}) error {
+	if r.Structured == nil {
+		return ErrNoStructuredOutput
+	}
+	data, err := json.Marshal(r.Structured)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// TokenEstimate 调用模型前的用量预估
+type TokenEstimate struct {
+	Model               string  `json:"model"`
+	Encoding            string  `json:"encoding"`              // cl100k_base / o200k_base
+	PromptTokens        int     `json:"prompt_tokens"`         // 首轮请求的输入 Token 数
+	MaxCompletionTokens int     `json:"max_completion_tokens"` // 输出 Token 上限
+	EstimatedCost       float64 `json:"estimated_cost"`        // 按输出上限计算的费用上限 (美元)
+	Exact               bool    `json:"exact"`                 // false 表示词表不可用，Token 数为估算值
+}
+
+// TokenEstimator 支持调用前预估用量的 Agent
+type TokenEstimator interface {
+	EstimateTokens(req *AgentRequest) *TokenEstimate
+}
+
+// ChatMessage 聊天消息
+type ChatMessage struct {
+	Role       string     `json:"role"` // "system", "user", "assistant", "tool"
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // assistant 请求的工具调用
+	ToolCallID string     `json:"tool_call_id,omitempty"` // tool 消息对应的调用 ID
+}
+
+// ToolCall 模型发起的工具调用
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // JSON 格式参数
+}
+
+// ToolDefinition 提供给模型的工具定义 (function calling)
+type ToolDefinition struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Parameters  interface{} `json:"parameters"` // JSON Schema
+}
+
+// LLMProvider 大模型提供方接口
+// Agent 通过该接口调用模型，便于切换 OpenAI 兼容服务或在测试中替换为本地服务
+type LLMProvider interface {
+	CreateCompletion(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error)
+}
+
+// StreamingProvider 支持流式输出的模型提供方
+// onDelta 按模型返回顺序接收文本增量，返回值为流结束后汇总的完整响应（含用量）
+type StreamingProvider interface {
+	CreateCompletionStream(ctx context.Context, req *CompletionRequest, onDelta func(string)) (*CompletionResponse, error)
+}
+
+// CompletionRequest 模型补全请求
+type CompletionRequest struct {
+	Model       string           `json:"model"`
+	Messages    []ChatMessage    `json:"messages"`
+	Temperature float64          `json:"temperature"`
+	MaxTokens   int              `json:"max_tokens"`
+	Tools       []ToolDefinition `json:"tools,omitempty"`
+	// ResponseFormat 为 ResponseFormatJSON 时要求模型只输出 JSON 对象
+	ResponseFormat string `json:"response_format,omitempty"`
+}
+
+// ResponseFormatJSON 要求模型输出 JSON 对象 (OpenAI json_object 模式)
+const ResponseFormatJSON = "json_object"
+
+// CompletionResponse 模型补全响应
+type CompletionResponse struct {
+	Content      string     `json:"content"`
+	Model        string     `json:"model"`
+	FinishReason string     `json:"finish_reason"`
+	ToolCalls    []ToolCall `json:"tool_calls,omitempty"`
+	Usage        TokenUsage `json:"usage"`
+}
+
+// TokenUsage Token 用量
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Add 累加 Token 用量
+func (u *TokenUsage) Add(other TokenUsage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
@@ -3,9 +3,12 @@ package openai
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"strings"
 
 	"github.com/sashabaranov/go-openai"
-	"github.com/zibianqu/novel-study/internal/ai"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
 )
 
 // Client OpenAI 客户端封装
@@ -15,107 +18,202 @@ type Client struct {
 
 // NewClient 创建 OpenAI 客户端
 func NewClient(apiKey string) *Client {
+	return NewClientWithBaseURL(apiKey, "")
+}
+
+// NewClientWithBaseURL 创建指向 OpenAI 兼容服务的客户端
+// baseURL 为空时使用 OpenAI 官方地址
+func NewClientWithBaseURL(apiKey, baseURL string) *Client {
 	if apiKey == "" {
 		return nil
 	}
+
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = baseURL
+	}
+	config.HTTPClient = &responseMetaDoer{doer: config.HTTPClient}
+
 	return &Client{
-		client: openai.NewClient(apiKey),
+		client: openai.NewClientWithConfig(config),
 	}
 }
 
-// ChatCompletion 聊天完成
-func (c *Client) ChatCompletion(ctx context.Context, messages []ai.ChatMessage, model string, temperature float64, maxTokens int) (*ai.AgentResponse, error) {
-	if c.client == nil {
-		return nil, errors.New("OpenAI client not initialized")
+// Verify 验证 API 密钥是否可用 (请求模型列表，不消耗 Token)
+func (c *Client) Verify(ctx context.Context) error {
+	if c == nil || c.client == nil {
+		return errors.New("OpenAI client not initialized")
 	}
 
-	// 转换消息格式
-	openaiMessages := make([]openai.ChatCompletionMessage, len(messages))
-	for i, msg := range messages {
-		openaiMessages[i] = openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
+	// 服务端返回的错误信息可能包含密钥片段，只保留状态码
+	_, err := c.client.ListModels(ctx)
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return fmt.Errorf("API key rejected (HTTP %d)", apiErr.HTTPStatusCode)
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return fmt.Errorf("API key rejected (HTTP %d)", reqErr.HTTPStatusCode)
+	}
+	return err
+}
+
+// CreateCompletion 实现 llm.LLMProvider
+func (c *Client) CreateCompletion(ctx context.Context, req *llm.CompletionRequest) (*llm.CompletionResponse, error) {
+	if c == nil || c.client == nil {
+		return nil, errors.New("OpenAI client not initialized")
 	}
 
-	// 调用 API
+	ctx, meta := withResponseMeta(ctx)
 	resp, err := c.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model:       model,
-		Messages:    openaiMessages,
-		Temperature: float32(temperature),
-		MaxTokens:   maxTokens,
-	})
+		Model:       req.Model,
+		Messages:    toOpenAIMessages(req.Messages),
+		Temperature: float32(req.Temperature),
+		MaxTokens:   req.MaxTokens,
+		Tools:       toOpenAITools(req.Tools),
 
+		ResponseFormat: toOpenAIResponseFormat(req.ResponseFormat),
+	})
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err, meta)
 	}
 
 	if len(resp.Choices) == 0 {
 		return nil, errors.New("no response from OpenAI")
 	}
 
-	return &ai.AgentResponse{
-		Content:    resp.Choices[0].Message.Content,
+	message := resp.Choices[0].Message
+
+	return &llm.CompletionResponse{
+		Content:      message.Content,
+		Model:        resp.Model,
+		FinishReason: string(resp.Choices[0].FinishReason),
+		ToolCalls:    fromOpenAIToolCalls(message.ToolCalls),
+		Usage: llm.TokenUsage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}, nil
+}
+
+// ChatCompletion 聊天完成
+func (c *Client) ChatCompletion(ctx context.Context, messages []llm.ChatMessage, model string, temperature float64, maxTokens int) (*llm.AgentResponse, error) {
+	resp, err := c.CreateCompletion(ctx, &llm.CompletionRequest{
+		Model:       model,
+		Messages:    messages,
+		Temperature: temperature,
+		MaxTokens:   maxTokens,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &llm.AgentResponse{
+		Content:    resp.Content,
 		TokensUsed: resp.Usage.TotalTokens,
 		Metadata: map[string]interface{}{
 			"model":             resp.Model,
-			"finish_reason":     resp.Choices[0].FinishReason,
+			"finish_reason":     resp.FinishReason,
 			"prompt_tokens":     resp.Usage.PromptTokens,
 			"completion_tokens": resp.Usage.CompletionTokens,
 		},
 	}, nil
 }
 
-// ChatCompletionStream 流式聊天完成
-func (c *Client) ChatCompletionStream(ctx context.Context, messages []ai.ChatMessage, model string, temperature float64, maxTokens int, callback func(string)) error {
-	if c.client == nil {
-		return errors.New("OpenAI client not initialized")
-	}
-
-	// 转换消息格式
-	openaiMessages := make([]openai.ChatCompletionMessage, len(messages))
-	for i, msg := range messages {
-		openaiMessages[i] = openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
+// CreateCompletionStream 实现 llm.StreamingProvider
+// 文本增量通过 onDelta 实时输出，工具调用按 index 拼接，流结束后返回汇总响应
+func (c *Client) CreateCompletionStream(ctx context.Context, req *llm.CompletionRequest, onDelta func(string)) (*llm.CompletionResponse, error) {
+	if c == nil || c.client == nil {
+		return nil, errors.New("OpenAI client not initialized")
 	}
 
-	// 创建流式请求
+	ctx, meta := withResponseMeta(ctx)
 	stream, err := c.client.CreateChatCompletionStream(ctx, openai.ChatCompletionRequest{
-		Model:       model,
-		Messages:    openaiMessages,
-		Temperature: float32(temperature),
-		MaxTokens:   maxTokens,
-		Stream:      true,
-	})
+		Model:         req.Model,
+		Messages:      toOpenAIMessages(req.Messages),
+		Temperature:   float32(req.Temperature),
+		MaxTokens:     req.MaxTokens,
+		Tools:         toOpenAITools(req.Tools),
+		Stream:        true,
+		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
 
+		ResponseFormat: toOpenAIResponseFormat(req.ResponseFormat),
+	})
 	if err != nil {
-		return err
+		return nil, wrapError(err, meta)
 	}
 	defer stream.Close()
 
-	// 接收流式响应
+	result := &llm.CompletionResponse{Model: req.Model}
+	var content strings.Builder
+	var toolCalls []llm.ToolCall
+
 	for {
-		response, err := stream.Recv()
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
 		if err != nil {
-			if err.Error() == "EOF" {
-				break
+			// 优先返回取消原因，便于调用方区分客户端断开与服务端错误
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
 			}
-			return err
+			return nil, fmt.Errorf("stream interrupted: %w", err)
 		}
 
-		if len(response.Choices) > 0 {
-			callback(response.Choices[0].Delta.Content)
+		if chunk.Model != "" {
+			result.Model = chunk.Model
 		}
+		// 开启 include_usage 后，用量在最后一个 choices 为空的分片中返回
+		if chunk.Usage != nil {
+			result.Usage = llm.TokenUsage{
+				PromptTokens:     chunk.Usage.PromptTokens,
+				CompletionTokens: chunk.Usage.CompletionTokens,
+				TotalTokens:      chunk.Usage.TotalTokens,
+			}
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		choice := chunk.Choices[0]
+		if choice.FinishReason != "" {
+			result.FinishReason = string(choice.FinishReason)
+		}
+		if choice.Delta.Content != "" {
+			content.WriteString(choice.Delta.Content)
+			if onDelta != nil {
+				onDelta(choice.Delta.Content)
+			}
+		}
+		toolCalls = mergeToolCallDeltas(toolCalls, choice.Delta.ToolCalls)
 	}
 
-	return nil
+	// 连接在模型给出结束原因前断开，视为错误而不是返回被截断的内容
+	if result.FinishReason == "" {
+		return nil, fmt.Errorf("stream interrupted: %w", io.ErrUnexpectedEOF)
+	}
+
+	result.Content = content.String()
+	result.ToolCalls = toolCalls
+	return result, nil
+}
+
+// ChatCompletionStream 流式聊天完成
+func (c *Client) ChatCompletionStream(ctx context.Context, messages []llm.ChatMessage, model string, temperature float64, maxTokens int, callback func(string)) error {
+	_, err := c.CreateCompletionStream(ctx, &llm.CompletionRequest{
+		Model:       model,
+		Messages:    messages,
+		Temperature: temperature,
+		MaxTokens:   maxTokens,
+	}, callback)
+	return err
 }
 
 // CreateEmbedding 创建向量嵌入
 func (c *Client) CreateEmbedding(ctx context.Context, texts []string) ([][]float32, error) {
-	if c.client == nil {
+	if c == nil || c.client == nil {
 		return nil, errors.New("OpenAI client not initialized")
 	}
 
@@ -141,3 +239,96 @@ func (c *Client) CreateEmbedding(ctx context.Context, texts []string) ([][]float
 
 	return embeddings, nil
 }
+
+// toOpenAIMessages 转换消息格式
+func toOpenAIMessages(messages []llm.ChatMessage) []openai.ChatCompletionMessage {
+	openaiMessages := make([]openai.ChatCompletionMessage, len(messages))
+	for i, msg := range messages {
+		openaiMessages[i] = openai.ChatCompletionMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			ToolCallID: msg.ToolCallID,
+		}
+
+		for _, call := range msg.ToolCalls {
+			openaiMessages[i].ToolCalls = append(openaiMessages[i].ToolCalls, openai.ToolCall{
+				ID:   call.ID,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      call.Name,
+					Arguments: call.Arguments,
+				},
+			})
+		}
+	}
+	return openaiMessages
+}
+
+// toOpenAIResponseFormat 转换输出格式要求，为空时不限制
+func toOpenAIResponseFormat(format string) *openai.ChatCompletionResponseFormat {
+	if format == "" {
+		return nil
+	}
+	return &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatType(format)}
+}
+
+// toOpenAITools 转换工具定义
+func toOpenAITools(definitions []llm.ToolDefinition) []openai.Tool {
+	if len(definitions) == 0 {
+		return nil
+	}
+
+	tools := make([]openai.Tool, len(definitions))
+	for i, def := range definitions {
+		tools[i] = openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        def.Name,
+				Description: def.Description,
+				Parameters:  def.Parameters,
+			},
+		}
+	}
+	return tools
+}
+
+// fromOpenAIToolCalls 转换模型返回的工具调用
+func fromOpenAIToolCalls(calls []openai.ToolCall) []llm.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	result := make([]llm.ToolCall, len(calls))
+	for i, call := range calls {
+		result[i] = llm.ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		}
+	}
+	return result
+}
+
+// mergeToolCallDeltas 将流式分片中的工具调用增量按 index 合并
+// 同一调用的 ID 与名称只在首个分片出现，参数 JSON 分散在后续分片中
+func mergeToolCallDeltas(calls []llm.ToolCall, deltas []openai.ToolCall) []llm.ToolCall {
+	for _, delta := range deltas {
+		index := len(calls)
+		if delta.Index != nil {
+			index = *delta.Index
+		}
+		for len(calls) <= index {
+			calls = append(calls, llm.ToolCall{})
+		}
+
+		call := &calls[index]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Function.Name != "" {
+			call.Name = delta.Function.Name
+		}
+		call.Arguments += delta.Function.Arguments
+	}
+	return calls
+}
@@ -0,0 +1,97 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+)
+
+type responseMetaKey struct{}
+
+// responseMeta 记录错误响应的头信息，go-openai 的错误类型不包含响应头
+type responseMeta struct {
+	retryAfter time.Duration
+}
+
+func withResponseMeta(ctx context.Context) (context.Context, *responseMeta) {
+	meta := &responseMeta{}
+	return context.WithValue(ctx, responseMetaKey{}, meta), meta
+}
+
+// responseMetaDoer 包装 HTTP 客户端，在请求失败时记录 Retry-After
+type responseMetaDoer struct {
+	doer openai.HTTPDoer
+}
+
+func (d *responseMetaDoer) Do(req *http.Request) (*http.Response, error) {
+	resp, err := d.doer.Do(req)
+	if err != nil || resp.StatusCode < http.StatusBadRequest {
+		return resp, err
+	}
+
+	if meta, ok := req.Context().Value(responseMetaKey{}).(*responseMeta); ok {
+		meta.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return resp, err
+}
+
+// parseRetryAfter 解析 Retry-After，支持秒数与 HTTP 日期两种格式
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// wrapError 将 go-openai 的错误转换为 llm.ProviderError，便于按状态码分类
+func wrapError(err error, meta *responseMeta) error {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return &llm.ProviderError{
+			StatusCode: apiErr.HTTPStatusCode,
+			Code:       errorCode(apiErr),
+			RetryAfter: meta.retryAfter,
+			Err:        err,
+		}
+	}
+
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return &llm.ProviderError{
+			StatusCode: reqErr.HTTPStatusCode,
+			RetryAfter: meta.retryAfter,
+			Err:        err,
+		}
+	}
+
+	return err
+}
+
+// errorCode 获取错误码，兼容 code 为空时使用 type 的服务
+func errorCode(apiErr *openai.APIError) string {
+	switch code := apiErr.Code.(type) {
+	case string:
+		if code != "" {
+			return code
+		}
+	case nil:
+	default:
+		return fmt.Sprint(code)
+	}
+	return apiErr.Type
+}
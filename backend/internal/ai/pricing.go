@@ -0,0 +1,53 @@
+package ai
+
+import (
+	"strings"
+
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+)
+
+// ModelPrice 模型单价 (美元 / 1K tokens)
+type ModelPrice struct {
+	InputPer1K  float64
+	OutputPer1K float64
+}
+
+// modelPrices 常用模型单价，带日期后缀的模型版本按最长前缀匹配
+var modelPrices = map[string]ModelPrice{
+	"gpt-4o-mini":   {InputPer1K: 0.00015, OutputPer1K: 0.0006},
+	"gpt-4o":        {InputPer1K: 0.0025, OutputPer1K: 0.01},
+	"gpt-4.1-nano":  {InputPer1K: 0.0001, OutputPer1K: 0.0004},
+	"gpt-4.1-mini":  {InputPer1K: 0.0004, OutputPer1K: 0.0016},
+	"gpt-4.1":       {InputPer1K: 0.002, OutputPer1K: 0.008},
+	"gpt-4-turbo":   {InputPer1K: 0.01, OutputPer1K: 0.03},
+	"gpt-4":         {InputPer1K: 0.03, OutputPer1K: 0.06},
+	"gpt-3.5-turbo": {InputPer1K: 0.0005, OutputPer1K: 0.0015},
+}
+
+// fallbackModelPrice 未知模型按较高的单价估算，避免绕过费用预算
+var fallbackModelPrice = ModelPrice{InputPer1K: 0.01, OutputPer1K: 0.03}
+
+// PriceOf 获取模型单价
+func PriceOf(model string) ModelPrice {
+	if price, ok := modelPrices[model]; ok {
+		return price
+	}
+
+	matched := ""
+	for name := range modelPrices {
+		if strings.HasPrefix(model, name) && len(name) > len(matched) {
+			matched = name
+		}
+	}
+	if matched != "" {
+		return modelPrices[matched]
+	}
+	return fallbackModelPrice
+}
+
+// EstimateCost 按模型单价估算一次调用的费用 (美元)
+func EstimateCost(model string, usage llm.TokenUsage) float64 {
+	price := PriceOf(model)
+	return float64(usage.PromptTokens)/1000*price.InputPer1K +
+		float64(usage.CompletionTokens)/1000*price.OutputPer1K
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/zibianqu/novel-study/internal/ai/guard"
+	"github.com/zibianqu/novel-study/internal/ai/tokenizer"
 )
 
 // Section Prompt 片段
@@ -13,15 +16,18 @@ type Section struct {
 	Content  string // 片段内容
 	Priority int    // 优先级 (数字越大越重要)
 	Tokens   int    // Token 数量估算
+	UserData bool   // 内容由用户提供，组装时包装为数据块
 }
 
 // PromptBuilder Prompt 构建器
 type PromptBuilder struct {
-	sections      []*Section
-	maxTokens     int
-	systemPrompt  string
-	userPrompt    string
-	tokenCounter  TokenCounter
+	sections     []*Section
+	maxTokens    int
+	systemPrompt string
+	userPrompt   string
+	tokenCounter TokenCounter
+	summarizer   Summarizer
+	summaryCache *ContextCache
 }
 
 // TokenCounter Token 计数接口
@@ -30,6 +36,7 @@ type TokenCounter interface {
 }
 
 // SimpleTokenCounter 简单的 Token 计数器 (1 token ≈ 4 字符)
+// 中英文混排时误差较大，预算计算请使用 CounterForModel
 type SimpleTokenCounter struct{}
 
 func (c *SimpleTokenCounter) Count(text string) int {
@@ -38,13 +45,32 @@ func (c *SimpleTokenCounter) Count(text string) int {
 	return (runeCount*2 + 2) / 3 // 粗略估算
 }
 
-// NewPromptBuilder 创建 Prompt 构建器
+// CounterForModel 返回模型对应的 BPE 计数器 (cl100k_base / o200k_base)
+func CounterForModel(model string) TokenCounter {
+	return tokenizer.ForModel(model)
+}
+
+// NewPromptBuilder 创建 Prompt 构建器，使用默认编码计数
 func NewPromptBuilder(maxTokens int) *PromptBuilder {
+	return NewPromptBuilderForModel(maxTokens, "")
+}
+
+// NewPromptBuilderForModel 创建按目标模型分词计数的 Prompt 构建器
+func NewPromptBuilderForModel(maxTokens int, model string) *PromptBuilder {
 	return &PromptBuilder{
 		sections:     make([]*Section, 0),
 		maxTokens:    maxTokens,
-		tokenCounter: &SimpleTokenCounter{},
+		tokenCounter: CounterForModel(model),
+	}
+}
+
+// SetTokenCounter 替换 Token 计数器，并重新计算已添加片段的 Token 数
+func (pb *PromptBuilder) SetTokenCounter(counter TokenCounter) *PromptBuilder {
+	pb.tokenCounter = counter
+	for _, section := range pb.sections {
+		section.Tokens = counter.Count(section.Content)
 	}
+	return pb
 }
 
 // SetSystemPrompt 设置系统提示词
@@ -75,6 +101,15 @@ func (pb *PromptBuilder) AddSection(name string, content string, priority int) *
 	return pb
 }
 
+// AddUserSection 添加用户提供的片段 (章节正文、知识条目等)，组装时包装为数据块，防止其中的文字被当作指令
+func (pb *PromptBuilder) AddUserSection(name string, content string, priority int) *PromptBuilder {
+	pb.AddSection(name, content, priority)
+	if content != "" {
+		pb.sections[len(pb.sections)-1].UserData = true
+	}
+	return pb
+}
+
 // AddProjectContext 添加项目上下文
 func (pb *PromptBuilder) AddProjectContext(ctx context.Context, projectID int, projectInfo map[string]interface{}) *PromptBuilder {
 	if projectInfo == nil {
@@ -145,7 +180,34 @@ func (pb *PromptBuilder) AddRecentContent(content string, maxLength int) *Prompt
 	builder.WriteString(content)
 	builder.WriteString("\n")
 
-	return pb.AddSection("recent_content", builder.String(), 9)
+	return pb.AddUserSection("recent_content", builder.String(), 9)
+}
+
+// AddChapterSummaries 添加前几章的摘要，按章节顺序排列
+func (pb *PromptBuilder) AddChapterSummaries(summaries []StorySummary) *PromptBuilder {
+	lines := formatStorySummaries(summaries)
+	if lines == "" {
+		return pb
+	}
+	return pb.AddSection("chapter_summaries", "### 前情提要\n"+lines, 8)
+}
+
+// AddVolumeSummaries 添加项目与卷级摘要，作为更早剧情的长期记忆
+func (pb *PromptBuilder) AddVolumeSummaries(projectSummary string, summaries []StorySummary) *PromptBuilder {
+	lines := formatStorySummaries(summaries)
+	if projectSummary == "" && lines == "" {
+		return pb
+	}
+
+	var content strings.Builder
+	content.WriteString("### 故事梗概\n")
+	if projectSummary != "" {
+		content.WriteString(projectSummary)
+		content.WriteString("\n")
+	}
+	content.WriteString(lines)
+
+	return pb.AddSection("volume_summaries", content.String(), 7)
 }
 
 // AddKnowledgeBase 添加知识库内容
@@ -160,7 +222,7 @@ func (pb *PromptBuilder) AddKnowledgeBase(items []string, category string) *Prom
 		content.WriteString(fmt.Sprintf("%d. %s\n", i+1, item))
 	}
 
-	return pb.AddSection(fmt.Sprintf("knowledge_%s", category), content.String(), 6)
+	return pb.AddUserSection(fmt.Sprintf("knowledge_%s", category), content.String(), 6)
 }
 
 // AddStorylineContext 添加三线信息
@@ -239,25 +301,54 @@ func (pb *PromptBuilder) AddMetadata() *PromptBuilder {
 
 // Build 构建最终 Prompt
 func (pb *PromptBuilder) Build() string {
+	result, _ := pb.BuildWithReport(context.Background())
+	return result
+}
+
+// BuildWithReport 构建最终 Prompt，并返回每个片段是原文保留、压缩为摘要、截断还是被丢弃
+func (pb *PromptBuilder) BuildWithReport(ctx context.Context) (string, *BuildReport) {
+	selectedSections, report := pb.selectWithReport(ctx)
+
+	// 组装最终 prompt
+	result := pb.assembleFinalPrompt(selectedSections)
+	report.TotalTokens = pb.tokenCounter.Count(result)
+	return result, report
+}
+
+// BuildMessages 与 BuildWithReport 的预算处理相同，但将系统提示词与其余部分 (片段与用户提示词) 分开返回
+func (pb *PromptBuilder) BuildMessages(ctx context.Context) (string, string, *BuildReport) {
+	selectedSections, report := pb.selectWithReport(ctx)
+
+	report.TotalTokens = pb.tokenCounter.Count(pb.assembleFinalPrompt(selectedSections))
+	return pb.systemPrompt, pb.assembleBody(selectedSections), report
+}
+
+// selectWithReport 在预算内选择片段，必要时压缩或截断
+func (pb *PromptBuilder) selectWithReport(ctx context.Context) ([]*Section, *BuildReport) {
 	// 计算固定部分的 token
 	systemTokens := pb.tokenCounter.Count(pb.systemPrompt)
 	userTokens := pb.tokenCounter.Count(pb.userPrompt)
 	fixedTokens := systemTokens + userTokens
 
-	// 可用于动态内容的 token
-	availableTokens := pb.maxTokens - fixedTokens
+	// 可用于动态内容的 token，扣除数据块标记占用的部分
+	availableTokens := pb.maxTokens - fixedTokens - pb.userDataTokens()
 	if availableTokens < 0 {
 		availableTokens = pb.maxTokens / 2 // 至少保留一半给动态内容
 	}
 
 	// 按优先级排序片段
 	sortedSections := pb.sortSectionsByPriority()
+	report := newBuildReport(pb.maxTokens, sortedSections)
+
+	// 超出预算时优先压缩低优先级片段
+	if pb.summarizer != nil {
+		sortedSections = pb.summarizeSections(ctx, sortedSections, availableTokens, report)
+	}
 
 	// 选择片段直到达到 token 限制
 	selectedSections := pb.selectSections(sortedSections, availableTokens)
-
-	// 组装最终 prompt
-	return pb.assembleFinalPrompt(selectedSections)
+	report.recordSelection(sortedSections, selectedSections)
+	return selectedSections, report
 }
 
 // sortSectionsByPriority 按优先级排序
@@ -301,38 +392,48 @@ func (pb *PromptBuilder) selectSections(sections []*Section, maxTokens int) []*S
 	return selected
 }
 
-// truncateSection 截断片段
+// truncateSection 截断片段，二分查找能放入 maxTokens 的最长前缀
 func (pb *PromptBuilder) truncateSection(section *Section, maxTokens int) *Section {
-	// 粗略估算需要保留的字符数
-	targetChars := maxTokens * 3 / 2
-	runes := []rune(section.Content)
+	if section.Tokens <= maxTokens {
+		return section
+	}
 
-	if len(runes) > targetChars {
-		runes = runes[:targetChars]
-		return &Section{
-			Name:     section.Name,
-			Content:  string(runes) + "...\n",
-			Priority: section.Priority,
-			Tokens:   maxTokens,
+	runes := []rune(section.Content)
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if pb.tokenCounter.Count(string(runes[:mid])+"...\n") <= maxTokens {
+			lo = mid
+		} else {
+			hi = mid - 1
 		}
 	}
 
-	return section
+	content := string(runes[:lo]) + "...\n"
+	return &Section{
+		Name:     section.Name,
+		Content:  content,
+		Priority: section.Priority,
+		Tokens:   pb.tokenCounter.Count(content),
+		UserData: section.UserData,
+	}
 }
 
 // assembleFinalPrompt 组装最终 prompt
 func (pb *PromptBuilder) assembleFinalPrompt(sections []*Section) string {
-	var builder strings.Builder
-
-	// 系统提示词
-	if pb.systemPrompt != "" {
-		builder.WriteString(pb.systemPrompt)
-		builder.WriteString("\n\n")
+	if pb.systemPrompt == "" {
+		return pb.assembleBody(sections)
 	}
+	return pb.systemPrompt + "\n\n" + pb.assembleBody(sections)
+}
+
+// assembleBody 组装系统提示词之后的部分：动态片段与用户提示词
+func (pb *PromptBuilder) assembleBody(sections []*Section) string {
+	var builder strings.Builder
 
 	// 动态片段
 	for _, section := range sections {
-		builder.WriteString(section.Content)
+		builder.WriteString(sectionText(section))
 		builder.WriteString("\n")
 	}
 
@@ -345,6 +446,40 @@ func (pb *PromptBuilder) assembleFinalPrompt(sections []*Section) string {
 	return builder.String()
 }
 
+// sectionText 片段的最终文本，用户提供的片段保留 "### 标题" 行，其余内容包装为数据块
+func sectionText(section *Section) string {
+	if !section.UserData {
+		return section.Content
+	}
+	heading, body := splitHeading(section.Content)
+	block := guard.WrapUserContent(section.Name, strings.TrimRight(body, "\n")) + "\n"
+	if heading == "" {
+		return block
+	}
+	return heading + "\n" + block
+}
+
+// splitHeading 拆分片段开头的 "### 标题" 行
+func splitHeading(content string) (string, string) {
+	if strings.HasPrefix(content, "### ") {
+		if idx := strings.Index(content, "\n"); idx >= 0 {
+			return content[:idx], content[idx+1:]
+		}
+	}
+	return "", content
+}
+
+// userDataTokens 数据块标记占用的 Token 数
+func (pb *PromptBuilder) userDataTokens() int {
+	total := 0
+	for _, section := range pb.sections {
+		if section.UserData {
+			total += pb.tokenCounter.Count(guard.WrapUserContent(section.Name, " "))
+		}
+	}
+	return total
+}
+
 // GetEstimatedTokens 获取预估的总 token 数
 func (pb *PromptBuilder) GetEstimatedTokens() int {
 	total := pb.tokenCounter.Count(pb.systemPrompt) + pb.tokenCounter.Count(pb.userPrompt)
@@ -362,3 +497,20 @@ func (pb *PromptBuilder) GetSectionsSummary() map[string]int {
 	}
 	return summary
 }
+
+// StorySummary 章节或卷的摘要
+type StorySummary struct {
+	Title   string
+	Summary string
+}
+
+func formatStorySummaries(summaries []StorySummary) string {
+	var content strings.Builder
+	for _, s := range summaries {
+		if s.Summary == "" {
+			continue
+		}
+		content.WriteString(fmt.Sprintf("**%s**: %s\n", s.Title, s.Summary))
+	}
+	return content.String()
+}
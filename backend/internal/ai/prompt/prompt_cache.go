@@ -1,6 +1,8 @@
 package prompt
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"sync"
 	"time"
 )
@@ -156,6 +158,7 @@ type ContextCache struct {
 	projectCache   *PromptCache
 	characterCache *PromptCache
 	knowledgeCache *PromptCache
+	summaryCache   *PromptCache
 }
 
 // NewContextCache 创建上下文缓存管理器
@@ -164,6 +167,7 @@ func NewContextCache() *ContextCache {
 		projectCache:   NewPromptCache(100, 30*time.Minute),
 		characterCache: NewPromptCache(200, 1*time.Hour),
 		knowledgeCache: NewPromptCache(500, 2*time.Hour),
+		summaryCache:   NewPromptCache(500, 24*time.Hour),
 	}
 }
 
@@ -203,6 +207,18 @@ func (cc *ContextCache) SetKnowledgeContent(agentID int, category string, conten
 	cc.knowledgeCache.Set(key, content, tokens)
 }
 
+// GetSectionSummary 获取片段摘要，按原文内容与目标长度索引
+func (cc *ContextCache) GetSectionSummary(content string, maxTokens int) (string, bool) {
+	key := formatSummaryKey(content, maxTokens)
+	return cc.summaryCache.Get(key)
+}
+
+// SetSectionSummary 设置片段摘要
+func (cc *ContextCache) SetSectionSummary(content string, maxTokens int, summary string, tokens int) {
+	key := formatSummaryKey(content, maxTokens)
+	cc.summaryCache.Set(key, summary, tokens)
+}
+
 // InvalidateProject 失效项目缓存
 func (cc *ContextCache) InvalidateProject(projectID int) {
 	key := formatProjectKey(projectID)
@@ -215,6 +231,7 @@ func (cc *ContextCache) GetAllStats() map[string]interface{} {
 		"project":   cc.projectCache.GetStats(),
 		"character": cc.characterCache.GetStats(),
 		"knowledge": cc.knowledgeCache.GetStats(),
+		"summary":   cc.summaryCache.GetStats(),
 	}
 }
 
@@ -232,4 +249,6 @@ func formatKnowledgeKey(agentID int, category string) string {
 	return fmt.Sprintf("knowledge:%d:%s", agentID, category)
 }
 
-import "fmt"
+func formatSummaryKey(content string, maxTokens int) string {
+	return fmt.Sprintf("summary:%x:%d", sha256.Sum256([]byte(content)), maxTokens)
+}
@@ -0,0 +1,97 @@
+package prompt
+
+import (
+	"context"
+
+	"github.com/zibianqu/novel-study/internal/ai/guard"
+)
+
+// InspectedMessage 发送给模型的一条消息
+type InspectedMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	Tokens  int    `json:"tokens"`
+}
+
+// InjectedDocument 注入 Prompt 的 RAG 文档
+type InjectedDocument struct {
+	ID       int                    `json:"id"`
+	Content  string                 `json:"content"`
+	Score    float64                `json:"score"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// PromptInspection Prompt 调试信息：模型将收到的消息与各片段的处理情况，不调用模型
+type PromptInspection struct {
+	Messages   []InspectedMessage `json:"messages"`
+	Sections   map[string]int     `json:"sections"` // 各片段原始 Token 数
+	Report     *BuildReport       `json:"report"`
+	Dropped    []string           `json:"dropped"`
+	Truncated  []string           `json:"truncated"`
+	Summarized []string           `json:"summarized"`
+	Documents  []InjectedDocument `json:"documents"`
+}
+
+// MessageBuilder 将组装好的用户 Prompt 转换为发送给模型的消息，与Agent执行时使用同一实现
+// (系统提示词模板、输出 Schema 说明、数据块说明与上下文数据块)，返回的消息不需要填写 Tokens
+type MessageBuilder func(userPrompt string) ([]InspectedMessage, error)
+
+// InspectAgentPrompt 与 BuildAgentPrompt 相同的方式构建 Prompt，拆分为系统消息与用户消息返回
+// messages 不为空时由它根据组装好的用户 Prompt 生成消息，否则按系统提示词与用户 Prompt 直接拆分
+func (ps *PromptService) InspectAgentPrompt(
+	ctx context.Context,
+	agentSystemPrompt string,
+	userPrompt string,
+	options *PromptOptions,
+	messages MessageBuilder,
+) (*PromptInspection, error) {
+	builder := ps.newAgentPromptBuilder(ctx, agentSystemPrompt, userPrompt, options)
+	sections := builder.GetSectionsSummary()
+	system, user, report := builder.BuildMessages(ctx)
+
+	inspection := &PromptInspection{
+		Sections:   sections,
+		Report:     report,
+		Dropped:    report.withStatus(SectionDropped),
+		Truncated:  report.withStatus(SectionTruncated),
+		Summarized: report.withStatus(SectionSummarized),
+		Documents:  []InjectedDocument{},
+	}
+
+	if messages != nil {
+		built, err := messages(user)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range built {
+			msg.Tokens = builder.tokenCounter.Count(msg.Content)
+			inspection.Messages = append(inspection.Messages, msg)
+		}
+		return inspection, nil
+	}
+
+	if system != "" {
+		// 与Agent发送时一致：包含用户数据块时追加数据块说明
+		if guard.ContainsDataBlock(user) {
+			system += guard.DataBlockInstruction
+		}
+		inspection.Messages = append(inspection.Messages, InspectedMessage{
+			Role: "system", Content: system, Tokens: builder.tokenCounter.Count(system),
+		})
+	}
+	inspection.Messages = append(inspection.Messages, InspectedMessage{
+		Role: "user", Content: user, Tokens: builder.tokenCounter.Count(user),
+	})
+	return inspection, nil
+}
+
+// withStatus 返回处于指定状态的片段名称
+func (r *BuildReport) withStatus(status string) []string {
+	names := []string{}
+	for _, section := range r.Sections {
+		if section.Status == status {
+			names = append(names, section.Name)
+		}
+	}
+	return names
+}
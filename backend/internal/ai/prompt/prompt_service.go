@@ -3,6 +3,9 @@ package prompt
 import (
 	"context"
 	"fmt"
+	"unicode/utf8"
+
+	"github.com/zibianqu/novel-study/internal/ai/guard"
 )
 
 // PromptService Prompt 服务
@@ -28,7 +31,33 @@ func (ps *PromptService) BuildAgentPrompt(
 	userPrompt string,
 	options *PromptOptions,
 ) (string, error) {
-	builder := NewPromptBuilder(ps.maxTokens)
+	result, _, err := ps.BuildAgentPromptWithReport(ctx, agentSystemPrompt, userPrompt, options)
+	return result, err
+}
+
+// BuildAgentPromptWithReport 构建 Agent Prompt，并返回各片段的处理情况
+func (ps *PromptService) BuildAgentPromptWithReport(
+	ctx context.Context,
+	agentSystemPrompt string,
+	userPrompt string,
+	options *PromptOptions,
+) (string, *BuildReport, error) {
+	result, report := ps.newAgentPromptBuilder(ctx, agentSystemPrompt, userPrompt, options).BuildWithReport(ctx)
+	return result, report, nil
+}
+
+// newAgentPromptBuilder 按选项添加各片段，返回尚未构建的 PromptBuilder
+func (ps *PromptService) newAgentPromptBuilder(
+	ctx context.Context,
+	agentSystemPrompt string,
+	userPrompt string,
+	options *PromptOptions,
+) *PromptBuilder {
+	builder := NewPromptBuilderForModel(ps.maxTokens, options.Model)
+	// 摘要器按请求传入 (摘要Agent的用量计入请求的用户与项目)，摘要缓存在共享的 ContextCache 中
+	if options.Summarizer != nil {
+		builder.SetSummarizer(options.Summarizer, ps.cache)
+	}
 
 	// 设置基本 prompt
 	builder.SetSystemPrompt(agentSystemPrompt)
@@ -53,6 +82,14 @@ func (ps *PromptService) BuildAgentPrompt(
 		builder.AddRecentContent(options.RecentContent, maxLen)
 	}
 
+	// 添加长期记忆：前几章摘要与卷级摘要
+	if len(options.ChapterSummaries) > 0 {
+		builder.AddChapterSummaries(options.ChapterSummaries)
+	}
+	if options.ProjectSummary != "" || len(options.VolumeSummaries) > 0 {
+		builder.AddVolumeSummaries(options.ProjectSummary, options.VolumeSummaries)
+	}
+
 	// 添加知识库内容
 	if len(options.KnowledgeItems) > 0 {
 		for category, items := range options.KnowledgeItems {
@@ -80,7 +117,7 @@ func (ps *PromptService) BuildAgentPrompt(
 		builder.AddMetadata()
 	}
 
-	return builder.Build(), nil
+	return builder
 }
 
 // BuildContinueWritePrompt 构建续写 Prompt
@@ -89,15 +126,25 @@ func (ps *PromptService) BuildContinueWritePrompt(
 	agentSystemPrompt string,
 	options *ContinueWriteOptions,
 ) (string, error) {
+	recentMaxLen := 2000
+	if options.FullContext {
+		recentMaxLen = utf8.RuneCountInString(options.Context)
+	}
+
 	promptOptions := &PromptOptions{
-		ProjectID:            options.ProjectID,
-		ProjectInfo:          options.ProjectInfo,
-		ChapterInfo:          options.ChapterInfo,
-		RecentContent:        options.Context,
-		RecentContentMaxLen:  2000,
-		Storylines:           options.Storylines,
-		Characters:           options.Characters,
-		IncludeMetadata:      true,
+		Model:               options.Model,
+		ProjectID:           options.ProjectID,
+		ProjectInfo:         options.ProjectInfo,
+		ChapterInfo:         options.ChapterInfo,
+		RecentContent:       options.Context,
+		RecentContentMaxLen: recentMaxLen,
+		ChapterSummaries:    options.ChapterSummaries,
+		VolumeSummaries:     options.VolumeSummaries,
+		ProjectSummary:      options.ProjectSummary,
+		Storylines:          options.Storylines,
+		Characters:          options.Characters,
+		IncludeMetadata:     true,
+		Summarizer:          options.Summarizer,
 	}
 
 	// 构建用户 Prompt
@@ -109,7 +156,7 @@ func (ps *PromptService) BuildContinueWritePrompt(
 		userPrompt += fmt.Sprintf("，风格要求：%s", options.Style)
 	}
 	if options.CustomPrompt != "" {
-		userPrompt += "\n" + options.CustomPrompt
+		userPrompt += "\n附加要求：\n" + guard.WrapUserContent("custom_prompt", options.CustomPrompt)
 	}
 	userPrompt += "\n\n请开始续写："
 
@@ -123,6 +170,7 @@ func (ps *PromptService) BuildPolishPrompt(
 	options *PolishOptions,
 ) (string, error) {
 	promptOptions := &PromptOptions{
+		Model:           options.Model,
 		ProjectID:       options.ProjectID,
 		ProjectInfo:     options.ProjectInfo,
 		IncludeMetadata: false,
@@ -130,7 +178,7 @@ func (ps *PromptService) BuildPolishPrompt(
 
 	// 构建用户 Prompt
 	userPrompt := "请对以下内容进行润色：\n\n"
-	userPrompt += options.Content + "\n\n"
+	userPrompt += guard.WrapUserContent("content", options.Content) + "\n\n"
 
 	switch options.PolishType {
 	case "grammar":
@@ -144,7 +192,7 @@ func (ps *PromptService) BuildPolishPrompt(
 	}
 
 	if options.CustomPrompt != "" {
-		userPrompt += options.CustomPrompt + "\n"
+		userPrompt += "附加要求：\n" + guard.WrapUserContent("custom_prompt", options.CustomPrompt) + "\n"
 	}
 
 	userPrompt += "\n请输出润色后的内容："
@@ -164,33 +212,45 @@ func (ps *PromptService) GetCacheStats() map[string]interface{} {
 
 // PromptOptions Prompt 构建选项
 type PromptOptions struct {
-	ProjectID            int
-	ProjectInfo          map[string]interface{}
-	ChapterInfo          map[string]interface{}
-	RecentContent        string
-	RecentContentMaxLen  int
-	KnowledgeItems       map[string][]string // category -> items
-	Storylines           map[string]interface{}
-	Characters           []map[string]interface{}
-	WritingGuidelines    string
-	IncludeMetadata      bool
+	Model               string // 目标模型，决定 Token 计数使用的编码
+	ProjectID           int
+	ProjectInfo         map[string]interface{}
+	ChapterInfo         map[string]interface{}
+	RecentContent       string
+	RecentContentMaxLen int
+	ChapterSummaries    []StorySummary      // 前几章摘要，按章节顺序
+	VolumeSummaries     []StorySummary      // 之前各卷的摘要
+	ProjectSummary      string              // 项目整体摘要
+	KnowledgeItems      map[string][]string // category -> items
+	Storylines          map[string]interface{}
+	Characters          []map[string]interface{}
+	WritingGuidelines   string
+	IncludeMetadata     bool
+	Summarizer          Summarizer // 超出预算时压缩低优先级片段，为空时截断
 }
 
 // ContinueWriteOptions 续写选项
 type ContinueWriteOptions struct {
-	ProjectID    int
-	ProjectInfo  map[string]interface{}
-	ChapterInfo  map[string]interface{}
-	Context      string // 上下文内容
-	Length       int
-	Style        string
-	CustomPrompt string
-	Storylines   map[string]interface{}
-	Characters   []map[string]interface{}
+	Model            string
+	ProjectID        int
+	ProjectInfo      map[string]interface{}
+	ChapterInfo      map[string]interface{}
+	Context          string         // 上下文内容
+	FullContext      bool           // Context 为完整的最近一章时不再只截取末尾
+	ChapterSummaries []StorySummary // 前几章摘要
+	VolumeSummaries  []StorySummary // 之前各卷的摘要
+	ProjectSummary   string
+	Length           int
+	Style            string
+	CustomPrompt     string
+	Storylines       map[string]interface{}
+	Characters       []map[string]interface{}
+	Summarizer       Summarizer // 超出预算时压缩低优先级片段，为空时截断
 }
 
 // PolishOptions 润色选项
 type PolishOptions struct {
+	Model        string
 	ProjectID    int
 	ProjectInfo  map[string]interface{}
 	Content      string
@@ -0,0 +1,172 @@
+package prompt
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Summarizer 将过长的片段压缩为摘要
+type Summarizer interface {
+	Summarize(ctx context.Context, content string, maxTokens int) (string, error)
+}
+
+// 片段在最终 Prompt 中的处理方式
+const (
+	SectionVerbatim   = "verbatim"   // 原文保留
+	SectionSummarized = "summarized" // 压缩为摘要
+	SectionTruncated  = "truncated"  // 截断
+	SectionDropped    = "dropped"    // 预算不足被丢弃
+)
+
+const (
+	// minSummarizeTokens 小于该值的片段不值得压缩
+	minSummarizeTokens = 200
+	// summaryCompressionRatio 摘要长度约为原文的 1/4
+	summaryCompressionRatio = 4
+)
+
+// SectionReport 单个片段的处理结果
+type SectionReport struct {
+	Name           string `json:"name"`
+	Priority       int    `json:"priority"`
+	Status         string `json:"status"`
+	OriginalTokens int    `json:"original_tokens"`
+	Tokens         int    `json:"tokens"`           // 处理后的 Token 数，丢弃时为 0
+	Cached         bool   `json:"cached,omitempty"` // 摘要来自缓存
+}
+
+// BuildReport Prompt 构建报告
+type BuildReport struct {
+	MaxTokens   int              `json:"max_tokens"`
+	TotalTokens int              `json:"total_tokens"`
+	Sections    []*SectionReport `json:"sections"` // 按优先级从高到低
+}
+
+// Summarized 返回被压缩为摘要的片段名称
+func (r *BuildReport) Summarized() []string {
+	var names []string
+	for _, section := range r.Sections {
+		if section.Status == SectionSummarized {
+			names = append(names, section.Name)
+		}
+	}
+	return names
+}
+
+// SetSummarizer 设置超出预算时使用的摘要器，cache 为空时不缓存摘要
+// 未设置摘要器时超出预算的片段直接截断
+func (pb *PromptBuilder) SetSummarizer(summarizer Summarizer, cache *ContextCache) *PromptBuilder {
+	pb.summarizer = summarizer
+	pb.summaryCache = cache
+	return pb
+}
+
+// summarizeSections 总量超出预算时从优先级最低的片段开始逐个压缩，直到放得下为止
+// 压缩失败的片段保持原样，交给 selectSections 截断
+func (pb *PromptBuilder) summarizeSections(ctx context.Context, sections []*Section, maxTokens int, report *BuildReport) []*Section {
+	total := 0
+	for _, section := range sections {
+		total += section.Tokens
+	}
+
+	result := make([]*Section, len(sections))
+	copy(result, sections)
+
+	for i := len(result) - 1; i >= 0 && total > maxTokens; i-- {
+		section := result[i]
+		if section.Tokens < minSummarizeTokens {
+			continue
+		}
+
+		summary, cached, err := pb.summarizeSection(ctx, section, section.Tokens/summaryCompressionRatio)
+		if err != nil {
+			log.Printf("⚠️ 压缩片段 %s 失败，改为截断: %v", section.Name, err)
+			continue
+		}
+
+		tokens := pb.tokenCounter.Count(summary)
+		if tokens >= section.Tokens {
+			continue
+		}
+
+		total -= section.Tokens - tokens
+		result[i] = &Section{
+			Name:     section.Name,
+			Content:  summary,
+			Priority: section.Priority,
+			Tokens:   tokens,
+			UserData: section.UserData,
+		}
+		report.Sections[i].Status = SectionSummarized
+		report.Sections[i].Cached = cached
+	}
+
+	return result
+}
+
+// summarizeSection 压缩单个片段，保留 "### 标题" 行并标注为摘要
+func (pb *PromptBuilder) summarizeSection(ctx context.Context, section *Section, maxTokens int) (string, bool, error) {
+	heading, body := splitHeading(section.Content)
+
+	if pb.summaryCache != nil {
+		if summary, ok := pb.summaryCache.GetSectionSummary(body, maxTokens); ok {
+			return formatSummary(heading, summary), true, nil
+		}
+	}
+
+	summary, err := pb.summarizer.Summarize(ctx, body, maxTokens)
+	if err != nil {
+		return "", false, err
+	}
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return "", false, fmt.Errorf("empty summary")
+	}
+
+	if pb.summaryCache != nil {
+		pb.summaryCache.SetSectionSummary(body, maxTokens, summary, pb.tokenCounter.Count(summary))
+	}
+	return formatSummary(heading, summary), false, nil
+}
+
+func formatSummary(heading, summary string) string {
+	if heading == "" {
+		return summary + "\n"
+	}
+	return fmt.Sprintf("%s（摘要）\n%s\n", heading, summary)
+}
+
+// newBuildReport 按排序后的片段初始化报告，默认原文保留
+func newBuildReport(maxTokens int, sections []*Section) *BuildReport {
+	report := &BuildReport{
+		MaxTokens: maxTokens,
+		Sections:  make([]*SectionReport, len(sections)),
+	}
+	for i, section := range sections {
+		report.Sections[i] = &SectionReport{
+			Name:           section.Name,
+			Priority:       section.Priority,
+			Status:         SectionVerbatim,
+			OriginalTokens: section.Tokens,
+		}
+	}
+	return report
+}
+
+// recordSelection 根据最终选中的片段更新报告，selected 与 sections 按相同顺序排列
+func (r *BuildReport) recordSelection(sections, selected []*Section) {
+	for i, section := range r.Sections {
+		switch {
+		case i >= len(selected):
+			section.Status = SectionDropped
+			section.Tokens = 0
+		case selected[i] != sections[i]:
+			section.Status = SectionTruncated
+			section.Tokens = selected[i].Tokens
+		default:
+			section.Tokens = selected[i].Tokens
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package prompt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Template 使用 Go text/template 语法的提示词模板，如 "你正在创作《{{.project_title}}》"
+type Template struct {
+	tmpl      *template.Template
+	variables []string
+}
+
+// ParseTemplate 解析提示词模板
+func ParseTemplate(name, content string) (*Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template: %w", err)
+	}
+	return &Template{tmpl: tmpl, variables: collectVariables(tmpl)}, nil
+}
+
+// Variables 模板引用的顶层变量，按名称排序
+func (t *Template) Variables() []string {
+	return t.variables
+}
+
+// Render 渲染模板，未提供的变量按空字符串处理
+func (t *Template) Render(data map[string]interface{}) (string, error) {
+	values := make(map[string]interface{}, len(data)+len(t.variables))
+	for _, name := range t.variables {
+		values[name] = ""
+	}
+	for k, v := range data {
+		values[k] = v
+	}
+
+	var out strings.Builder
+	if err := t.tmpl.Execute(&out, values); err != nil {
+		return "", fmt.Errorf("failed to render prompt template: %w", err)
+	}
+	return out.String(), nil
+}
+
+// collectVariables 遍历语法树收集 {{.name}} 形式引用的变量
+func collectVariables(tmpl *template.Template) []string {
+	seen := make(map[string]bool)
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			walkNode(t.Tree.Root, seen)
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func walkNode(node parse.Node, seen map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkNode(child, seen)
+		}
+	case *parse.ActionNode:
+		walkNode(n.Pipe, seen)
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, seen)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, seen)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, seen)
+	case *parse.TemplateNode:
+		walkNode(n.Pipe, seen)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkNode(cmd, seen)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			walkNode(arg, seen)
+		}
+	case *parse.FieldNode:
+		seen[n.Ident[0]] = true
+	case *parse.ChainNode:
+		walkNode(n.Node, seen)
+	}
+}
+
+// walkBranch with/range 内部的 "." 指向子对象，只收集条件 (管道) 中的变量与 else 分支
+func walkBranch(n *parse.BranchNode, seen map[string]bool) {
+	walkNode(n.Pipe, seen)
+	if n.NodeType == parse.NodeIf {
+		walkNode(n.List, seen)
+	}
+	walkNode(n.ElseList, seen)
+}
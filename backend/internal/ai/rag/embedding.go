@@ -2,24 +2,31 @@ package rag
 
 import (
 	"context"
-
-	"github.com/zibianqu/novel-study/internal/ai/openai"
+	"fmt"
 )
 
+// Embedder 向量嵌入提供方（由 openai.Client 实现）
+type Embedder interface {
+	CreateEmbedding(ctx context.Context, texts []string) ([][]float32, error)
+}
+
 // EmbeddingService 向量嵌入服务
 type EmbeddingService struct {
-	client *openai.Client
+	client Embedder
 }
 
 // NewEmbeddingService 创建嵌入服务
-func NewEmbeddingService(apiKey string) *EmbeddingService {
+func NewEmbeddingService(client Embedder) *EmbeddingService {
 	return &EmbeddingService{
-		client: openai.NewClient(apiKey),
+		client: client,
 	}
 }
 
 // Embed 生成向量嵌入
 func (s *EmbeddingService) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if s.client == nil {
+		return nil, fmt.Errorf("embedding client not configured")
+	}
 	return s.client.CreateEmbedding(ctx, texts)
 }
 
@@ -0,0 +1,45 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+)
+
+// SummarizerAgentKey 压缩超长上下文使用的Agent
+const SummarizerAgentKey = "agent_7_summarizer"
+
+// AgentSummarizer 通过摘要Agent压缩 Prompt 片段，实现 prompt.Summarizer
+// 用量按发起请求的用户与项目记录
+type AgentSummarizer struct {
+	engine    *Engine
+	agentKey  string
+	userID    int
+	projectID int
+}
+
+// Summarizer 创建使用摘要Agent的摘要器
+func (e *Engine) Summarizer(userID, projectID int) *AgentSummarizer {
+	return &AgentSummarizer{
+		engine:    e,
+		agentKey:  SummarizerAgentKey,
+		userID:    userID,
+		projectID: projectID,
+	}
+}
+
+// Summarize 将内容压缩到约 maxTokens 个 Token
+func (s *AgentSummarizer) Summarize(ctx context.Context, content string, maxTokens int) (string, error) {
+	resp, err := s.engine.ExecuteAgent(ctx, s.agentKey, &llm.AgentRequest{
+		Prompt:     fmt.Sprintf("请将以下内容压缩为不超过 %d 个 Token 的摘要：\n\n%s", maxTokens, content),
+		UserID:     s.userID,
+		ProjectID:  s.projectID,
+		MaxTokens:  maxTokens,
+		ActionType: "summarize",
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.Content, nil
+}
@@ -0,0 +1,55 @@
+package tokenizer
+
+import (
+	"math"
+	"unicode"
+)
+
+// 词表不可用时每个汉字 (含假名、谚文) 约占的 Token 数 (经验值)
+var cjkTokensPerRune = map[string]float64{
+	CL100KBase: 1.3,
+	O200KBase:  0.8,
+}
+
+// Estimator 不依赖词表的估算计数器
+// 与真实编码使用相同的预分词，再按片段内的字符类别估算，误差远小于按字符数折算
+type Estimator struct {
+	Encoding string
+}
+
+// Count 实现 Counter
+func (e *Estimator) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	matchers, err := matchersFor(e.Encoding)
+	if err != nil {
+		matchers = cl100kMatchers
+	}
+	perCJK, ok := cjkTokensPerRune[e.Encoding]
+	if !ok {
+		perCJK = cjkTokensPerRune[CL100KBase]
+	}
+
+	total := 0.0
+	for _, piece := range split(text, matchers) {
+		var cjk, ascii, other int
+		for _, r := range piece {
+			switch {
+			case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+				cjk++
+			case r <= unicode.MaxASCII:
+				ascii++
+			default:
+				other++
+			}
+		}
+		total += float64(cjk) * perCJK
+		// 英文单词、数字与标点大多整段就是一个 Token，长单词约每 6 个字符一个
+		if ascii > 0 {
+			total += 1 + float64((ascii-1)/6)
+		}
+		total += float64(other)
+	}
+	return int(math.Ceil(total))
+}
@@ -0,0 +1,74 @@
+// fetch 下载 tiktoken 词表文件并校验 SHA-256，由 go generate 调用
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const baseURL = "https://openaipublic.blob.core.windows.net/encodings/"
+
+// 与 tiktoken 官方实现中记录的哈希一致
+var files = map[string]string{
+	"cl100k_base.tiktoken": "223921b76ee99bde995b7ff738513eef100fb51d18c93597a113bcffe865b2a7",
+	"o200k_base.tiktoken":  "446a9538cb6c348e3516120d7c08b09f57c36495e2acfffe59a5bf8b0cfb1a2d",
+}
+
+func main() {
+	dir := flag.String("dir", "data", "output directory")
+	flag.Parse()
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	for name, expected := range files {
+		path := filepath.Join(*dir, name)
+		if ok, _ := verify(path, expected); ok {
+			log.Printf("%s 已存在且校验通过", name)
+			continue
+		}
+		if err := download(client, baseURL+name, path, expected); err != nil {
+			log.Fatalf("下载 %s 失败: %v", name, err)
+		}
+		log.Printf("%s 下载完成", name)
+	}
+}
+
+func download(client *http.Client, url, path, expected string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != expected {
+		return fmt.Errorf("checksum mismatch")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func verify(path, expected string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) == expected, nil
+}
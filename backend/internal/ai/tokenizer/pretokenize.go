@@ -0,0 +1,223 @@
+package tokenizer
+
+import "unicode"
+
+// 预分词与 tiktoken 的正则保持一致，Go 的 regexp 不支持其中的零宽断言与占有量词，因此逐项手写匹配
+//
+// cl100k_base:
+//
+//	'(?i:[sdmt]|ll|ve|re)|[^\r\n\p{L}\p{N}]?+\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]++[\r\n]*|\s*[\r\n]|\s+(?!\S)|\s+
+//
+// o200k_base:
+//
+//	[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?
+//	|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?
+//	|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+
+
+// matcher 返回从 i 开始的匹配长度 (按 rune 计)，0 表示不匹配
+type matcher func(s []rune, i int) int
+
+var (
+	cl100kMatchers = []matcher{
+		matchContractionCL100K,
+		matchLetters,
+		matchNumbers,
+		matchPunctuation(isNewline),
+		matchNewlineSpace,
+		matchTrailingSpace,
+		matchSpace,
+	}
+	o200kMatchers = []matcher{
+		matchCasedWord,
+		matchUpperWord,
+		matchNumbers,
+		matchPunctuation(func(r rune) bool { return isNewline(r) || r == '/' }),
+		matchNewlineSpace,
+		matchTrailingSpace,
+		matchSpace,
+	}
+)
+
+// split 按匹配规则把文本切分为预分词片段
+func split(text string, matchers []matcher) []string {
+	s := []rune(text)
+	pieces := make([]string, 0, len(s)/3+1)
+	for i := 0; i < len(s); {
+		n := 0
+		for _, m := range matchers {
+			if n = m(s, i); n > 0 {
+				break
+			}
+		}
+		if n == 0 {
+			n = 1
+		}
+		pieces = append(pieces, string(s[i:i+n]))
+		i += n
+	}
+	return pieces
+}
+
+func isNewline(r rune) bool { return r == '\r' || r == '\n' }
+
+func isLetterOrNumber(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }
+
+// isPrefix [^\r\n\p{L}\p{N}]
+func isPrefix(r rune) bool { return !isNewline(r) && !isLetterOrNumber(r) }
+
+// isUpperClass [\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]
+func isUpperClass(r rune) bool {
+	return unicode.In(r, unicode.Lu, unicode.Lt, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+// isLowerClass [\p{Ll}\p{Lm}\p{Lo}\p{M}]
+func isLowerClass(r rune) bool {
+	return unicode.In(r, unicode.Ll, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+func runLength(s []rune, i int, in func(rune) bool) int {
+	n := 0
+	for i+n < len(s) && in(s[i+n]) {
+		n++
+	}
+	return n
+}
+
+// matchContractionCL100K '(?i:[sdmt]|ll|ve|re)
+func matchContractionCL100K(s []rune, i int) int {
+	if s[i] != '\'' || i+1 >= len(s) {
+		return 0
+	}
+	if i+2 < len(s) {
+		switch string(unicode.ToLower(s[i+1])) + string(unicode.ToLower(s[i+2])) {
+		case "ll", "ve", "re":
+			return 3
+		}
+	}
+	switch unicode.ToLower(s[i+1]) {
+	case 's', 'd', 'm', 't':
+		return 2
+	}
+	return 0
+}
+
+// matchContractionO200K (?i:'s|'t|'re|'ve|'m|'ll|'d)
+func matchContractionO200K(s []rune, i int) int {
+	if i >= len(s) || s[i] != '\'' || i+1 >= len(s) {
+		return 0
+	}
+	if i+2 < len(s) {
+		switch string(unicode.ToLower(s[i+1])) + string(unicode.ToLower(s[i+2])) {
+		case "re", "ve", "ll":
+			return 3
+		}
+	}
+	switch unicode.ToLower(s[i+1]) {
+	case 's', 't', 'm', 'd':
+		return 2
+	}
+	return 0
+}
+
+// matchLetters [^\r\n\p{L}\p{N}]?+\p{L}+
+func matchLetters(s []rune, i int) int {
+	j := i
+	if isPrefix(s[j]) {
+		j++
+	}
+	n := runLength(s, j, unicode.IsLetter)
+	if n == 0 {
+		return 0
+	}
+	return j + n - i
+}
+
+// matchNumbers \p{N}{1,3}
+func matchNumbers(s []rune, i int) int {
+	n := runLength(s, i, unicode.IsNumber)
+	if n > 3 {
+		n = 3
+	}
+	return n
+}
+
+// matchPunctuation  ?[^\s\p{L}\p{N}]+ 后接由 trailing 描述的字符
+func matchPunctuation(trailing func(rune) bool) matcher {
+	return func(s []rune, i int) int {
+		j := i
+		if s[j] == ' ' {
+			j++
+		}
+		n := runLength(s, j, func(r rune) bool { return !unicode.IsSpace(r) && !isLetterOrNumber(r) })
+		if n == 0 {
+			return 0
+		}
+		j += n
+		return j + runLength(s, j, trailing) - i
+	}
+}
+
+// matchNewlineSpace \s*[\r\n]+ (cl100k 为 \s*[\r\n]，在空白段内结果相同)，取空白段中最后一个换行为止
+func matchNewlineSpace(s []rune, i int) int {
+	n := runLength(s, i, unicode.IsSpace)
+	for k := n - 1; k >= 0; k-- {
+		if isNewline(s[i+k]) {
+			return k + 1
+		}
+	}
+	return 0
+}
+
+// matchTrailingSpace \s+(?!\S)，空白后紧跟非空白字符时留下最后一个空白给下一个片段
+func matchTrailingSpace(s []rune, i int) int {
+	n := runLength(s, i, unicode.IsSpace)
+	if n == 0 || i+n == len(s) {
+		return n
+	}
+	return n - 1
+}
+
+// matchSpace \s+
+func matchSpace(s []rune, i int) int {
+	return runLength(s, i, unicode.IsSpace)
+}
+
+// matchCasedWord [^\r\n\p{L}\p{N}]?[Lu Lt Lm Lo M]*[Ll Lm Lo M]+(contraction)?
+func matchCasedWord(s []rune, i int) int {
+	try := func(j int) int {
+		upper := runLength(s, j, isUpperClass)
+		// 大写部分贪婪匹配后回退，直到后面至少有一个小写类字符
+		for k := j + upper; k >= j; k-- {
+			if k < len(s) && isLowerClass(s[k]) {
+				end := k + runLength(s, k, isLowerClass)
+				return end + matchContractionO200K(s, end) - i
+			}
+		}
+		return 0
+	}
+	if isPrefix(s[i]) {
+		if n := try(i + 1); n > 0 {
+			return n
+		}
+	}
+	return try(i)
+}
+
+// matchUpperWord [^\r\n\p{L}\p{N}]?[Lu Lt Lm Lo M]+[Ll Lm Lo M]*(contraction)?
+func matchUpperWord(s []rune, i int) int {
+	try := func(j int) int {
+		upper := runLength(s, j, isUpperClass)
+		if upper == 0 {
+			return 0
+		}
+		end := j + upper
+		end += runLength(s, end, isLowerClass)
+		return end + matchContractionO200K(s, end) - i
+	}
+	if isPrefix(s[i]) {
+		if n := try(i + 1); n > 0 {
+			return n
+		}
+	}
+	return try(i)
+}
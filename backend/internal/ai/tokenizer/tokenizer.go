@@ -0,0 +1,305 @@
+// Package tokenizer 提供与 OpenAI cl100k_base / o200k_base 兼容的 BPE 分词，用于 Prompt 预算与用量预估
+//
+// 词表文件 (*.tiktoken) 随仓库提交并嵌入在 data 目录中，可通过 go generate 重新下载并校验:
+//
+//	go generate ./internal/ai/tokenizer
+//
+// 也可以通过环境变量 TOKENIZER_DATA_DIR 指定词表目录。词表不可用时退回到按字符类别的估算
+package tokenizer
+
+//go:generate go run ./fetch -dir data
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 支持的编码
+const (
+	CL100KBase = "cl100k_base"
+	O200KBase  = "o200k_base"
+)
+
+// ErrEncodingUnavailable 词表文件不存在
+var ErrEncodingUnavailable = errors.New("tokenizer encoding data not available")
+
+//go:embed data
+var embedded embed.FS
+
+// Counter Token 计数器，与 prompt.TokenCounter 一致
+type Counter interface {
+	Count(text string) int
+}
+
+// Encoding BPE 编码
+type Encoding struct {
+	name     string
+	ranks    map[string]int
+	matchers []matcher
+}
+
+// NewEncoding 使用给定词表创建编码，name 决定预分词规则
+func NewEncoding(name string, ranks map[string]int) (*Encoding, error) {
+	matchers, err := matchersFor(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Encoding{name: name, ranks: ranks, matchers: matchers}, nil
+}
+
+// Name 编码名称
+func (e *Encoding) Name() string {
+	return e.name
+}
+
+// Split 返回预分词结果，每个片段独立进行 BPE 合并
+func (e *Encoding) Split(text string) []string {
+	return split(text, e.matchers)
+}
+
+// Encode 将文本编码为 Token ID
+func (e *Encoding) Encode(text string) []int {
+	var tokens []int
+	for _, piece := range split(text, e.matchers) {
+		if rank, ok := e.ranks[piece]; ok {
+			tokens = append(tokens, rank)
+			continue
+		}
+		tokens = append(tokens, e.bytePairEncode([]byte(piece))...)
+	}
+	return tokens
+}
+
+// Count 实现 Counter
+func (e *Encoding) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	return len(e.Encode(text))
+}
+
+// bytePairEncode 按词表优先级反复合并相邻字节段，优先级相同时合并最左侧的一对
+// 每段以起始字节下标标识，next/prev 组成链表，候选合并放入小顶堆，段变化后旧候选通过版本号作废
+func (e *Encoding) bytePairEncode(piece []byte) []int {
+	n := len(piece)
+	if n == 1 {
+		return []int{e.ranks[string(piece)]}
+	}
+
+	next := make([]int, n)
+	prev := make([]int, n)
+	version := make([]int, n)
+	removed := make([]bool, n)
+	for i := range next {
+		next[i], prev[i] = i+1, i-1
+	}
+	segmentEnd := func(i int) int {
+		if next[i] >= n {
+			return n
+		}
+		return next[i]
+	}
+	// pairRank 段 i 与其后一段合并后的优先级
+	pairRank := func(i int) (int, bool) {
+		if next[i] >= n {
+			return 0, false
+		}
+		rank, ok := e.ranks[string(piece[i:segmentEnd(next[i])])]
+		return rank, ok
+	}
+
+	pq := &mergeQueue{}
+	for i := 0; i < n-1; i++ {
+		if rank, ok := pairRank(i); ok {
+			heap.Push(pq, mergeCandidate{rank: rank, pos: i})
+		}
+	}
+
+	for pq.Len() > 0 {
+		c := heap.Pop(pq).(mergeCandidate)
+		if removed[c.pos] || version[c.pos] != c.version {
+			continue
+		}
+
+		right := next[c.pos]
+		removed[right] = true
+		next[c.pos] = next[right]
+		if next[right] < n {
+			prev[next[right]] = c.pos
+		}
+
+		for _, i := range []int{c.pos, prev[c.pos]} {
+			if i < 0 {
+				continue
+			}
+			version[i]++
+			if rank, ok := pairRank(i); ok {
+				heap.Push(pq, mergeCandidate{rank: rank, pos: i, version: version[i]})
+			}
+		}
+	}
+
+	var tokens []int
+	for i := 0; i < n; i = next[i] {
+		tokens = append(tokens, e.ranks[string(piece[i:segmentEnd(i)])])
+	}
+	return tokens
+}
+
+type mergeCandidate struct {
+	rank    int
+	pos     int
+	version int
+}
+
+// mergeQueue 按 (rank, pos) 排序的小顶堆
+type mergeQueue []mergeCandidate
+
+func (q mergeQueue) Len() int { return len(q) }
+func (q mergeQueue) Less(i, j int) bool {
+	if q[i].rank != q[j].rank {
+		return q[i].rank < q[j].rank
+	}
+	return q[i].pos < q[j].pos
+}
+func (q mergeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *mergeQueue) Push(x interface{}) { *q = append(*q, x.(mergeCandidate)) }
+func (q *mergeQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+func matchersFor(name string) ([]matcher, error) {
+	switch name {
+	case CL100KBase:
+		return cl100kMatchers, nil
+	case O200KBase:
+		return o200kMatchers, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding: %s", name)
+	}
+}
+
+// ParseRanks 解析 tiktoken 词表文件 (每行 "base64(token) rank")
+func ParseRanks(data []byte) (map[string]int, error) {
+	ranks := make(map[string]int, 200000)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		token, rankText, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid rank line %d", line)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token on line %d: %w", line, err)
+		}
+		rank, err := strconv.Atoi(rankText)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank on line %d: %w", line, err)
+		}
+		ranks[string(decoded)] = rank
+	}
+	return ranks, scanner.Err()
+}
+
+var (
+	encodingsMu sync.Mutex
+	encodings   = make(map[string]*Encoding)
+	loadErrors  = make(map[string]error)
+)
+
+// GetEncoding 加载编码，结果会被缓存
+func GetEncoding(name string) (*Encoding, error) {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	if enc, ok := encodings[name]; ok {
+		return enc, nil
+	}
+	if err, ok := loadErrors[name]; ok {
+		return nil, err
+	}
+
+	enc, err := loadEncoding(name)
+	if err != nil {
+		loadErrors[name] = err
+		return nil, err
+	}
+	encodings[name] = enc
+	return enc, nil
+}
+
+func loadEncoding(name string) (*Encoding, error) {
+	if _, err := matchersFor(name); err != nil {
+		return nil, err
+	}
+
+	file := name + ".tiktoken"
+	data, err := fs.ReadFile(embedded, "data/"+file)
+	if errors.Is(err, fs.ErrNotExist) {
+		if dir := os.Getenv("TOKENIZER_DATA_DIR"); dir != "" {
+			data, err = os.ReadFile(filepath.Join(dir, file))
+		}
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrEncodingUnavailable, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	ranks, err := ParseRanks(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	return NewEncoding(name, ranks)
+}
+
+// EncodingForModel 按模型名选择编码，"提供方:模型" 形式的前缀会被忽略
+func EncodingForModel(model string) string {
+	if _, rest, ok := strings.Cut(model, ":"); ok {
+		model = rest
+	}
+	model = strings.ToLower(model)
+
+	for _, prefix := range []string{"gpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "o1", "o3", "o4", "chatgpt-4o"} {
+		if strings.HasPrefix(model, prefix) {
+			return O200KBase
+		}
+	}
+	return CL100KBase
+}
+
+var warnOnce sync.Map
+
+// ForModel 返回模型对应的计数器，词表不可用时退回到估算
+func ForModel(model string) Counter {
+	name := EncodingForModel(model)
+	enc, err := GetEncoding(name)
+	if err == nil {
+		return enc
+	}
+
+	if _, warned := warnOnce.LoadOrStore(name, true); !warned {
+		log.Printf("⚠️ 分词词表 %s 不可用，使用估算值: %v", name, err)
+	}
+	return &Estimator{Encoding: name}
+}
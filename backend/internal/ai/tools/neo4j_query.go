@@ -24,29 +24,32 @@ func (t *Neo4jQueryTool) GetName() string {
 }
 
 func (t *Neo4jQueryTool) GetDescription() string {
-	return "查询知识图谱中的关系数据。参数: query_type(查询类型: character_relations|角色关系, world_events|世界事件, plot_arcs|剧情弧), entity_id(实体ID), project_id(项目ID)"
+	return "查询知识图谱中的关系数据: character_relations(角色关系), world_events(世界事件), plot_arcs(剧情弧), character_state(角色状态)"
 }
 
-func (t *Neo4jQueryTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
-	queryType, ok := params["query_type"].(string)
-	if !ok || queryType == "" {
-		return nil, fmt.Errorf("missing required parameter: query_type")
-	}
+func (t *Neo4jQueryTool) GetParameters() *Schema {
+	return ObjectSchema(map[string]*Schema{
+		"query_type":   StringParam("查询类型", "character_relations", "world_events", "plot_arcs", "character_state"),
+		"project_id":   IntegerParam("项目ID"),
+		"character_id": IntegerParam("角色ID, character_relations 和 character_state 查询必填"),
+		"limit":        IntegerParam("world_events 返回数量").WithDefault(10).WithRange(1, 100),
+		"status":       StringParam("plot_arcs 剧情弧状态").WithDefault("active"),
+	}, "query_type", "project_id")
+}
 
-	projectID, ok := params["project_id"].(float64)
-	if !ok {
-		return nil, fmt.Errorf("missing required parameter: project_id")
-	}
+func (t *Neo4jQueryTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	queryType := params["query_type"].(string)
+	projectID := params["project_id"].(int)
 
 	switch queryType {
 	case "character_relations":
-		return t.queryCharacterRelations(ctx, int(projectID), params)
+		return t.queryCharacterRelations(ctx, projectID, params)
 	case "world_events":
-		return t.queryWorldEvents(ctx, int(projectID), params)
+		return t.queryWorldEvents(ctx, projectID, params)
 	case "plot_arcs":
-		return t.queryPlotArcs(ctx, int(projectID), params)
+		return t.queryPlotArcs(ctx, projectID, params)
 	case "character_state":
-		return t.queryCharacterState(ctx, int(projectID), params)
+		return t.queryCharacterState(ctx, projectID, params)
 	default:
 		return nil, fmt.Errorf("unsupported query_type: %s", queryType)
 	}
@@ -54,12 +57,12 @@ func (t *Neo4jQueryTool) Execute(ctx context.Context, params map[string]interfac
 
 // queryCharacterRelations 查询角色关系
 func (t *Neo4jQueryTool) queryCharacterRelations(ctx context.Context, projectID int, params map[string]interface{}) (interface{}, error) {
-	characterID, ok := params["character_id"].(float64)
+	characterID, ok := params["character_id"].(int)
 	if !ok {
 		return nil, fmt.Errorf("missing character_id for character_relations query")
 	}
 
-	relations, err := t.neo4jRepo.GetCharacterRelations(ctx, int(characterID), projectID)
+	relations, err := t.neo4jRepo.GetCharacterRelations(ctx, characterID, projectID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query character relations: %w", err)
 	}
@@ -72,10 +75,7 @@ func (t *Neo4jQueryTool) queryCharacterRelations(ctx context.Context, projectID
 
 // queryWorldEvents 查询世界事件
 func (t *Neo4jQueryTool) queryWorldEvents(ctx context.Context, projectID int, params map[string]interface{}) (interface{}, error) {
-	limit := 10
-	if l, ok := params["limit"].(float64); ok {
-		limit = int(l)
-	}
+	limit := params["limit"].(int)
 
 	events, err := t.neo4jRepo.GetRecentWorldEvents(ctx, projectID, limit)
 	if err != nil {
@@ -90,10 +90,7 @@ func (t *Neo4jQueryTool) queryWorldEvents(ctx context.Context, projectID int, pa
 
 // queryPlotArcs 查询剧情弧
 func (t *Neo4jQueryTool) queryPlotArcs(ctx context.Context, projectID int, params map[string]interface{}) (interface{}, error) {
-	status := "active"
-	if s, ok := params["status"].(string); ok {
-		status = s
-	}
+	status := params["status"].(string)
 
 	arcs, err := t.neo4jRepo.GetPlotArcs(ctx, projectID, status)
 	if err != nil {
@@ -108,12 +105,12 @@ func (t *Neo4jQueryTool) queryPlotArcs(ctx context.Context, projectID int, param
 
 // queryCharacterState 查询角色当前状态
 func (t *Neo4jQueryTool) queryCharacterState(ctx context.Context, projectID int, params map[string]interface{}) (interface{}, error) {
-	characterID, ok := params["character_id"].(float64)
+	characterID, ok := params["character_id"].(int)
 	if !ok {
 		return nil, fmt.Errorf("missing character_id for character_state query")
 	}
 
-	state, err := t.neo4jRepo.GetCharacterCurrentState(ctx, int(characterID), projectID)
+	state, err := t.neo4jRepo.GetCharacterCurrentState(ctx, characterID, projectID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query character state: %w", err)
 	}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/zibianqu/novel-study/internal/model"
 	"github.com/zibianqu/novel-study/internal/repository"
 )
 
@@ -26,23 +27,26 @@ func (t *GetProjectStatusTool) GetName() string {
 }
 
 func (t *GetProjectStatusTool) GetDescription() string {
-	return "获取项目当前状态，包括总章节数、总字数、最后更新时间等。参数: project_id(项目ID)"
+	return "获取项目当前状态，包括总章节数、总字数、最后更新时间等"
+}
+
+func (t *GetProjectStatusTool) GetParameters() *Schema {
+	return ObjectSchema(map[string]*Schema{
+		"project_id": IntegerParam("项目ID"),
+	}, "project_id")
 }
 
 func (t *GetProjectStatusTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
-	projectID, ok := params["project_id"].(float64)
-	if !ok {
-		return nil, fmt.Errorf("missing required parameter: project_id")
-	}
+	projectID := params["project_id"].(int)
 
 	// 获取项目基本信息
-	project, err := t.projectRepo.GetByID(ctx, int(projectID))
+	project, err := t.projectRepo.GetByID(projectID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get project: %w", err)
 	}
 
 	// 获取章节统计
-	chapters, err := t.chapterRepo.GetByProjectID(ctx, int(projectID))
+	chapters, err := t.chapterRepo.GetByProjectID(projectID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get chapters: %w", err)
 	}
@@ -92,24 +96,32 @@ func (t *GetChapterContentTool) GetName() string {
 }
 
 func (t *GetChapterContentTool) GetDescription() string {
-	return "获取指定章节的内容。参数: chapter_id(章节ID) 或 chapter_number(章节号) + project_id(项目ID)"
+	return "获取项目中指定章节的内容，按 chapter_id 或 chapter_number 查询"
+}
+
+func (t *GetChapterContentTool) GetParameters() *Schema {
+	return ObjectSchema(map[string]*Schema{
+		"chapter_id":     IntegerParam("章节ID"),
+		"chapter_number": IntegerParam("章节号"),
+		"project_id":     IntegerParam("项目ID"),
+	}, "project_id")
 }
 
 func (t *GetChapterContentTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
-	var chapter interface{}
-	var err error
+	projectID := params["project_id"].(int)
 
 	// 支持两种查询方式
-	if chapterID, ok := params["chapter_id"].(float64); ok {
-		chapter, err = t.chapterRepo.GetByID(ctx, int(chapterID))
-	} else if chapterNum, ok := params["chapter_number"].(float64); ok {
-		projectID, ok := params["project_id"].(float64)
-		if !ok {
-			return nil, fmt.Errorf("project_id required when using chapter_number")
+	var chapter *model.Chapter
+	var err error
+	if chapterID, ok := params["chapter_id"].(int); ok {
+		chapter, err = t.chapterRepo.GetByID(chapterID)
+		if err == nil && chapter.ProjectID != projectID {
+			return nil, fmt.Errorf("chapter %d not found in project %d", chapterID, projectID)
 		}
-		chapter, err = t.chapterRepo.GetByNumber(ctx, int(projectID), int(chapterNum))
+	} else if chapterNum, ok := params["chapter_number"].(int); ok {
+		chapter, err = t.chapterRepo.GetByNumber(projectID, chapterNum)
 	} else {
-		return nil, fmt.Errorf("either chapter_id or (chapter_number + project_id) required")
+		return nil, fmt.Errorf("either chapter_id or chapter_number required")
 	}
 
 	if err != nil {
@@ -24,53 +24,67 @@ func (t *RAGSearchTool) GetName() string {
 }
 
 func (t *RAGSearchTool) GetDescription() string {
-	return "从知识库中检索相关内容。参数: query(搜索查询), project_id(项目ID), top_k(返回数量, 默认3), agent_id(Agent专属知识库过滤, 可选)"
+	return "从知识库中检索相关内容"
 }
 
-func (t *RAGSearchTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
-	// 解析参数
-	query, ok := params["query"].(string)
-	if !ok || query == "" {
-		return nil, fmt.Errorf("missing required parameter: query")
-	}
+func (t *RAGSearchTool) GetParameters() *Schema {
+	return ObjectSchema(map[string]*Schema{
+		"query":      StringParam("搜索查询"),
+		"project_id": IntegerParam("项目ID"),
+		"top_k":      IntegerParam("返回数量").WithDefault(3).WithRange(1, 20),
+		"agent_id":   IntegerParam("Agent专属知识库过滤, 可选"),
+	}, "query", "project_id")
+}
 
-	projectID, ok := params["project_id"].(float64)
-	if !ok {
-		return nil, fmt.Errorf("missing required parameter: project_id")
+func (t *RAGSearchTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	// 参数已由 ToolRegistry 按 Schema 校验
+	query := params["query"].(string)
+	if query == "" {
+		return nil, fmt.Errorf("query cannot be empty")
 	}
 
-	// 可选参数
-	topK := 3
-	if k, ok := params["top_k"].(float64); ok {
-		topK = int(k)
-	}
-
-	var agentID *int
-	if aid, ok := params["agent_id"].(float64); ok {
-		id := int(aid)
-		agentID = &id
-	}
+	projectID := params["project_id"].(int)
+	topK := params["top_k"].(int)
 
 	// 执行检索
-	results, err := t.retriever.Search(ctx, query, int(projectID), topK, agentID)
+	docs, err := t.retriever.Retrieve(ctx, projectID, query, topK)
 	if err != nil {
 		return nil, fmt.Errorf("RAG search failed: %w", err)
 	}
 
+	// 按 Agent 专属知识库过滤 (metadata.agent_id)
+	agentID, filterByAgent := params["agent_id"].(int)
+
 	// 格式化返回结果
-	formattedResults := make([]map[string]interface{}, 0, len(results))
-	for _, r := range results {
+	formattedResults := make([]map[string]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		if filterByAgent && !matchesAgent(doc.Metadata, agentID) {
+			continue
+		}
+		source, _ := doc.Metadata["source"].(string)
 		formattedResults = append(formattedResults, map[string]interface{}{
-			"content":    r.Content,
-			"similarity": r.Similarity,
-			"source":     r.Source,
-			"metadata":   r.Metadata,
+			"content":    doc.Content,
+			"similarity": doc.Score,
+			"source":     source,
+			"metadata":   doc.Metadata,
 		})
 	}
 
 	return map[string]interface{}{
 		"query":   query,
-		"count":   len(results),
+		"count":   len(formattedResults),
 		"results": formattedResults,
 	}, nil
 }
+
+// matchesAgent metadata 中的 agent_id 经 JSON 解码为 float64
+func matchesAgent(metadata map[string]interface{}, agentID int) bool {
+	switch v := metadata["agent_id"].(type) {
+	case float64:
+		return int(v) == agentID
+	case int:
+		return v == agentID
+	default:
+		return false
+	}
+}
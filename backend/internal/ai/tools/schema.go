@@ -0,0 +1,306 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Schema 工具参数的 JSON Schema 描述（支持 function calling 所需的子集）
+type Schema struct {
+	Type                 string             `json:"type"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+}
+
+// ObjectSchema 创建对象类型的参数定义，未声明的参数会被拒绝
+func ObjectSchema(properties map[string]*Schema, required ...string) *Schema {
+	additional := false
+	return &Schema{
+		Type:                 "object",
+		Properties:           properties,
+		Required:             required,
+		AdditionalProperties: &additional,
+	}
+}
+
+// StringParam 创建字符串参数，可选地限定取值范围
+func StringParam(description string, enum ...string) *Schema {
+	s := &Schema{Type: "string", Description: description}
+	for _, v := range enum {
+		s.Enum = append(s.Enum, v)
+	}
+	return s
+}
+
+// IntegerParam 创建整数参数
+func IntegerParam(description string) *Schema {
+	return &Schema{Type: "integer", Description: description}
+}
+
+// NumberParam 创建数值参数
+func NumberParam(description string) *Schema {
+	return &Schema{Type: "number", Description: description}
+}
+
+// BooleanParam 创建布尔参数
+func BooleanParam(description string) *Schema {
+	return &Schema{Type: "boolean", Description: description}
+}
+
+// WithDefault 设置参数默认值
+func (s *Schema) WithDefault(value interface{}) *Schema {
+	s.Default = value
+	return s
+}
+
+// WithRange 设置数值参数的取值范围
+func (s *Schema) WithRange(min, max float64) *Schema {
+	s.Minimum = &min
+	s.Maximum = &max
+	return s
+}
+
+// ValidationError 参数校验错误
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// Validate 按 Schema 校验参数并做类型转换
+// 整数参数统一转换为 int，数值参数转换为 float64，缺省的可选参数填充默认值
+func (s *Schema) Validate(params map[string]interface{}) (map[string]interface{}, error) {
+	if s == nil {
+		return params, nil
+	}
+
+	var problems []string
+	value := s.coerce("", params, &problems)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	result, _ := value.(map[string]interface{})
+	if result == nil {
+		result = make(map[string]interface{})
+	}
+	return result, nil
+}
+
+// coerce 递归校验并转换单个值
+func (s *Schema) coerce(path string, value interface{}, problems *[]string) interface{} {
+	fail := func(format string, args ...interface{}) interface{} {
+		name := path
+		if name == "" {
+			name = "arguments"
+		}
+		*problems = append(*problems, fmt.Sprintf("%s: %s", name, fmt.Sprintf(format, args...)))
+		return nil
+	}
+
+	var result interface{}
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			if value != nil {
+				return fail("expected object, got %s", typeName(value))
+			}
+			obj = map[string]interface{}{}
+		}
+		return s.coerceObject(path, obj, problems)
+
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fail("expected array, got %s", typeName(value))
+		}
+		coerced := make([]interface{}, len(items))
+		for i, item := range items {
+			if s.Items != nil {
+				coerced[i] = s.Items.coerce(fmt.Sprintf("%s[%d]", path, i), item, problems)
+			} else {
+				coerced[i] = item
+			}
+		}
+		return coerced
+
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fail("expected string, got %s", typeName(value))
+		}
+		result = str
+
+	case "integer":
+		n, ok := toFloat(value)
+		if !ok || n != math.Trunc(n) {
+			return fail("expected integer, got %s", typeName(value))
+		}
+		if msg := s.checkRange(n); msg != "" {
+			return fail("%s", msg)
+		}
+		result = int(n)
+
+	case "number":
+		n, ok := toFloat(value)
+		if !ok {
+			return fail("expected number, got %s", typeName(value))
+		}
+		if msg := s.checkRange(n); msg != "" {
+			return fail("%s", msg)
+		}
+		result = n
+
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			result = v
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fail("expected boolean, got %q", v)
+			}
+			result = b
+		default:
+			return fail("expected boolean, got %s", typeName(value))
+		}
+
+	default:
+		result = value
+	}
+
+	if len(s.Enum) > 0 && !s.inEnum(result) {
+		allowed := make([]string, len(s.Enum))
+		for i, v := range s.Enum {
+			allowed[i] = fmt.Sprint(v)
+		}
+		return fail("must be one of [%s], got %v", strings.Join(allowed, ", "), result)
+	}
+
+	return result
+}
+
+// coerceObject 校验对象的必填项、未知字段及各属性
+func (s *Schema) coerceObject(path string, obj map[string]interface{}, problems *[]string) map[string]interface{} {
+	result := make(map[string]interface{}, len(obj))
+
+	for _, name := range s.Required {
+		if v, ok := obj[name]; !ok || v == nil {
+			*problems = append(*problems, fmt.Sprintf("%s: missing required parameter", joinPath(path, name)))
+		}
+	}
+
+	// 按名称排序，保证错误信息稳定
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v := obj[name]
+		prop, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				*problems = append(*problems, fmt.Sprintf("%s: unknown parameter", joinPath(path, name)))
+				continue
+			}
+			result[name] = v
+			continue
+		}
+		if v == nil {
+			continue
+		}
+		result[name] = prop.coerce(joinPath(path, name), v, problems)
+	}
+
+	// 填充默认值
+	for name, prop := range s.Properties {
+		if _, ok := result[name]; !ok && prop.Default != nil {
+			result[name] = prop.Default
+		}
+	}
+
+	return result
+}
+
+func (s *Schema) checkRange(n float64) string {
+	if s.Minimum != nil && n < *s.Minimum {
+		return fmt.Sprintf("must be >= %v, got %v", *s.Minimum, n)
+	}
+	if s.Maximum != nil && n > *s.Maximum {
+		return fmt.Sprintf("must be <= %v, got %v", *s.Maximum, n)
+	}
+	return ""
+}
+
+func (s *Schema) inEnum(value interface{}) bool {
+	for _, v := range s.Enum {
+		if fmt.Sprint(v) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// toFloat 将 JSON 解码后可能出现的数值表示统一为 float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64, float32, int, int64, json.Number:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
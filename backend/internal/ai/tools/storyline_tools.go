@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/zibianqu/novel-study/internal/model"
 	"github.com/zibianqu/novel-study/internal/repository"
 )
 
@@ -24,33 +25,33 @@ func (t *GetStorylineStatusTool) GetName() string {
 }
 
 func (t *GetStorylineStatusTool) GetDescription() string {
-	return "获取三线(天线/地线/剧情线)当前状态。参数: project_id(项目ID), line_type(线类型: skyline|天线, groundline|地线, plotline|剧情线, all|全部)"
+	return "获取三线(天线/地线/剧情线)当前状态"
 }
 
-func (t *GetStorylineStatusTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
-	projectID, ok := params["project_id"].(float64)
-	if !ok {
-		return nil, fmt.Errorf("missing required parameter: project_id")
-	}
+func (t *GetStorylineStatusTool) GetParameters() *Schema {
+	return ObjectSchema(map[string]*Schema{
+		"project_id": IntegerParam("项目ID"),
+		"line_type":  StringParam("线类型: skyline(天线), groundline(地线), plotline(剧情线), all(全部)", "skyline", "groundline", "plotline", "all").WithDefault("all"),
+	}, "project_id")
+}
 
-	lineType := "all"
-	if lt, ok := params["line_type"].(string); ok {
-		lineType = lt
-	}
+func (t *GetStorylineStatusTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	projectID := params["project_id"].(int)
+	lineType := params["line_type"].(string)
 
 	if lineType == "all" {
 		// 获取所有三线
-		skylines, err := t.storylineRepo.GetByType(ctx, int(projectID), "skyline")
+		skylines, err := t.storylineRepo.GetByType(projectID, "skyline")
 		if err != nil {
 			return nil, fmt.Errorf("failed to get skylines: %w", err)
 		}
 
-		groundlines, err := t.storylineRepo.GetByType(ctx, int(projectID), "groundline")
+		groundlines, err := t.storylineRepo.GetByType(projectID, "groundline")
 		if err != nil {
 			return nil, fmt.Errorf("failed to get groundlines: %w", err)
 		}
 
-		plotlines, err := t.storylineRepo.GetByType(ctx, int(projectID), "plotline")
+		plotlines, err := t.storylineRepo.GetByType(projectID, "plotline")
 		if err != nil {
 			return nil, fmt.Errorf("failed to get plotlines: %w", err)
 		}
@@ -62,7 +63,7 @@ func (t *GetStorylineStatusTool) Execute(ctx context.Context, params map[string]
 		}, nil
 	} else {
 		// 获取指定类型的线
-		lines, err := t.storylineRepo.GetByType(ctx, int(projectID), lineType)
+		lines, err := t.storylineRepo.GetByType(projectID, lineType)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get %s: %w", lineType, err)
 		}
@@ -91,20 +92,36 @@ func (t *UpdateStorylineTool) GetName() string {
 }
 
 func (t *UpdateStorylineTool) GetDescription() string {
-	return "更新三线规划内容。参数: storyline_id(线ID), title(标题), content(内容), status(状态)"
+	return "更新三线规划内容"
+}
+
+func (t *UpdateStorylineTool) IsWriteTool() bool {
+	return true
+}
+
+func (t *UpdateStorylineTool) GetParameters() *Schema {
+	return ObjectSchema(map[string]*Schema{
+		"storyline_id": IntegerParam("线ID"),
+		"project_id":   IntegerParam("项目ID"),
+		"title":        StringParam("标题"),
+		"content":      StringParam("内容"),
+		"status":       StringParam("状态", "planned", "ongoing", "completed"),
+	}, "storyline_id", "project_id")
 }
 
 func (t *UpdateStorylineTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
-	storylineID, ok := params["storyline_id"].(float64)
-	if !ok {
-		return nil, fmt.Errorf("missing required parameter: storyline_id")
-	}
+	storylineID := params["storyline_id"].(int)
+	projectID := params["project_id"].(int)
 
 	// 获取现有数据
-	storyline, err := t.storylineRepo.GetByID(ctx, int(storylineID))
+	storyline, err := t.storylineRepo.GetByID(storylineID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get storyline: %w", err)
 	}
+	// 只能修改当前项目的三线，其他项目的三线与不存在时返回相同的错误
+	if storyline.ProjectID != projectID {
+		return nil, fmt.Errorf("storyline %d not found in project %d", storylineID, projectID)
+	}
 
 	// 更新字段
 	if title, ok := params["title"].(string); ok {
@@ -120,7 +137,7 @@ func (t *UpdateStorylineTool) Execute(ctx context.Context, params map[string]int
 	}
 
 	// 保存更新
-	if err := t.storylineRepo.Update(ctx, storyline); err != nil {
+	if err := t.storylineRepo.Update(storyline); err != nil {
 		return nil, fmt.Errorf("failed to update storyline: %w", err)
 	}
 
@@ -148,39 +165,45 @@ func (t *CreateStorylineTool) GetName() string {
 }
 
 func (t *CreateStorylineTool) GetDescription() string {
-	return "创建新的三线规划。参数: project_id(项目ID), line_type(线类型), title(标题), content(内容), chapter_range(章节范围, 可选)"
+	return "创建新的三线规划"
 }
 
-func (t *CreateStorylineTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
-	projectID, ok := params["project_id"].(float64)
-	if !ok {
-		return nil, fmt.Errorf("missing required parameter: project_id")
-	}
+func (t *CreateStorylineTool) IsWriteTool() bool {
+	return true
+}
 
-	lineType, ok := params["line_type"].(string)
-	if !ok || lineType == "" {
-		return nil, fmt.Errorf("missing required parameter: line_type")
-	}
+func (t *CreateStorylineTool) GetParameters() *Schema {
+	return ObjectSchema(map[string]*Schema{
+		"project_id":    IntegerParam("项目ID"),
+		"line_type":     StringParam("线类型", "skyline", "groundline", "plotline"),
+		"title":         StringParam("标题"),
+		"content":       StringParam("内容"),
+		"chapter_range": StringParam("章节范围, 例如 [1,10], 可选"),
+	}, "project_id", "line_type", "title")
+}
 
-	title, ok := params["title"].(string)
-	if !ok || title == "" {
-		return nil, fmt.Errorf("missing required parameter: title")
-	}
+func (t *CreateStorylineTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	projectID := params["project_id"].(int)
+	lineType := params["line_type"].(string)
 
-	content, ok := params["content"].(string)
-	if !ok {
-		content = ""
+	title := params["title"].(string)
+	if title == "" {
+		return nil, fmt.Errorf("title cannot be empty")
 	}
 
-	storyline := &repository.Storyline{
-		ProjectID: int(projectID),
-		LineType:  lineType,
-		Title:     title,
-		Content:   content,
-		Status:    "planned",
+	content, _ := params["content"].(string)
+	chapterRange, _ := params["chapter_range"].(string)
+
+	storyline := &model.Storyline{
+		ProjectID:    projectID,
+		LineType:     lineType,
+		Title:        title,
+		Content:      content,
+		ChapterRange: chapterRange,
+		Status:       "planned",
 	}
 
-	if err := t.storylineRepo.Create(ctx, storyline); err != nil {
+	if err := t.storylineRepo.Create(storyline); err != nil {
 		return nil, fmt.Errorf("failed to create storyline: %w", err)
 	}
 
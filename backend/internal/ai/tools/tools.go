@@ -3,16 +3,31 @@ package tools
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
+
+	"github.com/zibianqu/novel-study/internal/ai/guard"
 )
 
 // Tool Agent工具接口
 type Tool interface {
 	GetName() string
 	GetDescription() string
+	GetParameters() *Schema
 	Execute(ctx context.Context, params map[string]interface{}) (interface{}, error)
 }
 
+// WriteTool 会修改项目数据的工具需实现此接口
+type WriteTool interface {
+	IsWriteTool() bool
+}
+
+// IsWriteTool 判断工具是否会修改项目数据
+func IsWriteTool(tool Tool) bool {
+	w, ok := tool.(WriteTool)
+	return ok && w.IsWriteTool()
+}
+
 // ToolRegistry 工具注册表
 type ToolRegistry struct {
 	tools map[string]Tool
@@ -47,41 +62,61 @@ func (r *ToolRegistry) Get(name string) (Tool, error) {
 	return tool, nil
 }
 
-// Execute 执行工具并记录日志
+// Execute 校验参数后执行工具并记录日志
 func (r *ToolRegistry) Execute(ctx context.Context, agentID int, toolName string, params map[string]interface{}) (interface{}, error) {
 	tool, err := r.Get(toolName)
 	if err != nil {
+		r.LogCall(agentID, toolName, params, nil, err, 0)
+		return nil, err
+	}
+
+	coerced, err := tool.GetParameters().Validate(params)
+	if err != nil {
+		err = fmt.Errorf("invalid arguments for tool %s: %w", toolName, err)
+		r.LogCall(agentID, toolName, params, nil, err, 0)
 		return nil, err
 	}
 
 	startTime := time.Now()
-	result, execErr := tool.Execute(ctx, params)
+	result, execErr := tool.Execute(ctx, coerced)
 	duration := time.Since(startTime)
 
 	// 记录日志
-	if r.logger != nil {
-		r.logger.Log(agentID, toolName, params, result, execErr, duration)
-	}
+	r.LogCall(agentID, toolName, coerced, result, execErr, duration)
 
 	return result, execErr
 }
 
-// ListTools 列出所有可用工具
+// LogCall 记录工具调用日志 (包括被拒绝、未执行的调用)
+func (r *ToolRegistry) LogCall(agentID int, toolName string, params map[string]interface{}, result interface{}, err error, duration time.Duration) {
+	if r != nil && r.logger != nil {
+		r.logger.Log(agentID, toolName, params, result, err, duration)
+	}
+}
+
+// ListTools 列出所有可用工具（按名称排序）
 func (r *ToolRegistry) ListTools() []ToolInfo {
 	tools := make([]ToolInfo, 0, len(r.tools))
 	for name, tool := range r.tools {
 		tools = append(tools, ToolInfo{
 			Name:        name,
 			Description: tool.GetDescription(),
+			Parameters:  tool.GetParameters(),
+			Write:       IsWriteTool(tool),
 		})
 	}
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].Name < tools[j].Name
+	})
 	return tools
 }
 
 // ToolInfo 工具信息
 type ToolInfo struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Parameters  *Schema `json:"parameters"`
+	Write       bool    `json:"write"` // 是否会修改项目数据
 }
 
 // ToolCallResult 工具调用结果
@@ -92,4 +127,6 @@ type ToolCallResult struct {
 	Error      string                 `json:"error,omitempty"`
 	DurationMs int64                  `json:"duration_ms"`
 	Params     map[string]interface{} `json:"params,omitempty"`
+	// InjectionFindings 工具输出中命中的提示词注入特征
+	InjectionFindings []guard.Finding `json:"injection_findings,omitempty"`
 }
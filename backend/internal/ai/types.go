@@ -1,47 +1,34 @@
 package ai
 
-import "context"
+import "github.com/zibianqu/novel-study/internal/ai/llm"
 
-// Agent 接口定义
-type Agent interface {
-	Execute(ctx context.Context, req *AgentRequest) (*AgentResponse, error)
-	ExecuteStream(ctx context.Context, req *AgentRequest, callback func(string)) error
-	GetName() string
-	GetDescription() string
+// BudgetGuard 预算检查
+// 在调用模型前检查用户与项目的用量，超出预算时返回错误，接近预算时返回提醒信息
+type BudgetGuard interface {
+	CheckBudget(userID, projectID int) ([]string, error)
 }
 
-// AgentConfig Agent配置
-type AgentConfig struct {
-	AgentKey     string   `json:"agent_key"`
-	Name         string   `json:"name"`
-	Description  string   `json:"description"`
-	SystemPrompt string   `json:"system_prompt"`
-	Model        string   `json:"model"`
-	Temperature  float64  `json:"temperature"`
-	MaxTokens    int      `json:"max_tokens"`
-	Tools        []string `json:"tools"`
+// ProviderResolver 按用户选择模型提供方
+// 返回 nil 表示用户未配置自己的 API 密钥，使用系统默认的提供方
+type ProviderResolver interface {
+	ProviderFor(userID int) (llm.LLMProvider, error)
 }
 
-// AgentRequest Agent请求
-type AgentRequest struct {
-	Prompt      string                 `json:"prompt"`
-	Context     map[string]interface{} `json:"context"`      // 修复: string -> map
-	ProjectID   int                    `json:"project_id"`
-	Metadata    map[string]interface{} `json:"metadata"`
-	MaxTokens   int                    `json:"max_tokens"`
-	Temperature float64                `json:"temperature"`
+// PromptTemplateResolver 按Agent与项目解析系统提示词模板，项目覆盖模板优先于全局模板
+// 返回 nil 表示没有对应的模板，使用Agent配置中的系统提示词
+type PromptTemplateResolver interface {
+	ResolveAgentPrompt(agentKey string, projectID int, data map[string]interface{}) (*ResolvedPrompt, error)
 }
 
-// AgentResponse Agent响应
-type AgentResponse struct {
-	Content    string                 `json:"content"`
-	TokensUsed int                    `json:"tokens_used"`
-	DurationMs int64                  `json:"duration_ms"`
-	Metadata   map[string]interface{} `json:"metadata"`
+// ResolvedPrompt 渲染后的系统提示词及其模板版本
+type ResolvedPrompt struct {
+	Content   string
+	VersionID int
 }
 
-// ChatMessage 聊天消息
-type ChatMessage struct {
-	Role    string `json:"role"`    // "system", "user", "assistant"
-	Content string `json:"content"`
+// AgentPromptInfo Agent实际使用的系统提示词与模型，用于调试 Prompt
+type AgentPromptInfo struct {
+	SystemPrompt            string `json:"system_prompt"`
+	Model                   string `json:"model"`
+	PromptTemplateVersionID int    `json:"prompt_template_version_id,omitempty"`
 }
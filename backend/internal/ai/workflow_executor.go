@@ -0,0 +1,107 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zibianqu/novel-study/internal/ai/collaboration"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+)
+
+// dependencyPrefix 调度器将依赖任务的输出以 dependency_<任务ID> 放入任务上下文
+const dependencyPrefix = "dependency_"
+
+// WorkflowExecutor 通过引擎中的Agent执行工作流任务，实现 collaboration.AgentExecutor
+// 用量按任务上下文中的 user_id、project_id 记录，并通过 collaboration.RecordUsage 计入任务
+type WorkflowExecutor struct {
+	engine *Engine
+}
+
+// WorkflowExecutor 创建工作流任务执行器
+func (e *Engine) WorkflowExecutor() *WorkflowExecutor {
+	return &WorkflowExecutor{engine: e}
+}
+
+// Execute 执行引擎中的Agent：自定义模板按 agent_key (包括扩展Agent)，内置模板按核心Agent编号
+// 上下文中有部分输出回调时流式执行
+func (x *WorkflowExecutor) Execute(ctx context.Context, agent collaboration.AgentRef, input string, taskContext map[string]interface{}) (string, error) {
+	req := workflowRequest(input, taskContext)
+
+	var (
+		resp *llm.AgentResponse
+		err  error
+	)
+	callback := collaboration.OutputCallback(ctx)
+	switch {
+	case agent.Key != "" && callback != nil:
+		resp, err = x.engine.ExecuteAgentStream(ctx, agent.Key, req, callback)
+	case agent.Key != "":
+		resp, err = x.engine.ExecuteAgent(ctx, agent.Key, req)
+	case callback != nil:
+		resp, err = x.engine.ExecuteAgentStreamByID(ctx, agent.ID, req, callback)
+	default:
+		resp, err = x.engine.ExecuteAgentByID(ctx, agent.ID, req)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	collaboration.RecordUsage(ctx, resp.TokensUsed)
+	return resp.Content, nil
+}
+
+// workflowRequest 将任务输入与上下文 (包括依赖任务的输出) 转换为Agent请求
+// 输入为空的任务 (如审核上游内容) 以依赖任务的输出作为提示词
+func workflowRequest(input string, taskContext map[string]interface{}) *llm.AgentRequest {
+	reqContext := make(map[string]interface{}, len(taskContext))
+	for k, v := range taskContext {
+		reqContext[k] = v
+	}
+
+	prompt := input
+	if strings.TrimSpace(prompt) == "" {
+		prompt = dependencyPrompt(reqContext)
+	}
+
+	return &llm.AgentRequest{
+		Prompt:     prompt,
+		Context:    reqContext,
+		ProjectID:  contextInt(reqContext, "project_id"),
+		UserID:     contextInt(reqContext, "user_id"),
+		ActionType: "workflow",
+	}
+}
+
+// dependencyPrompt 按任务ID顺序拼接依赖任务的输出，没有依赖时返回通用提示
+func dependencyPrompt(taskContext map[string]interface{}) string {
+	var ids []string
+	for k := range taskContext {
+		if strings.HasPrefix(k, dependencyPrefix) {
+			ids = append(ids, strings.TrimPrefix(k, dependencyPrefix))
+		}
+	}
+	if len(ids) == 0 {
+		return "请根据上下文完成本任务。"
+	}
+	sort.Strings(ids)
+
+	var b strings.Builder
+	b.WriteString("请基于以下上游任务的输出完成本任务。\n")
+	for _, id := range ids {
+		b.WriteString(fmt.Sprintf("\n### %s\n%v\n", id, taskContext[dependencyPrefix+id]))
+	}
+	return b.String()
+}
+
+// contextInt 读取上下文中的整数，从数据库恢复的运行中数字为 float64
+func contextInt(taskContext map[string]interface{}, key string) int {
+	switch v := taskContext[key].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -44,6 +45,17 @@ type Config struct {
 	AIRateLimit    int
 	AIRateWindow   time.Duration
 
+	// AI 预算配置 (未单独设置预算的用户/项目使用，0 表示不限制，费用单位为美元)
+	UserDailyTokenBudget      int64
+	UserMonthlyTokenBudget    int64
+	UserDailyCostBudget       float64
+	UserMonthlyCostBudget     float64
+	ProjectDailyTokenBudget   int64
+	ProjectMonthlyTokenBudget int64
+	ProjectDailyCostBudget    float64
+	ProjectMonthlyCostBudget  float64
+	BudgetWarnRatio           float64 // 用量达到预算的该比例时发出提醒
+
 	// 密码策略
 	PasswordMinLength     int
 	PasswordRequireLetters bool
@@ -56,7 +68,20 @@ type Config struct {
 	UserSessionCacheTTL   time.Duration
 
 	// OpenAI 配置
-	OpenAIAPIKey string
+	OpenAIAPIKey  string
+	OpenAIBaseURL string              // OpenAI 兼容服务地址，为空时使用官方地址
+	LLMProviders  []LLMProviderConfig // 额外的 OpenAI 兼容提供方，模型名以 "名称:" 开头时使用
+
+	// 模型调用录制回放 (用于离线测试与演示)，目录为空时关闭
+	LLMFixtureDir    string
+	LLMFixtureMode   string // replay / record
+	LLMFixtureStrict bool   // 回放时遇到未录制的请求直接失败
+
+	// Prompt 上下文预算 (Token)，超出时低优先级片段会被压缩为摘要
+	PromptMaxTokens int
+
+	// 管理员配置
+	AdminUserIDs []int // 可访问管理接口的用户ID
 
 	// 服务器配置
 	Environment string
@@ -100,6 +125,17 @@ func Load() *Config {
 		APIRateWindow: getEnvDuration("API_RATE_WINDOW", time.Minute),
 		AIRateLimit:   getEnvInt("AI_RATE_LIMIT", 10),
 		AIRateWindow:  getEnvDuration("AI_RATE_WINDOW", time.Minute),
+
+		// AI 预算
+		UserDailyTokenBudget:      getEnvInt64("USER_DAILY_TOKEN_BUDGET", 0),
+		UserMonthlyTokenBudget:    getEnvInt64("USER_MONTHLY_TOKEN_BUDGET", 0),
+		UserDailyCostBudget:       getEnvFloat("USER_DAILY_COST_BUDGET", 0),
+		UserMonthlyCostBudget:     getEnvFloat("USER_MONTHLY_COST_BUDGET", 0),
+		ProjectDailyTokenBudget:   getEnvInt64("PROJECT_DAILY_TOKEN_BUDGET", 0),
+		ProjectMonthlyTokenBudget: getEnvInt64("PROJECT_MONTHLY_TOKEN_BUDGET", 0),
+		ProjectDailyCostBudget:    getEnvFloat("PROJECT_DAILY_COST_BUDGET", 0),
+		ProjectMonthlyCostBudget:  getEnvFloat("PROJECT_MONTHLY_COST_BUDGET", 0),
+		BudgetWarnRatio:           getEnvFloat("BUDGET_WARN_RATIO", 0.8),
 		
 		// 密码策略
 		PasswordMinLength:     getEnvInt("PASSWORD_MIN_LENGTH", 8),
@@ -113,8 +149,19 @@ func Load() *Config {
 		UserSessionCacheTTL: getEnvDuration("USER_SESSION_CACHE_TTL", 24*time.Hour),
 		
 		// OpenAI
-		OpenAIAPIKey: getEnv("OPENAI_API_KEY", ""),
+		OpenAIAPIKey:  getEnv("OPENAI_API_KEY", ""),
+		OpenAIBaseURL: getEnv("OPENAI_BASE_URL", ""),
+		LLMProviders:  getEnvProviders("LLM_PROVIDERS"),
+
+		LLMFixtureDir:    getEnv("LLM_FIXTURE_DIR", ""),
+		LLMFixtureMode:   getEnv("LLM_FIXTURE_MODE", "replay"),
+		LLMFixtureStrict: getEnvBool("LLM_FIXTURE_STRICT", false),
+
+		PromptMaxTokens: getEnvInt("PROMPT_MAX_TOKENS", 12000),
 		
+		// 管理员
+		AdminUserIDs: getEnvIntList("ADMIN_USER_IDS"),
+
 		// 服务器
 		Environment: getEnv("ENVIRONMENT", "development"),
 		Debug:       getEnvBool("DEBUG", false),
@@ -151,6 +198,32 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// LLMProviderConfig 额外的模型提供方配置
+type LLMProviderConfig struct {
+	Name    string
+	BaseURL string
+	APIKey  string
+}
+
+// getEnvProviders 解析 "名称=地址,名称=地址" 格式的提供方列表
+// 密钥从 LLM_PROVIDER_<名称>_API_KEY 读取，本地服务可不设置
+func getEnvProviders(key string) []LLMProviderConfig {
+	var providers []LLMProviderConfig
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		name, baseURL, ok := strings.Cut(strings.TrimSpace(item), "=")
+		name, baseURL = strings.TrimSpace(name), strings.TrimSpace(baseURL)
+		if !ok || name == "" || baseURL == "" {
+			continue
+		}
+		providers = append(providers, LLMProviderConfig{
+			Name:    name,
+			BaseURL: baseURL,
+			APIKey:  getEnv("LLM_PROVIDER_"+strings.ToUpper(name)+"_API_KEY", "none"),
+		})
+	}
+	return providers
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -167,6 +240,34 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvInt64(key string, defaultValue int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		if intValue, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvIntList(key string) []int {
+	var values []int
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		if intValue, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			values = append(values, intValue)
+		}
+	}
+	return values
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -276,8 +276,7 @@ func (r *Neo4jRepository) FindPath(
 	}
 
 	result, err := r.client.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
-		result, err := tx.Run(ctx, query, params)
-		if err != nil {
+		if _, err := tx.Run(ctx, query, params); err != nil {
 			return nil, err
 		}
 
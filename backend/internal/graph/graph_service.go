@@ -2,7 +2,6 @@ package graph
 
 import (
 	"context"
-	"fmt"
 )
 
 // GraphService 图谱服务
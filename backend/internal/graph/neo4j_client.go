@@ -37,10 +37,10 @@ func NewNeo4jClient(config *Neo4jConfig) (*Neo4jClient, error) {
 	driver, err := neo4j.NewDriverWithContext(
 		config.URI,
 		neo4j.BasicAuth(config.Username, config.Password, ""),
-		func(config *neo4j.Config) {
-			config.MaxConnectionPoolSize = config.MaxConnectionPoolSize
-			config.MaxConnectionLifetime = config.MaxConnectionLifetime
-			config.ConnectionAcquisitionTimeout = config.ConnectionTimeout
+		func(c *neo4j.Config) {
+			c.MaxConnectionPoolSize = config.MaxConnectionPoolSize
+			c.MaxConnectionLifetime = config.MaxConnectionLifetime
+			c.ConnectionAcquisitionTimeout = config.ConnectionTimeout
 		},
 	)
 	if err != nil {
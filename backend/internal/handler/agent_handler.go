@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zibianqu/novel-study/internal/model"
+	"github.com/zibianqu/novel-study/internal/service"
+)
+
+// AgentHandler 用户扩展Agent处理器
+type AgentHandler struct {
+	service *service.AgentService
+}
+
+func NewAgentHandler(service *service.AgentService) *AgentHandler {
+	return &AgentHandler{service: service}
+}
+
+// CreateAgent 创建扩展Agent
+func (h *AgentHandler) CreateAgent(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req model.CreateAgentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	agent, err := h.service.CreateAgent(userID, &req)
+	if err != nil {
+		h.respondError(c, err, "创建Agent失败")
+		return
+	}
+
+	c.JSON(http.StatusCreated, agent)
+}
+
+// GetAgents 获取当前用户的扩展Agent列表
+func (h *AgentHandler) GetAgents(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	agents, err := h.service.GetUserAgents(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取Agent列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"agents": agents})
+}
+
+// GetAgent 获取扩展Agent详情
+func (h *AgentHandler) GetAgent(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	agentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的Agent ID"})
+		return
+	}
+
+	agent, err := h.service.GetAgent(agentID, userID)
+	if err != nil {
+		h.respondError(c, err, "获取Agent失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, agent)
+}
+
+// UpdateAgent 更新扩展Agent
+func (h *AgentHandler) UpdateAgent(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	agentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的Agent ID"})
+		return
+	}
+
+	var req model.UpdateAgentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	agent, err := h.service.UpdateAgent(agentID, userID, &req)
+	if err != nil {
+		h.respondError(c, err, "更新Agent失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, agent)
+}
+
+// DeleteAgent 删除扩展Agent
+func (h *AgentHandler) DeleteAgent(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	agentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的Agent ID"})
+		return
+	}
+
+	if err := h.service.DeleteAgent(agentID, userID); err != nil {
+		h.respondError(c, err, "删除失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Agent已删除"})
+}
+
+// RunAgent 运行扩展Agent
+func (h *AgentHandler) RunAgent(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	agentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的Agent ID"})
+		return
+	}
+
+	var req model.RunAgentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.service.RunAgent(c.Request.Context(), agentID, userID, &req)
+	if err != nil {
+		h.respondError(c, err, "运行Agent失败: "+err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// respondError 将服务层错误映射为 HTTP 状态码
+func (h *AgentHandler) respondError(c *gin.Context, err error, fallback string) {
+	if respondBudgetExceeded(c, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agent不存在"})
+	case errors.Is(err, service.ErrInvalidAgent):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -1,9 +1,12 @@
 package handler
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/zibianqu/novel-study/internal/model"
 	"github.com/zibianqu/novel-study/internal/service"
 )
 
@@ -31,6 +34,9 @@ func (h *AIHandler) Chat(c *gin.Context) {
 
 	resp, err := h.service.Chat(c.Request.Context(), userID, req.ProjectID, req.Message)
 	if err != nil {
+		if respondBudgetExceeded(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -38,6 +44,61 @@ func (h *AIHandler) Chat(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
+// EstimateChat 生成前预估对话的 Token 用量与费用上限
+func (h *AIHandler) EstimateChat(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req struct {
+		ProjectID int    `json:"project_id" binding:"required"`
+		Message   string `json:"message" binding:"required"`
+		AgentKey  string `json:"agent_key"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	estimate, err := h.service.EstimateChat(userID, req.ProjectID, req.AgentKey, req.Message)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "项目不存在"})
+		case errors.Is(err, service.ErrForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, estimate)
+}
+
+// InspectPrompt 调试 Prompt：返回Agent将收到的系统消息与用户消息、各片段 Token 数及注入的 RAG 文档，不调用模型
+func (h *AIHandler) InspectPrompt(c *gin.Context) {
+	var req model.InspectPromptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	inspection, err := h.service.InspectPrompt(c.Request.Context(), c.GetInt("user_id"), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "项目或章节不存在"})
+		case errors.Is(err, service.ErrForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, inspection)
+}
+
 // ChatStream 流式对话 (SSE) - 修复版
 func (h *AIHandler) ChatStream(c *gin.Context) {
 	userID := c.GetInt("user_id")
@@ -64,6 +125,21 @@ func (h *AIHandler) ChatStream(c *gin.Context) {
 		return
 	}
 
+	// 超出预算时直接返回 JSON 错误
+	warnings, err := h.service.CheckBudget(userID, req.ProjectID)
+	if err != nil {
+		switch {
+		case respondBudgetExceeded(c, err):
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "项目不存在"})
+		case errors.Is(err, service.ErrForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
 	// ✅ 参数验证通过，现在可以设置 SSE 头
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
@@ -77,20 +153,34 @@ func (h *AIHandler) ChatStream(c *gin.Context) {
 		return
 	}
 
+	// 生成开始前先发送预算提醒
+	if len(warnings) > 0 {
+		c.SSEvent("warning", gin.H{"budget_warnings": warnings})
+		flusher.Flush()
+	}
+
 	// 流式输出回调
 	callback := func(chunk string) {
 		c.SSEvent("message", chunk)
 		flusher.Flush()
 	}
 
-	err := h.service.ChatStream(c.Request.Context(), userID, req.ProjectID, req.Message, callback)
+	resp, err := h.service.ChatStream(c.Request.Context(), userID, req.ProjectID, req.Message, callback)
 	if err != nil {
+		// 客户端已断开时不再写入
+		if c.Request.Context().Err() != nil {
+			return
+		}
 		c.SSEvent("error", err.Error())
 		flusher.Flush()
 		return
 	}
 
-	c.SSEvent("done", "")
+	c.SSEvent("done", gin.H{
+		"tokens_used": resp.TokensUsed,
+		"duration_ms": resp.DurationMs,
+		"metadata":    resp.Metadata,
+	})
 	flusher.Flush()
 }
 
@@ -111,6 +201,9 @@ func (h *AIHandler) GenerateChapter(c *gin.Context) {
 
 	resp, err := h.service.GenerateChapter(c.Request.Context(), userID, req.ProjectID, req.ChapterTitle, req.Outline)
 	if err != nil {
+		if respondBudgetExceeded(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -134,6 +227,9 @@ func (h *AIHandler) CheckQuality(c *gin.Context) {
 
 	resp, err := h.service.CheckQuality(c.Request.Context(), userID, req.ProjectID, req.Content)
 	if err != nil {
+		if respondBudgetExceeded(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -151,3 +247,24 @@ func (h *AIHandler) GetAgents(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"agents": agents})
 }
+
+// ReloadAgents 从数据库重新加载Agent定义（管理员）
+func (h *AIHandler) ReloadAgents(c *gin.Context) {
+	count, err := h.service.ReloadAgents()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重新加载 Agent 失败: " + err.Error()})
+		return
+	}
+
+	agents, _ := h.service.GetAgents()
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Agent 定义已重新加载",
+		"count":   count,
+		"agents":  agents,
+	})
+}
+
+// GetTools 获取工具列表及参数定义
+func (h *AIHandler) GetTools(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"tools": h.service.GetTools()})
+}
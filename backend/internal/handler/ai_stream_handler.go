@@ -2,37 +2,53 @@ package handler
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/zibianqu/novel-study/internal/ai"
+	"github.com/zibianqu/novel-study/internal/ai/guard"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/ai/prompt"
+	"github.com/zibianqu/novel-study/internal/repository"
+	"github.com/zibianqu/novel-study/internal/service"
 
 	"github.com/gin-gonic/gin"
 )
 
 // AIStreamHandler AI 流式生成Handler
 type AIStreamHandler struct {
-	aiEngine *ai.Engine
+	aiEngine    *ai.Engine
+	projectRepo *repository.ProjectRepository
+	summaries   *service.SummaryService
+	prompts     *prompt.PromptService
 }
 
 // NewAIStreamHandler 创建Handler
-func NewAIStreamHandler(aiEngine *ai.Engine) *AIStreamHandler {
+func NewAIStreamHandler(aiEngine *ai.Engine, projectRepo *repository.ProjectRepository) *AIStreamHandler {
 	return &AIStreamHandler{
-		aiEngine: aiEngine,
+		aiEngine:    aiEngine,
+		projectRepo: projectRepo,
 	}
 }
 
+// SetLongRangeMemory 设置续写时使用的章节/卷摘要，指定 chapter_id 时生效
+func (h *AIStreamHandler) SetLongRangeMemory(summaries *service.SummaryService, prompts *prompt.PromptService) {
+	h.summaries = summaries
+	h.prompts = prompts
+}
+
 // ContinueWriteRequest 续写请求
 type ContinueWriteRequest struct {
-	ProjectID     int                    `json:"project_id" binding:"required"`
-	ChapterID     int                    `json:"chapter_id"`
-	Context       string                 `json:"context"`       // 上下文
-	Length        int                    `json:"length"`        // 生成长度
-	Style         string                 `json:"style"`         // 风格要求
-	CustomPrompt  string                 `json:"custom_prompt"` // 自定义提示
-	AgentID       int                    `json:"agent_id"`      // 指定 Agent (0=自动选择)
-	ExtraContext  map[string]interface{} `json:"extra_context"` // 额外上下文
+	ProjectID    int                    `json:"project_id" binding:"required"`
+	ChapterID    int                    `json:"chapter_id"`
+	Context      string                 `json:"context"`       // 上下文
+	Length       int                    `json:"length"`        // 生成长度
+	Style        string                 `json:"style"`         // 风格要求
+	CustomPrompt string                 `json:"custom_prompt"` // 自定义提示
+	AgentID      int                    `json:"agent_id"`      // 指定 Agent (0=自动选择)
+	ExtraContext map[string]interface{} `json:"extra_context"` // 额外上下文
 }
 
 // PolishRequest 润色请求
@@ -64,7 +80,7 @@ type ChatRequest struct {
 
 // ChatMessage 对话消息
 type ChatMessage struct {
-	Role    string `json:"role"`    // user, assistant
+	Role    string `json:"role"` // user, assistant
 	Content string `json:"content"`
 }
 
@@ -82,11 +98,16 @@ func (h *AIStreamHandler) ContinueWrite(c *gin.Context) {
 		return
 	}
 
-	// 创建 SSE 写入器
-	stream := NewSSEStreamHandler(c)
+	stream, ok := h.openStream(c, req.ProjectID)
+	if !ok {
+		return
+	}
 
-	// 构建提示词
-	prompt := h.buildContinuePrompt(&req)
+	// 构建提示词，指定章节时带上前几章与之前各卷的摘要
+	prompt, ok := h.buildContinuePromptWithMemory(c.Request.Context(), c.GetInt("user_id"), &req)
+	if !ok {
+		prompt = h.buildContinuePrompt(&req)
+	}
 
 	// 准备上下文
 	context := req.ExtraContext
@@ -99,7 +120,13 @@ func (h *AIStreamHandler) ContinueWrite(c *gin.Context) {
 	context["style"] = req.Style
 
 	// 执行流式生成
-	h.executeStream(c.Request.Context(), stream, req.AgentID, prompt, context)
+	h.executeStream(c.Request.Context(), stream, req.AgentID, &llm.AgentRequest{
+		Prompt:     prompt,
+		Context:    context,
+		ProjectID:  req.ProjectID,
+		UserID:     c.GetInt("user_id"),
+		ActionType: "stream_continue",
+	})
 }
 
 // Polish 润色接口 (SSE)
@@ -116,7 +143,10 @@ func (h *AIStreamHandler) Polish(c *gin.Context) {
 		return
 	}
 
-	stream := NewSSEStreamHandler(c)
+	stream, ok := h.openStream(c, req.ProjectID)
+	if !ok {
+		return
+	}
 	prompt := h.buildPolishPrompt(&req)
 
 	context := req.ExtraContext
@@ -128,7 +158,13 @@ func (h *AIStreamHandler) Polish(c *gin.Context) {
 	context["original_content"] = req.Content
 
 	// 使用审核导演 (Agent 3) 进行润色
-	h.executeStream(c.Request.Context(), stream, 3, prompt, context)
+	h.executeStream(c.Request.Context(), stream, 3, &llm.AgentRequest{
+		Prompt:     prompt,
+		Context:    context,
+		ProjectID:  req.ProjectID,
+		UserID:     c.GetInt("user_id"),
+		ActionType: "stream_polish",
+	})
 }
 
 // Rewrite 改写接口 (SSE)
@@ -145,7 +181,10 @@ func (h *AIStreamHandler) Rewrite(c *gin.Context) {
 		return
 	}
 
-	stream := NewSSEStreamHandler(c)
+	stream, ok := h.openStream(c, req.ProjectID)
+	if !ok {
+		return
+	}
 	prompt := h.buildRewritePrompt(&req)
 
 	context := req.ExtraContext
@@ -157,7 +196,13 @@ func (h *AIStreamHandler) Rewrite(c *gin.Context) {
 	context["original_content"] = req.Content
 
 	// 默认使用旁白叙述者 (Agent 1)
-	h.executeStream(c.Request.Context(), stream, 1, prompt, context)
+	h.executeStream(c.Request.Context(), stream, 1, &llm.AgentRequest{
+		Prompt:     prompt,
+		Context:    context,
+		ProjectID:  req.ProjectID,
+		UserID:     c.GetInt("user_id"),
+		ActionType: "stream_rewrite",
+	})
 }
 
 // Chat 对话接口 (SSE)
@@ -174,7 +219,10 @@ func (h *AIStreamHandler) Chat(c *gin.Context) {
 		return
 	}
 
-	stream := NewSSEStreamHandler(c)
+	stream, ok := h.openStream(c, req.ProjectID)
+	if !ok {
+		return
+	}
 
 	context := req.ExtraContext
 	if context == nil {
@@ -183,7 +231,11 @@ func (h *AIStreamHandler) Chat(c *gin.Context) {
 	if req.ProjectID > 0 {
 		context["project_id"] = req.ProjectID
 	}
-	context["history"] = req.History
+
+	history := make([]llm.ChatMessage, len(req.History))
+	for i, msg := range req.History {
+		history[i] = llm.ChatMessage{Role: msg.Role, Content: msg.Content}
+	}
 
 	// 默认使用总导演 (Agent 0)
 	agentID := req.AgentID
@@ -191,50 +243,145 @@ func (h *AIStreamHandler) Chat(c *gin.Context) {
 		agentID = 0
 	}
 
-	h.executeStream(c.Request.Context(), stream, agentID, req.Message, context)
+	h.executeStream(c.Request.Context(), stream, agentID, &llm.AgentRequest{
+		Prompt:     req.Message,
+		Context:    context,
+		ProjectID:  req.ProjectID,
+		UserID:     c.GetInt("user_id"),
+		ActionType: "stream_chat",
+		History:    history,
+	})
+}
+
+// checkProjectAccess 在进入 SSE 模式前校验项目权限，失败时直接返回 JSON 错误
+// projectID 为 0 表示不关联项目
+func (h *AIStreamHandler) checkProjectAccess(c *gin.Context, projectID int) bool {
+	if projectID == 0 {
+		return true
+	}
+
+	project, err := h.projectRepo.GetByID(projectID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "项目不存在"})
+		return false
+	}
+	if project.UserID != c.GetInt("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问此项目"})
+		return false
+	}
+	return true
+}
+
+// openStream 校验项目权限与预算后进入 SSE 模式，并在生成开始前发送预算提醒
+// 校验失败时直接返回 JSON 错误
+func (h *AIStreamHandler) openStream(c *gin.Context, projectID int) (*SSEStreamHandler, bool) {
+	if !h.checkProjectAccess(c, projectID) {
+		return nil, false
+	}
+	warnings, ok := h.checkBudget(c, projectID)
+	if !ok {
+		return nil, false
+	}
+
+	stream := NewSSEStreamHandler(c)
+	if err := stream.OnBudgetWarnings(warnings); err != nil {
+		log.Printf("Failed to send budget warnings: %v", err)
+	}
+	return stream, true
+}
+
+// checkBudget 在进入 SSE 模式前检查预算，超出时直接返回 JSON 错误，接近上限时返回提醒
+func (h *AIStreamHandler) checkBudget(c *gin.Context, projectID int) ([]string, bool) {
+	warnings, err := h.aiEngine.CheckBudget(c.GetInt("user_id"), projectID)
+	if err != nil {
+		if !respondBudgetExceeded(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return warnings, true
 }
 
 // executeStream 执行流式生成
+// 生成过程中的模型错误以 SSE error 事件返回，完成事件携带 Token 用量
 func (h *AIStreamHandler) executeStream(
 	ctx context.Context,
 	stream *SSEStreamHandler,
 	agentID int,
-	prompt string,
-	context map[string]interface{},
+	req *llm.AgentRequest,
 ) {
 	start := time.Now()
 
-	// 创建请求
-	req := &ai.AgentRequest{
-		Prompt:  prompt,
-		Context: context,
-	}
+	// 流式接口输出正文，不使用Agent的结构化输出 (如借用审核导演润色)
+	req.RawOutput = true
 
 	// 执行流式生成
-	err := h.aiEngine.ExecuteAgentStream(ctx, agentID, req, func(chunk string) {
+	resp, err := h.aiEngine.ExecuteAgentStreamByID(ctx, agentID, req, func(chunk string) {
 		if err := stream.OnChunk(chunk); err != nil {
 			log.Printf("Failed to send chunk: %v", err)
 		}
 	})
 
 	if err != nil {
+		// 客户端断开时无需再写入
+		if ctx.Err() != nil {
+			log.Printf("Stream canceled by client: %v", err)
+			return
+		}
 		stream.OnError(err)
 		return
 	}
 
 	// 发送完成信号
 	stream.OnComplete(map[string]interface{}{
-		"duration_ms": time.Since(start).Milliseconds(),
-		"agent_id":    agentID,
+		"duration_ms":       time.Since(start).Milliseconds(),
+		"agent_id":          agentID,
+		"model":             resp.Model,
+		"finish_reason":     resp.Metadata["finish_reason"],
+		"prompt_tokens":     resp.Usage.PromptTokens,
+		"completion_tokens": resp.Usage.CompletionTokens,
+		"total_tokens":      resp.Usage.TotalTokens,
+		"budget_warnings":   resp.Metadata["budget_warnings"],
 	})
 }
 
+// buildContinuePromptWithMemory 使用完整的当前章节、前几章摘要与卷级摘要构建续写提示词
+// 超出预算的片段由摘要Agent压缩，用量计入当前用户与项目
+// 未配置摘要服务、未指定章节或加载失败时返回 false
+func (h *AIStreamHandler) buildContinuePromptWithMemory(ctx context.Context, userID int, req *ContinueWriteRequest) (string, bool) {
+	if h.summaries == nil || h.prompts == nil || req.ChapterID <= 0 {
+		return "", false
+	}
+
+	options, err := h.summaries.ContinueWriteMemory(req.ProjectID, req.ChapterID, 0)
+	if err != nil {
+		log.Printf("⚠️ 加载章节 %d 的摘要失败: %v", req.ChapterID, err)
+		return "", false
+	}
+	// 前端传入的上下文 (如光标前的内容) 优先于完整章节
+	if req.Context != "" {
+		options.Context = req.Context
+		options.FullContext = false
+	}
+	options.Length = req.Length
+	options.Style = req.Style
+	options.CustomPrompt = req.CustomPrompt
+	options.Summarizer = h.aiEngine.Summarizer(userID, req.ProjectID)
+
+	result, err := h.prompts.BuildContinueWritePrompt(ctx, "", options)
+	if err != nil {
+		log.Printf("⚠️ 构建续写提示词失败: %v", err)
+		return "", false
+	}
+	return result, true
+}
+
 // buildContinuePrompt 构建续写提示词
 func (h *AIStreamHandler) buildContinuePrompt(req *ContinueWriteRequest) string {
 	prompt := "请续写以下内容\n\n"
 
 	if req.Context != "" {
-		prompt += "上下文：\n" + req.Context + "\n\n"
+		prompt += "上下文：\n" + guard.WrapUserContent("context", req.Context) + "\n\n"
 	}
 
 	if req.Style != "" {
@@ -246,7 +393,7 @@ func (h *AIStreamHandler) buildContinuePrompt(req *ContinueWriteRequest) string
 	}
 
 	if req.CustomPrompt != "" {
-		prompt += "\n" + req.CustomPrompt + "\n"
+		prompt += "\n附加要求：\n" + guard.WrapUserContent("custom_prompt", req.CustomPrompt) + "\n"
 	}
 
 	prompt += "\n请开始续写："
@@ -258,7 +405,7 @@ func (h *AIStreamHandler) buildContinuePrompt(req *ContinueWriteRequest) string
 func (h *AIStreamHandler) buildPolishPrompt(req *PolishRequest) string {
 	prompt := "请对以下内容进行润色\n\n"
 
-	prompt += "原文：\n" + req.Content + "\n\n"
+	prompt += "原文：\n" + guard.WrapUserContent("content", req.Content) + "\n\n"
 
 	switch req.PolishType {
 	case "grammar":
@@ -272,7 +419,7 @@ func (h *AIStreamHandler) buildPolishPrompt(req *PolishRequest) string {
 	}
 
 	if req.CustomPrompt != "" {
-		prompt += "\n" + req.CustomPrompt + "\n"
+		prompt += "\n附加要求：\n" + guard.WrapUserContent("custom_prompt", req.CustomPrompt) + "\n"
 	}
 
 	prompt += "\n请输出润色后的内容："
@@ -284,7 +431,7 @@ func (h *AIStreamHandler) buildPolishPrompt(req *PolishRequest) string {
 func (h *AIStreamHandler) buildRewritePrompt(req *RewriteRequest) string {
 	prompt := "请根据以下指令改写内容\n\n"
 
-	prompt += "原文：\n" + req.Content + "\n\n"
+	prompt += "原文：\n" + guard.WrapUserContent("content", req.Content) + "\n\n"
 	prompt += "改写指令：" + req.Instruction + "\n"
 
 	if req.Style != "" {
@@ -295,5 +442,3 @@ func (h *AIStreamHandler) buildRewritePrompt(req *RewriteRequest) string {
 
 	return prompt
 }
-
-import "fmt"
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zibianqu/novel-study/internal/service"
+)
+
+// APIKeyHandler 用户自带 API 密钥处理器
+type APIKeyHandler struct {
+	service *service.APIKeyService
+}
+
+func NewAPIKeyHandler(service *service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{service: service}
+}
+
+// SetAPIKeyRequest 设置 API 密钥请求
+type SetAPIKeyRequest struct {
+	APIKey string `json:"api_key" binding:"required"`
+}
+
+// GetAPIKey 获取是否已设置 API 密钥（不返回密钥）
+func (h *APIKeyHandler) GetAPIKey(c *gin.Context) {
+	status, err := h.service.GetStatus(c.GetInt("user_id"))
+	if err != nil {
+		h.respondError(c, err, "获取 API 密钥状态失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// SetAPIKey 验证并保存 API 密钥
+func (h *APIKeyHandler) SetAPIKey(c *gin.Context) {
+	var req SetAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "api_key 不能为空"})
+		return
+	}
+
+	status, err := h.service.SetAPIKey(c.Request.Context(), c.GetInt("user_id"), req.APIKey)
+	if err != nil {
+		h.respondError(c, err, "保存 API 密钥失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// TestAPIKey 验证已保存的 API 密钥
+func (h *APIKeyHandler) TestAPIKey(c *gin.Context) {
+	if err := h.service.TestAPIKey(c.Request.Context(), c.GetInt("user_id")); err != nil {
+		h.respondError(c, err, "验证 API 密钥失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"valid": true, "message": "API 密钥可用"})
+}
+
+// DeleteAPIKey 删除 API 密钥
+func (h *APIKeyHandler) DeleteAPIKey(c *gin.Context) {
+	if err := h.service.DeleteAPIKey(c.GetInt("user_id")); err != nil {
+		h.respondError(c, err, "删除 API 密钥失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API 密钥已删除"})
+}
+
+// respondError 将服务层错误映射为 HTTP 状态码
+func (h *APIKeyHandler) respondError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+	case errors.Is(err, service.ErrAPIKeyNotSet):
+		c.JSON(http.StatusNotFound, gin.H{"error": "未设置 API 密钥"})
+	case errors.Is(err, service.ErrInvalidAPIKey):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
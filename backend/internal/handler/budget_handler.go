@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zibianqu/novel-study/internal/model"
+	"github.com/zibianqu/novel-study/internal/service"
+)
+
+// BudgetHandler AI 预算处理器
+type BudgetHandler struct {
+	service *service.BudgetService
+}
+
+func NewBudgetHandler(service *service.BudgetService) *BudgetHandler {
+	return &BudgetHandler{service: service}
+}
+
+// GetBudget 获取当前用户的预算执行情况
+func (h *BudgetHandler) GetBudget(c *gin.Context) {
+	status, err := h.service.GetUserBudget(c.GetInt("user_id"))
+	if err != nil {
+		h.respondError(c, err, "获取预算失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// GetProjectBudget 获取项目预算执行情况
+func (h *BudgetHandler) GetProjectBudget(c *gin.Context) {
+	projectID, ok := h.pathID(c, "无效的项目 ID")
+	if !ok {
+		return
+	}
+
+	status, err := h.service.GetProjectBudget(projectID, c.GetInt("user_id"))
+	if err != nil {
+		h.respondError(c, err, "获取预算失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// UpdateProjectBudget 设置项目预算
+func (h *BudgetHandler) UpdateProjectBudget(c *gin.Context) {
+	projectID, ok := h.pathID(c, "无效的项目 ID")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := h.service.SetProjectBudget(projectID, c.GetInt("user_id"), &req)
+	if err != nil {
+		h.respondError(c, err, "设置预算失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// GetUserBudget 获取指定用户的预算执行情况（管理员）
+func (h *BudgetHandler) GetUserBudget(c *gin.Context) {
+	userID, ok := h.pathID(c, "无效的用户 ID")
+	if !ok {
+		return
+	}
+
+	status, err := h.service.GetUserBudget(userID)
+	if err != nil {
+		h.respondError(c, err, "获取预算失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// UpdateUserBudget 设置指定用户的预算（管理员）
+func (h *BudgetHandler) UpdateUserBudget(c *gin.Context) {
+	userID, ok := h.pathID(c, "无效的用户 ID")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := h.service.SetUserBudget(userID, &req)
+	if err != nil {
+		h.respondError(c, err, "设置预算失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+func (h *BudgetHandler) pathID(c *gin.Context, message string) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondError 将服务层错误映射为 HTTP 状态码
+func (h *BudgetHandler) respondError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "项目不存在"})
+	case errors.Is(err, service.ErrInvalidBudget):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// respondBudgetExceeded 超出预算时返回 429 (Token) 或 402 (费用)，已处理时返回 true
+func respondBudgetExceeded(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrTokenBudgetExceeded):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "code": "TOKEN_BUDGET_EXCEEDED"})
+	case errors.Is(err, service.ErrCostBudgetExceeded):
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error(), "code": "COST_BUDGET_EXCEEDED"})
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zibianqu/novel-study/internal/model"
+	"github.com/zibianqu/novel-study/internal/service"
+)
+
+// ChatSessionHandler 多轮对话会话处理器
+type ChatSessionHandler struct {
+	service *service.ChatSessionService
+}
+
+func NewChatSessionHandler(service *service.ChatSessionService) *ChatSessionHandler {
+	return &ChatSessionHandler{service: service}
+}
+
+// CreateSession 创建会话
+func (h *ChatSessionHandler) CreateSession(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req model.CreateChatSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := h.service.CreateSession(userID, &req)
+	if err != nil {
+		h.respondError(c, err, "创建会话失败")
+		return
+	}
+
+	c.JSON(http.StatusCreated, session)
+}
+
+// GetProjectSessions 获取项目下的会话列表
+func (h *ChatSessionHandler) GetProjectSessions(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	projectID, err := strconv.Atoi(c.Param("projectId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的项目 ID"})
+		return
+	}
+
+	sessions, err := h.service.GetProjectSessions(projectID, userID)
+	if err != nil {
+		h.respondError(c, err, "获取会话列表失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// GetSession 获取会话详情及消息记录
+func (h *ChatSessionHandler) GetSession(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	sessionID, ok := h.sessionID(c)
+	if !ok {
+		return
+	}
+
+	session, err := h.service.GetSession(sessionID, userID)
+	if err != nil {
+		h.respondError(c, err, "获取会话失败")
+		return
+	}
+
+	messages, err := h.service.GetMessages(sessionID, userID)
+	if err != nil {
+		h.respondError(c, err, "获取消息失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"session": session, "messages": messages})
+}
+
+// RenameSession 重命名会话
+func (h *ChatSessionHandler) RenameSession(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	sessionID, ok := h.sessionID(c)
+	if !ok {
+		return
+	}
+
+	var req model.RenameChatSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := h.service.RenameSession(sessionID, userID, req.Title)
+	if err != nil {
+		h.respondError(c, err, "重命名会话失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// ForkSession 分叉会话
+func (h *ChatSessionHandler) ForkSession(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	sessionID, ok := h.sessionID(c)
+	if !ok {
+		return
+	}
+
+	var req model.ForkChatSessionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	session, err := h.service.ForkSession(sessionID, userID, &req)
+	if err != nil {
+		h.respondError(c, err, "分叉会话失败")
+		return
+	}
+
+	c.JSON(http.StatusCreated, session)
+}
+
+// DeleteSession 删除会话
+func (h *ChatSessionHandler) DeleteSession(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	sessionID, ok := h.sessionID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteSession(sessionID, userID); err != nil {
+		h.respondError(c, err, "删除失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// SendMessage 在会话中发送消息
+func (h *ChatSessionHandler) SendMessage(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	sessionID, ok := h.sessionID(c)
+	if !ok {
+		return
+	}
+
+	var req model.SendChatMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.service.SendMessage(c.Request.Context(), sessionID, userID, req.Message)
+	if err != nil {
+		h.respondError(c, err, "对话失败: "+err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// SendMessageStream 在会话中发送消息 (SSE)
+func (h *ChatSessionHandler) SendMessageStream(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	sessionID, ok := h.sessionID(c)
+	if !ok {
+		return
+	}
+
+	var req model.SendChatMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 在进入 SSE 模式前校验会话权限与预算
+	session, err := h.service.GetSession(sessionID, userID)
+	if err != nil {
+		h.respondError(c, err, "获取会话失败")
+		return
+	}
+	warnings, err := h.service.CheckBudget(userID, session.ProjectID)
+	if err != nil {
+		h.respondError(c, err, "检查预算失败")
+		return
+	}
+
+	stream := NewSSEStreamHandler(c)
+	ctx := c.Request.Context()
+	if err := stream.OnBudgetWarnings(warnings); err != nil {
+		log.Printf("Failed to send budget warnings: %v", err)
+	}
+
+	resp, err := h.service.SendMessageStream(ctx, sessionID, userID, req.Message, func(chunk string) {
+		if err := stream.OnChunk(chunk); err != nil {
+			log.Printf("Failed to send chunk: %v", err)
+		}
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		stream.OnError(err)
+		return
+	}
+
+	stream.OnComplete(map[string]interface{}{
+		"session_id":        sessionID,
+		"duration_ms":       resp.DurationMs,
+		"model":             resp.Model,
+		"finish_reason":     resp.Metadata["finish_reason"],
+		"prompt_tokens":     resp.Usage.PromptTokens,
+		"completion_tokens": resp.Usage.CompletionTokens,
+		"total_tokens":      resp.Usage.TotalTokens,
+		"budget_warnings":   resp.Metadata["budget_warnings"],
+	})
+}
+
+// sessionID 解析路径中的会话 ID
+func (h *ChatSessionHandler) sessionID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的会话 ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondError 将服务层错误映射为 HTTP 状态码
+func (h *ChatSessionHandler) respondError(c *gin.Context, err error, fallback string) {
+	if respondBudgetExceeded(c, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+	case errors.Is(err, service.ErrInvalidChatSession):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
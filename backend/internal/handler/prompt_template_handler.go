@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zibianqu/novel-study/internal/model"
+	"github.com/zibianqu/novel-study/internal/service"
+)
+
+// PromptTemplateHandler 提示词模板处理器
+// 管理员路由管理全局模板，项目路由 (/projects/:id/prompt-templates) 管理项目覆盖模板
+type PromptTemplateHandler struct {
+	service *service.PromptTemplateService
+}
+
+func NewPromptTemplateHandler(service *service.PromptTemplateService) *PromptTemplateHandler {
+	return &PromptTemplateHandler{service: service}
+}
+
+// ListTemplates 获取模板列表
+func (h *PromptTemplateHandler) ListTemplates(c *gin.Context) {
+	projectID, ok := h.projectID(c)
+	if !ok {
+		return
+	}
+
+	templates, err := h.service.ListTemplates(projectID, c.GetInt("user_id"))
+	if err != nil {
+		h.respondError(c, err, "获取模板失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// GetTemplate 获取模板详情及全部版本
+func (h *PromptTemplateHandler) GetTemplate(c *gin.Context) {
+	projectID, templateID, ok := h.ids(c)
+	if !ok {
+		return
+	}
+
+	tmpl, err := h.service.GetTemplate(templateID, projectID, c.GetInt("user_id"))
+	if err != nil {
+		h.respondError(c, err, "获取模板失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, tmpl)
+}
+
+// CreateTemplate 创建模板
+func (h *PromptTemplateHandler) CreateTemplate(c *gin.Context) {
+	projectID, ok := h.projectID(c)
+	if !ok {
+		return
+	}
+
+	var req model.CreatePromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tmpl, err := h.service.CreateTemplate(projectID, c.GetInt("user_id"), &req)
+	if err != nil {
+		h.respondError(c, err, "创建模板失败")
+		return
+	}
+
+	c.JSON(http.StatusCreated, tmpl)
+}
+
+// CreateVersion 创建新版本并立即生效
+func (h *PromptTemplateHandler) CreateVersion(c *gin.Context) {
+	projectID, templateID, ok := h.ids(c)
+	if !ok {
+		return
+	}
+
+	var req model.CreatePromptTemplateVersionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	version, err := h.service.CreateVersion(templateID, projectID, c.GetInt("user_id"), &req)
+	if err != nil {
+		h.respondError(c, err, "创建版本失败")
+		return
+	}
+
+	c.JSON(http.StatusCreated, version)
+}
+
+// Rollback 回滚到指定版本
+func (h *PromptTemplateHandler) Rollback(c *gin.Context) {
+	projectID, templateID, ok := h.ids(c)
+	if !ok {
+		return
+	}
+
+	var req model.RollbackPromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tmpl, err := h.service.Rollback(templateID, projectID, c.GetInt("user_id"), req.Version)
+	if err != nil {
+		h.respondError(c, err, "回滚模板失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, tmpl)
+}
+
+// DeleteTemplate 删除项目覆盖模板
+func (h *PromptTemplateHandler) DeleteTemplate(c *gin.Context) {
+	projectID, templateID, ok := h.ids(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteTemplate(templateID, projectID, c.GetInt("user_id")); err != nil {
+		h.respondError(c, err, "删除模板失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// projectID 项目路由返回路径中的项目 ID，管理员路由返回 0
+func (h *PromptTemplateHandler) projectID(c *gin.Context) (int, bool) {
+	if c.Param("id") == "" {
+		return 0, true
+	}
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的项目 ID"})
+		return 0, false
+	}
+	return projectID, true
+}
+
+func (h *PromptTemplateHandler) ids(c *gin.Context) (int, int, bool) {
+	projectID, ok := h.projectID(c)
+	if !ok {
+		return 0, 0, false
+	}
+	templateID, err := strconv.Atoi(c.Param("templateId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的模板 ID"})
+		return 0, 0, false
+	}
+	return projectID, templateID, true
+}
+
+// respondError 将服务层错误映射为 HTTP 状态码
+func (h *PromptTemplateHandler) respondError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "模板不存在"})
+	case errors.Is(err, service.ErrInvalidPromptTemplate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
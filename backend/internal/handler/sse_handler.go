@@ -159,7 +159,7 @@ func (w *SSEWriter) IsClosed() bool {
 
 // StreamResponse 流式响应结构
 type StreamResponse struct {
-	Type     string                 `json:"type"`     // chunk, complete, error, progress
+	Type     string                 `json:"type"`     // chunk, complete, error, progress, warning
 	Content  string                 `json:"content"`  // 内容片段
 	Metadata map[string]interface{} `json:"metadata"` // 元数据
 }
@@ -196,6 +196,18 @@ func (h *SSEStreamHandler) OnComplete(metadata map[string]interface{}) error {
 	})
 }
 
+// OnBudgetWarnings 在生成开始前发送预算提醒，没有提醒时不发送
+func (h *SSEStreamHandler) OnBudgetWarnings(warnings []string) error {
+	if len(warnings) == 0 {
+		return nil
+	}
+
+	return h.writer.WriteJSON("warning", StreamResponse{
+		Type:     "warning",
+		Metadata: map[string]interface{}{"budget_warnings": warnings},
+	})
+}
+
 // OnError 处理错误
 func (h *SSEStreamHandler) OnError(err error) error {
 	return h.writer.WriteError(err)
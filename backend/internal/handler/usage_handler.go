@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zibianqu/novel-study/internal/model"
+	"github.com/zibianqu/novel-study/internal/service"
+)
+
+// defaultUsageDays 未指定起止日期时统计最近的天数
+const defaultUsageDays = 30
+
+// UsageHandler Token 用量统计处理器
+type UsageHandler struct {
+	service *service.UsageService
+}
+
+func NewUsageHandler(service *service.UsageService) *UsageHandler {
+	return &UsageHandler{service: service}
+}
+
+// GetUsage 获取当前用户的 Token 用量
+// 查询参数: group_by (project,agent,day 逗号分隔)、project_id、agent_key、from、to (YYYY-MM-DD)
+func (h *UsageHandler) GetUsage(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	q, ok := h.parseQuery(c)
+	if !ok {
+		return
+	}
+
+	stats, err := h.service.GetUserUsage(userID, q)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, usageResponse(q, stats))
+}
+
+// GetAllUsage 获取全部用户的 Token 用量（管理员），额外支持 user_id 过滤与 user 分组
+func (h *UsageHandler) GetAllUsage(c *gin.Context) {
+	q, ok := h.parseQuery(c)
+	if !ok {
+		return
+	}
+
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户 ID"})
+			return
+		}
+		q.UserID = &id
+	}
+
+	stats, err := h.service.GetUsage(q)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, usageResponse(q, stats))
+}
+
+// parseQuery 解析统计查询参数，to 为包含当天的结束日期
+func (h *UsageHandler) parseQuery(c *gin.Context) (*model.UsageQuery, bool) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	q := &model.UsageQuery{
+		From:     today.AddDate(0, 0, -(defaultUsageDays - 1)),
+		To:       today.AddDate(0, 0, 1),
+		AgentKey: c.Query("agent_key"),
+		GroupBy:  []string{model.UsageGroupDay},
+	}
+
+	if raw := c.Query("group_by"); raw != "" {
+		q.GroupBy = nil
+		for _, group := range strings.Split(raw, ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				q.GroupBy = append(q.GroupBy, group)
+			}
+		}
+	}
+
+	if raw := c.Query("from"); raw != "" {
+		from, err := time.ParseInLocation("2006-01-02", raw, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from 格式应为 YYYY-MM-DD"})
+			return nil, false
+		}
+		q.From = from
+	}
+	if raw := c.Query("to"); raw != "" {
+		to, err := time.ParseInLocation("2006-01-02", raw, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to 格式应为 YYYY-MM-DD"})
+			return nil, false
+		}
+		q.To = to.AddDate(0, 0, 1)
+	}
+
+	if raw := c.Query("project_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的项目 ID"})
+			return nil, false
+		}
+		q.ProjectID = &id
+	}
+
+	return q, true
+}
+
+// usageResponse 组装统计结果，附带所有分组的合计
+func usageResponse(q *model.UsageQuery, stats []*model.UsageStat) gin.H {
+	total := model.UsageStat{}
+	for _, stat := range stats {
+		total.Calls += stat.Calls
+		total.PromptTokens += stat.PromptTokens
+		total.CompletionTokens += stat.CompletionTokens
+		total.TotalTokens += stat.TotalTokens
+		total.Cost += stat.Cost
+	}
+
+	return gin.H{
+		"from":     q.From.Format("2006-01-02"),
+		"to":       q.To.AddDate(0, 0, -1).Format("2006-01-02"),
+		"group_by": q.GroupBy,
+		"usage":    stats,
+		"total":    total,
+	}
+}
+
+// respondError 将服务层错误映射为 HTTP 状态码
+func (h *UsageHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "项目不存在"})
+	case errors.Is(err, service.ErrInvalidUsageQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用量统计失败"})
+	}
+}
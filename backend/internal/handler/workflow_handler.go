@@ -0,0 +1,359 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zibianqu/novel-study/internal/ai/collaboration"
+	"github.com/zibianqu/novel-study/internal/model"
+	"github.com/zibianqu/novel-study/internal/service"
+)
+
+// workflowKeepAliveInterval 运行流式推送的心跳间隔，任务之间可能长时间没有事件
+const workflowKeepAliveInterval = 15 * time.Second
+
+// WorkflowHandler 工作流处理器
+// 用户级模板路由为 /workflow-templates，项目路由 (/projects/:id/workflow-templates) 管理项目模板
+type WorkflowHandler struct {
+	service *service.WorkflowService
+}
+
+func NewWorkflowHandler(service *service.WorkflowService) *WorkflowHandler {
+	return &WorkflowHandler{service: service}
+}
+
+// ListRuns 获取项目的工作流运行记录
+func (h *WorkflowHandler) ListRuns(c *gin.Context) {
+	projectID, ok := h.projectID(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	runs, err := h.service.ListRuns(projectID, c.GetInt("user_id"), limit, offset)
+	if err != nil {
+		h.respondError(c, err, "获取运行记录失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"runs": runs})
+}
+
+// GetRun 获取运行详情及各任务的状态、输入输出与错误
+func (h *WorkflowHandler) GetRun(c *gin.Context) {
+	projectID, ok := h.projectID(c)
+	if !ok {
+		return
+	}
+
+	run, err := h.service.GetRun(projectID, c.GetInt("user_id"), c.Param("runId"))
+	if err != nil {
+		h.respondError(c, err, "获取运行详情失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
+
+// StartRun 启动工作流运行，运行在后台执行，通过状态或流式接口查看进度
+func (h *WorkflowHandler) StartRun(c *gin.Context) {
+	projectID, ok := h.projectID(c)
+	if !ok {
+		return
+	}
+
+	var req model.StartWorkflowRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	run, err := h.service.StartWorkflow(c.GetInt("user_id"), projectID, req.TemplateID, req.Input, req.Context)
+	if err != nil {
+		h.respondError(c, err, "启动工作流失败")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, run)
+}
+
+// CancelRun 取消正在执行的运行
+func (h *WorkflowHandler) CancelRun(c *gin.Context) {
+	projectID, ok := h.projectID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.CancelRun(projectID, c.GetInt("user_id"), c.Param("runId")); err != nil {
+		h.respondError(c, err, "取消运行失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已取消"})
+}
+
+// ListApprovals 获取项目中等待处理的审批
+func (h *WorkflowHandler) ListApprovals(c *gin.Context) {
+	projectID, ok := h.projectID(c)
+	if !ok {
+		return
+	}
+
+	approvals, err := h.service.ListApprovals(projectID, c.GetInt("user_id"))
+	if err != nil {
+		h.respondError(c, err, "获取待审批列表失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"approvals": approvals})
+}
+
+// ResolveApproval 处理审批 (通过、修改后通过或驳回)，运行随后在后台继续执行
+func (h *WorkflowHandler) ResolveApproval(c *gin.Context) {
+	projectID, ok := h.projectID(c)
+	if !ok {
+		return
+	}
+
+	var req model.ResolveWorkflowApprovalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	run, err := h.service.ResolveApproval(projectID, c.GetInt("user_id"), c.Param("runId"), c.Param("taskId"), &req)
+	if err != nil {
+		h.respondError(c, err, "处理审批失败")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, run)
+}
+
+// StreamRun 以 SSE 推送运行进度
+// 先推送当前的运行记录 (run)，随后推送任务状态 (task、progress)、Agent 的部分输出 (chunk)
+// 与每轮审核得分 (review)，运行结束时推送 complete
+func (h *WorkflowHandler) StreamRun(c *gin.Context) {
+	projectID, ok := h.projectID(c)
+	if !ok {
+		return
+	}
+	userID := c.GetInt("user_id")
+	runID := c.Param("runId")
+
+	// 先订阅再读取运行记录，避免遗漏两者之间的事件
+	events, unsubscribe := h.service.Subscribe(runID)
+	defer unsubscribe()
+
+	run, err := h.service.GetRun(projectID, userID, runID)
+	if err != nil {
+		h.respondError(c, err, "获取运行详情失败")
+		return
+	}
+
+	writer := NewSSEWriter(c)
+	if writer == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "不支持流式响应"})
+		return
+	}
+	if err := writer.WriteJSON("run", run); err != nil {
+		return
+	}
+	if events == nil {
+		writeRunComplete(writer, run)
+		return
+	}
+
+	ticker := time.NewTicker(workflowKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				run, err := h.service.GetRun(projectID, userID, runID)
+				if err != nil {
+					writer.WriteError(err)
+					return
+				}
+				writeRunComplete(writer, run)
+				return
+			}
+			if err := writeRunEvent(writer, event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := writer.KeepAlive(); err != nil {
+				return
+			}
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// writeRunEvent 将运行事件写为 SSE 事件
+func writeRunEvent(writer *SSEWriter, event *collaboration.RunEvent) error {
+	switch event.Type {
+	case collaboration.EventTaskStatus:
+		if err := writer.WriteJSON("task", event); err != nil {
+			return err
+		}
+		if event.Total == 0 {
+			return nil
+		}
+		return writer.WriteProgress(event.Finished, event.Total, fmt.Sprintf("任务 %s %s", event.TaskID, event.Status))
+	case collaboration.EventTaskOutput:
+		return writer.WriteJSON("chunk", StreamResponse{
+			Type:     "chunk",
+			Content:  event.Chunk,
+			Metadata: map[string]interface{}{"task_id": event.TaskID, "agent_id": event.AgentID},
+		})
+	default:
+		return writer.WriteJSON(event.Type, event)
+	}
+}
+
+// writeRunComplete 推送运行的最终状态
+func writeRunComplete(writer *SSEWriter, run *model.WorkflowRun) {
+	writer.WriteComplete(map[string]interface{}{
+		"run_id":        run.ID,
+		"status":        run.Status,
+		"final_content": run.FinalContent,
+		"error":         run.Error,
+	})
+}
+
+// ListTemplates 获取可用的工作流模板 (内置、用户级与项目模板)
+func (h *WorkflowHandler) ListTemplates(c *gin.Context) {
+	projectID, ok := h.projectID(c)
+	if !ok {
+		return
+	}
+
+	templates, err := h.service.ListTemplates(projectID, c.GetInt("user_id"))
+	if err != nil {
+		h.respondError(c, err, "获取模板失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// GetTemplate 获取自定义模板及其定义
+func (h *WorkflowHandler) GetTemplate(c *gin.Context) {
+	templateID, ok := h.templateID(c)
+	if !ok {
+		return
+	}
+
+	tmpl, err := h.service.GetTemplate(templateID, c.GetInt("user_id"))
+	if err != nil {
+		h.respondError(c, err, "获取模板失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, tmpl)
+}
+
+// CreateTemplate 创建自定义模板，定义不合法时返回 400
+func (h *WorkflowHandler) CreateTemplate(c *gin.Context) {
+	projectID, ok := h.projectID(c)
+	if !ok {
+		return
+	}
+
+	var req model.SaveWorkflowTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tmpl, err := h.service.CreateTemplate(projectID, c.GetInt("user_id"), &req)
+	if err != nil {
+		h.respondError(c, err, "创建模板失败")
+		return
+	}
+
+	c.JSON(http.StatusCreated, tmpl)
+}
+
+// UpdateTemplate 更新自定义模板的定义
+func (h *WorkflowHandler) UpdateTemplate(c *gin.Context) {
+	templateID, ok := h.templateID(c)
+	if !ok {
+		return
+	}
+
+	var req model.SaveWorkflowTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tmpl, err := h.service.UpdateTemplate(templateID, c.GetInt("user_id"), &req)
+	if err != nil {
+		h.respondError(c, err, "更新模板失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, tmpl)
+}
+
+// DeleteTemplate 删除自定义模板
+func (h *WorkflowHandler) DeleteTemplate(c *gin.Context) {
+	templateID, ok := h.templateID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteTemplate(templateID, c.GetInt("user_id")); err != nil {
+		h.respondError(c, err, "删除模板失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// projectID 项目路由返回路径中的项目 ID，用户级模板路由返回 0
+func (h *WorkflowHandler) projectID(c *gin.Context) (int, bool) {
+	if c.Param("id") == "" {
+		return 0, true
+	}
+	projectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的项目 ID"})
+		return 0, false
+	}
+	return projectID, true
+}
+
+func (h *WorkflowHandler) templateID(c *gin.Context) (int, bool) {
+	templateID, err := strconv.Atoi(c.Param("templateId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的模板 ID"})
+		return 0, false
+	}
+	return templateID, true
+}
+
+// respondError 将服务层错误映射为 HTTP 状态码
+func (h *WorkflowHandler) respondError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "资源不存在"})
+	case errors.Is(err, service.ErrInvalidWorkflow):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrWorkflowRunFinished), errors.Is(err, service.ErrApprovalNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin 仅允许配置的管理员用户访问，需在 JWTAuth 之后使用
+func RequireAdmin(adminUserIDs []int) gin.HandlerFunc {
+	admins := make(map[int]bool, len(adminUserIDs))
+	for _, id := range adminUserIDs {
+		admins[id] = true
+	}
+
+	return func(c *gin.Context) {
+		if !admins[c.GetInt("user_id")] {
+			RespondError(c, http.StatusForbidden, "FORBIDDEN", "需要管理员权限")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -123,11 +123,11 @@ func RateLimitByPath() gin.HandlerFunc {
 			// 登录/注册: 5次/分钟
 			capacity = 5
 			refillRate = 5.0 / 60.0
-		case path == "/api/v1/ai/chat" || path == "/api/v1/ai/chat/stream":
+		case path == "/api/v1/ai/chat" || path == "/api/v1/ai/chat/stream" || isAIStreamPath(path) || isChatMessagePath(path):
 			// AI 对话: 20次/分钟
 			capacity = 20
 			refillRate = 20.0 / 60.0
-		case path == "/api/v1/ai/generate/chapter":
+		case path == "/api/v1/ai/generate/chapter" || isAgentRunPath(path):
 			// AI 生成: 10次/分钟
 			capacity = 10
 			refillRate = 10.0 / 60.0
@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -49,7 +50,11 @@ func TimeoutByPath() gin.HandlerFunc {
 		switch {
 		case c.Request.URL.Path == "/api/v1/ai/chat" ||
 			c.Request.URL.Path == "/api/v1/ai/chat/stream" ||
-			c.Request.URL.Path == "/api/v1/ai/generate/chapter":
+			c.Request.URL.Path == "/api/v1/ai/generate/chapter" ||
+			isAIStreamPath(path) ||
+			isChatMessagePath(path) ||
+			isAgentRunPath(path) ||
+			isWorkflowStreamPath(path):
 			// AI 相关请求 60秒
 			duration = 60 * time.Second
 		default:
@@ -76,3 +81,25 @@ func TimeoutByPath() gin.HandlerFunc {
 		}
 	}
 }
+
+// isAgentRunPath 判断是否为运行扩展Agent的路径 (/api/v1/agents/:id/run)
+func isAgentRunPath(path string) bool {
+	return strings.HasPrefix(path, "/api/v1/agents/") && strings.HasSuffix(path, "/run")
+}
+
+// isAIStreamPath 判断是否为 AI 流式生成路径 (/api/v1/ai/stream/*)
+func isAIStreamPath(path string) bool {
+	return strings.HasPrefix(path, "/api/v1/ai/stream/")
+}
+
+// isChatMessagePath 判断是否为会话内发送消息的路径 (/api/v1/chat/sessions/:id/messages[/stream])
+func isChatMessagePath(path string) bool {
+	return strings.HasPrefix(path, "/api/v1/chat/sessions/") &&
+		(strings.HasSuffix(path, "/messages") || strings.HasSuffix(path, "/messages/stream"))
+}
+
+// isWorkflowStreamPath 判断是否为工作流运行的流式推送路径 (/api/v1/projects/:id/workflow-runs/:runId/stream)
+func isWorkflowStreamPath(path string) bool {
+	return strings.HasPrefix(path, "/api/v1/projects/") &&
+		strings.Contains(path, "/workflow-runs/") && strings.HasSuffix(path, "/stream")
+}
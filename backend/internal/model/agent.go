@@ -5,36 +5,116 @@ import (
 )
 
 type Agent struct {
-	ID           int       `json:"id"`
-	UserID       *int      `json:"user_id"`
-	AgentKey     string    `json:"agent_key"`
-	Name         string    `json:"name"`
-	Icon         string    `json:"icon"`
-	Description  string    `json:"description"`
-	Type         string    `json:"type"`  // core, extension
-	Layer        string    `json:"layer"` // decision, strategy, execution, quality, auxiliary
-	SystemPrompt string    `json:"system_prompt"`
-	Model        string    `json:"model"`
-	Temperature  float64   `json:"temperature"`
-	MaxTokens    int       `json:"max_tokens"`
-	Tools        string    `json:"tools"` // JSON array
-	IsActive     bool      `json:"is_active"`
-	SortOrder    int       `json:"sort_order"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID             int       `json:"id"`
+	UserID         *int      `json:"user_id"`
+	AgentKey       string    `json:"agent_key"`
+	Name           string    `json:"name"`
+	Icon           string    `json:"icon"`
+	Description    string    `json:"description"`
+	Type           string    `json:"type"`  // core, extension
+	Layer          string    `json:"layer"` // decision, strategy, execution, quality, auxiliary
+	SystemPrompt   string    `json:"system_prompt"`
+	Model          string    `json:"model"`
+	Temperature    float64   `json:"temperature"`
+	MaxTokens      int       `json:"max_tokens"`
+	Tools          string    `json:"tools"`           // JSON array
+	InputSchema    string    `json:"input_schema"`    // JSON Schema, 校验运行时的 input
+	OutputSchema   string    `json:"output_schema"`   // JSON Schema
+	Permissions    string    `json:"permissions"`     // JSON object, 如 {"max_tool_steps": 3}
+	FallbackModels string    `json:"fallback_models"` // JSON array, 主模型不可用时依次尝试的备用模型
+	IsActive       bool      `json:"is_active"`
+	SortOrder      int       `json:"sort_order"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// AgentPermissions 扩展Agent的权限配置
+type AgentPermissions struct {
+	MaxToolSteps int `json:"max_tool_steps"` // 单次执行最多的工具调用轮数
+}
+
+// CreateAgentRequest 创建扩展Agent请求
+type CreateAgentRequest struct {
+	AgentKey       string                 `json:"agent_key" binding:"required,min=2,max=40"`
+	Name           string                 `json:"name" binding:"required,min=1,max=100"`
+	Icon           string                 `json:"icon" binding:"max=50"`
+	Description    string                 `json:"description"`
+	SystemPrompt   string                 `json:"system_prompt" binding:"required"`
+	Model          string                 `json:"model" binding:"max=50"`
+	Temperature    *float64               `json:"temperature" binding:"omitempty,min=0,max=2"`
+	MaxTokens      int                    `json:"max_tokens" binding:"omitempty,min=1,max=16384"`
+	Tools          []string               `json:"tools"`
+	InputSchema    map[string]interface{} `json:"input_schema"`
+	OutputSchema   map[string]interface{} `json:"output_schema"`
+	Permissions    *AgentPermissions      `json:"permissions"`
+	FallbackModels []string               `json:"fallback_models"` // 如 ["gpt-4o-mini", "local:qwen2.5"]
+}
+
+// UpdateAgentRequest 更新扩展Agent请求, 未提供的字段保持不变
+type UpdateAgentRequest struct {
+	Name           string                 `json:"name" binding:"omitempty,min=1,max=100"`
+	Icon           string                 `json:"icon" binding:"max=50"`
+	Description    string                 `json:"description"`
+	SystemPrompt   string                 `json:"system_prompt"`
+	Model          string                 `json:"model" binding:"max=50"`
+	Temperature    *float64               `json:"temperature" binding:"omitempty,min=0,max=2"`
+	MaxTokens      int                    `json:"max_tokens" binding:"omitempty,min=1,max=16384"`
+	Tools          []string               `json:"tools"`
+	InputSchema    map[string]interface{} `json:"input_schema"`
+	OutputSchema   map[string]interface{} `json:"output_schema"`
+	Permissions    *AgentPermissions      `json:"permissions"`
+	IsActive       *bool                  `json:"is_active"`
+	FallbackModels []string               `json:"fallback_models"` // 传空数组清空
 }
 
+// RunAgentRequest 运行Agent请求
+type RunAgentRequest struct {
+	ProjectID int                    `json:"project_id" binding:"required"`
+	Prompt    string                 `json:"prompt" binding:"required"`
+	Input     map[string]interface{} `json:"input"`
+}
+
+// AI 调用使用的 API 密钥来源
+const (
+	KeySourcePlatform = "platform" // 系统配置的密钥
+	KeySourceUser     = "user"     // 用户自己的密钥
+)
+
 type AIInteractionLog struct {
 	ID             int       `json:"id"`
 	UserID         int       `json:"user_id"`
 	ProjectID      *int      `json:"project_id"`
 	AgentID        *int      `json:"agent_id"`
+	AgentKey       string    `json:"agent_key"`
 	ActionType     string    `json:"action_type"`
 	InputPrompt    string    `json:"input_prompt"`
 	OutputResponse string    `json:"output_response"`
 	TokensInput    int       `json:"tokens_input"`
 	TokensOutput   int       `json:"tokens_output"`
+	Cost           float64   `json:"cost"`       // 估算费用 (美元)
+	KeySource      string    `json:"key_source"` // platform / user
 	Model          string    `json:"model"`
 	DurationMs     int       `json:"duration_ms"`
 	CreatedAt      time.Time `json:"created_at"`
+
+	// PromptTemplateVersionID 本次调用使用的提示词模板版本，未使用模板时为空
+	PromptTemplateVersionID *int `json:"prompt_template_version_id"`
+}
+
+// InjectionFinding 命中的提示词注入特征
+type InjectionFinding struct {
+	Pattern string `json:"pattern"`
+	Excerpt string `json:"excerpt"`
+}
+
+// PromptInjectionIncident 疑似提示词注入的请求记录
+type PromptInjectionIncident struct {
+	ID           int                `json:"id"`
+	UserID       int                `json:"user_id"`
+	ProjectID    *int               `json:"project_id"`
+	AgentKey     string             `json:"agent_key"`
+	ActionType   string             `json:"action_type"`
+	Findings     []InjectionFinding `json:"findings"`
+	BlockedTools []string           `json:"blocked_tools"` // 本次请求被禁用的写入工具
+	CreatedAt    time.Time          `json:"created_at"`
 }
@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+// 预算作用范围
+const (
+	BudgetScopeUser    = "user"
+	BudgetScopeProject = "project"
+)
+
+// Budget 用户或项目的 AI 预算，字段为空时使用系统默认值，0 表示不限制
+type Budget struct {
+	ID                int       `json:"id"`
+	Scope             string    `json:"scope"`
+	ScopeID           int       `json:"scope_id"`
+	DailyTokenLimit   *int64    `json:"daily_token_limit"`
+	MonthlyTokenLimit *int64    `json:"monthly_token_limit"`
+	DailyCostLimit    *float64  `json:"daily_cost_limit"`
+	MonthlyCostLimit  *float64  `json:"monthly_cost_limit"`
+	WarnRatio         *float64  `json:"warn_ratio"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// UpdateBudgetRequest 设置预算请求，未提供的字段恢复为系统默认值
+type UpdateBudgetRequest struct {
+	DailyTokenLimit   *int64   `json:"daily_token_limit"`
+	MonthlyTokenLimit *int64   `json:"monthly_token_limit"`
+	DailyCostLimit    *float64 `json:"daily_cost_limit"`
+	MonthlyCostLimit  *float64 `json:"monthly_cost_limit"`
+	WarnRatio         *float64 `json:"warn_ratio"`
+}
+
+// BudgetPeriod 一个统计周期内的用量与上限，上限为 0 表示不限制
+type BudgetPeriod struct {
+	Tokens     int64   `json:"tokens"`
+	TokenLimit int64   `json:"token_limit"`
+	Cost       float64 `json:"cost"`
+	CostLimit  float64 `json:"cost_limit"`
+}
+
+// BudgetStatus 预算执行情况
+type BudgetStatus struct {
+	Scope     string       `json:"scope"`
+	ScopeID   int          `json:"scope_id"`
+	WarnRatio float64      `json:"warn_ratio"`
+	Daily     BudgetPeriod `json:"daily"`
+	Monthly   BudgetPeriod `json:"monthly"`
+	Warnings  []string     `json:"warnings"`
+}
@@ -42,3 +42,22 @@ type UpdateChapterRequest struct {
 	Status    string `json:"status" binding:"omitempty,oneof=draft published"`
 	SortOrder int    `json:"sort_order"`
 }
+
+// ChapterSummary 章节摘要 (不含正文)
+type ChapterSummary struct {
+	ChapterID   int    `json:"chapter_id"`
+	VolumeID    *int   `json:"volume_id"`
+	Title       string `json:"title"`
+	SortOrder   int    `json:"sort_order"`
+	Summary     string `json:"summary"`
+	SummaryHash string `json:"-"`
+}
+
+// VolumeSummary 卷摘要
+type VolumeSummary struct {
+	VolumeID    int    `json:"volume_id"`
+	Title       string `json:"title"`
+	SortOrder   int    `json:"sort_order"`
+	Summary     string `json:"summary"`
+	SummaryHash string `json:"-"`
+}
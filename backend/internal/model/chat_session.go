@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+// ChatSession 多轮对话会话
+type ChatSession struct {
+	ID           int       `json:"id"`
+	UserID       int       `json:"user_id"`
+	ProjectID    int       `json:"project_id"`
+	AgentKey     string    `json:"agent_key"`
+	Title        string    `json:"title"`
+	ForkedFrom   *int      `json:"forked_from"`
+	MessageCount int       `json:"message_count"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ChatSessionMessage 会话中的一条消息
+type ChatSessionMessage struct {
+	ID         int       `json:"id"`
+	SessionID  int       `json:"session_id"`
+	Role       string    `json:"role"` // user, assistant
+	Content    string    `json:"content"`
+	TokensUsed int       `json:"tokens_used"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CreateChatSessionRequest 创建会话请求
+type CreateChatSessionRequest struct {
+	ProjectID int    `json:"project_id" binding:"required"`
+	Title     string `json:"title" binding:"omitempty,max=200"`
+	AgentKey  string `json:"agent_key"` // 为空时使用总导演
+}
+
+// RenameChatSessionRequest 重命名会话请求
+type RenameChatSessionRequest struct {
+	Title string `json:"title" binding:"required,min=1,max=200"`
+}
+
+// ForkChatSessionRequest 分叉会话请求
+type ForkChatSessionRequest struct {
+	MessageID int    `json:"message_id"` // 复制到该消息为止 (含)，0 表示复制全部
+	Title     string `json:"title" binding:"omitempty,max=200"`
+}
+
+// SendChatMessageRequest 会话内发送消息请求
+type SendChatMessageRequest struct {
+	Message string `json:"message" binding:"required"`
+}
@@ -0,0 +1,14 @@
+package model
+
+// InspectPromptRequest 调试 Prompt 请求，只构建 Prompt 不调用模型
+type InspectPromptRequest struct {
+	ProjectID         int    `json:"project_id" binding:"required"`
+	AgentKey          string `json:"agent_key"`  // 为空时使用总导演
+	ChapterID         int    `json:"chapter_id"` // 指定时带上章节正文、前几章与之前各卷的摘要
+	Message           string `json:"message" binding:"required"`
+	RecentContent     string `json:"recent_content"` // 覆盖章节正文作为最近内容
+	WritingGuidelines string `json:"writing_guidelines"`
+	RAGQuery          string `json:"rag_query"` // 指定时检索项目知识库并注入 Prompt
+	RAGTopK           int    `json:"rag_top_k"`
+	IncludeMetadata   bool   `json:"include_metadata"`
+}
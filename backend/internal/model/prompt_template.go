@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+// PromptTemplate 提示词模板，ProjectID 为空时为全局模板
+type PromptTemplate struct {
+	ID              int       `json:"id"`
+	Name            string    `json:"name"`
+	ProjectID       *int      `json:"project_id"`
+	Description     string    `json:"description"`
+	ActiveVersionID *int      `json:"active_version_id"`
+	ActiveVersion   int       `json:"active_version"` // 当前生效的版本号，0 表示没有版本
+	CreatedBy       *int      `json:"created_by"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+
+	Versions []*PromptTemplateVersion `json:"versions,omitempty"` // 详情接口返回全部版本
+}
+
+// PromptTemplateVersion 模板的不可变版本
+type PromptTemplateVersion struct {
+	ID         int       `json:"id"`
+	TemplateID int       `json:"template_id"`
+	Version    int       `json:"version"`
+	Content    string    `json:"content"`
+	Variables  []string  `json:"variables"`
+	ChangeNote string    `json:"change_note"`
+	CreatedBy  *int      `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CreatePromptTemplateRequest 创建模板请求，同时创建第一个版本
+type CreatePromptTemplateRequest struct {
+	Name        string `json:"name" binding:"required,min=1,max=100"`
+	Description string `json:"description"`
+	Content     string `json:"content" binding:"required"`
+	ChangeNote  string `json:"change_note"`
+}
+
+// CreatePromptTemplateVersionRequest 创建新版本请求，新版本立即生效
+type CreatePromptTemplateVersionRequest struct {
+	Content    string `json:"content" binding:"required"`
+	ChangeNote string `json:"change_note"`
+}
+
+// RollbackPromptTemplateRequest 回滚到指定版本
+type RollbackPromptTemplateRequest struct {
+	Version int `json:"version" binding:"required,min=1"`
+}
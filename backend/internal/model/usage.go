@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// 用量统计支持的分组维度
+const (
+	UsageGroupUser    = "user"
+	UsageGroupProject = "project"
+	UsageGroupAgent   = "agent"
+	UsageGroupDay     = "day"
+)
+
+// UsageQuery 用量统计查询条件
+type UsageQuery struct {
+	UserID    *int
+	ProjectID *int
+	AgentKey  string
+	KeySource string    // platform / user，为空时不限
+	From      time.Time // 含
+	To        time.Time // 不含
+	GroupBy   []string  // user / project / agent / day
+}
+
+// UsageStat 一个分组的用量汇总，未参与分组的维度为空
+type UsageStat struct {
+	UserID           *int    `json:"user_id,omitempty"`
+	ProjectID        *int    `json:"project_id,omitempty"`
+	AgentKey         *string `json:"agent_key,omitempty"`
+	Day              *string `json:"day,omitempty"`
+	Calls            int64   `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"` // 估算费用 (美元)
+}
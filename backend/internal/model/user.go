@@ -22,7 +22,8 @@ type RegisterRequest struct {
 }
 
 type LoginRequest struct {
-	Username string `json:"username" binding:"required"`
+	Username string `json:"username"` // 用户名与邮箱二选一
+	Email    string `json:"email" binding:"omitempty,email"`
 	Password string `json:"password" binding:"required"`
 }
 
@@ -0,0 +1,132 @@
+package model
+
+import "time"
+
+// 工作流运行状态
+const (
+	WorkflowRunPending   = "pending"
+	WorkflowRunRunning   = "running"
+	WorkflowRunCompleted = "completed"
+	WorkflowRunFailed    = "failed"
+	WorkflowRunCanceled  = "canceled"
+
+	WorkflowRunAwaitingApproval = "awaiting_approval" // 暂停在审批任务，处理后继续执行
+)
+
+// WorkflowRun 一次工作流运行，任务状态随执行持久化
+type WorkflowRun struct {
+	ID            string                 `json:"id"`
+	ProjectID     int                    `json:"project_id"`
+	UserID        int                    `json:"user_id"`
+	TemplateID    string                 `json:"template_id"`
+	Name          string                 `json:"name"`
+	Status        string                 `json:"status"` // pending, running, awaiting_approval, completed, failed, canceled
+	Input         string                 `json:"input"`
+	Context       map[string]interface{} `json:"context"`
+	FailurePolicy string                 `json:"failure_policy"`
+	FinalContent  string                 `json:"final_content"`
+	Error         string                 `json:"error"`
+	StartedAt     *time.Time             `json:"started_at"`
+	FinishedAt    *time.Time             `json:"finished_at"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+
+	Tasks []*WorkflowTaskRun `json:"tasks,omitempty"` // 详情接口返回全部任务
+}
+
+// Finished 运行是否已结束
+func (r *WorkflowRun) Finished() bool {
+	return r.Status == WorkflowRunCompleted || r.Status == WorkflowRunFailed || r.Status == WorkflowRunCanceled
+}
+
+// StartWorkflowRunRequest 启动工作流运行
+type StartWorkflowRunRequest struct {
+	TemplateID string                 `json:"template_id" binding:"required"` // 内置模板 ID 或自定义模板的 custom_<id>
+	Input      string                 `json:"input" binding:"required"`
+	Context    map[string]interface{} `json:"context"`
+}
+
+// WorkflowTaskRun 工作流运行中的任务
+type WorkflowTaskRun struct {
+	RunID         string                 `json:"run_id"`
+	TaskID        string                 `json:"task_id"`
+	SortOrder     int                    `json:"sort_order"`
+	AgentID       int                    `json:"agent_id"`
+	AgentKey      string                 `json:"agent_key,omitempty"` // 自定义模板的任务按 agent_key 执行
+	Type          string                 `json:"type"`
+	Input         string                 `json:"input"`
+	OriginalInput string                 `json:"original_input,omitempty"` // 审批驳回前的原始输入，未被驳回过时为空
+	Context       map[string]interface{} `json:"context"`
+	DependsOn     []string               `json:"depends_on"`
+	Review        *WorkflowTaskReview    `json:"review,omitempty"`
+	Approval      *WorkflowApproval      `json:"approval,omitempty"` // 审批任务最近一次的处理结果
+	Status        string                 `json:"status"`
+	Result        string                 `json:"result"`
+	Error         string                 `json:"error"`
+	TokensUsed    int                    `json:"tokens_used"`
+	DurationMs    int64                  `json:"duration_ms"`
+	StartedAt     *time.Time             `json:"started_at"`
+	FinishedAt    *time.Time             `json:"finished_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+}
+
+// WorkflowTaskReview 任务的审核-修改循环配置
+type WorkflowTaskReview struct {
+	ReviewerID    int     `json:"reviewer_id"`
+	ReviewerKey   string  `json:"reviewer_key,omitempty"`
+	MaxIterations int     `json:"max_iterations"`
+	MinScore      float64 `json:"min_score"`
+}
+
+// WorkflowApproval 审批任务的处理结果
+type WorkflowApproval struct {
+	Action    string    `json:"action"` // approve, edit, reject
+	Feedback  string    `json:"feedback,omitempty"`
+	UserID    int       `json:"user_id"`
+	DecidedAt time.Time `json:"decided_at"`
+}
+
+// PendingWorkflowApproval 等待项目所有者处理的审批
+type PendingWorkflowApproval struct {
+	RunID          string            `json:"run_id"`
+	RunName        string            `json:"run_name"`
+	TaskID         string            `json:"task_id"`
+	Prompt         string            `json:"prompt"` // 审批任务的说明
+	UpstreamTaskID string            `json:"upstream_task_id"`
+	UpstreamOutput string            `json:"upstream_output"`         // 待审批的内容
+	LastDecision   *WorkflowApproval `json:"last_decision,omitempty"` // 之前被驳回时的处理结果
+	WaitingSince   *time.Time        `json:"waiting_since"`
+}
+
+// ResolveWorkflowApprovalRequest 处理审批：通过、修改上游输出后通过，或驳回并给出修改意见
+type ResolveWorkflowApprovalRequest struct {
+	Action   string `json:"action" binding:"required,oneof=approve edit reject"`
+	Content  string `json:"content"`  // edit 时必填
+	Feedback string `json:"feedback"` // reject 时必填
+}
+
+// CustomWorkflowTemplatePrefix 自定义模板在启动运行时使用的标识前缀，如 custom_12
+const CustomWorkflowTemplatePrefix = "custom_"
+
+// WorkflowTemplate 工作流模板
+// 自定义模板保存 JSON/YAML 定义，ProjectID 为空时为用户级模板，在该用户的所有项目中可用；
+// 内置模板由代码注册，ID 为 0
+type WorkflowTemplate struct {
+	ID          int       `json:"id"`
+	Key         string    `json:"key"` // 启动运行时使用的模板标识
+	UserID      int       `json:"user_id,omitempty"`
+	ProjectID   *int      `json:"project_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Format      string    `json:"format,omitempty"` // json, yaml
+	Definition  string    `json:"definition,omitempty"`
+	Builtin     bool      `json:"builtin"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SaveWorkflowTemplateRequest 创建或更新自定义模板，名称与描述取自定义内容
+type SaveWorkflowTemplateRequest struct {
+	Format     string `json:"format" binding:"omitempty,oneof=json yaml"` // 为空时根据内容判断
+	Definition string `json:"definition" binding:"required"`
+}
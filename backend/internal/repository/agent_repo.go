@@ -2,6 +2,8 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
+
 	"github.com/zibianqu/novel-study/internal/model"
 )
 
@@ -13,15 +15,142 @@ func NewAgentRepository(db *sql.DB) *AgentRepository {
 	return &AgentRepository{db: db}
 }
 
+// agentColumns agents 表查询列，与 scanAgent 的顺序一致
+const agentColumns = `
+	id, user_id, agent_key, name, COALESCE(icon, ''), COALESCE(description, ''), type, layer,
+	system_prompt, COALESCE(model, ''), COALESCE(temperature, 0), COALESCE(max_tokens, 0),
+	COALESCE(tools, '[]'::jsonb), COALESCE(input_schema, '{}'::jsonb), COALESCE(output_schema, '{}'::jsonb),
+	COALESCE(permissions, '{}'::jsonb), COALESCE(fallback_models, '[]'::jsonb),
+	COALESCE(is_active, false), COALESCE(sort_order, 0), created_at, updated_at
+`
+
 func (r *AgentRepository) GetCoreAgents() ([]*model.Agent, error) {
-	query := `
-		SELECT id, agent_key, name, icon, description, type, layer,
-		       system_prompt, model, temperature, max_tokens, tools,
-		       is_active, sort_order, created_at, updated_at
+	query := `SELECT ` + agentColumns + `
 		FROM agents WHERE type = 'core' AND is_active = true
 		ORDER BY sort_order ASC
 	`
-	rows, err := r.db.Query(query)
+	return r.queryAgents(query)
+}
+
+// ListCoreAgents 获取全部核心Agent定义（包括已停用的）
+func (r *AgentRepository) ListCoreAgents() ([]*model.Agent, error) {
+	query := `SELECT ` + agentColumns + `
+		FROM agents WHERE type = 'core'
+		ORDER BY sort_order ASC
+	`
+	return r.queryAgents(query)
+}
+
+// ListActiveExtensionAgents 获取所有用户已启用的扩展Agent
+func (r *AgentRepository) ListActiveExtensionAgents() ([]*model.Agent, error) {
+	query := `SELECT ` + agentColumns + `
+		FROM agents WHERE type = 'extension' AND is_active = true
+		ORDER BY id ASC
+	`
+	return r.queryAgents(query)
+}
+
+// GetExtensionAgentsByUserID 获取用户创建的扩展Agent
+func (r *AgentRepository) GetExtensionAgentsByUserID(userID int) ([]*model.Agent, error) {
+	query := `SELECT ` + agentColumns + `
+		FROM agents WHERE type = 'extension' AND user_id = $1
+		ORDER BY sort_order ASC, id ASC
+	`
+	return r.queryAgents(query, userID)
+}
+
+func (r *AgentRepository) GetByID(id int) (*model.Agent, error) {
+	query := `SELECT ` + agentColumns + ` FROM agents WHERE id = $1`
+	return scanAgent(r.db.QueryRow(query, id))
+}
+
+func (r *AgentRepository) GetByKey(agentKey string) (*model.Agent, error) {
+	query := `SELECT ` + agentColumns + ` FROM agents WHERE agent_key = $1`
+	return scanAgent(r.db.QueryRow(query, agentKey))
+}
+
+// CreateExtension 创建扩展Agent
+func (r *AgentRepository) CreateExtension(agent *model.Agent) error {
+	query := `
+		INSERT INTO agents (user_id, agent_key, name, icon, description, type, layer,
+		                    system_prompt, model, temperature, max_tokens, tools,
+		                    input_schema, output_schema, permissions, fallback_models, is_active, sort_order,
+		                    created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, 'extension', $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, NOW(), NOW())
+		RETURNING id, type, created_at, updated_at
+	`
+	return r.db.QueryRow(
+		query,
+		agent.UserID,
+		agent.AgentKey,
+		agent.Name,
+		agent.Icon,
+		agent.Description,
+		agent.Layer,
+		agent.SystemPrompt,
+		agent.Model,
+		agent.Temperature,
+		agent.MaxTokens,
+		agent.Tools,
+		agent.InputSchema,
+		agent.OutputSchema,
+		agent.Permissions,
+		agent.FallbackModels,
+		agent.IsActive,
+		agent.SortOrder,
+	).Scan(&agent.ID, &agent.Type, &agent.CreatedAt, &agent.UpdatedAt)
+}
+
+// UpdateExtension 更新扩展Agent（仅限创建者）
+func (r *AgentRepository) UpdateExtension(agent *model.Agent) error {
+	query := `
+		UPDATE agents
+		SET name = $1, icon = $2, description = $3, system_prompt = $4, model = $5,
+		    temperature = $6, max_tokens = $7, tools = $8, input_schema = $9,
+		    output_schema = $10, permissions = $11, fallback_models = $12, is_active = $13,
+		    updated_at = NOW()
+		WHERE id = $14 AND user_id = $15 AND type = 'extension'
+		RETURNING updated_at
+	`
+	return r.db.QueryRow(
+		query,
+		agent.Name,
+		agent.Icon,
+		agent.Description,
+		agent.SystemPrompt,
+		agent.Model,
+		agent.Temperature,
+		agent.MaxTokens,
+		agent.Tools,
+		agent.InputSchema,
+		agent.OutputSchema,
+		agent.Permissions,
+		agent.FallbackModels,
+		agent.IsActive,
+		agent.ID,
+		agent.UserID,
+	).Scan(&agent.UpdatedAt)
+}
+
+// DeleteExtension 删除扩展Agent（仅限创建者）
+func (r *AgentRepository) DeleteExtension(id, userID int) error {
+	query := `DELETE FROM agents WHERE id = $1 AND user_id = $2 AND type = 'extension'`
+	result, err := r.db.Exec(query, id, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *AgentRepository) queryAgents(query string, args ...interface{}) ([]*model.Agent, error) {
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -29,39 +158,59 @@ func (r *AgentRepository) GetCoreAgents() ([]*model.Agent, error) {
 
 	var agents []*model.Agent
 	for rows.Next() {
-		agent := &model.Agent{}
-		err := rows.Scan(
-			&agent.ID,
-			&agent.AgentKey,
-			&agent.Name,
-			&agent.Icon,
-			&agent.Description,
-			&agent.Type,
-			&agent.Layer,
-			&agent.SystemPrompt,
-			&agent.Model,
-			&agent.Temperature,
-			&agent.MaxTokens,
-			&agent.Tools,
-			&agent.IsActive,
-			&agent.SortOrder,
-			&agent.CreatedAt,
-			&agent.UpdatedAt,
-		)
+		agent, err := scanAgent(rows)
 		if err != nil {
 			return nil, err
 		}
 		agents = append(agents, agent)
 	}
-	return agents, nil
+	return agents, rows.Err()
+}
+
+// rowScanner 兼容 *sql.Row 与 *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAgent(row rowScanner) (*model.Agent, error) {
+	agent := &model.Agent{}
+	err := row.Scan(
+		&agent.ID,
+		&agent.UserID,
+		&agent.AgentKey,
+		&agent.Name,
+		&agent.Icon,
+		&agent.Description,
+		&agent.Type,
+		&agent.Layer,
+		&agent.SystemPrompt,
+		&agent.Model,
+		&agent.Temperature,
+		&agent.MaxTokens,
+		&agent.Tools,
+		&agent.InputSchema,
+		&agent.OutputSchema,
+		&agent.Permissions,
+		&agent.FallbackModels,
+		&agent.IsActive,
+		&agent.SortOrder,
+		&agent.CreatedAt,
+		&agent.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return agent, nil
 }
 
 func (r *AgentRepository) LogInteraction(log *model.AIInteractionLog) error {
+	// user_id 为 0 (如系统发起的工作流) 时记录为 NULL；未指定 agent_id 时按 agent_key 关联
 	query := `
 		INSERT INTO ai_interaction_logs 
-		(user_id, project_id, agent_id, action_type, input_prompt, output_response,
-		 tokens_input, tokens_output, model, duration_ms, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW())
+		(user_id, project_id, agent_id, agent_key, action_type, input_prompt, output_response,
+		 tokens_input, tokens_output, cost, key_source, model, duration_ms, prompt_template_version_id, created_at)
+		VALUES (NULLIF($1, 0), $2, COALESCE($3, (SELECT id FROM agents WHERE agent_key = $4)),
+		        $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, NOW())
 		RETURNING id, created_at
 	`
 	return r.db.QueryRow(
@@ -69,12 +218,48 @@ func (r *AgentRepository) LogInteraction(log *model.AIInteractionLog) error {
 		log.UserID,
 		log.ProjectID,
 		log.AgentID,
+		log.AgentKey,
 		log.ActionType,
 		log.InputPrompt,
 		log.OutputResponse,
 		log.TokensInput,
 		log.TokensOutput,
+		log.Cost,
+		log.KeySource,
 		log.Model,
 		log.DurationMs,
+		log.PromptTemplateVersionID,
 	).Scan(&log.ID, &log.CreatedAt)
 }
+
+// LogInjectionIncident 记录疑似提示词注入的请求
+func (r *AgentRepository) LogInjectionIncident(incident *model.PromptInjectionIncident) error {
+	findings, err := json.Marshal(incident.Findings)
+	if err != nil {
+		return err
+	}
+	blockedTools := incident.BlockedTools
+	if blockedTools == nil {
+		blockedTools = []string{}
+	}
+	blocked, err := json.Marshal(blockedTools)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO prompt_injection_incidents
+		(user_id, project_id, agent_key, action_type, findings, blocked_tools)
+		VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+	return r.db.QueryRow(
+		query,
+		incident.UserID,
+		incident.ProjectID,
+		incident.AgentKey,
+		incident.ActionType,
+		findings,
+		blocked,
+	).Scan(&incident.ID, &incident.CreatedAt)
+}
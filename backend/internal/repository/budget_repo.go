@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/zibianqu/novel-study/internal/model"
+)
+
+// BudgetRepository AI 预算仓库
+type BudgetRepository struct {
+	db *sql.DB
+}
+
+// NewBudgetRepository 创建预算仓库
+func NewBudgetRepository(db *sql.DB) *BudgetRepository {
+	return &BudgetRepository{db: db}
+}
+
+// Get 获取用户或项目的预算设置，未设置时返回 sql.ErrNoRows
+func (r *BudgetRepository) Get(scope string, scopeID int) (*model.Budget, error) {
+	query := `
+		SELECT id, scope, scope_id, daily_token_limit, monthly_token_limit,
+		       daily_cost_limit, monthly_cost_limit, warn_ratio, updated_at
+		FROM ai_budgets
+		WHERE scope = $1 AND scope_id = $2
+	`
+	budget := &model.Budget{}
+	var dailyTokens, monthlyTokens sql.NullInt64
+	var dailyCost, monthlyCost, warnRatio sql.NullFloat64
+
+	err := r.db.QueryRow(query, scope, scopeID).Scan(
+		&budget.ID,
+		&budget.Scope,
+		&budget.ScopeID,
+		&dailyTokens,
+		&monthlyTokens,
+		&dailyCost,
+		&monthlyCost,
+		&warnRatio,
+		&budget.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if dailyTokens.Valid {
+		budget.DailyTokenLimit = &dailyTokens.Int64
+	}
+	if monthlyTokens.Valid {
+		budget.MonthlyTokenLimit = &monthlyTokens.Int64
+	}
+	if dailyCost.Valid {
+		budget.DailyCostLimit = &dailyCost.Float64
+	}
+	if monthlyCost.Valid {
+		budget.MonthlyCostLimit = &monthlyCost.Float64
+	}
+	if warnRatio.Valid {
+		budget.WarnRatio = &warnRatio.Float64
+	}
+	return budget, nil
+}
+
+// Upsert 创建或替换预算设置
+func (r *BudgetRepository) Upsert(budget *model.Budget) error {
+	query := `
+		INSERT INTO ai_budgets
+		(scope, scope_id, daily_token_limit, monthly_token_limit,
+		 daily_cost_limit, monthly_cost_limit, warn_ratio, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		ON CONFLICT (scope, scope_id) DO UPDATE SET
+			daily_token_limit = EXCLUDED.daily_token_limit,
+			monthly_token_limit = EXCLUDED.monthly_token_limit,
+			daily_cost_limit = EXCLUDED.daily_cost_limit,
+			monthly_cost_limit = EXCLUDED.monthly_cost_limit,
+			warn_ratio = EXCLUDED.warn_ratio,
+			updated_at = NOW()
+		RETURNING id, updated_at
+	`
+	return r.db.QueryRow(
+		query,
+		budget.Scope,
+		budget.ScopeID,
+		budget.DailyTokenLimit,
+		budget.MonthlyTokenLimit,
+		budget.DailyCostLimit,
+		budget.MonthlyCostLimit,
+		budget.WarnRatio,
+	).Scan(&budget.ID, &budget.UpdatedAt)
+}
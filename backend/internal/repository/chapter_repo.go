@@ -96,6 +96,39 @@ func (r *ChapterRepository) GetByProjectID(projectID int) ([]*model.Chapter, err
 	return chapters, nil
 }
 
+// GetByNumber 按章节序号 (从 1 开始，按排序顺序) 获取项目中的章节
+func (r *ChapterRepository) GetByNumber(projectID, number int) (*model.Chapter, error) {
+	if number < 1 {
+		return nil, sql.ErrNoRows
+	}
+	chapter := &model.Chapter{}
+	query := `
+		SELECT id, project_id, volume_id, title, content, word_count,
+		       sort_order, status, locked_by, locked_at, created_at, updated_at
+		FROM chapters WHERE project_id = $1
+		ORDER BY sort_order ASC, created_at ASC
+		OFFSET $2 LIMIT 1
+	`
+	err := r.db.QueryRow(query, projectID, number-1).Scan(
+		&chapter.ID,
+		&chapter.ProjectID,
+		&chapter.VolumeID,
+		&chapter.Title,
+		&chapter.Content,
+		&chapter.WordCount,
+		&chapter.SortOrder,
+		&chapter.Status,
+		&chapter.LockedBy,
+		&chapter.LockedAt,
+		&chapter.CreatedAt,
+		&chapter.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return chapter, nil
+}
+
 func (r *ChapterRepository) Update(chapter *model.Chapter) error {
 	query := `
 		UPDATE chapters 
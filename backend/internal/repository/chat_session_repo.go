@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/zibianqu/novel-study/internal/model"
+)
+
+// ChatSessionRepository 对话会话仓库
+type ChatSessionRepository struct {
+	db *sql.DB
+}
+
+// NewChatSessionRepository 创建对话会话仓库
+func NewChatSessionRepository(db *sql.DB) *ChatSessionRepository {
+	return &ChatSessionRepository{db: db}
+}
+
+const chatSessionColumns = `
+	s.id, s.user_id, s.project_id, s.agent_key, s.title, s.forked_from,
+	(SELECT COUNT(*) FROM chat_messages m WHERE m.session_id = s.id),
+	s.created_at, s.updated_at`
+
+// Create 创建会话
+func (r *ChatSessionRepository) Create(session *model.ChatSession) error {
+	query := `
+		INSERT INTO chat_sessions (user_id, project_id, agent_key, title, forked_from, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`
+	return r.db.QueryRow(
+		query,
+		session.UserID,
+		session.ProjectID,
+		session.AgentKey,
+		session.Title,
+		session.ForkedFrom,
+	).Scan(&session.ID, &session.CreatedAt, &session.UpdatedAt)
+}
+
+// GetByID 根据ID获取会话
+func (r *ChatSessionRepository) GetByID(id int) (*model.ChatSession, error) {
+	query := `SELECT ` + chatSessionColumns + ` FROM chat_sessions s WHERE s.id = $1`
+	return scanChatSession(r.db.QueryRow(query, id))
+}
+
+// GetByProject 获取用户在项目下的会话，最近活跃的在前
+func (r *ChatSessionRepository) GetByProject(userID, projectID int) ([]*model.ChatSession, error) {
+	query := `SELECT ` + chatSessionColumns + `
+		FROM chat_sessions s
+		WHERE s.user_id = $1 AND s.project_id = $2
+		ORDER BY s.updated_at DESC, s.id DESC
+	`
+	rows, err := r.db.Query(query, userID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]*model.ChatSession, 0)
+	for rows.Next() {
+		session, err := scanChatSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// UpdateTitle 修改会话标题
+func (r *ChatSessionRepository) UpdateTitle(id int, title string) error {
+	result, err := r.db.Exec(`UPDATE chat_sessions SET title = $1, updated_at = NOW() WHERE id = $2`, title, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Delete 删除会话及其消息
+func (r *ChatSessionRepository) Delete(id int) error {
+	result, err := r.db.Exec(`DELETE FROM chat_sessions WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AddMessages 追加消息并刷新会话活跃时间
+func (r *ChatSessionRepository) AddMessages(sessionID int, messages ...*model.ChatSessionMessage) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO chat_messages (session_id, role, content, tokens_used, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING id, created_at
+	`
+	for _, msg := range messages {
+		msg.SessionID = sessionID
+		if err := tx.QueryRow(query, sessionID, msg.Role, msg.Content, msg.TokensUsed).Scan(&msg.ID, &msg.CreatedAt); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE chat_sessions SET updated_at = NOW() WHERE id = $1`, sessionID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetMessages 获取会话的全部消息，按时间顺序
+func (r *ChatSessionRepository) GetMessages(sessionID int) ([]*model.ChatSessionMessage, error) {
+	query := `
+		SELECT id, session_id, role, content, tokens_used, created_at
+		FROM chat_messages WHERE session_id = $1
+		ORDER BY id ASC
+	`
+	rows, err := r.db.Query(query, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]*model.ChatSessionMessage, 0)
+	for rows.Next() {
+		msg := &model.ChatSessionMessage{}
+		if err := rows.Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content, &msg.TokensUsed, &msg.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// Fork 创建新会话，并从 fork.ForkedFrom 指向的会话复制到 uptoMessageID (含) 为止的消息
+// uptoMessageID 为 0 时复制全部消息
+func (r *ChatSessionRepository) Fork(fork *model.ChatSession, uptoMessageID int) error {
+	if fork.ForkedFrom == nil {
+		return sql.ErrNoRows
+	}
+	sourceID := *fork.ForkedFrom
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO chat_sessions (user_id, project_id, agent_key, title, forked_from, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`, fork.UserID, fork.ProjectID, fork.AgentKey, fork.Title, sourceID).Scan(&fork.ID, &fork.CreatedAt, &fork.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO chat_messages (session_id, role, content, tokens_used, created_at)
+		SELECT $1, role, content, tokens_used, created_at
+		FROM chat_messages
+		WHERE session_id = $2 AND ($3 = 0 OR id <= $3)
+		ORDER BY id ASC
+	`, fork.ID, sourceID, uptoMessageID)
+	if err != nil {
+		return err
+	}
+	copied, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	fork.MessageCount = int(copied)
+
+	return tx.Commit()
+}
+
+// MessageBelongsTo 检查消息是否属于指定会话
+func (r *ChatSessionRepository) MessageBelongsTo(sessionID, messageID int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM chat_messages WHERE id = $1 AND session_id = $2)`,
+		messageID, sessionID,
+	).Scan(&exists)
+	return exists, err
+}
+
+func scanChatSession(row rowScanner) (*model.ChatSession, error) {
+	session := &model.ChatSession{}
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.ProjectID,
+		&session.AgentKey,
+		&session.Title,
+		&session.ForkedFrom,
+		&session.MessageCount,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
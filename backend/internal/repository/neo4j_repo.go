@@ -150,3 +150,84 @@ func (r *Neo4jRepository) DeleteNode(ctx context.Context, projectID int, nodeID
 
 	return err
 }
+
+// GetCharacterRelations 获取角色的全部关系 (双向)，角色 ID 兼容整数与字符串
+func (r *Neo4jRepository) GetCharacterRelations(ctx context.Context, characterID, projectID int) ([]map[string]interface{}, error) {
+	return r.query(ctx, `
+		MATCH (c:Character {project_id: $project_id})-[rel]-(o)
+		WHERE c.id IN [$character_id, toString($character_id)]
+		RETURN type(rel) AS relation, o.id AS target_id, o.name AS target_name,
+		       labels(o)[0] AS target_type, properties(rel) AS properties
+	`, map[string]interface{}{
+		"character_id": characterID,
+		"project_id":   projectID,
+	})
+}
+
+// GetRecentWorldEvents 获取最近的世界事件
+func (r *Neo4jRepository) GetRecentWorldEvents(ctx context.Context, projectID, limit int) ([]map[string]interface{}, error) {
+	return r.query(ctx, `
+		MATCH (e:Event {project_id: $project_id})
+		RETURN properties(e) AS event
+		ORDER BY e.timestamp DESC
+		LIMIT $limit
+	`, map[string]interface{}{
+		"project_id": projectID,
+		"limit":      limit,
+	})
+}
+
+// GetPlotArcs 获取剧情弧，status 为空时返回全部
+func (r *Neo4jRepository) GetPlotArcs(ctx context.Context, projectID int, status string) ([]map[string]interface{}, error) {
+	return r.query(ctx, `
+		MATCH (a:PlotArc {project_id: $project_id})
+		WHERE $status = '' OR a.status = $status
+		RETURN properties(a) AS arc
+	`, map[string]interface{}{
+		"project_id": projectID,
+		"status":     status,
+	})
+}
+
+// GetCharacterCurrentState 获取角色节点的当前属性
+func (r *Neo4jRepository) GetCharacterCurrentState(ctx context.Context, characterID, projectID int) (map[string]interface{}, error) {
+	records, err := r.query(ctx, `
+		MATCH (c:Character {project_id: $project_id})
+		WHERE c.id IN [$character_id, toString($character_id)]
+		RETURN properties(c) AS state
+		LIMIT 1
+	`, map[string]interface{}{
+		"character_id": characterID,
+		"project_id":   projectID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("character %d not found", characterID)
+	}
+	state, _ := records[0]["state"].(map[string]interface{})
+	return state, nil
+}
+
+// query 执行只读查询，每条记录转换为列名到值的映射
+func (r *Neo4jRepository) query(ctx context.Context, cypher string, params map[string]interface{}) ([]map[string]interface{}, error) {
+	session := r.driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx, cypher, params)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]map[string]interface{}, 0)
+	for result.Next(ctx) {
+		record := result.Record()
+		row := make(map[string]interface{}, len(record.Keys))
+		for i, key := range record.Keys {
+			row[key] = record.Values[i]
+		}
+		records = append(records, row)
+	}
+	return records, result.Err()
+}
@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/zibianqu/novel-study/internal/model"
+)
+
+// PromptTemplateRepository 提示词模板仓库
+type PromptTemplateRepository struct {
+	db *sql.DB
+}
+
+// NewPromptTemplateRepository 创建提示词模板仓库
+func NewPromptTemplateRepository(db *sql.DB) *PromptTemplateRepository {
+	return &PromptTemplateRepository{db: db}
+}
+
+const promptTemplateColumns = `
+	t.id, t.name, t.project_id, COALESCE(t.description, ''), t.active_version_id,
+	COALESCE(v.version, 0), t.created_by, t.created_at, t.updated_at`
+
+const promptTemplateFrom = `
+	FROM prompt_templates t
+	LEFT JOIN prompt_template_versions v ON v.id = t.active_version_id`
+
+// Create 创建模板及其第一个版本，第一个版本立即生效
+func (r *PromptTemplateRepository) Create(tmpl *model.PromptTemplate, version *model.PromptTemplateVersion) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO prompt_templates (name, project_id, description, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`
+	if err := tx.QueryRow(query, tmpl.Name, tmpl.ProjectID, tmpl.Description, tmpl.CreatedBy).
+		Scan(&tmpl.ID, &tmpl.CreatedAt, &tmpl.UpdatedAt); err != nil {
+		return err
+	}
+
+	if err := insertVersion(tx, tmpl.ID, version); err != nil {
+		return err
+	}
+	tmpl.ActiveVersionID = &version.ID
+	tmpl.ActiveVersion = version.Version
+
+	return tx.Commit()
+}
+
+// GetByID 根据ID获取模板
+func (r *PromptTemplateRepository) GetByID(id int) (*model.PromptTemplate, error) {
+	query := `SELECT ` + promptTemplateColumns + promptTemplateFrom + ` WHERE t.id = $1`
+	return scanPromptTemplate(r.db.QueryRow(query, id))
+}
+
+// List 获取全局模板 (projectID 为 0) 或项目下的覆盖模板
+func (r *PromptTemplateRepository) List(projectID int) ([]*model.PromptTemplate, error) {
+	query := `SELECT ` + promptTemplateColumns + promptTemplateFrom + `
+		WHERE COALESCE(t.project_id, 0) = $1
+		ORDER BY t.name ASC
+	`
+	rows, err := r.db.Query(query, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := make([]*model.PromptTemplate, 0)
+	for rows.Next() {
+		tmpl, err := scanPromptTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, tmpl)
+	}
+	return templates, rows.Err()
+}
+
+// Delete 删除模板及其全部版本
+func (r *PromptTemplateRepository) Delete(id int) error {
+	return execAffectingOne(r.db, `DELETE FROM prompt_templates WHERE id = $1`, id)
+}
+
+// CreateVersion 追加新版本并设为当前生效版本，版本号自动递增
+func (r *PromptTemplateRepository) CreateVersion(templateID int, version *model.PromptTemplateVersion) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 锁定模板行，避免并发创建相同的版本号
+	if _, err := tx.Exec(`SELECT id FROM prompt_templates WHERE id = $1 FOR UPDATE`, templateID); err != nil {
+		return err
+	}
+	if err := insertVersion(tx, templateID, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertVersion 写入版本并更新模板的当前版本
+func insertVersion(tx *sql.Tx, templateID int, version *model.PromptTemplateVersion) error {
+	variables, err := json.Marshal(version.Variables)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO prompt_template_versions (template_id, version, content, variables, change_note, created_by, created_at)
+		VALUES ($1, (SELECT COALESCE(MAX(version), 0) + 1 FROM prompt_template_versions WHERE template_id = $1),
+		        $2, $3, $4, $5, NOW())
+		RETURNING id, version, created_at
+	`
+	if err := tx.QueryRow(query, templateID, version.Content, variables, version.ChangeNote, version.CreatedBy).
+		Scan(&version.ID, &version.Version, &version.CreatedAt); err != nil {
+		return err
+	}
+	version.TemplateID = templateID
+
+	_, err = tx.Exec(`UPDATE prompt_templates SET active_version_id = $1, updated_at = NOW() WHERE id = $2`, version.ID, templateID)
+	return err
+}
+
+// SetActiveVersion 将指定版本号设为当前生效版本 (用于回滚)
+func (r *PromptTemplateRepository) SetActiveVersion(templateID, version int) error {
+	query := `
+		UPDATE prompt_templates t
+		SET active_version_id = v.id, updated_at = NOW()
+		FROM prompt_template_versions v
+		WHERE t.id = $1 AND v.template_id = t.id AND v.version = $2
+	`
+	return execAffectingOne(r.db, query, templateID, version)
+}
+
+// ListVersions 获取模板的全部版本，最新的在前
+func (r *PromptTemplateRepository) ListVersions(templateID int) ([]*model.PromptTemplateVersion, error) {
+	query := `
+		SELECT id, template_id, version, content, COALESCE(variables, '[]'), COALESCE(change_note, ''), created_by, created_at
+		FROM prompt_template_versions WHERE template_id = $1
+		ORDER BY version DESC
+	`
+	rows, err := r.db.Query(query, templateID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]*model.PromptTemplateVersion, 0)
+	for rows.Next() {
+		version, err := scanPromptTemplateVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+// GetActiveVersion 按名称获取当前生效的版本，项目覆盖模板优先于全局模板
+func (r *PromptTemplateRepository) GetActiveVersion(name string, projectID int) (*model.PromptTemplateVersion, error) {
+	query := `
+		SELECT v.id, v.template_id, v.version, v.content, COALESCE(v.variables, '[]'), COALESCE(v.change_note, ''), v.created_by, v.created_at
+		FROM prompt_templates t
+		JOIN prompt_template_versions v ON v.id = t.active_version_id
+		WHERE t.name = $1 AND (t.project_id IS NULL OR t.project_id = $2)
+		ORDER BY t.project_id NULLS LAST
+		LIMIT 1
+	`
+	return scanPromptTemplateVersion(r.db.QueryRow(query, name, projectID))
+}
+
+func scanPromptTemplate(row rowScanner) (*model.PromptTemplate, error) {
+	tmpl := &model.PromptTemplate{}
+	err := row.Scan(
+		&tmpl.ID,
+		&tmpl.Name,
+		&tmpl.ProjectID,
+		&tmpl.Description,
+		&tmpl.ActiveVersionID,
+		&tmpl.ActiveVersion,
+		&tmpl.CreatedBy,
+		&tmpl.CreatedAt,
+		&tmpl.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func scanPromptTemplateVersion(row rowScanner) (*model.PromptTemplateVersion, error) {
+	version := &model.PromptTemplateVersion{}
+	var variables []byte
+	err := row.Scan(
+		&version.ID,
+		&version.TemplateID,
+		&version.Version,
+		&version.Content,
+		&variables,
+		&version.ChangeNote,
+		&version.CreatedBy,
+		&version.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(variables, &version.Variables); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/zibianqu/novel-study/internal/model"
+)
+
+// StorylineRepository 三线仓库
+type StorylineRepository struct {
+	db *sql.DB
+}
+
+// NewStorylineRepository 创建三线仓库
+func NewStorylineRepository(db *sql.DB) *StorylineRepository {
+	return &StorylineRepository{db: db}
+}
+
+const storylineColumns = `
+	id, COALESCE(project_id, 0), line_type, title, COALESCE(content, ''), COALESCE(chapter_range, ''),
+	COALESCE(status, 'planned'), COALESCE(sort_order, 0), parent_id, created_at, updated_at`
+
+// Create 创建三线
+func (r *StorylineRepository) Create(storyline *model.Storyline) error {
+	query := `
+		INSERT INTO storylines (project_id, line_type, title, content, chapter_range, status, sort_order, parent_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`
+	return r.db.QueryRow(query, storyline.ProjectID, storyline.LineType, storyline.Title, storyline.Content,
+		storyline.ChapterRange, storyline.Status, storyline.SortOrder, storyline.ParentID,
+	).Scan(&storyline.ID, &storyline.CreatedAt, &storyline.UpdatedAt)
+}
+
+// GetByID 获取三线
+func (r *StorylineRepository) GetByID(id int) (*model.Storyline, error) {
+	query := `SELECT ` + storylineColumns + ` FROM storylines WHERE id = $1`
+	return scanStoryline(r.db.QueryRow(query, id))
+}
+
+// GetByType 获取项目中指定类型的三线，按排序与创建顺序
+func (r *StorylineRepository) GetByType(projectID int, lineType string) ([]*model.Storyline, error) {
+	query := `SELECT ` + storylineColumns + `
+		FROM storylines
+		WHERE project_id = $1 AND line_type = $2
+		ORDER BY sort_order ASC, id ASC
+	`
+	rows, err := r.db.Query(query, projectID, lineType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	storylines := make([]*model.Storyline, 0)
+	for rows.Next() {
+		storyline, err := scanStoryline(rows)
+		if err != nil {
+			return nil, err
+		}
+		storylines = append(storylines, storyline)
+	}
+	return storylines, rows.Err()
+}
+
+// Update 更新三线的标题、内容、章节范围与状态
+func (r *StorylineRepository) Update(storyline *model.Storyline) error {
+	query := `
+		UPDATE storylines
+		SET title = $2, content = $3, chapter_range = $4, status = $5, sort_order = $6, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`
+	return r.db.QueryRow(query, storyline.ID, storyline.Title, storyline.Content, storyline.ChapterRange,
+		storyline.Status, storyline.SortOrder,
+	).Scan(&storyline.UpdatedAt)
+}
+
+func scanStoryline(row rowScanner) (*model.Storyline, error) {
+	storyline := &model.Storyline{}
+	err := row.Scan(
+		&storyline.ID,
+		&storyline.ProjectID,
+		&storyline.LineType,
+		&storyline.Title,
+		&storyline.Content,
+		&storyline.ChapterRange,
+		&storyline.Status,
+		&storyline.SortOrder,
+		&storyline.ParentID,
+		&storyline.CreatedAt,
+		&storyline.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return storyline, nil
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/zibianqu/novel-study/internal/model"
+)
+
+// SummaryRepository 章节、卷、项目三级摘要仓库
+type SummaryRepository struct {
+	db *sql.DB
+}
+
+// NewSummaryRepository 创建摘要仓库
+func NewSummaryRepository(db *sql.DB) *SummaryRepository {
+	return &SummaryRepository{db: db}
+}
+
+// ListChapterSummaries 获取项目下全部章节的摘要，顺序与章节列表一致
+func (r *SummaryRepository) ListChapterSummaries(projectID int) ([]*model.ChapterSummary, error) {
+	query := `
+		SELECT id, volume_id, title, sort_order, COALESCE(summary, ''), COALESCE(summary_hash, '')
+		FROM chapters WHERE project_id = $1
+		ORDER BY sort_order ASC, created_at ASC
+	`
+	rows, err := r.db.Query(query, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := make([]*model.ChapterSummary, 0)
+	for rows.Next() {
+		s := &model.ChapterSummary{}
+		if err := rows.Scan(&s.ChapterID, &s.VolumeID, &s.Title, &s.SortOrder, &s.Summary, &s.SummaryHash); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
+
+// UpdateChapterSummary 保存章节摘要
+func (r *SummaryRepository) UpdateChapterSummary(chapterID int, summary, hash string) error {
+	query := `UPDATE chapters SET summary = $1, summary_hash = $2, summary_updated_at = NOW() WHERE id = $3`
+	return execAffectingOne(r.db, query, summary, hash, chapterID)
+}
+
+// ListVolumeSummaries 获取项目下全部卷的摘要
+func (r *SummaryRepository) ListVolumeSummaries(projectID int) ([]*model.VolumeSummary, error) {
+	query := `
+		SELECT id, title, sort_order, COALESCE(summary, ''), COALESCE(summary_hash, '')
+		FROM volumes WHERE project_id = $1
+		ORDER BY sort_order ASC, id ASC
+	`
+	rows, err := r.db.Query(query, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := make([]*model.VolumeSummary, 0)
+	for rows.Next() {
+		s := &model.VolumeSummary{}
+		if err := rows.Scan(&s.VolumeID, &s.Title, &s.SortOrder, &s.Summary, &s.SummaryHash); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
+
+// UpdateVolumeSummary 保存卷摘要
+func (r *SummaryRepository) UpdateVolumeSummary(volumeID int, summary, hash string) error {
+	query := `UPDATE volumes SET summary = $1, summary_hash = $2, summary_updated_at = NOW() WHERE id = $3`
+	return execAffectingOne(r.db, query, summary, hash, volumeID)
+}
+
+// GetProjectSummary 获取项目摘要及其输入哈希
+func (r *SummaryRepository) GetProjectSummary(projectID int) (summary, hash string, err error) {
+	query := `SELECT COALESCE(summary, ''), COALESCE(summary_hash, '') FROM projects WHERE id = $1`
+	err = r.db.QueryRow(query, projectID).Scan(&summary, &hash)
+	return summary, hash, err
+}
+
+// UpdateProjectSummary 保存项目摘要
+func (r *SummaryRepository) UpdateProjectSummary(projectID int, summary, hash string) error {
+	query := `UPDATE projects SET summary = $1, summary_hash = $2, summary_updated_at = NOW() WHERE id = $3`
+	return execAffectingOne(r.db, query, summary, hash, projectID)
+}
+
+// execAffectingOne 执行更新，未命中任何行时返回 sql.ErrNoRows
+func execAffectingOne(db *sql.DB, query string, args ...interface{}) error {
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
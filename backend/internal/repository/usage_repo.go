@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/zibianqu/novel-study/internal/model"
+)
+
+// UsageRepository Token 用量统计仓库 (基于 ai_interaction_logs)
+type UsageRepository struct {
+	db *sql.DB
+}
+
+// NewUsageRepository 创建用量统计仓库
+func NewUsageRepository(db *sql.DB) *UsageRepository {
+	return &UsageRepository{db: db}
+}
+
+// usageGroupColumns 分组维度对应的列，分组字段只能来自此白名单
+var usageGroupColumns = map[string]string{
+	model.UsageGroupUser:    "user_id",
+	model.UsageGroupProject: "project_id",
+	model.UsageGroupAgent:   "agent_key",
+	model.UsageGroupDay:     "TO_CHAR(created_at, 'YYYY-MM-DD')",
+}
+
+// Aggregate 按维度聚合 Token 用量
+func (r *UsageRepository) Aggregate(q *model.UsageQuery) ([]*model.UsageStat, error) {
+	var groupCols []string
+	for _, group := range q.GroupBy {
+		col, ok := usageGroupColumns[group]
+		if !ok {
+			return nil, fmt.Errorf("unsupported usage group: %s", group)
+		}
+		groupCols = append(groupCols, col)
+	}
+
+	conditions := []string{"created_at >= $1", "created_at < $2"}
+	args := []interface{}{q.From, q.To}
+	if q.UserID != nil {
+		args = append(args, *q.UserID)
+		conditions = append(conditions, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+	if q.ProjectID != nil {
+		args = append(args, *q.ProjectID)
+		conditions = append(conditions, fmt.Sprintf("project_id = $%d", len(args)))
+	}
+	if q.AgentKey != "" {
+		args = append(args, q.AgentKey)
+		conditions = append(conditions, fmt.Sprintf("agent_key = $%d", len(args)))
+	}
+	if q.KeySource != "" {
+		args = append(args, q.KeySource)
+		conditions = append(conditions, fmt.Sprintf("key_source = $%d", len(args)))
+	}
+
+	selectCols := append(append([]string{}, groupCols...),
+		"COUNT(*)",
+		"COALESCE(SUM(tokens_input), 0)",
+		"COALESCE(SUM(tokens_output), 0)",
+		"COALESCE(SUM(cost), 0)",
+	)
+	query := fmt.Sprintf("SELECT %s FROM ai_interaction_logs WHERE %s",
+		strings.Join(selectCols, ", "), strings.Join(conditions, " AND "))
+	if len(groupCols) > 0 {
+		query += fmt.Sprintf(" GROUP BY %s ORDER BY %s", strings.Join(groupCols, ", "), strings.Join(groupCols, ", "))
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]*model.UsageStat, 0)
+	for rows.Next() {
+		stat := &model.UsageStat{}
+		var userID, projectID sql.NullInt64
+		var agentKey, day sql.NullString
+
+		dest := make([]interface{}, 0, len(q.GroupBy)+4)
+		for _, group := range q.GroupBy {
+			switch group {
+			case model.UsageGroupUser:
+				dest = append(dest, &userID)
+			case model.UsageGroupProject:
+				dest = append(dest, &projectID)
+			case model.UsageGroupAgent:
+				dest = append(dest, &agentKey)
+			case model.UsageGroupDay:
+				dest = append(dest, &day)
+			}
+		}
+		dest = append(dest, &stat.Calls, &stat.PromptTokens, &stat.CompletionTokens, &stat.Cost)
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		if userID.Valid {
+			id := int(userID.Int64)
+			stat.UserID = &id
+		}
+		if projectID.Valid {
+			id := int(projectID.Int64)
+			stat.ProjectID = &id
+		}
+		if agentKey.Valid {
+			stat.AgentKey = &agentKey.String
+		}
+		if day.Valid {
+			stat.Day = &day.String
+		}
+		stat.TotalTokens = stat.PromptTokens + stat.CompletionTokens
+
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
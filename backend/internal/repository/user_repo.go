@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+// UserRepository 用户仓库
+type UserRepository struct {
+	db *sql.DB
+}
+
+// NewUserRepository 创建用户仓库
+func NewUserRepository(db *sql.DB) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+// GetAPIKey 获取用户加密后的 API 密钥，未设置时返回空字符串
+func (r *UserRepository) GetAPIKey(userID int) (string, *time.Time, error) {
+	query := `SELECT api_key_encrypted, api_key_updated_at FROM users WHERE id = $1`
+
+	var encrypted sql.NullString
+	var updatedAt sql.NullTime
+	if err := r.db.QueryRow(query, userID).Scan(&encrypted, &updatedAt); err != nil {
+		return "", nil, err
+	}
+	if !encrypted.Valid || encrypted.String == "" {
+		return "", nil, nil
+	}
+	if updatedAt.Valid {
+		return encrypted.String, &updatedAt.Time, nil
+	}
+	return encrypted.String, nil, nil
+}
+
+// SetAPIKey 保存用户加密后的 API 密钥
+func (r *UserRepository) SetAPIKey(userID int, encrypted string) error {
+	query := `
+		UPDATE users
+		SET api_key_encrypted = $1, api_key_updated_at = NOW(), updated_at = NOW()
+		WHERE id = $2
+	`
+	return r.execOne(query, encrypted, userID)
+}
+
+// DeleteAPIKey 删除用户的 API 密钥
+func (r *UserRepository) DeleteAPIKey(userID int) error {
+	query := `
+		UPDATE users
+		SET api_key_encrypted = NULL, api_key_updated_at = NULL, updated_at = NOW()
+		WHERE id = $1
+	`
+	return r.execOne(query, userID)
+}
+
+func (r *UserRepository) execOne(query string, args ...interface{}) error {
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
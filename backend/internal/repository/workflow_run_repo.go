@@ -0,0 +1,367 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/zibianqu/novel-study/internal/model"
+)
+
+// WorkflowRunRepository 工作流运行仓库
+type WorkflowRunRepository struct {
+	db *sql.DB
+}
+
+// NewWorkflowRunRepository 创建工作流运行仓库
+func NewWorkflowRunRepository(db *sql.DB) *WorkflowRunRepository {
+	return &WorkflowRunRepository{db: db}
+}
+
+const workflowRunColumns = `
+	id, COALESCE(project_id, 0), COALESCE(user_id, 0), template_id, name, status, COALESCE(input, ''),
+	COALESCE(context, '{}'), failure_policy, COALESCE(final_content, ''), COALESCE(error, ''),
+	started_at, finished_at, created_at, updated_at`
+
+const workflowTaskColumns = `
+	run_id, task_id, sort_order, agent_id, agent_key, type, COALESCE(input, ''), original_input, COALESCE(context, '{}'),
+	COALESCE(depends_on, '[]'), review, approval, status, COALESCE(result, ''), COALESCE(error, ''),
+	tokens_used, duration_ms, started_at, finished_at, updated_at`
+
+// Create 保存运行及其全部任务
+func (r *WorkflowRunRepository) Create(run *model.WorkflowRun) error {
+	contextJSON, err := json.Marshal(run.Context)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO workflow_runs
+		(id, project_id, user_id, template_id, name, status, input, context, failure_policy, created_at, updated_at)
+		VALUES ($1, NULLIF($2, 0), NULLIF($3, 0), $4, $5, $6, $7, $8, $9, NOW(), NOW())
+		RETURNING created_at, updated_at
+	`
+	if err := tx.QueryRow(query, run.ID, run.ProjectID, run.UserID, run.TemplateID, run.Name,
+		run.Status, run.Input, contextJSON, run.FailurePolicy).Scan(&run.CreatedAt, &run.UpdatedAt); err != nil {
+		return err
+	}
+
+	for _, task := range run.Tasks {
+		taskContext, err := json.Marshal(task.Context)
+		if err != nil {
+			return err
+		}
+		dependsOn := task.DependsOn
+		if dependsOn == nil {
+			dependsOn = []string{}
+		}
+		deps, err := json.Marshal(dependsOn)
+		if err != nil {
+			return err
+		}
+		var review interface{} // 没有审核配置时写入 NULL
+		if task.Review != nil {
+			if review, err = json.Marshal(task.Review); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO workflow_run_tasks
+			(run_id, task_id, sort_order, agent_id, agent_key, type, input, context, depends_on, review, status, result, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW())
+		`, run.ID, task.TaskID, task.SortOrder, task.AgentID, task.AgentKey, task.Type, task.Input, taskContext, deps, review, task.Status, task.Result)
+		if err != nil {
+			return err
+		}
+		task.RunID = run.ID
+	}
+
+	return tx.Commit()
+}
+
+// UpdateTask 更新任务的状态、结果、错误与用量
+func (r *WorkflowRunRepository) UpdateTask(task *model.WorkflowTaskRun) error {
+	query := `
+		UPDATE workflow_run_tasks
+		SET status = $3, result = $4, error = $5, tokens_used = $6, duration_ms = $7,
+			started_at = $8, finished_at = $9, updated_at = NOW()
+		WHERE run_id = $1 AND task_id = $2
+	`
+	_, err := r.db.Exec(query, task.RunID, task.TaskID, task.Status, task.Result, task.Error,
+		task.TokensUsed, task.DurationMs, task.StartedAt, task.FinishedAt)
+	return err
+}
+
+// MarkRunning 将运行标记为执行中，首次开始时记录开始时间
+func (r *WorkflowRunRepository) MarkRunning(id string) error {
+	query := `
+		UPDATE workflow_runs
+		SET status = $2, started_at = COALESCE(started_at, NOW()), updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.db.Exec(query, id, model.WorkflowRunRunning)
+	return err
+}
+
+// Finish 记录运行结束时的状态、最终内容与错误
+func (r *WorkflowRunRepository) Finish(run *model.WorkflowRun) error {
+	now := time.Now()
+	run.FinishedAt = &now
+
+	query := `
+		UPDATE workflow_runs
+		SET status = $2, final_content = $3, error = $4, finished_at = $5, updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.db.Exec(query, run.ID, run.Status, run.FinalContent, run.Error, run.FinishedAt)
+	return err
+}
+
+// Pause 记录运行在审批任务处暂停，不记录结束时间
+func (r *WorkflowRunRepository) Pause(run *model.WorkflowRun) error {
+	query := `
+		UPDATE workflow_runs
+		SET status = $2, final_content = $3, error = '', updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.db.Exec(query, run.ID, model.WorkflowRunAwaitingApproval, run.FinalContent)
+	return err
+}
+
+// ResolveApproval 在同一事务中将暂停的运行改为待执行，并保存审批修改的任务 (状态、输入、结果与审批记录)
+// 运行不在等待审批的状态 (如已被处理或取消) 时返回 sql.ErrNoRows
+func (r *WorkflowRunRepository) ResolveApproval(runID string, tasks []*model.WorkflowTaskRun) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE workflow_runs SET status = $2, updated_at = NOW()
+		WHERE id = $1 AND status = $3
+	`, runID, model.WorkflowRunPending, model.WorkflowRunAwaitingApproval)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	for _, task := range tasks {
+		var approval interface{} // 上游任务没有审批记录，保留原值
+		if task.Approval != nil {
+			if approval, err = json.Marshal(task.Approval); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(`
+			UPDATE workflow_run_tasks
+			SET status = $3, input = $4, original_input = $5, result = $6, error = '',
+				finished_at = COALESCE($7, finished_at), approval = COALESCE($8, approval), updated_at = NOW()
+			WHERE run_id = $1 AND task_id = $2
+		`, runID, task.TaskID, task.Status, task.Input, task.OriginalInput, task.Result, task.FinishedAt, approval)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetByID 获取运行及其全部任务
+func (r *WorkflowRunRepository) GetByID(id string) (*model.WorkflowRun, error) {
+	query := `SELECT ` + workflowRunColumns + ` FROM workflow_runs WHERE id = $1`
+	run, err := scanWorkflowRun(r.db.QueryRow(query, id))
+	if err != nil {
+		return nil, err
+	}
+
+	run.Tasks, err = r.listTasks(id)
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// ListByProject 获取项目的运行记录 (不含任务)，最新的在前
+func (r *WorkflowRunRepository) ListByProject(projectID, limit, offset int) ([]*model.WorkflowRun, error) {
+	query := `SELECT ` + workflowRunColumns + `
+		FROM workflow_runs
+		WHERE project_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+	return r.queryRuns(query, projectID, limit, offset)
+}
+
+// ListAwaitingApproval 获取项目中暂停等待审批的运行及其任务，等待最久的在前
+func (r *WorkflowRunRepository) ListAwaitingApproval(projectID int) ([]*model.WorkflowRun, error) {
+	query := `SELECT ` + workflowRunColumns + `
+		FROM workflow_runs
+		WHERE project_id = $1 AND status = $2
+		ORDER BY updated_at ASC
+	`
+	runs, err := r.queryRuns(query, projectID, model.WorkflowRunAwaitingApproval)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, run := range runs {
+		if run.Tasks, err = r.listTasks(run.ID); err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+// ListUnfinished 获取未结束的运行及其任务，按创建时间排序
+// 等待审批的运行不在其中，处理审批后才继续执行
+func (r *WorkflowRunRepository) ListUnfinished() ([]*model.WorkflowRun, error) {
+	query := `SELECT ` + workflowRunColumns + `
+		FROM workflow_runs
+		WHERE status IN ($1, $2)
+		ORDER BY created_at ASC
+	`
+	runs, err := r.queryRuns(query, model.WorkflowRunPending, model.WorkflowRunRunning)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, run := range runs {
+		if run.Tasks, err = r.listTasks(run.ID); err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+func (r *WorkflowRunRepository) queryRuns(query string, args ...interface{}) ([]*model.WorkflowRun, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]*model.WorkflowRun, 0)
+	for rows.Next() {
+		run, err := scanWorkflowRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+func (r *WorkflowRunRepository) listTasks(runID string) ([]*model.WorkflowTaskRun, error) {
+	query := `SELECT ` + workflowTaskColumns + `
+		FROM workflow_run_tasks
+		WHERE run_id = $1
+		ORDER BY sort_order ASC
+	`
+	rows, err := r.db.Query(query, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := make([]*model.WorkflowTaskRun, 0)
+	for rows.Next() {
+		task, err := scanWorkflowTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+func scanWorkflowRun(row rowScanner) (*model.WorkflowRun, error) {
+	run := &model.WorkflowRun{}
+	var contextJSON []byte
+	err := row.Scan(
+		&run.ID,
+		&run.ProjectID,
+		&run.UserID,
+		&run.TemplateID,
+		&run.Name,
+		&run.Status,
+		&run.Input,
+		&contextJSON,
+		&run.FailurePolicy,
+		&run.FinalContent,
+		&run.Error,
+		&run.StartedAt,
+		&run.FinishedAt,
+		&run.CreatedAt,
+		&run.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contextJSON, &run.Context); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+func scanWorkflowTask(row rowScanner) (*model.WorkflowTaskRun, error) {
+	task := &model.WorkflowTaskRun{}
+	var contextJSON, dependsOn, review, approval []byte
+	err := row.Scan(
+		&task.RunID,
+		&task.TaskID,
+		&task.SortOrder,
+		&task.AgentID,
+		&task.AgentKey,
+		&task.Type,
+		&task.Input,
+		&task.OriginalInput,
+		&contextJSON,
+		&dependsOn,
+		&review,
+		&approval,
+		&task.Status,
+		&task.Result,
+		&task.Error,
+		&task.TokensUsed,
+		&task.DurationMs,
+		&task.StartedAt,
+		&task.FinishedAt,
+		&task.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contextJSON, &task.Context); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(dependsOn, &task.DependsOn); err != nil {
+		return nil, err
+	}
+	if review != nil {
+		task.Review = &model.WorkflowTaskReview{}
+		if err := json.Unmarshal(review, task.Review); err != nil {
+			return nil, err
+		}
+	}
+	if approval != nil {
+		task.Approval = &model.WorkflowApproval{}
+		if err := json.Unmarshal(approval, task.Approval); err != nil {
+			return nil, err
+		}
+	}
+	return task, nil
+}
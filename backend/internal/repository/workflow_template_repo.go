@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/zibianqu/novel-study/internal/model"
+)
+
+// WorkflowTemplateRepository 自定义工作流模板仓库
+type WorkflowTemplateRepository struct {
+	db *sql.DB
+}
+
+// NewWorkflowTemplateRepository 创建自定义工作流模板仓库
+func NewWorkflowTemplateRepository(db *sql.DB) *WorkflowTemplateRepository {
+	return &WorkflowTemplateRepository{db: db}
+}
+
+const workflowTemplateColumns = `
+	id, user_id, project_id, name, COALESCE(description, ''), format, definition, created_at, updated_at`
+
+// Create 创建模板
+func (r *WorkflowTemplateRepository) Create(tmpl *model.WorkflowTemplate) error {
+	query := `
+		INSERT INTO workflow_templates (user_id, project_id, name, description, format, definition, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`
+	err := r.db.QueryRow(query, tmpl.UserID, tmpl.ProjectID, tmpl.Name, tmpl.Description, tmpl.Format, tmpl.Definition).
+		Scan(&tmpl.ID, &tmpl.CreatedAt, &tmpl.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	tmpl.Key = workflowTemplateKey(tmpl.ID)
+	return nil
+}
+
+// Update 更新模板的定义
+func (r *WorkflowTemplateRepository) Update(tmpl *model.WorkflowTemplate) error {
+	query := `
+		UPDATE workflow_templates
+		SET name = $2, description = $3, format = $4, definition = $5, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`
+	return r.db.QueryRow(query, tmpl.ID, tmpl.Name, tmpl.Description, tmpl.Format, tmpl.Definition).Scan(&tmpl.UpdatedAt)
+}
+
+// Delete 删除模板
+func (r *WorkflowTemplateRepository) Delete(id int) error {
+	return execAffectingOne(r.db, `DELETE FROM workflow_templates WHERE id = $1`, id)
+}
+
+// GetByID 根据ID获取模板
+func (r *WorkflowTemplateRepository) GetByID(id int) (*model.WorkflowTemplate, error) {
+	query := `SELECT ` + workflowTemplateColumns + ` FROM workflow_templates WHERE id = $1`
+	return scanWorkflowTemplate(r.db.QueryRow(query, id))
+}
+
+// ListAvailable 获取用户级模板，projectID 不为 0 时同时返回该项目的模板
+func (r *WorkflowTemplateRepository) ListAvailable(userID, projectID int) ([]*model.WorkflowTemplate, error) {
+	query := `SELECT ` + workflowTemplateColumns + `
+		FROM workflow_templates
+		WHERE user_id = $1 AND (project_id IS NULL OR project_id = $2)
+		ORDER BY project_id NULLS FIRST, name ASC
+	`
+	rows, err := r.db.Query(query, userID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := make([]*model.WorkflowTemplate, 0)
+	for rows.Next() {
+		tmpl, err := scanWorkflowTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, tmpl)
+	}
+	return templates, rows.Err()
+}
+
+func scanWorkflowTemplate(row rowScanner) (*model.WorkflowTemplate, error) {
+	tmpl := &model.WorkflowTemplate{}
+	err := row.Scan(
+		&tmpl.ID,
+		&tmpl.UserID,
+		&tmpl.ProjectID,
+		&tmpl.Name,
+		&tmpl.Description,
+		&tmpl.Format,
+		&tmpl.Definition,
+		&tmpl.CreatedAt,
+		&tmpl.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.Key = workflowTemplateKey(tmpl.ID)
+	return tmpl, nil
+}
+
+func workflowTemplateKey(id int) string {
+	return fmt.Sprintf("%s%d", model.CustomWorkflowTemplatePrefix, id)
+}
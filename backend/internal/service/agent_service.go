@@ -0,0 +1,365 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/zibianqu/novel-study/internal/ai"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/ai/tools"
+	"github.com/zibianqu/novel-study/internal/model"
+	"github.com/zibianqu/novel-study/internal/repository"
+)
+
+var (
+	// ErrInvalidAgent 扩展Agent定义或输入不合法
+	ErrInvalidAgent = errors.New("invalid agent definition")
+	// ErrForbidden 无权访问资源
+	ErrForbidden = errors.New("forbidden")
+)
+
+// agentKeyPattern 用户提供的 Agent key 格式
+var agentKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,39}$`)
+
+const (
+	defaultExtensionModel       = "gpt-4o"
+	defaultExtensionTemperature = 0.7
+	defaultExtensionMaxTokens   = 4096
+	maxExtensionToolSteps       = 10
+	maxFallbackModels           = 3
+)
+
+// AgentService 用户扩展Agent服务
+type AgentService struct {
+	engine      *ai.Engine
+	agentRepo   *repository.AgentRepository
+	projectRepo *repository.ProjectRepository
+}
+
+// NewAgentService 创建扩展Agent服务
+func NewAgentService(engine *ai.Engine, agentRepo *repository.AgentRepository, projectRepo *repository.ProjectRepository) *AgentService {
+	return &AgentService{
+		engine:      engine,
+		agentRepo:   agentRepo,
+		projectRepo: projectRepo,
+	}
+}
+
+// ExtensionAgentKey 生成扩展Agent在引擎中的唯一 key，避免与核心Agent及其他用户冲突
+func ExtensionAgentKey(userID int, key string) string {
+	return fmt.Sprintf("ext_%d_%s", userID, key)
+}
+
+// CreateAgent 创建扩展Agent
+func (s *AgentService) CreateAgent(userID int, req *model.CreateAgentRequest) (*model.Agent, error) {
+	if !agentKeyPattern.MatchString(req.AgentKey) {
+		return nil, fmt.Errorf("%w: agent_key 只能包含小写字母、数字和下划线，且以字母开头", ErrInvalidAgent)
+	}
+
+	agent := &model.Agent{
+		UserID:       &userID,
+		AgentKey:     ExtensionAgentKey(userID, req.AgentKey),
+		Name:         req.Name,
+		Icon:         req.Icon,
+		Description:  req.Description,
+		Layer:        "auxiliary",
+		SystemPrompt: req.SystemPrompt,
+		Model:        req.Model,
+		Temperature:  defaultExtensionTemperature,
+		MaxTokens:    req.MaxTokens,
+		IsActive:     true,
+	}
+	if agent.Model == "" {
+		agent.Model = defaultExtensionModel
+	}
+	if req.Temperature != nil {
+		agent.Temperature = *req.Temperature
+	}
+	if agent.MaxTokens == 0 {
+		agent.MaxTokens = defaultExtensionMaxTokens
+	}
+
+	if err := s.applyDefinition(agent, req.Tools, req.InputSchema, req.OutputSchema, req.Permissions); err != nil {
+		return nil, err
+	}
+	if err := applyFallbackModels(agent, req.FallbackModels); err != nil {
+		return nil, err
+	}
+	// 先校验再写库，避免注册失败时留下引擎中不存在的记录
+	if err := s.engine.ValidateAgentModel(agent); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAgent, err)
+	}
+
+	if existing, err := s.agentRepo.GetByKey(agent.AgentKey); err == nil && existing != nil {
+		return nil, fmt.Errorf("%w: agent_key 已存在", ErrInvalidAgent)
+	}
+
+	if err := s.agentRepo.CreateExtension(agent); err != nil {
+		return nil, err
+	}
+
+	if err := s.engine.RegisterAgentModel(agent); err != nil {
+		return nil, err
+	}
+
+	return agent, nil
+}
+
+// GetAgent 获取扩展Agent详情
+func (s *AgentService) GetAgent(id, userID int) (*model.Agent, error) {
+	agent, err := s.agentRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 验证权限
+	if agent.Type != "extension" || agent.UserID == nil || *agent.UserID != userID {
+		return nil, fmt.Errorf("%w: 无权访问此Agent", ErrForbidden)
+	}
+
+	return agent, nil
+}
+
+// GetUserAgents 获取用户的扩展Agent列表
+func (s *AgentService) GetUserAgents(userID int) ([]*model.Agent, error) {
+	return s.agentRepo.GetExtensionAgentsByUserID(userID)
+}
+
+// UpdateAgent 更新扩展Agent
+func (s *AgentService) UpdateAgent(id, userID int, req *model.UpdateAgentRequest) (*model.Agent, error) {
+	agent, err := s.GetAgent(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 更新字段
+	if req.Name != "" {
+		agent.Name = req.Name
+	}
+	if req.Icon != "" {
+		agent.Icon = req.Icon
+	}
+	if req.Description != "" {
+		agent.Description = req.Description
+	}
+	if req.SystemPrompt != "" {
+		agent.SystemPrompt = req.SystemPrompt
+	}
+	if req.Model != "" {
+		agent.Model = req.Model
+	}
+	if req.Temperature != nil {
+		agent.Temperature = *req.Temperature
+	}
+	if req.MaxTokens > 0 {
+		agent.MaxTokens = req.MaxTokens
+	}
+	if req.IsActive != nil {
+		agent.IsActive = *req.IsActive
+	}
+
+	if err := s.applyDefinition(agent, req.Tools, req.InputSchema, req.OutputSchema, req.Permissions); err != nil {
+		return nil, err
+	}
+	if err := applyFallbackModels(agent, req.FallbackModels); err != nil {
+		return nil, err
+	}
+	if agent.IsActive {
+		if err := s.engine.ValidateAgentModel(agent); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAgent, err)
+		}
+	}
+
+	if err := s.agentRepo.UpdateExtension(agent); err != nil {
+		return nil, err
+	}
+
+	if err := s.engine.RegisterAgentModel(agent); err != nil {
+		return nil, err
+	}
+
+	return agent, nil
+}
+
+// DeleteAgent 删除扩展Agent
+func (s *AgentService) DeleteAgent(id, userID int) error {
+	agent, err := s.GetAgent(id, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.agentRepo.DeleteExtension(id, userID); err != nil {
+		return err
+	}
+
+	s.engine.UnregisterAgent(agent.AgentKey)
+	return nil
+}
+
+// RunAgent 在指定项目中运行扩展Agent
+func (s *AgentService) RunAgent(ctx context.Context, id, userID int, req *model.RunAgentRequest) (*llm.AgentResponse, error) {
+	agent, err := s.GetAgent(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !agent.IsActive {
+		return nil, fmt.Errorf("%w: Agent 已停用", ErrInvalidAgent)
+	}
+
+	// 验证项目权限
+	project, err := s.projectRepo.GetByID(req.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	if project.UserID != userID {
+		return nil, fmt.Errorf("%w: 无权访问此项目", ErrForbidden)
+	}
+
+	// 按 input_schema 校验输入
+	input := req.Input
+	if input == nil {
+		input = map[string]interface{}{}
+	}
+	var inputSchema tools.Schema
+	if err := json.Unmarshal([]byte(agent.InputSchema), &inputSchema); err == nil && inputSchema.Type != "" {
+		input, err = inputSchema.Validate(input)
+		if err != nil {
+			return nil, fmt.Errorf("%w: input 不符合 input_schema: %v", ErrInvalidAgent, err)
+		}
+	}
+
+	input["project_title"] = project.Title
+	return s.engine.ExecuteAgent(ctx, agent.AgentKey, &llm.AgentRequest{
+		Prompt:     req.Prompt,
+		Context:    input,
+		ProjectID:  req.ProjectID,
+		UserID:     userID,
+		ActionType: "agent_run",
+	})
+}
+
+// applyDefinition 校验并写入工具、Schema 与权限配置，nil 表示保持不变
+func (s *AgentService) applyDefinition(agent *model.Agent, toolNames []string, inputSchema, outputSchema map[string]interface{}, permissions *model.AgentPermissions) error {
+	if toolNames != nil {
+		if err := s.validateTools(toolNames); err != nil {
+			return err
+		}
+		data, _ := json.Marshal(toolNames)
+		agent.Tools = string(data)
+	}
+	if agent.Tools == "" {
+		agent.Tools = "[]"
+	}
+
+	if inputSchema != nil {
+		data, err := json.Marshal(inputSchema)
+		if err != nil {
+			return fmt.Errorf("%w: input_schema: %v", ErrInvalidAgent, err)
+		}
+		var schema tools.Schema
+		if err := json.Unmarshal(data, &schema); err != nil {
+			return fmt.Errorf("%w: input_schema: %v", ErrInvalidAgent, err)
+		}
+		if schema.Type != "" && schema.Type != "object" {
+			return fmt.Errorf("%w: input_schema 的 type 必须为 object", ErrInvalidAgent)
+		}
+		agent.InputSchema = string(data)
+	}
+	if agent.InputSchema == "" {
+		agent.InputSchema = "{}"
+	}
+
+	if outputSchema != nil {
+		data, err := json.Marshal(outputSchema)
+		if err != nil {
+			return fmt.Errorf("%w: output_schema: %v", ErrInvalidAgent, err)
+		}
+		var schema tools.Schema
+		if err := json.Unmarshal(data, &schema); err != nil {
+			return fmt.Errorf("%w: output_schema: %v", ErrInvalidAgent, err)
+		}
+		// 非空的 output_schema 会启用结构化输出，根节点必须为对象
+		if len(outputSchema) > 0 && schema.Type != "object" {
+			return fmt.Errorf("%w: output_schema 的 type 必须为 object", ErrInvalidAgent)
+		}
+		agent.OutputSchema = string(data)
+	}
+	if agent.OutputSchema == "" {
+		agent.OutputSchema = "{}"
+	}
+
+	if permissions != nil {
+		if permissions.MaxToolSteps < 0 || permissions.MaxToolSteps > maxExtensionToolSteps {
+			return fmt.Errorf("%w: max_tool_steps 必须在 0-%d 之间", ErrInvalidAgent, maxExtensionToolSteps)
+		}
+		data, _ := json.Marshal(permissions)
+		agent.Permissions = string(data)
+	}
+	if agent.Permissions == "" {
+		agent.Permissions = "{}"
+	}
+
+	return nil
+}
+
+// applyFallbackModels 校验并写入备用模型，nil 表示保持不变
+func applyFallbackModels(agent *model.Agent, models []string) error {
+	if models != nil {
+		if len(models) > maxFallbackModels {
+			return fmt.Errorf("%w: 备用模型最多 %d 个", ErrInvalidAgent, maxFallbackModels)
+		}
+		seen := map[string]bool{agent.Model: true}
+		for _, m := range models {
+			if m == "" || len(m) > 50 {
+				return fmt.Errorf("%w: 备用模型名称不能为空且不超过 50 个字符", ErrInvalidAgent)
+			}
+			if seen[m] {
+				return fmt.Errorf("%w: 备用模型重复: %s", ErrInvalidAgent, m)
+			}
+			seen[m] = true
+		}
+		data, _ := json.Marshal(models)
+		agent.FallbackModels = string(data)
+	}
+	if agent.FallbackModels == "" {
+		agent.FallbackModels = "[]"
+	}
+	return nil
+}
+
+// extensionAgentTools 扩展Agent可以使用的工具：只读，且按 project_id 限定在请求的项目内
+// 新增工具需确认不会修改数据、不会越过项目读取后再加入
+var extensionAgentTools = map[string]bool{
+	"rag_search":           true,
+	"query_neo4j":          true,
+	"get_project_status":   true,
+	"get_chapter_content":  true,
+	"get_storyline_status": true,
+}
+
+// validateTools 扩展Agent只能使用已注册且在白名单中的只读工具
+func (s *AgentService) validateTools(toolNames []string) error {
+	available := make(map[string]bool)
+	for _, info := range s.engine.ListTools() {
+		available[info.Name] = true
+	}
+
+	seen := make(map[string]bool, len(toolNames))
+	for _, name := range toolNames {
+		if !available[name] {
+			return fmt.Errorf("%w: 工具不存在: %s", ErrInvalidAgent, name)
+		}
+		if !extensionAgentTools[name] {
+			return fmt.Errorf("%w: 扩展Agent不允许使用该工具: %s", ErrInvalidAgent, name)
+		}
+		if seen[name] {
+			return fmt.Errorf("%w: 工具重复: %s", ErrInvalidAgent, name)
+		}
+		seen[name] = true
+	}
+
+	return nil
+}
@@ -3,8 +3,15 @@ package service
 import (
 	"context"
 	"fmt"
+	"log"
+	"strings"
 
 	"github.com/zibianqu/novel-study/internal/ai"
+	"github.com/zibianqu/novel-study/internal/ai/guard"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/ai/prompt"
+	"github.com/zibianqu/novel-study/internal/ai/rag"
+	"github.com/zibianqu/novel-study/internal/ai/tools"
 	"github.com/zibianqu/novel-study/internal/model"
 	"github.com/zibianqu/novel-study/internal/repository"
 )
@@ -14,6 +21,11 @@ type AIService struct {
 	engine      *ai.Engine
 	agentRepo   *repository.AgentRepository
 	projectRepo *repository.ProjectRepository
+
+	// 调试 Prompt 使用
+	prompts   *prompt.PromptService
+	retriever *rag.Retriever
+	summaries *SummaryService
 }
 
 // NewAIService 创建AI服务
@@ -25,8 +37,15 @@ func NewAIService(engine *ai.Engine, agentRepo *repository.AgentRepository, proj
 	}
 }
 
+// SetPromptInspection 设置调试 Prompt 所需的 Prompt 服务、RAG 检索器与摘要服务
+func (s *AIService) SetPromptInspection(prompts *prompt.PromptService, retriever *rag.Retriever, summaries *SummaryService) {
+	s.prompts = prompts
+	s.retriever = retriever
+	s.summaries = summaries
+}
+
 // Chat 与总导演对话
-func (s *AIService) Chat(ctx context.Context, userID, projectID int, message string) (*ai.AgentResponse, error) {
+func (s *AIService) Chat(ctx context.Context, userID, projectID int, message string) (*llm.AgentResponse, error) {
 	// 验证项目权限
 	project, err := s.projectRepo.GetByID(projectID)
 	if err != nil {
@@ -37,10 +56,11 @@ func (s *AIService) Chat(ctx context.Context, userID, projectID int, message str
 	}
 
 	// 构建Agent请求
-	req := &ai.AgentRequest{
-		UserID:    userID,
-		ProjectID: projectID,
-		Prompt:    message,
+	req := &llm.AgentRequest{
+		UserID:     userID,
+		ProjectID:  projectID,
+		Prompt:     message,
+		ActionType: "chat",
 		Context: map[string]interface{}{
 			"project_title": project.Title,
 			"project_type":  project.Type,
@@ -54,40 +74,88 @@ func (s *AIService) Chat(ctx context.Context, userID, projectID int, message str
 		return nil, err
 	}
 
-	// 记录日志
-	s.logInteraction(userID, projectID, 0, "chat", message, resp)
-
 	return resp, nil
 }
 
-// ChatStream 流式对话
-func (s *AIService) ChatStream(ctx context.Context, userID, projectID int, message string, callback func(string)) error {
-	// 验证项目权限
+// CheckBudget 检查用户与项目预算，流式接口在建立连接前调用
+func (s *AIService) CheckBudget(userID, projectID int) ([]string, error) {
 	project, err := s.projectRepo.GetByID(projectID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if project.UserID != userID {
-		return fmt.Errorf("无权访问此项目")
+		return nil, fmt.Errorf("%w: 无权访问此项目", ErrForbidden)
 	}
 
-	// 构建Agent请求
-	req := &ai.AgentRequest{
+	return s.engine.CheckBudget(userID, projectID)
+}
+
+// defaultEstimateAgent 预估用量时默认使用的Agent
+const defaultEstimateAgent = "agent_0_director"
+
+// EstimateChat 在生成前预估一次对话的 Token 用量与费用上限，请求内容与 Chat 一致
+func (s *AIService) EstimateChat(userID, projectID int, agentKey, message string) (*llm.TokenEstimate, error) {
+	project, err := s.projectRepo.GetByID(projectID)
+	if err != nil {
+		return nil, err
+	}
+	if project.UserID != userID {
+		return nil, fmt.Errorf("%w: 无权访问此项目", ErrForbidden)
+	}
+
+	if agentKey == "" {
+		agentKey = defaultEstimateAgent
+	}
+	// 扩展Agent只能由创建者使用
+	if strings.HasPrefix(agentKey, "ext_") && !strings.HasPrefix(agentKey, ExtensionAgentKey(userID, "")) {
+		return nil, fmt.Errorf("%w: 无权使用此Agent", ErrForbidden)
+	}
+
+	return s.engine.EstimateAgent(agentKey, &llm.AgentRequest{
 		UserID:    userID,
 		ProjectID: projectID,
 		Prompt:    message,
-		Stream:    true,
+		Context: map[string]interface{}{
+			"project_title": project.Title,
+			"project_type":  project.Type,
+			"project_genre": project.Genre,
+		},
+	})
+}
+
+// ChatStream 流式对话，返回的响应包含完整内容与 Token 用量
+func (s *AIService) ChatStream(ctx context.Context, userID, projectID int, message string, callback func(string)) (*llm.AgentResponse, error) {
+	// 验证项目权限
+	project, err := s.projectRepo.GetByID(projectID)
+	if err != nil {
+		return nil, err
+	}
+	if project.UserID != userID {
+		return nil, fmt.Errorf("无权访问此项目")
+	}
+
+	// 构建Agent请求
+	req := &llm.AgentRequest{
+		UserID:     userID,
+		ProjectID:  projectID,
+		Prompt:     message,
+		ActionType: "chat",
 		Context: map[string]interface{}{
 			"project_title": project.Title,
 		},
 	}
 
 	// 调用Agent 0 流式输出
-	return s.engine.ExecuteAgentStream(ctx, "agent_0_director", req, callback)
+	resp, err := s.engine.ExecuteAgentStream(ctx, "agent_0_director", req, callback)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
 }
 
 // GenerateChapter 生成章节
-func (s *AIService) GenerateChapter(ctx context.Context, userID, projectID int, chapterTitle, outline string) (*ai.AgentResponse, error) {
+func (s *AIService) GenerateChapter(ctx context.Context, userID, projectID int, chapterTitle, outline string) (*llm.AgentResponse, error) {
 	// 验证权限
 	project, err := s.projectRepo.GetByID(projectID)
 	if err != nil {
@@ -98,12 +166,13 @@ func (s *AIService) GenerateChapter(ctx context.Context, userID, projectID int,
 	}
 
 	// 构建 Prompt
-	prompt := fmt.Sprintf("请创作章节：%s\n\n大纲：%s", chapterTitle, outline)
+	prompt := fmt.Sprintf("请创作章节：%s\n\n大纲：\n%s", chapterTitle, guard.WrapUserContent("outline", outline))
 
-	req := &ai.AgentRequest{
-		UserID:    userID,
-		ProjectID: projectID,
-		Prompt:    prompt,
+	req := &llm.AgentRequest{
+		UserID:     userID,
+		ProjectID:  projectID,
+		Prompt:     prompt,
+		ActionType: "generate_chapter",
 		Context: map[string]interface{}{
 			"chapter_title": chapterTitle,
 			"outline":       outline,
@@ -116,18 +185,16 @@ func (s *AIService) GenerateChapter(ctx context.Context, userID, projectID int,
 		return nil, err
 	}
 
-	// 记录日志
-	s.logInteraction(userID, projectID, 1, "generate_chapter", prompt, resp)
-
 	return resp, nil
 }
 
 // CheckQuality 质量检查
-func (s *AIService) CheckQuality(ctx context.Context, userID, projectID int, content string) (*ai.AgentResponse, error) {
-	req := &ai.AgentRequest{
-		UserID:    userID,
-		ProjectID: projectID,
-		Prompt:    fmt.Sprintf("请审核以下内容：\n\n%s", content),
+func (s *AIService) CheckQuality(ctx context.Context, userID, projectID int, content string) (*llm.AgentResponse, error) {
+	req := &llm.AgentRequest{
+		UserID:     userID,
+		ProjectID:  projectID,
+		Prompt:     fmt.Sprintf("请审核以下内容：\n\n%s", guard.WrapUserContent("content", content)),
+		ActionType: "quality_check",
 	}
 
 	// 调用Agent 3 (审核导演)
@@ -136,9 +203,6 @@ func (s *AIService) CheckQuality(ctx context.Context, userID, projectID int, con
 		return nil, err
 	}
 
-	// 记录日志
-	s.logInteraction(userID, projectID, 3, "quality_check", content, resp)
-
 	return resp, nil
 }
 
@@ -147,20 +211,143 @@ func (s *AIService) GetAgents() ([]string, error) {
 	return s.engine.ListAgents(), nil
 }
 
-// logInteraction 记录AI交互日志
-func (s *AIService) logInteraction(userID, projectID, agentID int, actionType, input string, resp *ai.AgentResponse) {
-	log := &model.AIInteractionLog{
-		UserID:         userID,
-		ProjectID:      &projectID,
-		AgentID:        &agentID,
-		ActionType:     actionType,
-		InputPrompt:    input,
-		OutputResponse: resp.Content,
-		TokensInput:    0, // TODO: 计算
-		TokensOutput:   resp.TokensUsed,
-		Model:          "gpt-4o",
-		DurationMs:     int(resp.DurationMs),
-	}
-
-	s.agentRepo.LogInteraction(log)
+// ReloadAgents 从数据库重新加载Agent定义
+func (s *AIService) ReloadAgents() (int, error) {
+	return s.engine.LoadAgents()
+}
+
+// GetTools 获取工具列表（含参数 Schema）
+func (s *AIService) GetTools() []tools.ToolInfo {
+	return s.engine.ListTools()
+}
+
+// 调试 Prompt 时注入的 RAG 文档数，默认 5，最多与 rag_search 工具一致
+const (
+	defaultInspectRAGTopK = 5
+	maxInspectRAGTopK     = 20
+)
+
+// InspectPrompt 按Agent实际使用的系统提示词与模型构建 Prompt，返回模型将收到的消息，不调用模型
+func (s *AIService) InspectPrompt(ctx context.Context, userID int, req *model.InspectPromptRequest) (*prompt.PromptInspection, error) {
+	if s.prompts == nil {
+		return nil, fmt.Errorf("prompt inspection is not configured")
+	}
+
+	project, err := s.projectRepo.GetByID(req.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	if project.UserID != userID {
+		return nil, fmt.Errorf("%w: 无权访问此项目", ErrForbidden)
+	}
+
+	agentKey := req.AgentKey
+	if agentKey == "" {
+		agentKey = defaultEstimateAgent
+	}
+	if strings.HasPrefix(agentKey, "ext_") && !strings.HasPrefix(agentKey, ExtensionAgentKey(userID, "")) {
+		return nil, fmt.Errorf("%w: 无权使用此Agent", ErrForbidden)
+	}
+
+	agentReq := &llm.AgentRequest{
+		UserID:    userID,
+		ProjectID: req.ProjectID,
+		Prompt:    req.Message,
+		Context: map[string]interface{}{
+			"project_title": project.Title,
+			"project_type":  project.Type,
+			"project_genre": project.Genre,
+		},
+	}
+	agentPrompt, err := s.engine.AgentPrompt(agentKey, agentReq)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &prompt.PromptOptions{
+		Model:     agentPrompt.Model,
+		ProjectID: req.ProjectID,
+		ProjectInfo: map[string]interface{}{
+			"title":   project.Title,
+			"genre":   project.Genre,
+			"summary": project.Description,
+		},
+		RecentContent:     req.RecentContent,
+		WritingGuidelines: req.WritingGuidelines,
+		IncludeMetadata:   req.IncludeMetadata,
+		Summarizer:        s.engine.Summarizer(userID, req.ProjectID),
+	}
+
+	// 指定章节时与续写一致，带上章节正文与长期记忆
+	if req.ChapterID > 0 && s.summaries != nil {
+		memory, err := s.summaries.ContinueWriteMemory(req.ProjectID, req.ChapterID, 0)
+		if err != nil {
+			return nil, err
+		}
+		if options.RecentContent == "" {
+			options.RecentContent = memory.Context
+		}
+		options.ChapterSummaries = memory.ChapterSummaries
+		options.VolumeSummaries = memory.VolumeSummaries
+		options.ProjectSummary = memory.ProjectSummary
+	}
+
+	docs := s.retrieveForInspection(ctx, req)
+	if len(docs) > 0 {
+		items := make([]string, len(docs))
+		for i, doc := range docs {
+			items[i] = doc.Content
+		}
+		options.KnowledgeItems = map[string][]string{"rag": items}
+	}
+
+	// 组装好的 Prompt 作为用户提示词交给Agent构建消息，与执行时发送给模型的一致
+	messages := func(userPrompt string) ([]prompt.InspectedMessage, error) {
+		built := *agentReq
+		built.Prompt = userPrompt
+		chat, err := s.engine.AgentMessages(agentKey, &built)
+		if err != nil {
+			return nil, err
+		}
+		inspected := make([]prompt.InspectedMessage, len(chat))
+		for i, msg := range chat {
+			inspected[i] = prompt.InspectedMessage{Role: msg.Role, Content: msg.Content}
+		}
+		return inspected, nil
+	}
+
+	inspection, err := s.prompts.InspectAgentPrompt(ctx, agentPrompt.SystemPrompt, req.Message, options, messages)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		inspection.Documents = append(inspection.Documents, prompt.InjectedDocument{
+			ID:       doc.ID,
+			Content:  doc.Content,
+			Score:    doc.Score,
+			Metadata: doc.Metadata,
+		})
+	}
+	return inspection, nil
+}
+
+// retrieveForInspection 检索要注入 Prompt 的 RAG 文档，检索失败时不注入
+func (s *AIService) retrieveForInspection(ctx context.Context, req *model.InspectPromptRequest) []*rag.Document {
+	if s.retriever == nil || strings.TrimSpace(req.RAGQuery) == "" {
+		return nil
+	}
+
+	topK := req.RAGTopK
+	if topK <= 0 {
+		topK = defaultInspectRAGTopK
+	}
+	if topK > maxInspectRAGTopK {
+		topK = maxInspectRAGTopK
+	}
+	docs, err := s.retriever.Retrieve(ctx, req.ProjectID, req.RAGQuery, topK)
+	if err != nil {
+		log.Printf("⚠️ 调试 Prompt 检索知识库失败: %v", err)
+		return nil
+	}
+	return docs
 }
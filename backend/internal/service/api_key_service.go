@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/ai/openai"
+	"github.com/zibianqu/novel-study/internal/config"
+	"github.com/zibianqu/novel-study/internal/repository"
+	"github.com/zibianqu/novel-study/internal/util"
+)
+
+var (
+	// ErrInvalidAPIKey API 密钥格式错误或验证失败
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	// ErrAPIKeyNotSet 用户未设置 API 密钥
+	ErrAPIKeyNotSet = errors.New("api key not set")
+)
+
+const (
+	maxAPIKeyLength  = 300
+	apiKeyVerifyTime = 15 * time.Second
+)
+
+// APIKeyStatus 用户 API 密钥状态，不包含密钥本身
+type APIKeyStatus struct {
+	Configured bool       `json:"configured"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+// APIKeyService 用户自带 API 密钥服务，实现 ai.ProviderResolver
+// 密钥使用 AES-256-GCM 加密存储，任何接口都不会返回密钥明文
+type APIKeyService struct {
+	cfg      *config.Config
+	userRepo *repository.UserRepository
+}
+
+// NewAPIKeyService 创建 API 密钥服务
+func NewAPIKeyService(cfg *config.Config, userRepo *repository.UserRepository) *APIKeyService {
+	return &APIKeyService{
+		cfg:      cfg,
+		userRepo: userRepo,
+	}
+}
+
+// GetStatus 获取用户是否设置了 API 密钥
+func (s *APIKeyService) GetStatus(userID int) (*APIKeyStatus, error) {
+	encrypted, updatedAt, err := s.userRepo.GetAPIKey(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &APIKeyStatus{Configured: encrypted != "", UpdatedAt: updatedAt}, nil
+}
+
+// SetAPIKey 验证并保存用户的 API 密钥，验证失败时不保存
+func (s *APIKeyService) SetAPIKey(ctx context.Context, userID int, apiKey string) (*APIKeyStatus, error) {
+	apiKey = strings.TrimSpace(apiKey)
+	if apiKey == "" || len(apiKey) > maxAPIKeyLength || strings.ContainsAny(apiKey, " \t\r\n") {
+		return nil, fmt.Errorf("%w: 密钥格式不正确", ErrInvalidAPIKey)
+	}
+
+	if err := s.verify(ctx, apiKey); err != nil {
+		return nil, err
+	}
+
+	encrypted, err := util.EncryptAPIKey(apiKey, s.cfg.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("加密 API 密钥失败: %w", err)
+	}
+	if err := s.userRepo.SetAPIKey(userID, encrypted); err != nil {
+		return nil, err
+	}
+
+	return s.GetStatus(userID)
+}
+
+// TestAPIKey 验证已保存的 API 密钥是否可用
+func (s *APIKeyService) TestAPIKey(ctx context.Context, userID int) error {
+	apiKey, err := s.load(userID)
+	if err != nil {
+		return err
+	}
+	if apiKey == "" {
+		return ErrAPIKeyNotSet
+	}
+
+	return s.verify(ctx, apiKey)
+}
+
+// DeleteAPIKey 删除用户的 API 密钥，之后的调用使用系统密钥
+func (s *APIKeyService) DeleteAPIKey(userID int) error {
+	return s.userRepo.DeleteAPIKey(userID)
+}
+
+// ProviderFor 返回使用用户自己密钥的模型提供方，未设置密钥时返回 nil
+func (s *APIKeyService) ProviderFor(userID int) (llm.LLMProvider, error) {
+	apiKey, err := s.load(userID)
+	if err != nil || apiKey == "" {
+		return nil, err
+	}
+
+	return openai.NewClientWithBaseURL(apiKey, s.cfg.OpenAIBaseURL), nil
+}
+
+// load 读取并解密用户的 API 密钥，未设置时返回空字符串
+func (s *APIKeyService) load(userID int) (string, error) {
+	encrypted, _, err := s.userRepo.GetAPIKey(userID)
+	if err != nil || encrypted == "" {
+		return "", err
+	}
+
+	apiKey, err := util.DecryptAPIKey(encrypted, s.cfg.EncryptionKey)
+	if err != nil {
+		return "", fmt.Errorf("解密 API 密钥失败: %w", err)
+	}
+	return apiKey, nil
+}
+
+// verify 使用密钥请求模型服务，确认密钥可用
+func (s *APIKeyService) verify(ctx context.Context, apiKey string) error {
+	ctx, cancel := context.WithTimeout(ctx, apiKeyVerifyTime)
+	defer cancel()
+
+	client := openai.NewClientWithBaseURL(apiKey, s.cfg.OpenAIBaseURL)
+	if err := client.Verify(ctx); err != nil {
+		return fmt.Errorf("%w: 密钥验证失败: %v", ErrInvalidAPIKey, err)
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zibianqu/novel-study/internal/config"
+	"github.com/zibianqu/novel-study/internal/model"
+	"github.com/zibianqu/novel-study/internal/repository"
+)
+
+var (
+	// ErrTokenBudgetExceeded Token 用量超出预算
+	ErrTokenBudgetExceeded = errors.New("token budget exceeded")
+	// ErrCostBudgetExceeded 费用超出预算
+	ErrCostBudgetExceeded = errors.New("cost budget exceeded")
+	// ErrInvalidBudget 预算设置不合法
+	ErrInvalidBudget = errors.New("invalid budget")
+)
+
+// BudgetService AI 预算服务，实现 ai.BudgetGuard
+// 预算在每次调用模型前检查，进行中的调用不会被中断，因此用量可能略微超出上限
+type BudgetService struct {
+	cfg         *config.Config
+	budgetRepo  *repository.BudgetRepository
+	usageRepo   *repository.UsageRepository
+	projectRepo *repository.ProjectRepository
+}
+
+// NewBudgetService 创建预算服务
+func NewBudgetService(
+	cfg *config.Config,
+	budgetRepo *repository.BudgetRepository,
+	usageRepo *repository.UsageRepository,
+	projectRepo *repository.ProjectRepository,
+) *BudgetService {
+	return &BudgetService{
+		cfg:         cfg,
+		budgetRepo:  budgetRepo,
+		usageRepo:   usageRepo,
+		projectRepo: projectRepo,
+	}
+}
+
+// CheckBudget 检查用户与项目预算，任一超出时返回错误，接近上限时返回提醒
+// userID 或 projectID 为 0 时跳过对应检查
+func (s *BudgetService) CheckBudget(userID, projectID int) ([]string, error) {
+	var warnings []string
+
+	scopes := []struct {
+		scope string
+		id    int
+	}{
+		{model.BudgetScopeUser, userID},
+		{model.BudgetScopeProject, projectID},
+	}
+	for _, sc := range scopes {
+		if sc.id <= 0 {
+			continue
+		}
+
+		status, err := s.limits(sc.scope, sc.id)
+		if err != nil {
+			return nil, fmt.Errorf("检查预算失败: %w", err)
+		}
+		if !hasLimit(status) {
+			continue
+		}
+		if err := s.fillUsage(status); err != nil {
+			return nil, fmt.Errorf("检查预算失败: %w", err)
+		}
+		if err := exceeded(status); err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, status.Warnings...)
+	}
+
+	return warnings, nil
+}
+
+// GetUserBudget 获取用户预算执行情况
+func (s *BudgetService) GetUserBudget(userID int) (*model.BudgetStatus, error) {
+	return s.status(model.BudgetScopeUser, userID)
+}
+
+// GetProjectBudget 获取项目预算执行情况
+func (s *BudgetService) GetProjectBudget(projectID, userID int) (*model.BudgetStatus, error) {
+	if err := s.checkProject(projectID, userID); err != nil {
+		return nil, err
+	}
+	return s.status(model.BudgetScopeProject, projectID)
+}
+
+// SetUserBudget 设置用户预算 (管理员)
+func (s *BudgetService) SetUserBudget(userID int, req *model.UpdateBudgetRequest) (*model.BudgetStatus, error) {
+	if err := s.save(model.BudgetScopeUser, userID, req); err != nil {
+		return nil, err
+	}
+	return s.status(model.BudgetScopeUser, userID)
+}
+
+// SetProjectBudget 设置项目预算，仅项目所有者可设置
+// 项目预算只能进一步限制项目用量，用户预算仍然生效
+func (s *BudgetService) SetProjectBudget(projectID, userID int, req *model.UpdateBudgetRequest) (*model.BudgetStatus, error) {
+	if err := s.checkProject(projectID, userID); err != nil {
+		return nil, err
+	}
+	if err := s.save(model.BudgetScopeProject, projectID, req); err != nil {
+		return nil, err
+	}
+	return s.status(model.BudgetScopeProject, projectID)
+}
+
+func (s *BudgetService) checkProject(projectID, userID int) error {
+	project, err := s.projectRepo.GetByID(projectID)
+	if err != nil {
+		return err
+	}
+	if project.UserID != userID {
+		return fmt.Errorf("%w: 无权访问此项目", ErrForbidden)
+	}
+	return nil
+}
+
+func (s *BudgetService) save(scope string, scopeID int, req *model.UpdateBudgetRequest) error {
+	if (req.DailyTokenLimit != nil && *req.DailyTokenLimit < 0) ||
+		(req.MonthlyTokenLimit != nil && *req.MonthlyTokenLimit < 0) {
+		return fmt.Errorf("%w: Token 上限不能为负数", ErrInvalidBudget)
+	}
+	if (req.DailyCostLimit != nil && *req.DailyCostLimit < 0) ||
+		(req.MonthlyCostLimit != nil && *req.MonthlyCostLimit < 0) {
+		return fmt.Errorf("%w: 费用上限不能为负数", ErrInvalidBudget)
+	}
+	if req.WarnRatio != nil && (*req.WarnRatio <= 0 || *req.WarnRatio > 1) {
+		return fmt.Errorf("%w: warn_ratio 必须在 (0, 1] 之间", ErrInvalidBudget)
+	}
+
+	return s.budgetRepo.Upsert(&model.Budget{
+		Scope:             scope,
+		ScopeID:           scopeID,
+		DailyTokenLimit:   req.DailyTokenLimit,
+		MonthlyTokenLimit: req.MonthlyTokenLimit,
+		DailyCostLimit:    req.DailyCostLimit,
+		MonthlyCostLimit:  req.MonthlyCostLimit,
+		WarnRatio:         req.WarnRatio,
+	})
+}
+
+// status 获取预算上限与当前用量
+func (s *BudgetService) status(scope string, scopeID int) (*model.BudgetStatus, error) {
+	status, err := s.limits(scope, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.fillUsage(status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// limits 获取预算上限，未单独设置的字段使用系统默认值
+func (s *BudgetService) limits(scope string, scopeID int) (*model.BudgetStatus, error) {
+	status := &model.BudgetStatus{
+		Scope:     scope,
+		ScopeID:   scopeID,
+		WarnRatio: s.cfg.BudgetWarnRatio,
+		Warnings:  []string{},
+	}
+	if scope == model.BudgetScopeUser {
+		status.Daily.TokenLimit = s.cfg.UserDailyTokenBudget
+		status.Monthly.TokenLimit = s.cfg.UserMonthlyTokenBudget
+		status.Daily.CostLimit = s.cfg.UserDailyCostBudget
+		status.Monthly.CostLimit = s.cfg.UserMonthlyCostBudget
+	} else {
+		status.Daily.TokenLimit = s.cfg.ProjectDailyTokenBudget
+		status.Monthly.TokenLimit = s.cfg.ProjectMonthlyTokenBudget
+		status.Daily.CostLimit = s.cfg.ProjectDailyCostBudget
+		status.Monthly.CostLimit = s.cfg.ProjectMonthlyCostBudget
+	}
+
+	budget, err := s.budgetRepo.Get(scope, scopeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if budget.DailyTokenLimit != nil {
+		status.Daily.TokenLimit = *budget.DailyTokenLimit
+	}
+	if budget.MonthlyTokenLimit != nil {
+		status.Monthly.TokenLimit = *budget.MonthlyTokenLimit
+	}
+	if budget.DailyCostLimit != nil {
+		status.Daily.CostLimit = *budget.DailyCostLimit
+	}
+	if budget.MonthlyCostLimit != nil {
+		status.Monthly.CostLimit = *budget.MonthlyCostLimit
+	}
+	if budget.WarnRatio != nil {
+		status.WarnRatio = *budget.WarnRatio
+	}
+	return status, nil
+}
+
+// fillUsage 统计今日与本月用量并生成提醒
+// 预算只限制系统密钥的用量，用户使用自己的 API 密钥产生的用量不计入
+func (s *BudgetService) fillUsage(status *model.BudgetStatus) error {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	end := today.AddDate(0, 0, 1)
+
+	periods := []struct {
+		period *model.BudgetPeriod
+		from   time.Time
+	}{
+		{&status.Daily, today},
+		{&status.Monthly, month},
+	}
+	for _, p := range periods {
+		q := &model.UsageQuery{KeySource: model.KeySourcePlatform, From: p.from, To: end}
+		scopeID := status.ScopeID
+		if status.Scope == model.BudgetScopeUser {
+			q.UserID = &scopeID
+		} else {
+			q.ProjectID = &scopeID
+		}
+
+		stats, err := s.usageRepo.Aggregate(q)
+		if err != nil {
+			return err
+		}
+		if len(stats) > 0 {
+			p.period.Tokens = stats[0].TotalTokens
+			p.period.Cost = stats[0].Cost
+		}
+	}
+
+	status.Warnings = budgetWarnings(status)
+	return nil
+}
+
+// hasLimit 是否设置了任一上限
+func hasLimit(status *model.BudgetStatus) bool {
+	return status.Daily.TokenLimit > 0 || status.Monthly.TokenLimit > 0 ||
+		status.Daily.CostLimit > 0 || status.Monthly.CostLimit > 0
+}
+
+// exceeded 检查是否已达到上限
+func exceeded(status *model.BudgetStatus) error {
+	scope := budgetScopeName(status.Scope)
+	for _, p := range budgetPeriods(status) {
+		if p.period.TokenLimit > 0 && p.period.Tokens >= p.period.TokenLimit {
+			return fmt.Errorf("%w: %s%s Token 用量已达上限 (%d/%d)",
+				ErrTokenBudgetExceeded, scope, p.name, p.period.Tokens, p.period.TokenLimit)
+		}
+		if p.period.CostLimit > 0 && p.period.Cost >= p.period.CostLimit {
+			return fmt.Errorf("%w: %s%s费用已达上限 ($%.2f/$%.2f)",
+				ErrCostBudgetExceeded, scope, p.name, p.period.Cost, p.period.CostLimit)
+		}
+	}
+	return nil
+}
+
+// budgetWarnings 用量达到提醒比例时生成提醒
+func budgetWarnings(status *model.BudgetStatus) []string {
+	warnings := []string{}
+	scope := budgetScopeName(status.Scope)
+	for _, p := range budgetPeriods(status) {
+		if p.period.TokenLimit > 0 && float64(p.period.Tokens) >= float64(p.period.TokenLimit)*status.WarnRatio {
+			warnings = append(warnings, fmt.Sprintf("%s%s Token 用量已达预算的 %.0f%% (%d/%d)",
+				scope, p.name, float64(p.period.Tokens)/float64(p.period.TokenLimit)*100, p.period.Tokens, p.period.TokenLimit))
+		}
+		if p.period.CostLimit > 0 && p.period.Cost >= p.period.CostLimit*status.WarnRatio {
+			warnings = append(warnings, fmt.Sprintf("%s%s费用已达预算的 %.0f%% ($%.2f/$%.2f)",
+				scope, p.name, p.period.Cost/p.period.CostLimit*100, p.period.Cost, p.period.CostLimit))
+		}
+	}
+	return warnings
+}
+
+type namedBudgetPeriod struct {
+	name   string
+	period *model.BudgetPeriod
+}
+
+func budgetPeriods(status *model.BudgetStatus) []namedBudgetPeriod {
+	return []namedBudgetPeriod{
+		{"今日", &status.Daily},
+		{"本月", &status.Monthly},
+	}
+}
+
+func budgetScopeName(scope string) string {
+	if scope == model.BudgetScopeProject {
+		return "项目"
+	}
+	return "用户"
+}
@@ -12,12 +12,18 @@ import (
 type ChapterService struct {
 	repo        *repository.ChapterRepository
 	projectRepo *repository.ProjectRepository
+	summaries   *SummaryService
 }
 
 func NewChapterService(repo *repository.ChapterRepository, projectRepo *repository.ProjectRepository) *ChapterService {
 	return &ChapterService{repo: repo, projectRepo: projectRepo}
 }
 
+// SetSummaryService 设置摘要服务，章节内容变化后自动刷新摘要
+func (s *ChapterService) SetSummaryService(summaries *SummaryService) {
+	s.summaries = summaries
+}
+
 func (s *ChapterService) CreateChapter(userID int, req *model.CreateChapterRequest) (*model.Chapter, error) {
 	// 验证项目权限
 	project, err := s.projectRepo.GetByID(req.ProjectID)
@@ -48,6 +54,10 @@ func (s *ChapterService) CreateChapter(userID int, req *model.CreateChapterReque
 	// 更新项目总字数
 	s.updateProjectWordCount(req.ProjectID)
 
+	if chapter.Content != "" {
+		s.scheduleSummaryRefresh(userID, chapter.ID)
+	}
+
 	return chapter, nil
 }
 
@@ -93,6 +103,7 @@ func (s *ChapterService) UpdateChapter(id, userID int, req *model.UpdateChapterR
 	if req.Title != "" {
 		chapter.Title = req.Title
 	}
+	contentChanged := req.Content != "" && req.Content != chapter.Content
 	if req.Content != "" {
 		chapter.Content = req.Content
 		chapter.WordCount = countWords(req.Content)
@@ -111,6 +122,10 @@ func (s *ChapterService) UpdateChapter(id, userID int, req *model.UpdateChapterR
 	// 更新项目总字数
 	s.updateProjectWordCount(chapter.ProjectID)
 
+	if contentChanged {
+		s.scheduleSummaryRefresh(userID, chapter.ID)
+	}
+
 	return chapter, nil
 }
 
@@ -130,6 +145,10 @@ func (s *ChapterService) DeleteChapter(id, userID int) error {
 	// 更新项目总字数
 	s.updateProjectWordCount(projectID)
 
+	if s.summaries != nil {
+		s.summaries.ScheduleProjectRefresh(userID, projectID)
+	}
+
 	return nil
 }
 
@@ -141,6 +160,13 @@ func (s *ChapterService) UnlockChapter(chapterID, userID int) error {
 	return s.repo.Unlock(chapterID, userID)
 }
 
+// scheduleSummaryRefresh 内容变化后刷新章节及所在卷、项目的摘要
+func (s *ChapterService) scheduleSummaryRefresh(userID, chapterID int) {
+	if s.summaries != nil {
+		s.summaries.ScheduleRefresh(userID, chapterID)
+	}
+}
+
 // updateProjectWordCount 更新项目总字数
 func (s *ChapterService) updateProjectWordCount(projectID int) {
 	chapters, err := s.repo.GetByProjectID(projectID)
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zibianqu/novel-study/internal/ai"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/model"
+	"github.com/zibianqu/novel-study/internal/repository"
+)
+
+// ErrInvalidChatSession 会话请求不合法
+var ErrInvalidChatSession = errors.New("invalid chat session request")
+
+const (
+	defaultChatAgentKey     = "agent_0_director"
+	defaultChatSessionTitle = "新对话"
+	// chatTitleMaxRunes 根据首条消息自动生成标题时的最大长度
+	chatTitleMaxRunes = 30
+)
+
+// ChatSessionService 多轮对话会话服务
+type ChatSessionService struct {
+	engine      *ai.Engine
+	sessionRepo *repository.ChatSessionRepository
+	projectRepo *repository.ProjectRepository
+}
+
+// NewChatSessionService 创建对话会话服务
+func NewChatSessionService(engine *ai.Engine, sessionRepo *repository.ChatSessionRepository, projectRepo *repository.ProjectRepository) *ChatSessionService {
+	return &ChatSessionService{
+		engine:      engine,
+		sessionRepo: sessionRepo,
+		projectRepo: projectRepo,
+	}
+}
+
+// CreateSession 创建会话
+func (s *ChatSessionService) CreateSession(userID int, req *model.CreateChatSessionRequest) (*model.ChatSession, error) {
+	if err := s.checkProject(req.ProjectID, userID); err != nil {
+		return nil, err
+	}
+
+	agentKey := req.AgentKey
+	if agentKey == "" {
+		agentKey = defaultChatAgentKey
+	}
+	if err := s.checkAgent(agentKey, userID); err != nil {
+		return nil, err
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = defaultChatSessionTitle
+	}
+
+	session := &model.ChatSession{
+		UserID:    userID,
+		ProjectID: req.ProjectID,
+		AgentKey:  agentKey,
+		Title:     title,
+	}
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// GetSession 获取会话
+func (s *ChatSessionService) GetSession(id, userID int) (*model.ChatSession, error) {
+	session, err := s.sessionRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 验证权限
+	if session.UserID != userID {
+		return nil, fmt.Errorf("%w: 无权访问此会话", ErrForbidden)
+	}
+
+	return session, nil
+}
+
+// CheckBudget 检查用户与会话所属项目的预算，流式接口在建立连接前调用
+func (s *ChatSessionService) CheckBudget(userID, projectID int) ([]string, error) {
+	return s.engine.CheckBudget(userID, projectID)
+}
+
+// GetMessages 获取会话的消息记录
+func (s *ChatSessionService) GetMessages(id, userID int) ([]*model.ChatSessionMessage, error) {
+	if _, err := s.GetSession(id, userID); err != nil {
+		return nil, err
+	}
+
+	return s.sessionRepo.GetMessages(id)
+}
+
+// GetProjectSessions 获取项目下的会话列表
+func (s *ChatSessionService) GetProjectSessions(projectID, userID int) ([]*model.ChatSession, error) {
+	if err := s.checkProject(projectID, userID); err != nil {
+		return nil, err
+	}
+
+	return s.sessionRepo.GetByProject(userID, projectID)
+}
+
+// RenameSession 重命名会话
+func (s *ChatSessionService) RenameSession(id, userID int, title string) (*model.ChatSession, error) {
+	session, err := s.GetSession(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return nil, fmt.Errorf("%w: 标题不能为空", ErrInvalidChatSession)
+	}
+
+	if err := s.sessionRepo.UpdateTitle(id, title); err != nil {
+		return nil, err
+	}
+
+	session.Title = title
+	return session, nil
+}
+
+// ForkSession 从已有会话分叉出新会话，可指定截止的消息
+func (s *ChatSessionService) ForkSession(id, userID int, req *model.ForkChatSessionRequest) (*model.ChatSession, error) {
+	source, err := s.GetSession(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.MessageID > 0 {
+		ok, err := s.sessionRepo.MessageBelongsTo(id, req.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: 消息不属于此会话", ErrInvalidChatSession)
+		}
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = truncateRunes(source.Title+" (分支)", 200)
+	}
+
+	fork := &model.ChatSession{
+		UserID:     userID,
+		ProjectID:  source.ProjectID,
+		AgentKey:   source.AgentKey,
+		Title:      title,
+		ForkedFrom: &source.ID,
+	}
+	if err := s.sessionRepo.Fork(fork, req.MessageID); err != nil {
+		return nil, err
+	}
+
+	return fork, nil
+}
+
+// DeleteSession 删除会话
+func (s *ChatSessionService) DeleteSession(id, userID int) error {
+	if _, err := s.GetSession(id, userID); err != nil {
+		return err
+	}
+
+	return s.sessionRepo.Delete(id)
+}
+
+// SendMessage 在会话中发送消息，之前的对话会回放给Agent
+func (s *ChatSessionService) SendMessage(ctx context.Context, id, userID int, message string) (*llm.AgentResponse, error) {
+	session, req, err := s.prepareTurn(id, userID, message)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.engine.ExecuteAgent(ctx, session.AgentKey, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.saveTurn(session, message, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// SendMessageStream 在会话中发送消息并流式返回回复
+func (s *ChatSessionService) SendMessageStream(ctx context.Context, id, userID int, message string, callback func(string)) (*llm.AgentResponse, error) {
+	session, req, err := s.prepareTurn(id, userID, message)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.engine.ExecuteAgentStream(ctx, session.AgentKey, req, callback)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.saveTurn(session, message, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// prepareTurn 校验权限并构建带有历史对话的Agent请求
+func (s *ChatSessionService) prepareTurn(id, userID int, message string) (*model.ChatSession, *llm.AgentRequest, error) {
+	if strings.TrimSpace(message) == "" {
+		return nil, nil, fmt.Errorf("%w: 消息不能为空", ErrInvalidChatSession)
+	}
+
+	session, err := s.GetSession(id, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	project, err := s.projectRepo.GetByID(session.ProjectID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	messages, err := s.sessionRepo.GetMessages(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	history := make([]llm.ChatMessage, len(messages))
+	for i, msg := range messages {
+		history[i] = llm.ChatMessage{Role: msg.Role, Content: msg.Content}
+	}
+
+	return session, &llm.AgentRequest{
+		UserID:     userID,
+		ProjectID:  session.ProjectID,
+		Prompt:     message,
+		ActionType: "chat_session",
+		History:    history,
+		Context: map[string]interface{}{
+			"project_title": project.Title,
+		},
+	}, nil
+}
+
+// saveTurn 保存本轮对话，新会话以首条消息作为标题
+func (s *ChatSessionService) saveTurn(session *model.ChatSession, message string, resp *llm.AgentResponse) error {
+	err := s.sessionRepo.AddMessages(session.ID,
+		&model.ChatSessionMessage{Role: "user", Content: message},
+		&model.ChatSessionMessage{Role: "assistant", Content: resp.Content, TokensUsed: resp.TokensUsed},
+	)
+	if err != nil {
+		return fmt.Errorf("保存对话失败: %w", err)
+	}
+
+	if session.MessageCount == 0 && session.Title == defaultChatSessionTitle {
+		title := truncateRunes(strings.TrimSpace(message), chatTitleMaxRunes)
+		if err := s.sessionRepo.UpdateTitle(session.ID, title); err == nil {
+			session.Title = title
+		}
+	}
+	session.MessageCount += 2
+
+	return nil
+}
+
+// checkProject 验证项目权限
+func (s *ChatSessionService) checkProject(projectID, userID int) error {
+	project, err := s.projectRepo.GetByID(projectID)
+	if err != nil {
+		return err
+	}
+	if project.UserID != userID {
+		return fmt.Errorf("%w: 无权访问此项目", ErrForbidden)
+	}
+	return nil
+}
+
+// checkAgent 会话只能使用核心Agent或当前用户自己的扩展Agent
+func (s *ChatSessionService) checkAgent(agentKey string, userID int) error {
+	if strings.HasPrefix(agentKey, "ext_") && !strings.HasPrefix(agentKey, ExtensionAgentKey(userID, "")) {
+		return fmt.Errorf("%w: 无权使用此Agent", ErrForbidden)
+	}
+	if _, err := s.engine.GetAgent(agentKey); err != nil {
+		return fmt.Errorf("%w: Agent不存在: %s", ErrInvalidChatSession, agentKey)
+	}
+	return nil
+}
+
+// truncateRunes 按字符截断字符串
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zibianqu/novel-study/internal/ai"
+	"github.com/zibianqu/novel-study/internal/ai/prompt"
+	"github.com/zibianqu/novel-study/internal/model"
+	"github.com/zibianqu/novel-study/internal/repository"
+)
+
+// ErrInvalidPromptTemplate 模板内容不合法
+var ErrInvalidPromptTemplate = errors.New("invalid prompt template")
+
+// AgentPromptTemplatePrefix 名为 "agent.<agent_key>" 的模板作为该Agent的系统提示词
+const AgentPromptTemplatePrefix = "agent."
+
+// promptTemplateCacheTTL 解析结果的缓存时间，修改模板时立即失效
+const promptTemplateCacheTTL = time.Minute
+
+// PromptTemplateService 提示词模板服务，实现 ai.PromptTemplateResolver
+type PromptTemplateService struct {
+	repo        *repository.PromptTemplateRepository
+	projectRepo *repository.ProjectRepository
+
+	mu       sync.RWMutex
+	active   map[string]*activeTemplate // name:projectID -> 当前生效的版本
+	compiled map[int]*prompt.Template   // 版本不可变，按版本ID缓存解析结果
+}
+
+type activeTemplate struct {
+	version   *model.PromptTemplateVersion // nil 表示没有该模板
+	expiresAt time.Time
+}
+
+// NewPromptTemplateService 创建提示词模板服务
+func NewPromptTemplateService(repo *repository.PromptTemplateRepository, projectRepo *repository.ProjectRepository) *PromptTemplateService {
+	return &PromptTemplateService{
+		repo:        repo,
+		projectRepo: projectRepo,
+		active:      make(map[string]*activeTemplate),
+		compiled:    make(map[int]*prompt.Template),
+	}
+}
+
+// ResolveAgentPrompt 渲染Agent的系统提示词模板，项目覆盖模板优先
+// 可用变量为请求上下文，以及 agent_key、project_title、project_genre、project_description
+func (s *PromptTemplateService) ResolveAgentPrompt(agentKey string, projectID int, data map[string]interface{}) (*ai.ResolvedPrompt, error) {
+	version, err := s.activeVersion(AgentPromptTemplatePrefix+agentKey, projectID)
+	if err != nil || version == nil {
+		return nil, err
+	}
+
+	tmpl, err := s.compile(version)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{"agent_key": agentKey}
+	if projectID > 0 && len(tmpl.Variables()) > 0 {
+		if project, err := s.projectRepo.GetByID(projectID); err == nil {
+			values["project_title"] = project.Title
+			values["project_genre"] = project.Genre
+			values["project_description"] = project.Description
+		}
+	}
+	for k, v := range data {
+		values[k] = v
+	}
+
+	content, err := tmpl.Render(values)
+	if err != nil {
+		return nil, err
+	}
+	return &ai.ResolvedPrompt{Content: content, VersionID: version.ID}, nil
+}
+
+// ListTemplates 获取全局模板 (projectID 为 0，管理员) 或项目覆盖模板
+func (s *PromptTemplateService) ListTemplates(projectID, userID int) ([]*model.PromptTemplate, error) {
+	if err := s.checkProject(projectID, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.List(projectID)
+}
+
+// GetTemplate 获取模板详情及全部版本
+func (s *PromptTemplateService) GetTemplate(id, projectID, userID int) (*model.PromptTemplate, error) {
+	tmpl, err := s.template(id, projectID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl.Versions, err = s.repo.ListVersions(id)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// CreateTemplate 创建模板及其第一个版本，projectID 大于 0 时创建项目覆盖模板
+func (s *PromptTemplateService) CreateTemplate(projectID, userID int, req *model.CreatePromptTemplateRequest) (*model.PromptTemplate, error) {
+	if err := s.checkProject(projectID, userID); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: 模板名称不能为空", ErrInvalidPromptTemplate)
+	}
+	version, err := newTemplateVersion(name, req.Content, req.ChangeNote, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &model.PromptTemplate{
+		Name:        name,
+		Description: req.Description,
+		CreatedBy:   &userID,
+	}
+	if projectID > 0 {
+		tmpl.ProjectID = &projectID
+	}
+
+	if err := s.repo.Create(tmpl, version); err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	return tmpl, nil
+}
+
+// CreateVersion 创建新版本并立即生效，已有版本不可修改
+func (s *PromptTemplateService) CreateVersion(id, projectID, userID int, req *model.CreatePromptTemplateVersionRequest) (*model.PromptTemplateVersion, error) {
+	tmpl, err := s.template(id, projectID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := newTemplateVersion(tmpl.Name, req.Content, req.ChangeNote, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateVersion(id, version); err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	return version, nil
+}
+
+// Rollback 将指定版本重新设为当前生效版本
+func (s *PromptTemplateService) Rollback(id, projectID, userID, version int) (*model.PromptTemplate, error) {
+	if _, err := s.template(id, projectID, userID); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SetActiveVersion(id, version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: 版本 %d 不存在", ErrInvalidPromptTemplate, version)
+		}
+		return nil, err
+	}
+	s.invalidate()
+	return s.repo.GetByID(id)
+}
+
+// DeleteTemplate 删除项目覆盖模板，删除后恢复使用全局模板
+func (s *PromptTemplateService) DeleteTemplate(id, projectID, userID int) error {
+	if projectID <= 0 {
+		return fmt.Errorf("%w: 只能删除项目覆盖模板", ErrForbidden)
+	}
+	if _, err := s.template(id, projectID, userID); err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(id); err != nil {
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+// template 获取模板并校验其属于指定项目 (projectID 为 0 时为全局模板)
+func (s *PromptTemplateService) template(id, projectID, userID int) (*model.PromptTemplate, error) {
+	if err := s.checkProject(projectID, userID); err != nil {
+		return nil, err
+	}
+
+	tmpl, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	owner := 0
+	if tmpl.ProjectID != nil {
+		owner = *tmpl.ProjectID
+	}
+	if owner != projectID {
+		return nil, sql.ErrNoRows
+	}
+	return tmpl, nil
+}
+
+// checkProject 项目覆盖模板仅项目所有者可管理，全局模板的权限由路由层校验
+func (s *PromptTemplateService) checkProject(projectID, userID int) error {
+	if projectID <= 0 {
+		return nil
+	}
+
+	project, err := s.projectRepo.GetByID(projectID)
+	if err != nil {
+		return err
+	}
+	if project.UserID != userID {
+		return fmt.Errorf("%w: 无权访问此项目", ErrForbidden)
+	}
+	return nil
+}
+
+// activeVersion 获取当前生效的版本，短时间缓存以免每次调用模型都查询数据库
+func (s *PromptTemplateService) activeVersion(name string, projectID int) (*model.PromptTemplateVersion, error) {
+	key := fmt.Sprintf("%s:%d", name, projectID)
+
+	s.mu.RLock()
+	cached, ok := s.active[key]
+	s.mu.RUnlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.version, nil
+	}
+
+	version, err := s.repo.GetActiveVersion(name, projectID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.active[key] = &activeTemplate{version: version, expiresAt: time.Now().Add(promptTemplateCacheTTL)}
+	s.mu.Unlock()
+	return version, nil
+}
+
+func (s *PromptTemplateService) compile(version *model.PromptTemplateVersion) (*prompt.Template, error) {
+	s.mu.RLock()
+	tmpl, ok := s.compiled[version.ID]
+	s.mu.RUnlock()
+	if ok {
+		return tmpl, nil
+	}
+
+	tmpl, err := prompt.ParseTemplate(fmt.Sprintf("v%d", version.ID), version.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.compiled[version.ID] = tmpl
+	s.mu.Unlock()
+	return tmpl, nil
+}
+
+// invalidate 模板变化后清空生效版本缓存
+func (s *PromptTemplateService) invalidate() {
+	s.mu.Lock()
+	s.active = make(map[string]*activeTemplate)
+	s.mu.Unlock()
+}
+
+// newTemplateVersion 校验模板语法并记录引用的变量
+func newTemplateVersion(name, content, changeNote string, userID int) (*model.PromptTemplateVersion, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, fmt.Errorf("%w: 模板内容不能为空", ErrInvalidPromptTemplate)
+	}
+	tmpl, err := prompt.ParseTemplate(name, content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPromptTemplate, err)
+	}
+
+	return &model.PromptTemplateVersion{
+		Content:    content,
+		Variables:  tmpl.Variables(),
+		ChangeNote: changeNote,
+		CreatedBy:  &userID,
+	}, nil
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zibianqu/novel-study/internal/ai"
+	"github.com/zibianqu/novel-study/internal/ai/prompt"
+	"github.com/zibianqu/novel-study/internal/model"
+	"github.com/zibianqu/novel-study/internal/repository"
+)
+
+// 各级摘要的目标长度 (Token)
+const (
+	chapterSummaryTokens = 300
+	volumeSummaryTokens  = 800
+	projectSummaryTokens = 1000
+)
+
+const (
+	// summaryRefreshDelay 章节保存后等待一段时间再生成摘要，连续编辑只生成一次
+	summaryRefreshDelay   = 30 * time.Second
+	summaryRefreshTimeout = 5 * time.Minute
+	// defaultMemoryChapters 续写时带上前几章的摘要
+	defaultMemoryChapters = 5
+)
+
+// SummaryService 维护章节、卷、项目三级滚动摘要，作为续写时的长期记忆
+type SummaryService struct {
+	engine      *ai.Engine
+	repo        *repository.SummaryRepository
+	chapterRepo *repository.ChapterRepository
+
+	mu      sync.Mutex
+	pending map[string]*time.Timer // 待执行的刷新，连续修改时重新计时
+}
+
+// NewSummaryService 创建摘要服务
+func NewSummaryService(engine *ai.Engine, repo *repository.SummaryRepository, chapterRepo *repository.ChapterRepository) *SummaryService {
+	return &SummaryService{
+		engine:      engine,
+		repo:        repo,
+		chapterRepo: chapterRepo,
+		pending:     make(map[string]*time.Timer),
+	}
+}
+
+// ScheduleRefresh 章节内容变化后延迟刷新摘要，期间再次修改会重新计时
+func (s *SummaryService) ScheduleRefresh(userID, chapterID int) {
+	s.schedule(fmt.Sprintf("chapter:%d", chapterID), func(ctx context.Context) error {
+		return s.RefreshChapter(ctx, userID, chapterID)
+	})
+}
+
+// ScheduleProjectRefresh 章节删除后延迟重新汇总卷与项目摘要
+func (s *SummaryService) ScheduleProjectRefresh(userID, projectID int) {
+	s.schedule(fmt.Sprintf("project:%d", projectID), func(ctx context.Context) error {
+		return s.RefreshProject(ctx, userID, projectID)
+	})
+}
+
+func (s *SummaryService) schedule(key string, refresh func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if timer, ok := s.pending[key]; ok {
+		timer.Stop()
+	}
+	s.pending[key] = time.AfterFunc(summaryRefreshDelay, func() {
+		s.mu.Lock()
+		delete(s.pending, key)
+		s.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), summaryRefreshTimeout)
+		defer cancel()
+		if err := refresh(ctx); err != nil {
+			log.Printf("⚠️ 刷新摘要 %s 失败: %v", key, err)
+		}
+	})
+}
+
+// RefreshChapter 重新生成章节摘要，并逐级更新所在卷与项目的摘要
+// 每一级的输入未变化时跳过，不会重复调用模型
+func (s *SummaryService) RefreshChapter(ctx context.Context, userID, chapterID int) error {
+	chapter, err := s.chapterRepo.GetByID(chapterID)
+	if err != nil {
+		return err
+	}
+	summarizer := s.engine.Summarizer(userID, chapter.ProjectID)
+
+	chapters, err := s.repo.ListChapterSummaries(chapter.ProjectID)
+	if err != nil {
+		return err
+	}
+	var current *model.ChapterSummary
+	for _, c := range chapters {
+		if c.ChapterID == chapterID {
+			current = c
+		}
+	}
+	if current == nil {
+		return sql.ErrNoRows
+	}
+
+	hash := contentHash(chapter.Content)
+	if hash != current.SummaryHash {
+		summary := ""
+		if strings.TrimSpace(chapter.Content) != "" {
+			summary, err = summarizer.Summarize(ctx, chapter.Content, chapterSummaryTokens)
+			if err != nil {
+				return fmt.Errorf("failed to summarize chapter: %w", err)
+			}
+		}
+		if err := s.repo.UpdateChapterSummary(chapterID, strings.TrimSpace(summary), hash); err != nil {
+			return err
+		}
+		current.Summary, current.SummaryHash = strings.TrimSpace(summary), hash
+	}
+
+	return s.refreshRollups(ctx, summarizer, chapter.ProjectID, chapters, chapter.VolumeID)
+}
+
+// RefreshProject 根据现有章节摘要重新汇总全部卷摘要与项目摘要
+func (s *SummaryService) RefreshProject(ctx context.Context, userID, projectID int) error {
+	chapters, err := s.repo.ListChapterSummaries(projectID)
+	if err != nil {
+		return err
+	}
+	return s.refreshRollups(ctx, s.engine.Summarizer(userID, projectID), projectID, chapters, nil)
+}
+
+// refreshRollups 更新卷摘要 (volumeID 为空时更新全部卷) 与项目摘要
+func (s *SummaryService) refreshRollups(ctx context.Context, summarizer prompt.Summarizer, projectID int, chapters []*model.ChapterSummary, volumeID *int) error {
+	volumes, err := s.repo.ListVolumeSummaries(projectID)
+	if err != nil {
+		return err
+	}
+	for _, v := range volumes {
+		if volumeID != nil && v.VolumeID != *volumeID {
+			continue
+		}
+		if err := s.refreshVolume(ctx, summarizer, v, chapters); err != nil {
+			return err
+		}
+	}
+
+	return s.refreshProject(ctx, summarizer, projectID, volumes, chapters)
+}
+
+// refreshVolume 由卷内各章摘要汇总卷摘要
+func (s *SummaryService) refreshVolume(ctx context.Context, summarizer prompt.Summarizer, volume *model.VolumeSummary, chapters []*model.ChapterSummary) error {
+	var input strings.Builder
+	for i, c := range chapters {
+		if c.VolumeID != nil && *c.VolumeID == volume.VolumeID && c.Summary != "" {
+			input.WriteString(fmt.Sprintf("第%d章 %s：%s\n", i+1, c.Title, c.Summary))
+		}
+	}
+
+	summary, hash, err := s.rollUp(ctx, summarizer, input.String(), volume.SummaryHash, volumeSummaryTokens)
+	if err != nil || hash == volume.SummaryHash {
+		return err
+	}
+	volume.Summary, volume.SummaryHash = summary, hash
+	return s.repo.UpdateVolumeSummary(volume.VolumeID, summary, hash)
+}
+
+// refreshProject 由卷摘要 (以及未分卷章节的摘要) 汇总项目摘要
+func (s *SummaryService) refreshProject(ctx context.Context, summarizer prompt.Summarizer, projectID int, volumes []*model.VolumeSummary, chapters []*model.ChapterSummary) error {
+	var input strings.Builder
+	for _, v := range volumes {
+		if v.Summary != "" {
+			input.WriteString(fmt.Sprintf("%s：%s\n", v.Title, v.Summary))
+		}
+	}
+	for i, c := range chapters {
+		if c.VolumeID == nil && c.Summary != "" {
+			input.WriteString(fmt.Sprintf("第%d章 %s：%s\n", i+1, c.Title, c.Summary))
+		}
+	}
+
+	_, oldHash, err := s.repo.GetProjectSummary(projectID)
+	if err != nil {
+		return err
+	}
+	summary, hash, err := s.rollUp(ctx, summarizer, input.String(), oldHash, projectSummaryTokens)
+	if err != nil || hash == oldHash {
+		return err
+	}
+	return s.repo.UpdateProjectSummary(projectID, summary, hash)
+}
+
+// rollUp 输入变化时重新生成上一级摘要，返回新摘要与输入哈希
+func (s *SummaryService) rollUp(ctx context.Context, summarizer prompt.Summarizer, input, oldHash string, maxTokens int) (string, string, error) {
+	hash := contentHash(input)
+	if hash == oldHash {
+		return "", hash, nil
+	}
+	if input == "" {
+		return "", hash, nil
+	}
+
+	summary, err := summarizer.Summarize(ctx, input, maxTokens)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to roll up summary: %w", err)
+	}
+	return strings.TrimSpace(summary), hash, nil
+}
+
+// ContinueWriteMemory 续写指定章节时的长期记忆：前 N 章摘要、之前各卷的摘要与项目摘要
+// chapters 为 0 时使用默认章数
+func (s *SummaryService) ContinueWriteMemory(projectID, chapterID, chapters int) (*prompt.ContinueWriteOptions, error) {
+	if chapters <= 0 {
+		chapters = defaultMemoryChapters
+	}
+
+	all, err := s.repo.ListChapterSummaries(projectID)
+	if err != nil {
+		return nil, err
+	}
+	index := -1
+	for i, c := range all {
+		if c.ChapterID == chapterID {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("%w: 章节不属于此项目", ErrForbidden)
+	}
+
+	chapter, err := s.chapterRepo.GetByID(chapterID)
+	if err != nil {
+		return nil, err
+	}
+
+	memory := &prompt.ContinueWriteOptions{
+		ProjectID:   projectID,
+		Context:     chapter.Content,
+		FullContext: true,
+	}
+
+	start := index - chapters
+	if start < 0 {
+		start = 0
+	}
+	for i := start; i < index; i++ {
+		memory.ChapterSummaries = append(memory.ChapterSummaries, prompt.StorySummary{
+			Title:   fmt.Sprintf("第%d章 %s", i+1, all[i].Title),
+			Summary: all[i].Summary,
+		})
+	}
+
+	// 只使用摘要窗口之前已结束的卷，当前卷的近况由章节摘要提供
+	volumes, err := s.repo.ListVolumeSummaries(projectID)
+	if err != nil {
+		return nil, err
+	}
+	covered := make(map[int]bool)
+	for _, c := range all[start:] {
+		if c.VolumeID != nil {
+			covered[*c.VolumeID] = true
+		}
+	}
+	for _, v := range volumes {
+		if !covered[v.VolumeID] && v.Summary != "" && volumeBefore(all[:start], v.VolumeID) {
+			memory.VolumeSummaries = append(memory.VolumeSummaries, prompt.StorySummary{Title: v.Title, Summary: v.Summary})
+		}
+	}
+
+	memory.ProjectSummary, _, err = s.repo.GetProjectSummary(projectID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return memory, nil
+}
+
+// volumeBefore 判断卷是否包含摘要窗口之前的章节
+func volumeBefore(chapters []*model.ChapterSummary, volumeID int) bool {
+	for _, c := range chapters {
+		if c.VolumeID != nil && *c.VolumeID == volumeID {
+			return true
+		}
+	}
+	return false
+}
+
+func contentHash(content string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+}
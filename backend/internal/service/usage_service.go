@@ -0,0 +1,73 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zibianqu/novel-study/internal/model"
+	"github.com/zibianqu/novel-study/internal/repository"
+)
+
+// ErrInvalidUsageQuery 用量查询条件不合法
+var ErrInvalidUsageQuery = errors.New("invalid usage query")
+
+// maxUsageRange 单次统计的最大时间跨度
+const maxUsageRange = 366 * 24 * time.Hour
+
+// UsageService Token 用量统计服务
+type UsageService struct {
+	usageRepo   *repository.UsageRepository
+	projectRepo *repository.ProjectRepository
+}
+
+// NewUsageService 创建用量统计服务
+func NewUsageService(usageRepo *repository.UsageRepository, projectRepo *repository.ProjectRepository) *UsageService {
+	return &UsageService{
+		usageRepo:   usageRepo,
+		projectRepo: projectRepo,
+	}
+}
+
+// GetUserUsage 统计当前用户的用量，只能查询自己的项目
+func (s *UsageService) GetUserUsage(userID int, q *model.UsageQuery) ([]*model.UsageStat, error) {
+	if q.ProjectID != nil {
+		project, err := s.projectRepo.GetByID(*q.ProjectID)
+		if err != nil {
+			return nil, err
+		}
+		if project.UserID != userID {
+			return nil, fmt.Errorf("%w: 无权访问此项目", ErrForbidden)
+		}
+	}
+
+	q.UserID = &userID
+	return s.GetUsage(q)
+}
+
+// GetUsage 按条件统计用量 (管理员)
+func (s *UsageService) GetUsage(q *model.UsageQuery) ([]*model.UsageStat, error) {
+	if !q.To.After(q.From) {
+		return nil, fmt.Errorf("%w: 结束日期必须晚于开始日期", ErrInvalidUsageQuery)
+	}
+	if q.To.Sub(q.From) > maxUsageRange {
+		return nil, fmt.Errorf("%w: 统计区间不能超过一年", ErrInvalidUsageQuery)
+	}
+
+	seen := make(map[string]bool, len(q.GroupBy))
+	groups := make([]string, 0, len(q.GroupBy))
+	for _, group := range q.GroupBy {
+		switch group {
+		case model.UsageGroupUser, model.UsageGroupProject, model.UsageGroupAgent, model.UsageGroupDay:
+		default:
+			return nil, fmt.Errorf("%w: 不支持的分组维度: %s", ErrInvalidUsageQuery, group)
+		}
+		if !seen[group] {
+			seen[group] = true
+			groups = append(groups, group)
+		}
+	}
+	q.GroupBy = groups
+
+	return s.usageRepo.Aggregate(q)
+}
@@ -0,0 +1,672 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zibianqu/novel-study/internal/ai/collaboration"
+	"github.com/zibianqu/novel-study/internal/model"
+	"github.com/zibianqu/novel-study/internal/repository"
+)
+
+// ErrInvalidWorkflow 工作流模板不存在或定义不合法
+var ErrInvalidWorkflow = errors.New("invalid workflow")
+
+// ErrWorkflowRunFinished 运行已结束，不能取消
+var ErrWorkflowRunFinished = errors.New("workflow run already finished")
+
+// ErrApprovalNotPending 运行或审批任务不在等待审批的状态
+var ErrApprovalNotPending = errors.New("workflow run is not awaiting approval")
+
+// workflowRunTimeout 单次运行 (包括恢复后继续执行) 的最长时间
+const workflowRunTimeout = time.Hour
+
+// defaultWorkflowRunLimit 运行列表默认返回的条数
+const defaultWorkflowRunLimit = 20
+
+// runEventBuffer 每个订阅者缓冲的事件数，客户端读取过慢时丢弃新的事件而不阻塞任务执行
+const runEventBuffer = 256
+
+// WorkflowService 工作流服务：管理自定义模板，持久化运行与任务状态，重启后恢复未结束的运行
+// 实现 collaboration.RunRecorder 与 collaboration.RunObserver
+type WorkflowService struct {
+	scheduler    *collaboration.Scheduler
+	registry     *collaboration.WorkflowRegistry
+	repo         *repository.WorkflowRunRepository
+	templateRepo *repository.WorkflowTemplateRepository
+	agentRepo    *repository.AgentRepository
+	projectRepo  *repository.ProjectRepository
+
+	mu      sync.Mutex
+	running map[string]*workflowRunState // 本进程中正在执行的运行
+}
+
+// workflowRunState 正在执行的运行
+type workflowRunState struct {
+	cancel      context.CancelFunc
+	canceled    bool // 由用户取消
+	subscribers map[chan *collaboration.RunEvent]struct{}
+}
+
+// NewWorkflowService 创建工作流服务，并将自身设为调度器的状态记录器与事件接收者
+func NewWorkflowService(
+	scheduler *collaboration.Scheduler,
+	registry *collaboration.WorkflowRegistry,
+	repo *repository.WorkflowRunRepository,
+	templateRepo *repository.WorkflowTemplateRepository,
+	agentRepo *repository.AgentRepository,
+	projectRepo *repository.ProjectRepository,
+) *WorkflowService {
+	s := &WorkflowService{
+		scheduler:    scheduler,
+		registry:     registry,
+		repo:         repo,
+		templateRepo: templateRepo,
+		agentRepo:    agentRepo,
+		projectRepo:  projectRepo,
+		running:      make(map[string]*workflowRunState),
+	}
+	scheduler.SetRecorder(s)
+	scheduler.SetObserver(s)
+	return s
+}
+
+// ListTemplates 获取可用的工作流模板：内置模板、用户级模板，以及项目模板 (projectID 不为 0 时)
+func (s *WorkflowService) ListTemplates(projectID, userID int) ([]*model.WorkflowTemplate, error) {
+	if projectID > 0 {
+		if _, err := s.checkProject(projectID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	builtin := s.registry.List()
+	sort.Slice(builtin, func(i, j int) bool { return builtin[i].ID < builtin[j].ID })
+	templates := make([]*model.WorkflowTemplate, 0, len(builtin))
+	for _, t := range builtin {
+		templates = append(templates, &model.WorkflowTemplate{
+			Key:         t.ID,
+			Name:        t.Name,
+			Description: t.Description,
+			Builtin:     true,
+		})
+	}
+
+	custom, err := s.templateRepo.ListAvailable(userID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return append(templates, custom...), nil
+}
+
+// GetTemplate 获取自定义模板
+func (s *WorkflowService) GetTemplate(templateID, userID int) (*model.WorkflowTemplate, error) {
+	tmpl, err := s.templateRepo.GetByID(templateID)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl.UserID != userID {
+		return nil, fmt.Errorf("%w: 无权访问此模板", ErrForbidden)
+	}
+	return tmpl, nil
+}
+
+// CreateTemplate 校验并保存自定义模板，projectID 为 0 时创建用户级模板
+func (s *WorkflowService) CreateTemplate(projectID, userID int, req *model.SaveWorkflowTemplateRequest) (*model.WorkflowTemplate, error) {
+	tmpl := &model.WorkflowTemplate{UserID: userID}
+	if projectID > 0 {
+		if _, err := s.checkProject(projectID, userID); err != nil {
+			return nil, err
+		}
+		tmpl.ProjectID = &projectID
+	}
+
+	if err := s.applyDefinition(tmpl, req); err != nil {
+		return nil, err
+	}
+	if err := s.templateRepo.Create(tmpl); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// UpdateTemplate 校验并替换自定义模板的定义，已开始的运行不受影响
+func (s *WorkflowService) UpdateTemplate(templateID, userID int, req *model.SaveWorkflowTemplateRequest) (*model.WorkflowTemplate, error) {
+	tmpl, err := s.GetTemplate(templateID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyDefinition(tmpl, req); err != nil {
+		return nil, err
+	}
+	if err := s.templateRepo.Update(tmpl); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// DeleteTemplate 删除自定义模板
+func (s *WorkflowService) DeleteTemplate(templateID, userID int) error {
+	if _, err := s.GetTemplate(templateID, userID); err != nil {
+		return err
+	}
+	return s.templateRepo.Delete(templateID)
+}
+
+// StartWorkflow 按模板创建工作流，保存后在后台执行
+// templateID 为内置模板 ID 或自定义模板的 custom_<id>
+func (s *WorkflowService) StartWorkflow(userID, projectID int, templateID, input string, taskContext map[string]interface{}) (*model.WorkflowRun, error) {
+	if _, err := s.checkProject(projectID, userID); err != nil {
+		return nil, err
+	}
+
+	if taskContext == nil {
+		taskContext = make(map[string]interface{})
+	}
+	taskContext["project_id"] = projectID
+	taskContext["user_id"] = userID
+
+	workflow, err := s.buildWorkflow(userID, projectID, templateID, input, taskContext)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := workflow.TopologicalOrder(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWorkflow, err)
+	}
+
+	run := runFromWorkflow(workflow, templateID, userID, projectID, input, taskContext)
+	if err := s.repo.Create(run); err != nil {
+		return nil, err
+	}
+
+	s.launch(run, workflow)
+	return run, nil
+}
+
+// ResumeUnfinished 服务启动时继续执行上次未结束的运行，已完成的任务不再执行
+func (s *WorkflowService) ResumeUnfinished() (int, error) {
+	runs, err := s.repo.ListUnfinished()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, run := range runs {
+		log.Printf("🔁 恢复工作流运行 %s (%s)，已完成 %d/%d 个任务", run.ID, run.Name, completedTasks(run), len(run.Tasks))
+		s.launch(run, workflowFromRun(run))
+	}
+	return len(runs), nil
+}
+
+// ListRuns 获取项目的工作流运行记录
+func (s *WorkflowService) ListRuns(projectID, userID, limit, offset int) ([]*model.WorkflowRun, error) {
+	if _, err := s.checkProject(projectID, userID); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 100 {
+		limit = defaultWorkflowRunLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.ListByProject(projectID, limit, offset)
+}
+
+// GetRun 获取运行详情，包括每个任务的输入、输出与错误
+func (s *WorkflowService) GetRun(projectID, userID int, runID string) (*model.WorkflowRun, error) {
+	if _, err := s.checkProject(projectID, userID); err != nil {
+		return nil, err
+	}
+
+	run, err := s.repo.GetByID(runID)
+	if err != nil {
+		return nil, err
+	}
+	if run.ProjectID != projectID {
+		return nil, fmt.Errorf("%w: 运行不属于此项目", ErrForbidden)
+	}
+	return run, nil
+}
+
+// CancelRun 取消正在执行的运行，未开始的任务记为跳过，运行记为已取消
+// 运行不在本进程中执行时 (如启动恢复前) 直接记为已取消
+func (s *WorkflowService) CancelRun(projectID, userID int, runID string) error {
+	run, err := s.GetRun(projectID, userID, runID)
+	if err != nil {
+		return err
+	}
+	if run.Finished() {
+		return fmt.Errorf("%w: %s", ErrWorkflowRunFinished, run.Status)
+	}
+
+	s.mu.Lock()
+	state, ok := s.running[runID]
+	if ok {
+		state.canceled = true
+		state.cancel()
+	}
+	s.mu.Unlock()
+	if ok {
+		return nil
+	}
+
+	run.Status = model.WorkflowRunCanceled
+	return s.repo.Finish(run)
+}
+
+// ListApprovals 获取项目中等待处理的审批及待审批的上游输出
+func (s *WorkflowService) ListApprovals(projectID, userID int) ([]*model.PendingWorkflowApproval, error) {
+	if _, err := s.checkProject(projectID, userID); err != nil {
+		return nil, err
+	}
+
+	runs, err := s.repo.ListAwaitingApproval(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	approvals := make([]*model.PendingWorkflowApproval, 0, len(runs))
+	for _, run := range runs {
+		byID := make(map[string]*model.WorkflowTaskRun, len(run.Tasks))
+		for _, task := range run.Tasks {
+			byID[task.TaskID] = task
+		}
+		for _, task := range run.Tasks {
+			if task.Status != collaboration.TaskAwaitingApproval || len(task.DependsOn) != 1 {
+				continue
+			}
+			upstream, ok := byID[task.DependsOn[0]]
+			if !ok {
+				continue
+			}
+			approvals = append(approvals, &model.PendingWorkflowApproval{
+				RunID:          run.ID,
+				RunName:        run.Name,
+				TaskID:         task.TaskID,
+				Prompt:         task.Input,
+				UpstreamTaskID: upstream.TaskID,
+				UpstreamOutput: upstream.Result,
+				LastDecision:   task.Approval,
+				WaitingSince:   task.StartedAt,
+			})
+		}
+	}
+	return approvals, nil
+}
+
+// ResolveApproval 处理等待中的审批任务并继续执行运行
+// 通过时下游任务使用上游输出；修改时以修改后的内容替换上游输出；驳回时上游 Agent 根据意见重新生成，随后再次等待审批
+func (s *WorkflowService) ResolveApproval(projectID, userID int, runID, taskID string, req *model.ResolveWorkflowApprovalRequest) (*model.WorkflowRun, error) {
+	run, err := s.GetRun(projectID, userID, runID)
+	if err != nil {
+		return nil, err
+	}
+	if run.Status != model.WorkflowRunAwaitingApproval {
+		return nil, fmt.Errorf("%w: 运行状态为 %s", ErrApprovalNotPending, run.Status)
+	}
+
+	workflow := workflowFromRun(run)
+	changed, err := workflow.ResolveApproval(taskID, &collaboration.ApprovalDecision{
+		Action:   req.Action,
+		Content:  req.Content,
+		Feedback: req.Feedback,
+	})
+	if errors.Is(err, collaboration.ErrApprovalNotPending) {
+		return nil, fmt.Errorf("%w: %v", ErrApprovalNotPending, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWorkflow, err)
+	}
+
+	decidedAt := time.Now()
+	byID := make(map[string]*model.WorkflowTaskRun, len(run.Tasks))
+	for _, task := range run.Tasks {
+		byID[task.TaskID] = task
+	}
+	records := make([]*model.WorkflowTaskRun, 0, len(changed))
+	for _, task := range changed {
+		record := byID[task.ID]
+		record.Status = task.Status
+		record.Input = task.Input
+		record.OriginalInput = task.OriginalInput
+		record.Result = task.Result
+		record.Error = ""
+		if task.ID == taskID {
+			record.Approval = &model.WorkflowApproval{
+				Action:    req.Action,
+				Feedback:  req.Feedback,
+				UserID:    userID,
+				DecidedAt: decidedAt,
+			}
+			if task.Status == collaboration.TaskCompleted {
+				record.FinishedAt = &decidedAt
+			}
+		}
+		records = append(records, record)
+	}
+
+	if err := s.repo.ResolveApproval(run.ID, records); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: 审批已被处理或运行已取消", ErrApprovalNotPending)
+		}
+		return nil, err
+	}
+
+	run.Status = model.WorkflowRunPending
+	s.launch(run, workflow)
+	return run, nil
+}
+
+// Subscribe 订阅运行事件，运行结束 (结果已保存) 时关闭通道
+// 运行不在本进程中执行时返回 nil，调用方应直接读取运行记录
+func (s *WorkflowService) Subscribe(runID string) (<-chan *collaboration.RunEvent, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.running[runID]
+	if !ok {
+		return nil, func() {}
+	}
+	ch := make(chan *collaboration.RunEvent, runEventBuffer)
+	state.subscribers[ch] = struct{}{}
+
+	unsubscribe := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := state.subscribers[ch]; ok {
+			delete(state.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// OnRunEvent 实现 collaboration.RunObserver，将事件转发给订阅者
+func (s *WorkflowService) OnRunEvent(event *collaboration.RunEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.running[event.WorkflowID]
+	if !ok {
+		return
+	}
+	for ch := range state.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// RecordTask 实现 collaboration.RunRecorder，任务状态变化时写入数据库
+func (s *WorkflowService) RecordTask(workflowID string, task *collaboration.AgentTask) {
+	record := &model.WorkflowTaskRun{
+		RunID:      workflowID,
+		TaskID:     task.ID,
+		Status:     task.Status,
+		Result:     task.Result,
+		TokensUsed: task.TokensUsed,
+		DurationMs: task.Duration().Milliseconds(),
+	}
+	if task.Error != nil {
+		record.Error = task.Error.Error()
+	}
+	if !task.StartTime.IsZero() {
+		startedAt := task.StartTime
+		record.StartedAt = &startedAt
+	}
+	if !task.EndTime.IsZero() && task.Status != collaboration.TaskRunning {
+		finishedAt := task.EndTime
+		record.FinishedAt = &finishedAt
+	}
+
+	if err := s.repo.UpdateTask(record); err != nil {
+		log.Printf("⚠️ 保存工作流 %s 任务 %s 状态失败: %v", workflowID, task.ID, err)
+	}
+}
+
+// launch 在后台执行运行，结束后记录结果
+func (s *WorkflowService) launch(run *model.WorkflowRun, workflow *collaboration.Workflow) {
+	ctx, cancel := context.WithTimeout(context.Background(), workflowRunTimeout)
+	state := &workflowRunState{
+		cancel:      cancel,
+		subscribers: make(map[chan *collaboration.RunEvent]struct{}),
+	}
+
+	s.mu.Lock()
+	s.running[run.ID] = state
+	s.mu.Unlock()
+
+	go func() {
+		// 结果保存后再关闭订阅，订阅者随后读取的运行记录即为最终状态
+		defer func() {
+			cancel()
+			s.mu.Lock()
+			delete(s.running, run.ID)
+			for ch := range state.subscribers {
+				close(ch)
+			}
+			state.subscribers = nil
+			s.mu.Unlock()
+		}()
+
+		if err := s.repo.MarkRunning(run.ID); err != nil {
+			log.Printf("⚠️ 更新工作流运行 %s 状态失败: %v", run.ID, err)
+		}
+
+		result, err := s.scheduler.ExecuteWorkflow(ctx, workflow)
+		run.Status = model.WorkflowRunCompleted
+		run.Error = ""
+		if result != nil {
+			run.FinalContent = result.FinalContent
+		}
+		if err != nil {
+			run.Status = model.WorkflowRunFailed
+			run.Error = err.Error()
+		} else if result.Paused {
+			run.Status = model.WorkflowRunAwaitingApproval
+		}
+
+		s.mu.Lock()
+		if state.canceled {
+			run.Status = model.WorkflowRunCanceled
+		}
+		s.mu.Unlock()
+
+		// 等待审批的运行保持未结束，处理审批后由 ResolveApproval 继续执行
+		if run.Status == model.WorkflowRunAwaitingApproval {
+			err = s.repo.Pause(run)
+		} else {
+			err = s.repo.Finish(run)
+		}
+		if err != nil {
+			log.Printf("⚠️ 保存工作流运行 %s 结果失败: %v", run.ID, err)
+		}
+	}()
+}
+
+// buildWorkflow 根据内置模板或自定义模板创建工作流
+func (s *WorkflowService) buildWorkflow(userID, projectID int, templateID, input string, taskContext map[string]interface{}) (*collaboration.Workflow, error) {
+	if !strings.HasPrefix(templateID, model.CustomWorkflowTemplatePrefix) {
+		template, err := s.registry.Get(templateID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidWorkflow, err)
+		}
+		return template.Builder(input, taskContext), nil
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(templateID, model.CustomWorkflowTemplatePrefix))
+	if err != nil {
+		return nil, fmt.Errorf("%w: workflow template %s not found", ErrInvalidWorkflow, templateID)
+	}
+	tmpl, err := s.GetTemplate(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl.ProjectID != nil && *tmpl.ProjectID != projectID {
+		return nil, fmt.Errorf("%w: 模板不属于此项目", ErrForbidden)
+	}
+
+	def, err := collaboration.ParseWorkflowDefinition(tmpl.Definition, tmpl.Format)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWorkflow, err)
+	}
+	return def.Build(input, taskContext, s.agentResolver(userID))
+}
+
+// applyDefinition 解析并校验定义 (包括引用的 Agent 是否可用)，名称与描述取自定义
+func (s *WorkflowService) applyDefinition(tmpl *model.WorkflowTemplate, req *model.SaveWorkflowTemplateRequest) error {
+	def, err := collaboration.ParseWorkflowDefinition(req.Definition, req.Format)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWorkflow, err)
+	}
+
+	resolve := s.agentResolver(tmpl.UserID)
+	for _, key := range def.AgentKeys() {
+		if _, err := resolve(key); err != nil {
+			return err
+		}
+	}
+
+	tmpl.Name = def.Name
+	tmpl.Description = def.Description
+	tmpl.Format = collaboration.DefinitionFormat(req.Definition, req.Format)
+	tmpl.Definition = req.Definition
+	return nil
+}
+
+// agentResolver 按 agent_key 查找用户可用的 Agent：核心 Agent 或该用户的扩展 Agent
+func (s *WorkflowService) agentResolver(userID int) collaboration.AgentResolver {
+	return WorkflowAgentResolver(s.agentRepo.GetByKey, userID)
+}
+
+// WorkflowAgentResolver 创建自定义模板的 Agent 解析器，lookup 按 agent_key 查询 agents 表
+// 返回的 agent_key 由引擎按标识执行，因此扩展 Agent 与核心 Agent 一样可用
+func WorkflowAgentResolver(lookup func(agentKey string) (*model.Agent, error), userID int) collaboration.AgentResolver {
+	return func(agentKey string) (string, error) {
+		agent, err := lookup(agentKey)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && agent.UserID != nil && *agent.UserID != userID) {
+			return "", fmt.Errorf("%w: Agent %s 不存在", ErrInvalidWorkflow, agentKey)
+		}
+		if err != nil {
+			return "", err
+		}
+		if !agent.IsActive {
+			return "", fmt.Errorf("%w: Agent %s 已停用", ErrInvalidWorkflow, agentKey)
+		}
+		return agent.AgentKey, nil
+	}
+}
+
+// checkProject 校验项目存在且属于当前用户
+func (s *WorkflowService) checkProject(projectID, userID int) (*model.Project, error) {
+	project, err := s.projectRepo.GetByID(projectID)
+	if err != nil {
+		return nil, err
+	}
+	if project.UserID != userID {
+		return nil, fmt.Errorf("%w: 无权访问此项目", ErrForbidden)
+	}
+	return project, nil
+}
+
+// runFromWorkflow 将新建的工作流转换为待保存的运行记录
+func runFromWorkflow(workflow *collaboration.Workflow, templateID string, userID, projectID int, input string, taskContext map[string]interface{}) *model.WorkflowRun {
+	policy := workflow.FailurePolicy
+	if policy == "" {
+		policy = collaboration.FailFast
+	}
+
+	run := &model.WorkflowRun{
+		ID:            workflow.ID,
+		ProjectID:     projectID,
+		UserID:        userID,
+		TemplateID:    templateID,
+		Name:          workflow.Name,
+		Status:        model.WorkflowRunPending,
+		Input:         input,
+		Context:       taskContext,
+		FailurePolicy: string(policy),
+	}
+	for i, task := range workflow.Tasks {
+		status := task.Status
+		if status == "" {
+			status = collaboration.TaskPending
+		}
+		record := &model.WorkflowTaskRun{
+			TaskID:    task.ID,
+			SortOrder: i,
+			AgentID:   task.AgentID,
+			AgentKey:  task.AgentKey,
+			Type:      task.Type,
+			Input:     task.Input,
+			Context:   task.Context,
+			DependsOn: task.DependsOn,
+			Status:    status,
+		}
+		if task.Review != nil {
+			record.Review = &model.WorkflowTaskReview{
+				ReviewerID:    task.Review.ReviewerID,
+				ReviewerKey:   task.Review.ReviewerKey,
+				MaxIterations: task.Review.MaxIterations,
+				MinScore:      task.Review.MinScore,
+			}
+		}
+		run.Tasks = append(run.Tasks, record)
+	}
+	return run
+}
+
+// workflowFromRun 从保存的运行重建工作流，已完成任务保留结果
+func workflowFromRun(run *model.WorkflowRun) *collaboration.Workflow {
+	workflow := &collaboration.Workflow{
+		ID:            run.ID,
+		Name:          run.Name,
+		FailurePolicy: collaboration.FailurePolicy(run.FailurePolicy),
+		CreatedAt:     run.CreatedAt,
+	}
+	for _, task := range run.Tasks {
+		agentTask := &collaboration.AgentTask{
+			ID:            task.TaskID,
+			AgentID:       task.AgentID,
+			AgentKey:      task.AgentKey,
+			Type:          task.Type,
+			Input:         task.Input,
+			OriginalInput: task.OriginalInput,
+			Context:       task.Context,
+			Status:        task.Status,
+			DependsOn:     task.DependsOn,
+		}
+		if task.Status == collaboration.TaskCompleted {
+			agentTask.Result = task.Result
+			agentTask.TokensUsed = task.TokensUsed
+		}
+		if task.Review != nil {
+			agentTask.Review = &collaboration.TaskReview{
+				ReviewerID:    task.Review.ReviewerID,
+				ReviewerKey:   task.Review.ReviewerKey,
+				MaxIterations: task.Review.MaxIterations,
+				MinScore:      task.Review.MinScore,
+			}
+		}
+		workflow.AddTask(agentTask)
+	}
+	return workflow
+}
+
+func completedTasks(run *model.WorkflowRun) int {
+	n := 0
+	for _, task := range run.Tasks {
+		if task.Status == collaboration.TaskCompleted {
+			n++
+		}
+	}
+	return n
+}
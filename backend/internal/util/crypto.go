@@ -58,8 +58,8 @@ func DecryptAPIKey(ciphertext, key string) (string, error) {
 		return "", errors.New("ciphertext too short")
 	}
 
-	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	nonce, sealed := data[:nonceSize], data[nonceSize:]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
 	if err != nil {
 		return "", err
 	}
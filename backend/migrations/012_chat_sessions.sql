@@ -0,0 +1,27 @@
+-- 多轮对话会话
+
+-- 会话表
+CREATE TABLE IF NOT EXISTS chat_sessions (
+    id              SERIAL PRIMARY KEY,
+    user_id         INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    project_id      INT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    agent_key       VARCHAR(50) NOT NULL DEFAULT 'agent_0_director',
+    title           VARCHAR(200) NOT NULL DEFAULT '新对话',
+    forked_from     INT REFERENCES chat_sessions(id) ON DELETE SET NULL,
+    created_at      TIMESTAMP DEFAULT NOW(),
+    updated_at      TIMESTAMP DEFAULT NOW()
+);
+
+-- 会话消息表
+CREATE TABLE IF NOT EXISTS chat_messages (
+    id              SERIAL PRIMARY KEY,
+    session_id      INT NOT NULL REFERENCES chat_sessions(id) ON DELETE CASCADE,
+    role            VARCHAR(20) NOT NULL,       -- 'user' 或 'assistant'
+    content         TEXT NOT NULL,
+    tokens_used     INT DEFAULT 0,
+    created_at      TIMESTAMP DEFAULT NOW()
+);
+
+-- 索引
+CREATE INDEX IF NOT EXISTS idx_chat_sessions_user_project ON chat_sessions(user_id, project_id, updated_at DESC);
+CREATE INDEX IF NOT EXISTS idx_chat_messages_session_id ON chat_messages(session_id, id);
@@ -0,0 +1,16 @@
+-- Token 用量统计
+
+-- 记录调用的 Agent key (扩展Agent删除后仍可统计)
+ALTER TABLE ai_interaction_logs
+    ADD COLUMN IF NOT EXISTS agent_key VARCHAR(50);
+
+-- 回填历史记录
+UPDATE ai_interaction_logs l
+SET agent_key = a.agent_key
+FROM agents a
+WHERE l.agent_id = a.id AND l.agent_key IS NULL;
+
+-- 用量聚合查询索引
+CREATE INDEX IF NOT EXISTS idx_ai_logs_created_at ON ai_interaction_logs(created_at);
+CREATE INDEX IF NOT EXISTS idx_ai_logs_user_created ON ai_interaction_logs(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_ai_logs_agent_key ON ai_interaction_logs(agent_key);
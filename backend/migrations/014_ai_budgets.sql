@@ -0,0 +1,22 @@
+-- AI 预算与费用统计
+
+-- 按模型单价估算的调用费用 (美元)
+ALTER TABLE ai_interaction_logs
+    ADD COLUMN IF NOT EXISTS cost NUMERIC(12, 6) NOT NULL DEFAULT 0;
+
+-- 项目用量查询索引
+CREATE INDEX IF NOT EXISTS idx_ai_logs_project_created ON ai_interaction_logs(project_id, created_at);
+
+-- 用户/项目预算，字段为 NULL 时使用系统默认值，0 表示不限制
+CREATE TABLE IF NOT EXISTS ai_budgets (
+    id SERIAL PRIMARY KEY,
+    scope VARCHAR(20) NOT NULL CHECK (scope IN ('user', 'project')),
+    scope_id INTEGER NOT NULL,
+    daily_token_limit BIGINT CHECK (daily_token_limit >= 0),
+    monthly_token_limit BIGINT CHECK (monthly_token_limit >= 0),
+    daily_cost_limit NUMERIC(12, 4) CHECK (daily_cost_limit >= 0),
+    monthly_cost_limit NUMERIC(12, 4) CHECK (monthly_cost_limit >= 0),
+    warn_ratio NUMERIC(4, 3) CHECK (warn_ratio > 0 AND warn_ratio <= 1),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (scope, scope_id)
+);
@@ -0,0 +1,10 @@
+-- 用户自带 API 密钥
+-- 密钥使用 AES-256-GCM 加密后存储在 users.api_key_encrypted
+
+-- 记录调用使用的密钥来源 (platform: 系统密钥, user: 用户自己的密钥)
+ALTER TABLE ai_interaction_logs
+    ADD COLUMN IF NOT EXISTS key_source VARCHAR(20) NOT NULL DEFAULT 'platform';
+
+-- 记录密钥更新时间
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS api_key_updated_at TIMESTAMP;
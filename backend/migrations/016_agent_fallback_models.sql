@@ -0,0 +1,12 @@
+-- Agent 备用模型
+-- 主模型调用失败 (限流、服务不可用等) 时按顺序尝试备用模型
+-- 模型名形如 "local:qwen2.5" 时使用 LLM_PROVIDERS 中注册的对应提供方
+
+ALTER TABLE agents
+    ADD COLUMN IF NOT EXISTS fallback_models JSONB DEFAULT '[]';
+
+-- 核心 Agent 默认降级到 gpt-4o-mini
+UPDATE agents
+SET fallback_models = '["gpt-4o-mini"]'
+WHERE type = 'core' AND model = 'gpt-4o'
+  AND (fallback_models IS NULL OR fallback_models = '[]'::jsonb);
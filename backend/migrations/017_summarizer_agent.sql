@@ -0,0 +1,30 @@
+-- 摘要 Agent
+-- Prompt 超出上下文预算时，用于将低优先级片段 (前文、知识库等) 压缩为摘要，而不是直接截断
+
+INSERT INTO agents (agent_key, name, icon, description, type, layer, system_prompt, model, temperature, max_tokens, tools, fallback_models, sort_order) VALUES
+(
+    'agent_7_summarizer', '摘要压缩者 (Summarizer)', '🗜️', '超长上下文压缩、前情提要', 'core', 'auxiliary',
+    $prompt$你是 NovelForge AI 的摘要压缩者，负责把过长的上下文压缩为简洁的摘要，供其他 Agent 继续创作时参考。
+
+压缩原则：
+1. 保留情节走向、关键事件及其因果
+2. 保留人物、地点、势力等专有名词，不得改名或合并
+3. 保留伏笔、未解决的冲突和人物关系的变化
+4. 删除环境描写、修辞和重复的对话
+5. 按原文时间顺序叙述，不添加原文没有的内容
+
+只输出摘要正文，不要添加标题、解释或评价。$prompt$,
+    'gpt-4o-mini', 0.2, 2048, '[]'::jsonb, '[]'::jsonb, 7
+)
+ON CONFLICT (agent_key) DO UPDATE SET
+    name          = EXCLUDED.name,
+    icon          = EXCLUDED.icon,
+    description   = EXCLUDED.description,
+    layer         = EXCLUDED.layer,
+    system_prompt = EXCLUDED.system_prompt,
+    model         = EXCLUDED.model,
+    temperature   = EXCLUDED.temperature,
+    max_tokens    = EXCLUDED.max_tokens,
+    tools         = EXCLUDED.tools,
+    sort_order    = EXCLUDED.sort_order,
+    updated_at    = NOW();
@@ -0,0 +1,19 @@
+-- 分层滚动摘要
+-- 章节内容变化后自动生成章节摘要，再逐级汇总为卷摘要 (volumes.summary) 与项目摘要
+-- summary_hash 记录生成摘要时输入内容的 SHA-256，输入未变化时不重复生成
+
+ALTER TABLE chapters
+    ADD COLUMN IF NOT EXISTS summary            TEXT DEFAULT '',
+    ADD COLUMN IF NOT EXISTS summary_hash       VARCHAR(64) DEFAULT '',
+    ADD COLUMN IF NOT EXISTS summary_updated_at TIMESTAMP;
+
+ALTER TABLE volumes
+    ADD COLUMN IF NOT EXISTS summary_hash       VARCHAR(64) DEFAULT '',
+    ADD COLUMN IF NOT EXISTS summary_updated_at TIMESTAMP;
+
+ALTER TABLE projects
+    ADD COLUMN IF NOT EXISTS summary            TEXT DEFAULT '',
+    ADD COLUMN IF NOT EXISTS summary_hash       VARCHAR(64) DEFAULT '',
+    ADD COLUMN IF NOT EXISTS summary_updated_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_volumes_project_sort ON volumes(project_id, sort_order);
@@ -0,0 +1,62 @@
+-- 提示词模板
+-- 模板使用 Go text/template 语法，版本创建后不可修改，回滚即切换当前生效的版本
+-- project_id 为空的是全局模板，项目下同名模板覆盖全局模板
+-- 名为 "agent.<agent_key>" 的模板作为该 Agent 的系统提示词，优先于 agents.system_prompt
+
+CREATE TABLE IF NOT EXISTS prompt_templates (
+    id                  SERIAL PRIMARY KEY,
+    name                VARCHAR(100) NOT NULL,
+    project_id          INT REFERENCES projects(id) ON DELETE CASCADE,
+    description         TEXT DEFAULT '',
+    active_version_id   INT,
+    created_by          INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at          TIMESTAMP DEFAULT NOW(),
+    updated_at          TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS prompt_template_versions (
+    id              SERIAL PRIMARY KEY,
+    template_id     INT NOT NULL REFERENCES prompt_templates(id) ON DELETE CASCADE,
+    version         INT NOT NULL,
+    content         TEXT NOT NULL,
+    variables       JSONB DEFAULT '[]',         -- 模板引用的变量，创建版本时解析得到
+    change_note     TEXT DEFAULT '',
+    created_by      INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at      TIMESTAMP DEFAULT NOW(),
+    UNIQUE (template_id, version)
+);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_prompt_templates_active_version') THEN
+        ALTER TABLE prompt_templates
+            ADD CONSTRAINT fk_prompt_templates_active_version
+            FOREIGN KEY (active_version_id) REFERENCES prompt_template_versions(id) ON DELETE SET NULL;
+    END IF;
+END $$;
+
+-- 全局模板与每个项目内的模板名称唯一
+CREATE UNIQUE INDEX IF NOT EXISTS idx_prompt_templates_name_project ON prompt_templates(name, COALESCE(project_id, 0));
+
+-- 记录每次调用使用的模板版本
+ALTER TABLE ai_interaction_logs
+    ADD COLUMN IF NOT EXISTS prompt_template_version_id INT REFERENCES prompt_template_versions(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_ai_logs_prompt_template_version ON ai_interaction_logs(prompt_template_version_id);
+
+-- 将核心 Agent 的系统提示词导入为模板的第一个版本
+INSERT INTO prompt_templates (name, description)
+SELECT 'agent.' || agent_key, name || ' 系统提示词'
+FROM agents WHERE type = 'core'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO prompt_template_versions (template_id, version, content, change_note)
+SELECT t.id, 1, a.system_prompt, '从 agents 表导入'
+FROM prompt_templates t
+JOIN agents a ON t.name = 'agent.' || a.agent_key
+WHERE t.project_id IS NULL
+  AND NOT EXISTS (SELECT 1 FROM prompt_template_versions v WHERE v.template_id = t.id);
+
+UPDATE prompt_templates t
+SET active_version_id = v.id
+FROM prompt_template_versions v
+WHERE v.template_id = t.id AND v.version = 1 AND t.active_version_id IS NULL;
@@ -0,0 +1,32 @@
+-- 结构化输出
+-- output_schema 不为空时引擎要求模型输出 JSON (json_object 模式)，按 Schema 校验，不符合时要求模型修正
+-- 审核导演的输出用于审核-修改循环的评分与修改建议
+
+UPDATE agents
+SET output_schema = $schema$
+{
+  "type": "object",
+  "properties": {
+    "total_score": {"type": "number", "description": "总分", "minimum": 0, "maximum": 100},
+    "dimensions": {
+      "type": "object",
+      "description": "各维度得分",
+      "properties": {
+        "quality":   {"type": "number", "minimum": 0, "maximum": 100},
+        "logic":     {"type": "number", "minimum": 0, "maximum": 100},
+        "plot":      {"type": "number", "minimum": 0, "maximum": 100},
+        "storyline": {"type": "number", "minimum": 0, "maximum": 100}
+      },
+      "required": ["quality", "logic", "plot", "storyline"]
+    },
+    "passed": {"type": "boolean", "description": "total_score >= 75 为通过"},
+    "issues": {"type": "array", "description": "发现的问题", "items": {"type": "string"}},
+    "suggestions": {"type": "array", "description": "具体、可执行的修改建议", "items": {"type": "string"}},
+    "revision_guide": {"type": "string", "description": "需要修改时的具体指导"}
+  },
+  "required": ["total_score", "dimensions", "passed", "suggestions"]
+}
+$schema$::jsonb,
+    updated_at = NOW()
+WHERE agent_key = 'agent_3_quality'
+  AND (output_schema IS NULL OR output_schema = '{}'::jsonb);
@@ -0,0 +1,16 @@
+-- 提示词注入防护
+-- 用户提供的内容命中注入特征时，本次请求禁用会修改项目数据的工具，并记录在此
+
+CREATE TABLE IF NOT EXISTS prompt_injection_incidents (
+    id             SERIAL PRIMARY KEY,
+    user_id        INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    project_id     INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+    agent_key      VARCHAR(50) NOT NULL,
+    action_type    VARCHAR(50) NOT NULL DEFAULT 'agent',
+    findings       JSONB NOT NULL DEFAULT '[]',  -- [{pattern, excerpt}]
+    blocked_tools  JSONB NOT NULL DEFAULT '[]',  -- 本次请求被禁用的写入工具
+    created_at     TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_injection_incidents_created_at ON prompt_injection_incidents(created_at);
+CREATE INDEX IF NOT EXISTS idx_injection_incidents_project ON prompt_injection_incidents(project_id, created_at);
@@ -0,0 +1,41 @@
+-- 工作流运行持久化
+-- 任务状态变化时写入，服务重启后从最后完成的任务继续执行未结束的运行
+
+CREATE TABLE IF NOT EXISTS workflow_runs (
+    id              VARCHAR(64) PRIMARY KEY,               -- 工作流 ID
+    project_id      INT REFERENCES projects(id) ON DELETE CASCADE,
+    user_id         INT REFERENCES users(id) ON DELETE SET NULL,
+    template_id     VARCHAR(100) NOT NULL DEFAULT '',
+    name            VARCHAR(200) NOT NULL DEFAULT '',
+    status          VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, running, completed, failed
+    input           TEXT DEFAULT '',
+    context         JSONB DEFAULT '{}',
+    failure_policy  VARCHAR(30) NOT NULL DEFAULT 'fail_fast',
+    final_content   TEXT DEFAULT '',
+    error           TEXT DEFAULT '',
+    started_at      TIMESTAMP,
+    finished_at     TIMESTAMP,
+    created_at      TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS workflow_run_tasks (
+    run_id          VARCHAR(64) NOT NULL REFERENCES workflow_runs(id) ON DELETE CASCADE,
+    task_id         VARCHAR(100) NOT NULL,
+    sort_order      INT NOT NULL DEFAULT 0,
+    agent_id        INT NOT NULL,
+    type            VARCHAR(30) NOT NULL DEFAULT '',
+    input           TEXT DEFAULT '',
+    context         JSONB DEFAULT '{}',
+    depends_on      JSONB DEFAULT '[]',
+    status          VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, running, completed, failed, skipped
+    result          TEXT DEFAULT '',
+    error           TEXT DEFAULT '',
+    started_at      TIMESTAMP,
+    finished_at     TIMESTAMP,
+    updated_at      TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (run_id, task_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_workflow_runs_project ON workflow_runs(project_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_workflow_runs_unfinished ON workflow_runs(status) WHERE status IN ('pending', 'running');
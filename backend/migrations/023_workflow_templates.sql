@@ -0,0 +1,19 @@
+-- 自定义工作流模板
+-- definition 为 JSON 或 YAML 格式的工作流定义，保存时校验；project_id 为空的是用户级模板
+
+CREATE TABLE IF NOT EXISTS workflow_templates (
+    id              SERIAL PRIMARY KEY,
+    user_id         INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    project_id      INT REFERENCES projects(id) ON DELETE CASCADE,
+    name            VARCHAR(200) NOT NULL,
+    description     TEXT DEFAULT '',
+    format          VARCHAR(10) NOT NULL DEFAULT 'yaml', -- json, yaml
+    definition      TEXT NOT NULL,
+    created_at      TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_workflow_templates_user ON workflow_templates(user_id, project_id);
+
+-- 任务的审核-修改循环配置，恢复运行时需要
+ALTER TABLE workflow_run_tasks ADD COLUMN IF NOT EXISTS review JSONB;
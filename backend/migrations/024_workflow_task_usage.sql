@@ -0,0 +1,5 @@
+-- 工作流任务的 Token 用量与耗时 (包括审核-修改循环中的调用)
+
+ALTER TABLE workflow_run_tasks
+    ADD COLUMN IF NOT EXISTS tokens_used INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS duration_ms BIGINT NOT NULL DEFAULT 0;
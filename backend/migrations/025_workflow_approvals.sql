@@ -0,0 +1,7 @@
+-- 工作流审批关卡
+-- 运行在审批任务处暂停时状态为 awaiting_approval，不随服务重启恢复执行，处理审批后继续
+-- approval 记录审批任务最近一次的处理结果 (操作、意见、处理人与时间)
+
+ALTER TABLE workflow_run_tasks ADD COLUMN IF NOT EXISTS approval JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_workflow_runs_awaiting_approval ON workflow_runs(project_id, updated_at) WHERE status = 'awaiting_approval';
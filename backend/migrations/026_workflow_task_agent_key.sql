@@ -0,0 +1,4 @@
+-- 自定义模板的任务按 agent_key 引用 Agent (扩展 Agent 没有核心 Agent 编号)
+
+ALTER TABLE workflow_run_tasks
+    ADD COLUMN IF NOT EXISTS agent_key VARCHAR(100) NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- 审批驳回后上游任务的输入由原始输入、上一版内容与审批意见重新构建
+-- original_input 保存首次驳回前的输入，多次驳回时不丢失原始任务说明
+
+ALTER TABLE workflow_run_tasks
+    ADD COLUMN IF NOT EXISTS original_input TEXT NOT NULL DEFAULT '';
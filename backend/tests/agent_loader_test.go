@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai"
+	"github.com/zibianqu/novel-study/internal/ai/agents"
+	"github.com/zibianqu/novel-study/internal/config"
+	"github.com/zibianqu/novel-study/internal/model"
+	"github.com/zibianqu/novel-study/internal/repository"
+	"github.com/zibianqu/novel-study/internal/service"
+)
+
+func TestConfigFromModel(t *testing.T) {
+	config, err := agents.ConfigFromModel(&model.Agent{
+		AgentKey:     "agent_3_quality",
+		Name:         "审核导演",
+		SystemPrompt: "你是审核导演",
+		Model:        "gpt-4o-mini",
+		Temperature:  0.3,
+		MaxTokens:    2048,
+		Tools:        `["rag_search", "get_chapter_content"]`,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "agent_3_quality", config.AgentKey)
+	assert.Equal(t, "gpt-4o-mini", config.Model)
+	assert.Equal(t, 0.3, config.Temperature)
+	assert.Equal(t, []string{"rag_search", "get_chapter_content"}, config.Tools)
+}
+
+func TestConfigFromModel_ExtensionPermissions(t *testing.T) {
+	userID := 42
+	config, err := agents.ConfigFromModel(&model.Agent{
+		UserID:       &userID,
+		AgentKey:     "ext_42_poetry_writer",
+		Type:         "extension",
+		Name:         "诗词作者",
+		SystemPrompt: "你擅长创作古典诗词",
+		Model:        "gpt-4o",
+		Temperature:  0.9,
+		Tools:        `["rag_search"]`,
+		Permissions:  `{"max_tool_steps": 2}`,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"rag_search"}, config.Tools)
+	assert.Equal(t, 2, config.MaxToolSteps)
+}
+
+func TestConfigFromModel_Invalid(t *testing.T) {
+	_, err := agents.ConfigFromModel(&model.Agent{AgentKey: "agent_x", SystemPrompt: "", Tools: "[]"})
+	assert.Error(t, err)
+
+	_, err = agents.ConfigFromModel(&model.Agent{AgentKey: "agent_x", SystemPrompt: "p", Tools: "not json"})
+	assert.Error(t, err)
+
+	_, err = agents.ConfigFromModel(&model.Agent{AgentKey: "agent_x", SystemPrompt: "p", Permissions: "[]"})
+	assert.Error(t, err)
+}
+
+func TestCoreAgentNumber(t *testing.T) {
+	n, ok := agents.CoreAgentNumber("agent_6_plotline")
+	assert.True(t, ok)
+	assert.Equal(t, 6, n)
+
+	_, ok = agents.CoreAgentNumber("my_custom_agent")
+	assert.False(t, ok)
+}
+
+func TestAgentService_CreateAgentValidatesBeforeInsert(t *testing.T) {
+	engine := newTestEngine(t, &promptEchoProvider{})
+	// 仓库没有数据库连接，校验失败前一旦访问数据库就会 panic
+	agentService := service.NewAgentService(engine, repository.NewAgentRepository(nil), nil)
+
+	_, err := agentService.CreateAgent(7, &model.CreateAgentRequest{AgentKey: "poet", Name: "诗人"})
+	require.ErrorIs(t, err, service.ErrInvalidAgent)
+	assert.Contains(t, err.Error(), "empty system_prompt")
+
+	_, err = engine.GetAgent(service.ExtensionAgentKey(7, "poet"))
+	assert.Error(t, err)
+}
+
+func TestAgentService_CreateAgentOnlyAllowsListedTools(t *testing.T) {
+	engine := newTestEngine(t, &promptEchoProvider{})
+	agentService := service.NewAgentService(engine, repository.NewAgentRepository(nil), nil)
+
+	for _, tc := range []struct {
+		tools   []string
+		message string
+	}{
+		{[]string{"rag_search", "update_storyline"}, "不允许使用该工具: update_storyline"},
+		{[]string{"create_storyline"}, "不允许使用该工具: create_storyline"},
+		{[]string{"drop_tables"}, "工具不存在: drop_tables"},
+		{[]string{"rag_search", "rag_search"}, "工具重复: rag_search"},
+	} {
+		_, err := agentService.CreateAgent(7, &model.CreateAgentRequest{
+			AgentKey: "poet", Name: "诗人", SystemPrompt: "你是诗人", Tools: tc.tools,
+		})
+		require.ErrorIs(t, err, service.ErrInvalidAgent)
+		assert.Contains(t, err.Error(), tc.message)
+	}
+}
+
+// agentRowsDriver 测试用数据库驱动：按 type 条件返回 agents 表记录
+type agentRowsDriver struct{}
+
+func (agentRowsDriver) Open(string) (driver.Conn, error) { return agentRowsConn{}, nil }
+
+type agentRowsConn struct{}
+
+func (agentRowsConn) Prepare(query string) (driver.Stmt, error) {
+	return agentRowsStmt{query: query}, nil
+}
+func (agentRowsConn) Close() error              { return nil }
+func (agentRowsConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type agentRowsStmt struct{ query string }
+
+func (agentRowsStmt) Close() error                               { return nil }
+func (agentRowsStmt) NumInput() int                              { return -1 }
+func (agentRowsStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (s agentRowsStmt) Query([]driver.Value) (driver.Rows, error) {
+	now := time.Now()
+	row := func(id int64, userID interface{}, key, agentType, tools string) []driver.Value {
+		return []driver.Value{id, userID, key, key, "", "", agentType, "auxiliary", "你是" + key, "gpt-4o",
+			0.7, int64(4096), tools, "{}", "{}", "{}", "[]", true, int64(0), now, now}
+	}
+	rows := &staticRows{columns: make([]string, 21)}
+	if strings.Contains(s.query, "type = 'core'") {
+		rows.values = [][]driver.Value{row(1, nil, "agent_0_director", "core", "[]")}
+	} else {
+		rows.values = [][]driver.Value{
+			row(40, int64(7), "ext_7_broken", "extension", "not-json"),
+			row(41, int64(7), "ext_7_poet", "extension", "[]"),
+		}
+	}
+	return rows, nil
+}
+
+func init() {
+	sql.Register("agent-rows-stub", agentRowsDriver{})
+}
+
+func TestEngine_LoadAgentsSkipsBrokenExtensionAgents(t *testing.T) {
+	db, err := sql.Open("agent-rows-stub", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	engine := ai.NewEngine(&config.Config{}, nil, &promptEchoProvider{}, nil, repository.NewAgentRepository(db), nil, nil, nil, nil)
+	count, err := engine.LoadAgents()
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	_, err = engine.GetAgent("ext_7_poet")
+	assert.NoError(t, err)
+	_, err = engine.GetAgent("agent_0_director")
+	assert.NoError(t, err)
+	_, err = engine.GetAgent("ext_7_broken")
+	assert.Error(t, err)
+}
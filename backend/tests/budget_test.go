@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/agents"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/config"
+	"github.com/zibianqu/novel-study/internal/handler"
+	"github.com/zibianqu/novel-study/internal/model"
+	"github.com/zibianqu/novel-study/internal/repository"
+	"github.com/zibianqu/novel-study/internal/service"
+)
+
+// usageDriver 测试用数据库驱动：没有单独设置的预算
+// 用量查询按 key_source 过滤时只返回系统密钥的 800 Token，不过滤时返回包含用户密钥在内的 5000 Token
+type usageDriver struct {
+	mu      sync.Mutex
+	queries []string
+}
+
+func (d *usageDriver) Open(string) (driver.Conn, error) { return &usageConn{driver: d}, nil }
+
+type usageConn struct{ driver *usageDriver }
+
+func (c *usageConn) Prepare(query string) (driver.Stmt, error) {
+	return &usageStmt{driver: c.driver, query: query}, nil
+}
+func (c *usageConn) Close() error              { return nil }
+func (c *usageConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type usageStmt struct {
+	driver *usageDriver
+	query  string
+}
+
+func (s *usageStmt) Close() error  { return nil }
+func (s *usageStmt) NumInput() int { return -1 }
+func (s *usageStmt) Exec([]driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+func (s *usageStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if strings.Contains(s.query, "FROM ai_budgets") {
+		return &staticRows{columns: make([]string, 9)}, nil
+	}
+
+	s.driver.mu.Lock()
+	s.driver.queries = append(s.driver.queries, fmt.Sprintf("%s %v", s.query, args))
+	s.driver.mu.Unlock()
+
+	columns := []string{"calls", "tokens_input", "tokens_output", "cost"}
+	for _, arg := range args {
+		if arg == model.KeySourcePlatform {
+			return &staticRows{columns: columns, values: [][]driver.Value{{int64(2), int64(500), int64(300), 0.01}}}, nil
+		}
+	}
+	return &staticRows{columns: columns, values: [][]driver.Value{{int64(6), int64(3000), int64(2000), 0.05}}}, nil
+}
+
+var stubUsage = &usageDriver{}
+
+func init() {
+	sql.Register("usage-stub", stubUsage)
+}
+
+func TestBudgetService_CountsOnlyPlatformKeyUsage(t *testing.T) {
+	db, err := sql.Open("usage-stub", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	cfg := &config.Config{UserDailyTokenBudget: 1000, BudgetWarnRatio: 0.8}
+	budgetService := service.NewBudgetService(cfg, repository.NewBudgetRepository(db),
+		repository.NewUsageRepository(db), repository.NewProjectRepository(db))
+
+	// 总用量 5000 已超出上限，但其中用户自己密钥的用量不计入预算
+	warnings, err := budgetService.CheckBudget(7, 0)
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "(800/1000)")
+
+	require.NotEmpty(t, stubUsage.queries)
+	for _, query := range stubUsage.queries {
+		assert.Contains(t, query, "key_source = $4")
+	}
+}
+
+// exhaustedBudget 预算已用尽，记录检查次数
+type exhaustedBudget struct {
+	mu     sync.Mutex
+	checks int
+}
+
+func (b *exhaustedBudget) CheckBudget(userID, projectID int) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checks++
+	return nil, service.ErrTokenBudgetExceeded
+}
+
+func TestEngine_SkipsBudgetForUserProvider(t *testing.T) {
+	system, byok := &promptEchoProvider{}, &promptEchoProvider{}
+	engine := newTestEngine(t, system,
+		&model.Agent{AgentKey: "agent_1_narrator", Type: "core", SystemPrompt: "你是旁白叙述者", Model: "gpt-4o", IsActive: true})
+	budget := &exhaustedBudget{}
+	engine.SetBudgetGuard(budget)
+	engine.SetProviderResolver(staticProviderResolver{7: byok})
+
+	// 用户 7 使用自己的 API 密钥，不受系统预算限制
+	_, err := engine.CheckBudget(7, 3)
+	require.NoError(t, err)
+	_, err = engine.ExecuteAgent(context.Background(), "agent_1_narrator", &llm.AgentRequest{Prompt: "写开头", UserID: 7, ProjectID: 3})
+	require.NoError(t, err)
+	assert.Len(t, byok.requests, 1)
+	assert.Zero(t, budget.checks)
+
+	// 用户 8 使用系统密钥，预算用尽时拒绝调用
+	_, err = engine.CheckBudget(8, 3)
+	require.ErrorIs(t, err, service.ErrTokenBudgetExceeded)
+	_, err = engine.ExecuteAgent(context.Background(), "agent_1_narrator", &llm.AgentRequest{Prompt: "写开头", UserID: 8, ProjectID: 3})
+	require.ErrorIs(t, err, service.ErrTokenBudgetExceeded)
+	assert.Empty(t, system.requests)
+	assert.Equal(t, 2, budget.checks)
+}
+
+// warningBudget 预算接近上限，返回固定的提醒
+type warningBudget []string
+
+func (b warningBudget) CheckBudget(userID, projectID int) ([]string, error) {
+	return b, nil
+}
+
+func TestAIStreamHandler_SendsBudgetWarningsBeforeGeneration(t *testing.T) {
+	provider := &streamingEchoProvider{}
+	engine := newTestEngine(t, provider)
+	director, err := agents.NewAgentFromModel(&model.Agent{AgentKey: "agent_0_director", Type: "core", SystemPrompt: "你是总导演", Model: "gpt-4o", IsActive: true}, provider, engine.GetToolRegistry())
+	require.NoError(t, err)
+	engine.RegisterAgent("agent_0_director", 0, director)
+	engine.SetBudgetGuard(warningBudget{"用户今日 Token 用量已达预算的 85% (850/1000)"})
+
+	router := createTestRouter()
+	router.POST("/chat", func(c *gin.Context) {
+		c.Set("user_id", 7)
+		handler.NewAIStreamHandler(engine, nil).Chat(c)
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, createTestRequest(http.MethodPost, "/chat", map[string]interface{}{"message": "你好"}))
+
+	// 预算提醒是第一个事件，早于任何生成内容
+	body := w.Body.String()
+	require.True(t, strings.HasPrefix(body, "event: warning\n"), body)
+	assert.Contains(t, body[:strings.Index(body, "\n\n")], "(850/1000)")
+	assert.Less(t, strings.Index(body, "event: warning"), strings.Index(body, "event: chunk"))
+	assert.Contains(t, body, "event: complete")
+}
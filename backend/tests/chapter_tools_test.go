@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/tools"
+	"github.com/zibianqu/novel-study/internal/model"
+	"github.com/zibianqu/novel-study/internal/repository"
+)
+
+// chapterDriver 测试用数据库驱动：任何查询都返回属于项目 1 的第 7 章
+type chapterDriver struct{}
+
+func (chapterDriver) Open(string) (driver.Conn, error) { return chapterConn{}, nil }
+
+type chapterConn struct{}
+
+func (chapterConn) Prepare(string) (driver.Stmt, error) { return chapterStmt{}, nil }
+func (chapterConn) Close() error                        { return nil }
+func (chapterConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+type chapterStmt struct{}
+
+func (chapterStmt) Close() error  { return nil }
+func (chapterStmt) NumInput() int { return -1 }
+func (chapterStmt) Exec([]driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+func (chapterStmt) Query([]driver.Value) (driver.Rows, error) {
+	now := time.Now()
+	return &staticRows{
+		columns: []string{"id", "project_id", "volume_id", "title", "content", "word_count", "sort_order", "status", "locked_by", "locked_at", "created_at", "updated_at"},
+		values:  [][]driver.Value{{int64(7), int64(1), nil, "第七章", "正文", int64(2), int64(7), "draft", nil, nil, now, now}},
+	}, nil
+}
+
+func init() {
+	sql.Register("chapter-stub", chapterDriver{})
+}
+
+func TestGetChapterContentTool_RejectsOtherProjects(t *testing.T) {
+	db, err := sql.Open("chapter-stub", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	registry := tools.NewToolRegistry(&recordingLogger{})
+	registry.Register(tools.NewGetChapterContentTool(repository.NewChapterRepository(db)))
+
+	// 章节属于项目 1，从项目 2 读取时拒绝
+	_, err = registry.Execute(context.Background(), 1, "get_chapter_content", map[string]interface{}{
+		"chapter_id": 7, "project_id": 2,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found in project 2")
+
+	// 缺少 project_id 时不执行
+	_, err = registry.Execute(context.Background(), 1, "get_chapter_content", map[string]interface{}{
+		"chapter_id": 7,
+	})
+	require.Error(t, err)
+
+	result, err := registry.Execute(context.Background(), 1, "get_chapter_content", map[string]interface{}{
+		"chapter_id": 7, "project_id": 1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "正文", result.(*model.Chapter).Content)
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/agents"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/ai/openai"
+)
+
+func newHistoryTestAgent(baseURL string) *agents.BaseAgent {
+	return agents.NewBaseAgent(&llm.AgentConfig{
+		AgentKey:     "agent_0_director",
+		Name:         "总导演",
+		SystemPrompt: "你是总导演",
+		Model:        "gpt-4o",
+	}, openai.NewClientWithBaseURL("test-key", baseURL), nil, 0)
+}
+
+// sentMessages 提取发送给模型的 role:content 列表
+func sentMessages(request map[string]interface{}) []string {
+	var result []string
+	for _, m := range request["messages"].([]interface{}) {
+		msg := m.(map[string]interface{})
+		result = append(result, msg["role"].(string)+":"+msg["content"].(string))
+	}
+	return result
+}
+
+func TestBaseAgent_ReplaysHistory(t *testing.T) {
+	server, lastRequest := newFakeOpenAIServer(t, "好的，继续第三章。")
+	agent := newHistoryTestAgent(server.URL + "/v1")
+
+	_, err := agent.Execute(context.Background(), &llm.AgentRequest{
+		Prompt: "继续",
+		History: []llm.ChatMessage{
+			{Role: "user", Content: "第二章写到哪了？"},
+			{Role: "assistant", Content: "主角刚进城。"},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"system:你是总导演",
+		"user:第二章写到哪了？",
+		"assistant:主角刚进城。",
+		"user:继续",
+	}, sentMessages(*lastRequest))
+}
+
+func TestBaseAgent_HistoryTokenBudget(t *testing.T) {
+	server, lastRequest := newFakeOpenAIServer(t, "收到")
+	agent := newHistoryTestAgent(server.URL + "/v1")
+
+	long := strings.Repeat("很久以前的讨论", 50)
+	_, err := agent.Execute(context.Background(), &llm.AgentRequest{
+		Prompt: "继续",
+		History: []llm.ChatMessage{
+			{Role: "user", Content: long},
+			{Role: "assistant", Content: long},
+			{Role: "user", Content: "换个视角"},
+			{Role: "assistant", Content: "改用配角视角"},
+		},
+		HistoryTokenBudget: 50,
+	})
+	require.NoError(t, err)
+
+	// 超出预算的早期对话被丢弃，只保留最近的完整轮次
+	assert.Equal(t, []string{
+		"system:你是总导演",
+		"user:换个视角",
+		"assistant:改用配角视角",
+		"user:继续",
+	}, sentMessages(*lastRequest))
+}
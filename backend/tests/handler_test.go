@@ -2,23 +2,70 @@ package tests
 
 import (
 	"bytes"
+	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/config"
+	"github.com/zibianqu/novel-study/internal/handler"
+	"github.com/zibianqu/novel-study/internal/middleware"
 )
 
+// insertIDDriver 测试用数据库驱动：任何查询都返回一行 id = 1，模拟 INSERT ... RETURNING id
+type insertIDDriver struct{}
+
+func (insertIDDriver) Open(string) (driver.Conn, error) { return insertIDConn{}, nil }
+
+type insertIDConn struct{}
+
+func (insertIDConn) Prepare(string) (driver.Stmt, error) { return insertIDStmt{}, nil }
+func (insertIDConn) Close() error                        { return nil }
+func (insertIDConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+type insertIDStmt struct{}
+
+func (insertIDStmt) Close() error                               { return nil }
+func (insertIDStmt) NumInput() int                              { return -1 }
+func (insertIDStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (insertIDStmt) Query([]driver.Value) (driver.Rows, error)  { return &insertIDRows{}, nil }
+
+type insertIDRows struct{ done bool }
+
+func (r *insertIDRows) Columns() []string { return []string{"id"} }
+func (r *insertIDRows) Close() error      { return nil }
+func (r *insertIDRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+func init() {
+	sql.Register("insert-id-stub", insertIDDriver{})
+}
+
 func TestAuthHandler_Register(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	
+	db, err := sql.Open("insert-id-stub", "")
+	require.NoError(t, err)
+	defer db.Close()
+
 	// 创建测试路由
 	router := gin.New()
-	// 这里需要初始化handler
-	// authHandler := handler.NewAuthHandler(mockDB, mockConfig)
-	// router.POST("/register", authHandler.Register)
+	cfg := &config.Config{JWTSecret: "test-secret-at-least-32-characters-long"}
+	authHandler := handler.NewAuthHandler(db, cfg, middleware.NewLoginLimiter(5, time.Minute))
+	router.POST("/register", authHandler.Register)
 	
 	tests := []struct {
 		name       string
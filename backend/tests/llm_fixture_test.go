@@ -0,0 +1,243 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/agents"
+	"github.com/zibianqu/novel-study/internal/ai/collaboration"
+	"github.com/zibianqu/novel-study/internal/ai/fixture"
+	"github.com/zibianqu/novel-study/internal/ai/guard"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/ai/openai"
+	"github.com/zibianqu/novel-study/internal/model"
+)
+
+// newEchoServer 按请求中的系统提示词返回不同内容的 OpenAI 兼容服务
+func newEchoServer(t *testing.T, calls *int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		var body struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"model": body.Model,
+			"choices": []map[string]interface{}{
+				{"index": 0, "message": map[string]string{"role": "assistant", "content": body.Messages[0].Content + "的输出"}, "finish_reason": "stop"},
+			},
+			"usage": map[string]int{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// agentExecutor 按 Agent 编号调用对应的 Agent，供 Scheduler 使用
+type agentExecutor map[int]*agents.BaseAgent
+
+func (e agentExecutor) Execute(ctx context.Context, ref collaboration.AgentRef, input string, taskContext map[string]interface{}) (string, error) {
+	agent, ok := e[ref.ID]
+	if !ok {
+		return "", fmt.Errorf("agent %s not found", ref)
+	}
+	if input == "" {
+		input = "请处理上一步的结果"
+	}
+	resp, err := agent.Execute(ctx, &llm.AgentRequest{Prompt: input, Context: taskContext})
+	if err != nil {
+		return "", err
+	}
+	return resp.Content, nil
+}
+
+func newFixtureExecutor(provider llm.LLMProvider) agentExecutor {
+	newAgent := func(key, name string) *agents.BaseAgent {
+		return agents.NewBaseAgent(&llm.AgentConfig{
+			AgentKey:     key,
+			Name:         name,
+			SystemPrompt: "你是" + name,
+			Model:        "gpt-4o",
+		}, provider, nil, 0)
+	}
+	return agentExecutor{
+		1: newAgent("agent_1_narrator", "旁白叙述者"),
+		3: newAgent("agent_3_director", "审核导演"),
+	}
+}
+
+func runContinueWorkflow(t *testing.T, provider llm.LLMProvider) *collaboration.WorkflowResult {
+	scheduler := collaboration.NewScheduler(newFixtureExecutor(provider))
+	workflow := collaboration.BuildContinueWriteWorkflow("续写第三章", map[string]interface{}{"project_id": 1})
+
+	result, err := scheduler.ExecuteWorkflow(context.Background(), workflow)
+	require.NoError(t, err)
+	return result
+}
+
+func TestFixtureProvider_RecordsAndReplaysWorkflow(t *testing.T) {
+	dir := t.TempDir()
+	var calls int32
+	server := newEchoServer(t, &calls)
+	upstream := openai.NewClientWithBaseURL("test-key", server.URL+"/v1")
+
+	recorded := runContinueWorkflow(t, fixture.NewProvider(dir, upstream, fixture.ModeRecord, false))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	// 上下文以数据块传入，系统提示词末尾追加数据块说明
+	assert.Equal(t, "你是审核导演"+guard.DataBlockInstruction+"的输出", recorded.FinalContent)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	// 关闭服务后严格回放，结果与录制时一致且不再访问网络
+	server.Close()
+	replayed := runContinueWorkflow(t, fixture.NewProvider(dir, nil, fixture.ModeReplay, true))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, recorded.FinalContent, replayed.FinalContent)
+	for i, task := range replayed.Tasks {
+		assert.Equal(t, recorded.Tasks[i].Result, task.Result)
+	}
+}
+
+func TestFixtureProvider_StrictModeFailsOnUnknownRequest(t *testing.T) {
+	var calls int32
+	server := newEchoServer(t, &calls)
+	upstream := openai.NewClientWithBaseURL("test-key", server.URL+"/v1")
+	provider := fixture.NewProvider(t.TempDir(), upstream, fixture.ModeReplay, true)
+
+	_, err := provider.CreateCompletion(context.Background(), &llm.CompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []llm.ChatMessage{{Role: "user", Content: "没有录制过的请求"}},
+	})
+	require.ErrorIs(t, err, fixture.ErrFixtureNotFound)
+	assert.Contains(t, err.Error(), "没有录制过的请求")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+}
+
+func TestFixtureProvider_RecordsMissesWhenNotStrict(t *testing.T) {
+	server := newFakeStreamServer(t, []string{"夜色", "渐深"}, true)
+	provider := fixture.NewProvider(t.TempDir(), openai.NewClientWithBaseURL("test-key", server.URL+"/v1"), fixture.ModeReplay, false)
+
+	req := &llm.CompletionRequest{Model: "gpt-4o", Messages: []llm.ChatMessage{{Role: "user", Content: "续写"}}}
+	first, err := provider.CreateCompletionStream(context.Background(), req, func(string) {})
+	require.NoError(t, err)
+
+	// 第二次调用从录制回放，按原来的增量顺序输出
+	server.Close()
+	var chunks []string
+	second, err := provider.CreateCompletionStream(context.Background(), req, func(delta string) { chunks = append(chunks, delta) })
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"夜色", "渐深"}, chunks)
+	assert.Equal(t, first.Content, second.Content)
+	assert.Equal(t, first.Usage, second.Usage)
+}
+
+func TestFixtureHash_IgnoresInsignificantDifferences(t *testing.T) {
+	base := &llm.CompletionRequest{
+		Model:       "gpt-4o",
+		Temperature: 0.7,
+		Messages: []llm.ChatMessage{
+			{Role: "system", Content: "你是旁白叙述者"},
+			{Role: "assistant", ToolCalls: []llm.ToolCall{{ID: "call_1", Name: "rag_search", Arguments: `{"query":"主角","top_k":3}`}}},
+		},
+		Tools: []llm.ToolDefinition{{Name: "rag_search"}, {Name: "get_project_status"}},
+	}
+	variant := &llm.CompletionRequest{
+		Model:       "gpt-4o",
+		Temperature: 0.70000001,
+		Messages: []llm.ChatMessage{
+			{Role: "system", Content: "你是旁白叙述者  \r\n"},
+			{Role: "assistant", ToolCalls: []llm.ToolCall{{ID: "call_1", Name: "rag_search", Arguments: `{"top_k": 3, "query": "主角"}`}}},
+		},
+		Tools: []llm.ToolDefinition{{Name: "get_project_status"}, {Name: "rag_search"}},
+	}
+	assert.Equal(t, fixture.Hash(fixture.Normalize(base)), fixture.Hash(fixture.Normalize(variant)))
+
+	changed := *base
+	changed.Model = "gpt-4o-mini"
+	assert.NotEqual(t, fixture.Hash(fixture.Normalize(base)), fixture.Hash(fixture.Normalize(&changed)))
+}
+
+func TestFixtureProvider_RejectsCorruptFixture(t *testing.T) {
+	dir := t.TempDir()
+	req := &llm.CompletionRequest{Model: "gpt-4o", Messages: []llm.ChatMessage{{Role: "user", Content: "你好"}}}
+	hash := fixture.Hash(fixture.Normalize(req))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, hash+".json"), []byte("{"), 0o644))
+
+	_, err := fixture.NewProvider(dir, nil, fixture.ModeReplay, true).CreateCompletion(context.Background(), req)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid llm fixture")
+}
+
+// staticProviderResolver 为指定用户返回自己的提供方
+type staticProviderResolver map[int]llm.LLMProvider
+
+func (r staticProviderResolver) ProviderFor(userID int) (llm.LLMProvider, error) {
+	return r[userID], nil
+}
+
+func TestFixtureProvider_ForwardsRouterAndUserProviders(t *testing.T) {
+	dir := t.TempDir()
+	system, local, byok := &promptEchoProvider{}, &promptEchoProvider{}, &promptEchoProvider{}
+	router := llm.NewRouter(system)
+	router.Register("local", local)
+	provider := fixture.NewProvider(dir, router, fixture.ModeReplay, false)
+
+	// 路由结果保留上游的熔断器，Client 仍是录制回放提供方
+	route, err := provider.Route("local:qwen2.5")
+	require.NoError(t, err)
+	upstreamRoute, err := router.Route("local:qwen2.5")
+	require.NoError(t, err)
+	assert.Equal(t, "local", route.Provider)
+	assert.Equal(t, "qwen2.5", route.Model)
+	assert.Same(t, upstreamRoute.Breaker, route.Breaker)
+	assert.IsType(t, &fixture.Provider{}, route.Client)
+
+	engine := newTestEngine(t, provider,
+		&model.Agent{AgentKey: "agent_1_narrator", Type: "core", SystemPrompt: "你是旁白叙述者", Model: "gpt-4o", IsActive: true},
+		&model.Agent{AgentKey: "agent_2_local", Type: "core", SystemPrompt: "你是本地模型", Model: "local:qwen2.5", IsActive: true})
+	engine.SetProviderResolver(staticProviderResolver{7: byok})
+
+	for i := 0; i < 2; i++ {
+		_, err = engine.ExecuteAgent(context.Background(), "agent_1_narrator", &llm.AgentRequest{Prompt: "写开头", UserID: 7})
+		require.NoError(t, err)
+		_, err = engine.ExecuteAgent(context.Background(), "agent_2_local", &llm.AgentRequest{Prompt: "写开头", UserID: 7})
+		require.NoError(t, err)
+	}
+
+	// 用户自己的 API 密钥替换默认提供方，仍经过录制回放：第二次从录制回放
+	assert.Len(t, byok.requests, 1)
+	assert.Empty(t, system.requests)
+	// 非默认提供方收到去掉前缀的模型名，录制按路由前的模型名归档
+	require.Len(t, local.requests, 1)
+	assert.Equal(t, "qwen2.5", local.requests[0].Model)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	var models []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		var recorded fixture.Fixture
+		require.NoError(t, json.Unmarshal(data, &recorded))
+		models = append(models, recorded.Request.Model)
+	}
+	assert.ElementsMatch(t, []string{"gpt-4o", "local:qwen2.5"}, models)
+}
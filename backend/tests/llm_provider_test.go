@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/agents"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/ai/openai"
+)
+
+// newFakeOpenAIServer 创建模拟 OpenAI Chat Completions 接口的本地服务
+func newFakeOpenAIServer(t *testing.T, content string) (*httptest.Server, *map[string]interface{}) {
+	var lastRequest map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&lastRequest))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":     "chatcmpl-test",
+			"object": "chat.completion",
+			"model":  lastRequest["model"],
+			"choices": []map[string]interface{}{
+				{
+					"index":         0,
+					"message":       map[string]string{"role": "assistant", "content": content},
+					"finish_reason": "stop",
+				},
+			},
+			"usage": map[string]int{
+				"prompt_tokens":     42,
+				"completion_tokens": 17,
+				"total_tokens":      59,
+			},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &lastRequest
+}
+
+func TestOpenAIClient_CreateCompletion(t *testing.T) {
+	server, lastRequest := newFakeOpenAIServer(t, "夜色如墨。")
+	client := openai.NewClientWithBaseURL("test-key", server.URL+"/v1")
+
+	resp, err := client.CreateCompletion(context.Background(), &llm.CompletionRequest{
+		Model:       "gpt-4o-mini",
+		Messages:    []llm.ChatMessage{{Role: "user", Content: "写一句开头"}},
+		Temperature: 0.7,
+		MaxTokens:   128,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "夜色如墨。", resp.Content)
+	assert.Equal(t, "gpt-4o-mini", resp.Model)
+	assert.Equal(t, "stop", resp.FinishReason)
+	assert.Equal(t, llm.TokenUsage{PromptTokens: 42, CompletionTokens: 17, TotalTokens: 59}, resp.Usage)
+	assert.Equal(t, float64(128), (*lastRequest)["max_tokens"])
+}
+
+func TestOpenAIClient_EmptyAPIKey(t *testing.T) {
+	assert.Nil(t, openai.NewClientWithBaseURL("", "http://localhost"))
+}
+
+func TestBaseAgent_ExecuteReportsTokenUsage(t *testing.T) {
+	server, lastRequest := newFakeOpenAIServer(t, "青石小径蜿蜒向前。")
+	client := openai.NewClientWithBaseURL("test-key", server.URL+"/v1")
+
+	agent := agents.NewBaseAgent(&llm.AgentConfig{
+		AgentKey:     "agent_1_narrator",
+		Name:         "旁白叙述者",
+		SystemPrompt: "你是旁白叙述者",
+		Model:        "gpt-4o",
+		Temperature:  0.8,
+		MaxTokens:    4096,
+	}, client, nil, 1)
+	resp, err := agent.Execute(context.Background(), &llm.AgentRequest{
+		Prompt:    "描写一座古代庭院",
+		MaxTokens: 256,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "青石小径蜿蜒向前。", resp.Content)
+	assert.Equal(t, 59, resp.TokensUsed)
+	assert.Equal(t, 42, resp.Metadata["prompt_tokens"])
+	assert.Equal(t, 17, resp.Metadata["completion_tokens"])
+	assert.Equal(t, "gpt-4o", resp.Model)
+	assert.Equal(t, llm.TokenUsage{PromptTokens: 42, CompletionTokens: 17, TotalTokens: 59}, resp.Usage)
+
+	// 请求级 MaxTokens 覆盖 Agent 配置
+	assert.Equal(t, float64(256), (*lastRequest)["max_tokens"])
+	assert.Equal(t, "gpt-4o", (*lastRequest)["model"])
+
+	messages := (*lastRequest)["messages"].([]interface{})
+	require.Len(t, messages, 2)
+	assert.Equal(t, "system", messages[0].(map[string]interface{})["role"])
+}
@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/agents"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/ai/openai"
+)
+
+// newFakeStreamServer 创建按 SSE 分片返回内容的模拟服务
+// complete 为 false 时在输出分片后直接断开，模拟生成中途的连接中断
+func newFakeStreamServer(t *testing.T, chunks []string, complete bool) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, true, req["stream"])
+		assert.Equal(t, map[string]interface{}{"include_usage": true}, req["stream_options"])
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+
+		send := func(payload map[string]interface{}) {
+			data, _ := json.Marshal(payload)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+
+		for _, chunk := range chunks {
+			send(map[string]interface{}{
+				"model": "gpt-4o-2024-08-06",
+				"choices": []map[string]interface{}{
+					{"index": 0, "delta": map[string]string{"content": chunk}},
+				},
+			})
+		}
+		if !complete {
+			return
+		}
+
+		send(map[string]interface{}{
+			"model": "gpt-4o-2024-08-06",
+			"choices": []map[string]interface{}{
+				{"index": 0, "delta": map[string]string{}, "finish_reason": "stop"},
+			},
+		})
+		send(map[string]interface{}{
+			"model":   "gpt-4o-2024-08-06",
+			"choices": []map[string]interface{}{},
+			"usage": map[string]int{
+				"prompt_tokens":     30,
+				"completion_tokens": 12,
+				"total_tokens":      42,
+			},
+		})
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		flusher.Flush()
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newStreamTestAgent(baseURL string) *agents.BaseAgent {
+	return agents.NewBaseAgent(&llm.AgentConfig{
+		AgentKey:     "agent_1_narrator",
+		Name:         "旁白叙述者",
+		SystemPrompt: "你是旁白叙述者",
+		Model:        "gpt-4o",
+		MaxTokens:    512,
+	}, openai.NewClientWithBaseURL("test-key", baseURL), nil, 1)
+}
+
+func TestOpenAIClient_CreateCompletionStream(t *testing.T) {
+	server := newFakeStreamServer(t, []string{"月", "落", "乌啼"}, true)
+	client := openai.NewClientWithBaseURL("test-key", server.URL+"/v1")
+
+	var deltas []string
+	resp, err := client.CreateCompletionStream(context.Background(), &llm.CompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []llm.ChatMessage{{Role: "user", Content: "写一句诗"}},
+	}, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"月", "落", "乌啼"}, deltas)
+	assert.Equal(t, "月落乌啼", resp.Content)
+	assert.Equal(t, "gpt-4o-2024-08-06", resp.Model)
+	assert.Equal(t, "stop", resp.FinishReason)
+	assert.Equal(t, llm.TokenUsage{PromptTokens: 30, CompletionTokens: 12, TotalTokens: 42}, resp.Usage)
+}
+
+func TestBaseAgent_ExecuteStreamReportsUsage(t *testing.T) {
+	server := newFakeStreamServer(t, []string{"夜", "色", "如墨"}, true)
+	agent := newStreamTestAgent(server.URL + "/v1")
+
+	var content string
+	resp, err := agent.ExecuteStream(context.Background(), &llm.AgentRequest{Prompt: "描写夜晚"}, func(chunk string) {
+		content += chunk
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "夜色如墨", content)
+	assert.Equal(t, "夜色如墨", resp.Content)
+	assert.Equal(t, 42, resp.TokensUsed)
+	assert.Equal(t, 30, resp.Metadata["prompt_tokens"])
+	assert.Equal(t, 12, resp.Metadata["completion_tokens"])
+}
+
+func TestBaseAgent_ExecuteStreamInterrupted(t *testing.T) {
+	server := newFakeStreamServer(t, []string{"夜", "色"}, false)
+	agent := newStreamTestAgent(server.URL + "/v1")
+
+	var content string
+	_, err := agent.ExecuteStream(context.Background(), &llm.AgentRequest{Prompt: "描写夜晚"}, func(chunk string) {
+		content += chunk
+	})
+
+	// 已输出的内容不会因重试而重复，中断以错误形式返回
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stream interrupted")
+	assert.Equal(t, "夜色", content)
+}
+
+func TestBaseAgent_ExecuteStreamCanceled(t *testing.T) {
+	server := newFakeStreamServer(t, []string{"夜"}, true)
+	agent := newStreamTestAgent(server.URL + "/v1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := agent.ExecuteStream(ctx, &llm.AgentRequest{Prompt: "描写夜晚"}, nil)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+}
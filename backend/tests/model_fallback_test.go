@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/agents"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/ai/openai"
+)
+
+// modelServer 按模型名返回指定状态码的 OpenAI 兼容服务，记录请求的模型顺序
+type modelServer struct {
+	mu       sync.Mutex
+	models   []string
+	statuses map[string]int
+	header   http.Header
+}
+
+func newModelServer(t *testing.T, statuses map[string]int) (*modelServer, *httptest.Server) {
+	s := &modelServer{statuses: statuses, header: http.Header{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		s.mu.Lock()
+		s.models = append(s.models, body.Model)
+		status := s.statuses[body.Model]
+		for k, v := range s.header {
+			w.Header()[k] = v
+		}
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if status >= 400 {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]string{"message": "upstream error", "type": "server_error"},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"model": body.Model,
+			"choices": []map[string]interface{}{
+				{"index": 0, "message": map[string]string{"role": "assistant", "content": "来自 " + body.Model}, "finish_reason": "stop"},
+			},
+			"usage": map[string]int{"prompt_tokens": 5, "completion_tokens": 2, "total_tokens": 7},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+func (s *modelServer) requested() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.models...)
+}
+
+func newFallbackAgent(provider llm.LLMProvider, fallbacks ...string) *agents.BaseAgent {
+	return agents.NewBaseAgent(&llm.AgentConfig{
+		AgentKey:       "agent_0_director",
+		Name:           "总导演",
+		SystemPrompt:   "你是总导演",
+		Model:          "gpt-4o",
+		FallbackModels: fallbacks,
+	}, provider, nil, 0)
+}
+
+func TestBaseAgent_FallsBackWhenPrimaryUnavailable(t *testing.T) {
+	srv, server := newModelServer(t, map[string]int{"gpt-4o": http.StatusServiceUnavailable})
+	client := openai.NewClientWithBaseURL("test-key", server.URL+"/v1")
+
+	// 主模型重试耗尽后切换到备用模型
+	agent := newFallbackAgent(llm.NewRouter(client), "gpt-4o-mini")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	resp, err := agent.Execute(ctx, &llm.AgentRequest{Prompt: "你好"})
+	require.NoError(t, err)
+	assert.Equal(t, "来自 gpt-4o-mini", resp.Content)
+
+	models := srv.requested()
+	assert.Equal(t, "gpt-4o-mini", models[len(models)-1])
+	assert.Contains(t, models, "gpt-4o")
+}
+
+func TestBaseAgent_BadRequestDoesNotFallBack(t *testing.T) {
+	srv, server := newModelServer(t, map[string]int{"gpt-4o": http.StatusBadRequest})
+	client := openai.NewClientWithBaseURL("test-key", server.URL+"/v1")
+
+	agent := newFallbackAgent(llm.NewRouter(client), "gpt-4o-mini")
+	_, err := agent.Execute(context.Background(), &llm.AgentRequest{Prompt: "你好"})
+	require.Error(t, err)
+
+	// 请求本身有误时换模型也无济于事，不重试也不降级
+	assert.Equal(t, []string{"gpt-4o"}, srv.requested())
+}
+
+func TestOpenAIClient_ClassifiesErrorsAndRetryAfter(t *testing.T) {
+	srv, server := newModelServer(t, map[string]int{"gpt-4o": http.StatusTooManyRequests})
+	srv.header.Set("Retry-After", "7")
+	client := openai.NewClientWithBaseURL("test-key", server.URL+"/v1")
+
+	_, err := client.CreateCompletion(context.Background(), &llm.CompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []llm.ChatMessage{{Role: "user", Content: "你好"}},
+	})
+	require.Error(t, err)
+
+	var providerErr *llm.ProviderError
+	require.True(t, errors.As(err, &providerErr))
+	assert.Equal(t, http.StatusTooManyRequests, providerErr.StatusCode)
+	assert.True(t, llm.IsRetryable(err))
+	assert.False(t, llm.IsProviderFailure(err))
+	assert.Equal(t, 7*time.Second, llm.RetryAfterOf(err))
+}
+
+func TestProviderErrorClassification(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+		failure   bool
+	}{
+		{"rate limited", &llm.ProviderError{StatusCode: 429}, true, false},
+		{"quota exhausted", &llm.ProviderError{StatusCode: 429, Code: "insufficient_quota"}, false, false},
+		{"server error", &llm.ProviderError{StatusCode: 502}, true, true},
+		{"bad request", &llm.ProviderError{StatusCode: 400}, false, false},
+		{"unauthorized", &llm.ProviderError{StatusCode: 401}, false, false},
+		{"canceled", context.Canceled, false, false},
+		{"circuit open", llm.ErrCircuitOpen, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.retryable, llm.IsRetryable(tt.err))
+			assert.Equal(t, tt.failure, llm.IsProviderFailure(tt.err))
+		})
+	}
+}
+
+func TestCircuitBreaker_OpensAndRecovers(t *testing.T) {
+	breaker := llm.NewCircuitBreaker(2, 50*time.Millisecond)
+	assert.Equal(t, llm.CircuitClosed, breaker.State())
+
+	breaker.Failure()
+	assert.True(t, breaker.Allow())
+	breaker.Failure()
+	assert.Equal(t, llm.CircuitOpen, breaker.State())
+	assert.False(t, breaker.Allow())
+
+	// 冷却后放行一次探测请求，成功则恢复
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, breaker.Allow())
+	assert.False(t, breaker.Allow())
+	breaker.Success()
+	assert.Equal(t, llm.CircuitClosed, breaker.State())
+}
+
+func TestRouter_RoutesByProviderPrefix(t *testing.T) {
+	defaultSrv, defaultServer := newModelServer(t, nil)
+	localSrv, localServer := newModelServer(t, nil)
+
+	router := llm.NewRouter(openai.NewClientWithBaseURL("test-key", defaultServer.URL+"/v1"))
+	router.Register("local", openai.NewClientWithBaseURL("none", localServer.URL+"/v1"))
+
+	// 主模型所在的提供方熔断时直接使用备用提供方
+	route, err := router.Route("gpt-4o")
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		route.Breaker.Failure()
+	}
+
+	agent := newFallbackAgent(router, "local:qwen2.5")
+	resp, err := agent.Execute(context.Background(), &llm.AgentRequest{Prompt: "你好"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "来自 qwen2.5", resp.Content)
+	assert.Empty(t, defaultSrv.requested())
+	assert.Equal(t, []string{"qwen2.5"}, localSrv.requested())
+	assert.Equal(t, llm.CircuitOpen, router.BreakerStates()[llm.DefaultProviderName])
+}
@@ -0,0 +1,26 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zibianqu/novel-study/internal/ai"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+)
+
+func TestEstimateCostUsesModelPrice(t *testing.T) {
+	usage := llm.TokenUsage{PromptTokens: 2000, CompletionTokens: 1000, TotalTokens: 3000}
+
+	// gpt-4o: 0.0025 / 1K 输入，0.01 / 1K 输出
+	assert.InDelta(t, 0.015, ai.EstimateCost("gpt-4o", usage), 1e-9)
+
+	// 带日期后缀的版本按最长前缀匹配，gpt-4o-mini 不会被当作 gpt-4o
+	assert.Equal(t, ai.PriceOf("gpt-4o"), ai.PriceOf("gpt-4o-2024-08-06"))
+	assert.Equal(t, ai.PriceOf("gpt-4o-mini"), ai.PriceOf("gpt-4o-mini-2024-07-18"))
+	assert.NotEqual(t, ai.PriceOf("gpt-4o"), ai.PriceOf("gpt-4o-mini"))
+}
+
+func TestEstimateCostUnknownModelIsNotFree(t *testing.T) {
+	usage := llm.TokenUsage{PromptTokens: 1000, CompletionTokens: 1000, TotalTokens: 2000}
+	assert.Greater(t, ai.EstimateCost("some-local-model", usage), 0.0)
+}
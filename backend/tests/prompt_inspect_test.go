@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/guard"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/ai/prompt"
+	"github.com/zibianqu/novel-study/internal/model"
+)
+
+func TestPromptService_InspectSplitsSystemAndUserMessages(t *testing.T) {
+	service := prompt.NewPromptService(8000)
+
+	inspection, err := service.InspectAgentPrompt(context.Background(), "你是小说作者", "请续写", &prompt.PromptOptions{
+		ProjectID:      1,
+		ProjectInfo:    map[string]interface{}{"title": "长夜"},
+		RecentContent:  "夜色渐深。",
+		KnowledgeItems: map[string][]string{"rag": {"城门在子时关闭。"}},
+	}, nil)
+	require.NoError(t, err)
+
+	require.Len(t, inspection.Messages, 2)
+	assert.Equal(t, "system", inspection.Messages[0].Role)
+	assert.Equal(t, "你是小说作者"+guard.DataBlockInstruction, inspection.Messages[0].Content)
+	assert.Equal(t, "user", inspection.Messages[1].Role)
+	assert.Contains(t, inspection.Messages[1].Content, "### 参考知识 - rag")
+	assert.True(t, strings.HasSuffix(inspection.Messages[1].Content, "请续写"))
+	assert.Positive(t, inspection.Messages[1].Tokens)
+
+	assert.Contains(t, inspection.Sections, "project_context")
+	assert.Contains(t, inspection.Sections, "knowledge_rag")
+	assert.Empty(t, inspection.Dropped)
+	assert.Empty(t, inspection.Truncated)
+}
+
+func TestPromptService_InspectReportsDroppedSections(t *testing.T) {
+	service := prompt.NewPromptService(300)
+
+	inspection, err := service.InspectAgentPrompt(context.Background(), "", "请续写", &prompt.PromptOptions{
+		RecentContent:       strings.Repeat("夜色渐深，城门已闭。", 60),
+		RecentContentMaxLen: 5000,
+		KnowledgeItems:      map[string][]string{"history": {strings.Repeat("宗门往事。", 40)}},
+	}, nil)
+	require.NoError(t, err)
+
+	require.Len(t, inspection.Messages, 1)
+	assert.Equal(t, []string{"recent_content"}, inspection.Truncated)
+	assert.Equal(t, []string{"knowledge_history"}, inspection.Dropped)
+	assert.LessOrEqual(t, inspection.Report.TotalTokens, 300)
+}
+
+func TestPromptService_InspectUsesAgentMessageBuilder(t *testing.T) {
+	provider := &promptEchoProvider{}
+	engine := newTestEngine(t, provider,
+		&model.Agent{AgentKey: "agent_1_narrator", Type: "core", SystemPrompt: "你是旁白叙述者", Model: "gpt-4o", IsActive: true},
+		&model.Agent{AgentKey: "agent_3_reviewer", Type: "core", SystemPrompt: "你是审核导演", Model: "gpt-4o", IsActive: true,
+			OutputSchema: `{"type":"object","properties":{"score":{"type":"number"}},"required":["score"]}`})
+	agentReq := &llm.AgentRequest{Prompt: "请审核", Context: map[string]interface{}{"project_title": "长夜"}}
+
+	// 调试时的消息与执行时发送给模型的消息一致
+	messages, err := engine.AgentMessages("agent_1_narrator", agentReq)
+	require.NoError(t, err)
+	_, err = engine.ExecuteAgent(context.Background(), "agent_1_narrator", agentReq)
+	require.NoError(t, err)
+	require.Len(t, provider.requests, 1)
+	assert.Equal(t, provider.requests[0].Messages, messages)
+
+	build := func(userPrompt string) ([]prompt.InspectedMessage, error) {
+		req := *agentReq
+		req.Prompt = userPrompt
+		chat, err := engine.AgentMessages("agent_3_reviewer", &req)
+		if err != nil {
+			return nil, err
+		}
+		inspected := make([]prompt.InspectedMessage, len(chat))
+		for i, msg := range chat {
+			inspected[i] = prompt.InspectedMessage{Role: msg.Role, Content: msg.Content}
+		}
+		return inspected, nil
+	}
+	inspection, err := prompt.NewPromptService(8000).InspectAgentPrompt(context.Background(), "你是审核导演", "请审核", &prompt.PromptOptions{
+		KnowledgeItems: map[string][]string{"rag": {"城门在子时关闭。"}},
+	}, build)
+	require.NoError(t, err)
+
+	require.Len(t, inspection.Messages, 2)
+	system, user := inspection.Messages[0], inspection.Messages[1]
+	assert.True(t, strings.HasPrefix(system.Content, "你是审核导演"))
+	assert.Contains(t, system.Content, "JSON Schema")
+	assert.True(t, strings.HasSuffix(system.Content, guard.DataBlockInstruction))
+	assert.Contains(t, user.Content, "### 参考知识 - rag")
+	assert.Contains(t, user.Content, `<user_data label="context">`)
+	assert.Positive(t, system.Tokens)
+	assert.Positive(t, user.Tokens)
+}
@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/prompt"
+	"github.com/zibianqu/novel-study/internal/ai/tokenizer"
+)
+
+// fakeSummarizer 返回固定摘要并记录调用次数
+type fakeSummarizer struct {
+	calls int
+	err   error
+}
+
+func (s *fakeSummarizer) Summarize(ctx context.Context, content string, maxTokens int) (string, error) {
+	s.calls++
+	if s.err != nil {
+		return "", s.err
+	}
+	return "主角离开师门，途中结识同伴。", nil
+}
+
+func newOverflowingBuilder() *prompt.PromptBuilder {
+	builder := prompt.NewPromptBuilder(600).SetTokenCounter(&tokenizer.Estimator{Encoding: tokenizer.O200KBase})
+	builder.SetSystemPrompt("你是小说作者")
+	builder.SetUserPrompt("请续写")
+	builder.AddRecentContent(strings.Repeat("夜色渐深，城门已闭。", 40), 5000)
+	builder.AddKnowledgeBase([]string{strings.Repeat("宗门往事，代代相传。", 60)}, "history")
+	return builder
+}
+
+func sectionStatus(report *prompt.BuildReport, name string) string {
+	for _, section := range report.Sections {
+		if section.Name == name {
+			return section.Status
+		}
+	}
+	return ""
+}
+
+func TestPromptBuilder_SummarizesLowPrioritySections(t *testing.T) {
+	summarizer := &fakeSummarizer{}
+	cache := prompt.NewContextCache()
+
+	result, report := newOverflowingBuilder().SetSummarizer(summarizer, cache).BuildWithReport(context.Background())
+
+	assert.Equal(t, 1, summarizer.calls)
+	assert.Equal(t, []string{"knowledge_history"}, report.Summarized())
+	assert.Equal(t, prompt.SectionVerbatim, sectionStatus(report, "recent_content"))
+	assert.Contains(t, result, "### 参考知识 - history（摘要）\n<user_data label=\"knowledge_history\">\n主角离开师门")
+	assert.Contains(t, result, strings.Repeat("夜色渐深，城门已闭。", 40))
+	assert.LessOrEqual(t, report.TotalTokens, 600)
+
+	// 相同内容再次构建时使用缓存的摘要
+	_, report = newOverflowingBuilder().SetSummarizer(summarizer, cache).BuildWithReport(context.Background())
+	assert.Equal(t, 1, summarizer.calls)
+	assert.True(t, report.Sections[1].Cached)
+}
+
+func TestPromptBuilder_FallsBackToTruncationWhenSummarizerFails(t *testing.T) {
+	summarizer := &fakeSummarizer{err: errors.New("provider unavailable")}
+
+	result, report := newOverflowingBuilder().SetSummarizer(summarizer, nil).BuildWithReport(context.Background())
+	require.Equal(t, 2, summarizer.calls)
+
+	assert.Empty(t, report.Summarized())
+	assert.Equal(t, prompt.SectionTruncated, sectionStatus(report, "knowledge_history"))
+	assert.Contains(t, result, "...")
+}
+
+func TestPromptBuilder_KeepsSectionsVerbatimWithinBudget(t *testing.T) {
+	summarizer := &fakeSummarizer{}
+	builder := prompt.NewPromptBuilder(4000).SetSummarizer(summarizer, nil)
+	builder.AddRecentContent("天色渐晚。", 100)
+
+	_, report := builder.BuildWithReport(context.Background())
+	assert.Zero(t, summarizer.calls)
+	assert.Equal(t, prompt.SectionVerbatim, sectionStatus(report, "recent_content"))
+}
+
+func TestPromptService_UsesSummarizerFromOptions(t *testing.T) {
+	service := prompt.NewPromptService(600)
+	newOptions := func(summarizer prompt.Summarizer) *prompt.PromptOptions {
+		return &prompt.PromptOptions{
+			RecentContent:       strings.Repeat("夜色渐深，城门已闭。", 40),
+			RecentContentMaxLen: 5000,
+			KnowledgeItems:      map[string][]string{"history": {strings.Repeat("宗门往事，代代相传。", 60)}},
+			Summarizer:          summarizer,
+		}
+	}
+
+	summarizer := &fakeSummarizer{}
+	inspection, err := service.InspectAgentPrompt(context.Background(), "你是小说作者", "请续写", newOptions(summarizer), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, summarizer.calls)
+	assert.Equal(t, []string{"knowledge_history"}, inspection.Summarized)
+
+	// 摘要器只对传入它的请求生效，其他请求仍然截断
+	inspection, err = service.InspectAgentPrompt(context.Background(), "你是小说作者", "请续写", newOptions(nil), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, summarizer.calls)
+	assert.Empty(t, inspection.Summarized)
+}
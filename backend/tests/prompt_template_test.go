@@ -0,0 +1,34 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/prompt"
+)
+
+func TestParseTemplate_CollectsTopLevelVariables(t *testing.T) {
+	tmpl, err := prompt.ParseTemplate("agent.agent_3_narrative", `你正在创作《{{.project_title}}》。
+{{if .genre}}类型：{{.genre}}{{end}}
+{{range .characters}}- {{.name}}{{end}}
+{{with .style}}文风：{{.tone}}{{end}}`)
+	require.NoError(t, err)
+
+	// range/with 内部的字段属于子对象，不是顶层变量
+	assert.Equal(t, []string{"characters", "genre", "project_title", "style"}, tmpl.Variables())
+}
+
+func TestTemplate_RenderTreatsMissingVariablesAsEmpty(t *testing.T) {
+	tmpl, err := prompt.ParseTemplate("greeting", "你正在创作《{{.project_title}}》{{.extra}}。")
+	require.NoError(t, err)
+
+	result, err := tmpl.Render(map[string]interface{}{"project_title": "长夜"})
+	require.NoError(t, err)
+	assert.Equal(t, "你正在创作《长夜》。", result)
+}
+
+func TestParseTemplate_RejectsInvalidSyntax(t *testing.T) {
+	_, err := prompt.ParseTemplate("broken", "你好 {{.name")
+	assert.Error(t, err)
+}
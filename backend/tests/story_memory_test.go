@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/prompt"
+)
+
+func TestPromptService_ContinueWriteUsesLongRangeMemory(t *testing.T) {
+	service := prompt.NewPromptService(8000)
+	recent := strings.Repeat("林远推开城门。", 400)
+
+	result, err := service.BuildContinueWritePrompt(context.Background(), "你是小说作者", &prompt.ContinueWriteOptions{
+		Context:     recent,
+		FullContext: true,
+		ChapterSummaries: []prompt.StorySummary{
+			{Title: "第3章 夜雨", Summary: "林远在雨夜遇袭，被师姐所救。"},
+			{Title: "第4章 出山", Summary: "林远辞别师门。"},
+		},
+		VolumeSummaries: []prompt.StorySummary{
+			{Title: "第一卷 少年", Summary: "林远拜入青云门。"},
+		},
+		ProjectSummary: "少年林远踏上修行之路。",
+	})
+	require.NoError(t, err)
+
+	// 完整保留最近一章，而不是只截取末尾 2000 字
+	assert.Contains(t, result, recent)
+	assert.Contains(t, result, "### 前情提要\n**第3章 夜雨**: 林远在雨夜遇袭，被师姐所救。\n**第4章 出山**: 林远辞别师门。\n")
+	assert.Contains(t, result, "### 故事梗概\n少年林远踏上修行之路。\n**第一卷 少年**: 林远拜入青云门。\n")
+
+	// 依次为最近章节、前几章摘要、卷级摘要
+	recentAt := strings.Index(result, "### 前文内容")
+	chaptersAt := strings.Index(result, "### 前情提要")
+	volumesAt := strings.Index(result, "### 故事梗概")
+	assert.True(t, recentAt < chaptersAt && chaptersAt < volumesAt)
+}
+
+func TestPromptService_ContinueWriteKeepsTailWithoutFullContext(t *testing.T) {
+	service := prompt.NewPromptService(8000)
+	recent := strings.Repeat("甲", 1000) + strings.Repeat("乙", 2000)
+
+	result, err := service.BuildContinueWritePrompt(context.Background(), "", &prompt.ContinueWriteOptions{Context: recent})
+	require.NoError(t, err)
+
+	assert.NotContains(t, result, "甲")
+	assert.Contains(t, result, "..."+strings.Repeat("乙", 2000))
+	assert.NotContains(t, result, "### 前情提要")
+}
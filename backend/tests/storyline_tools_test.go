@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/tools"
+	"github.com/zibianqu/novel-study/internal/repository"
+)
+
+// storylineDriver 测试用数据库驱动：SELECT 返回属于项目 1 的三线，UPDATE 记录执行次数
+type storylineDriver struct {
+	mu      sync.Mutex
+	updates int
+}
+
+func (d *storylineDriver) Open(string) (driver.Conn, error) { return &storylineConn{driver: d}, nil }
+
+type storylineConn struct{ driver *storylineDriver }
+
+func (c *storylineConn) Prepare(query string) (driver.Stmt, error) {
+	return &storylineStmt{driver: c.driver, query: strings.TrimSpace(query)}, nil
+}
+func (c *storylineConn) Close() error              { return nil }
+func (c *storylineConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type storylineStmt struct {
+	driver *storylineDriver
+	query  string
+}
+
+func (s *storylineStmt) Close() error  { return nil }
+func (s *storylineStmt) NumInput() int { return -1 }
+func (s *storylineStmt) Exec([]driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+func (s *storylineStmt) Query([]driver.Value) (driver.Rows, error) {
+	now := time.Now()
+	if strings.HasPrefix(s.query, "UPDATE") {
+		s.driver.mu.Lock()
+		s.driver.updates++
+		s.driver.mu.Unlock()
+		return &staticRows{columns: []string{"updated_at"}, values: [][]driver.Value{{now}}}, nil
+	}
+	return &staticRows{
+		columns: []string{"id", "project_id", "line_type", "title", "content", "chapter_range", "status", "sort_order", "parent_id", "created_at", "updated_at"},
+		values:  [][]driver.Value{{int64(5), int64(1), "skyline", "天线", "旧内容", "", "planned", int64(0), nil, now, now}},
+	}, nil
+}
+
+// staticRows 依次返回固定的数据行
+type staticRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *staticRows) Columns() []string { return r.columns }
+func (r *staticRows) Close() error      { return nil }
+func (r *staticRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+var stubStoryline = &storylineDriver{}
+
+func init() {
+	sql.Register("storyline-stub", stubStoryline)
+}
+
+func TestUpdateStorylineTool_RejectsOtherProjects(t *testing.T) {
+	db, err := sql.Open("storyline-stub", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	registry := tools.NewToolRegistry(&recordingLogger{})
+	registry.Register(tools.NewUpdateStorylineTool(repository.NewStorylineRepository(db)))
+
+	// 三线属于项目 1，从项目 2 修改时拒绝
+	_, err = registry.Execute(context.Background(), 1, "update_storyline", map[string]interface{}{
+		"storyline_id": 5, "project_id": 2, "content": "篡改",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found in project 2")
+	assert.Zero(t, stubStoryline.updates)
+
+	// 缺少 project_id 时不执行
+	_, err = registry.Execute(context.Background(), 1, "update_storyline", map[string]interface{}{
+		"storyline_id": 5, "content": "篡改",
+	})
+	require.Error(t, err)
+	assert.Zero(t, stubStoryline.updates)
+
+	result, err := registry.Execute(context.Background(), 1, "update_storyline", map[string]interface{}{
+		"storyline_id": 5, "project_id": 1, "content": "新内容",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, true, result.(map[string]interface{})["success"])
+	assert.Equal(t, 1, stubStoryline.updates)
+}
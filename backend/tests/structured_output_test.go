@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/agents"
+	"github.com/zibianqu/novel-study/internal/ai/collaboration"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/ai/tools"
+)
+
+func TestParseQualityReview_FencedJSON(t *testing.T) {
+	content := "```json\n{\"total_score\": 72, \"dimensions\": {\"logic\": 80, \"plot\": 65}, \"passed\": false, " +
+		"\"issues\": [\"节奏拖沓\"], \"suggestions\": [\"删减第二段\"], \"revision_guide\": \"压缩铺垫\"}\n```"
+
+	review, err := collaboration.ParseQualityReview(content)
+	require.NoError(t, err)
+
+	feedback := review.Feedback()
+	assert.False(t, feedback.Approved)
+	assert.Equal(t, 72.0, feedback.Score)
+	assert.Equal(t, 65.0, feedback.Dimensions["plot"])
+	assert.Equal(t, []string{"节奏拖沓"}, feedback.Issues)
+	assert.Equal(t, []string{"删减第二段"}, feedback.Suggestions)
+	assert.Equal(t, "压缩铺垫", feedback.Comments)
+}
+
+func TestParseQualityReview_RequiresTotalScore(t *testing.T) {
+	_, err := collaboration.ParseQualityReview(`{"passed": true, "suggestions": []}`)
+	assert.Error(t, err)
+
+	_, err = collaboration.ParseQualityReview("内容很好，通过")
+	assert.Error(t, err)
+}
+
+// repairStreamProvider 第一次输出不符合 Schema 的内容，修正后输出合法 JSON
+type repairStreamProvider struct {
+	calls int
+}
+
+func (p *repairStreamProvider) CreateCompletion(ctx context.Context, req *llm.CompletionRequest) (*llm.CompletionResponse, error) {
+	return p.CreateCompletionStream(ctx, req, func(string) {})
+}
+
+func (p *repairStreamProvider) CreateCompletionStream(ctx context.Context, req *llm.CompletionRequest, onDelta func(string)) (*llm.CompletionResponse, error) {
+	p.calls++
+	content := "评分：八分"
+	if p.calls > 1 {
+		content = "```json\n{\"score\": \"8\"}\n```"
+	}
+	onDelta(content)
+	return &llm.CompletionResponse{Content: content, Model: req.Model}, nil
+}
+
+func TestParseStructuredOutput_SharesJSONExtraction(t *testing.T) {
+	schema := tools.ObjectSchema(map[string]*tools.Schema{"score": {Type: "integer"}}, "score")
+
+	obj, err := agents.ParseStructuredOutput("结果如下：\n```json\n{\"score\": 7}\n```", schema)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"score": 7}, obj)
+
+	_, err = agents.ParseStructuredOutput("没有 JSON", schema)
+	assert.Error(t, err)
+
+	object, ok := llm.ExtractJSONObject("  前言 {\"a\": {\"b\": 1}} 后记 ")
+	assert.True(t, ok)
+	assert.Equal(t, `{"a": {"b": 1}}`, object)
+}
+
+func TestBaseAgent_StreamBuffersStructuredOutputUntilValid(t *testing.T) {
+	provider := &repairStreamProvider{}
+	agent := agents.NewBaseAgent(&llm.AgentConfig{
+		AgentKey:     "agent_test",
+		SystemPrompt: "你是评分助手",
+		Model:        "gpt-4o-mini",
+		OutputSchema: tools.ObjectSchema(map[string]*tools.Schema{"score": {Type: "integer"}}, "score"),
+	}, provider, tools.NewToolRegistry(&recordingLogger{}), 99)
+
+	var chunks []string
+	resp, err := agent.ExecuteStream(context.Background(), &llm.AgentRequest{Prompt: "给这一章打分"}, func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, provider.calls)
+
+	// 不符合 Schema 的首轮输出不推送，只输出校验后的 JSON
+	assert.Equal(t, []string{`{"score":8}`}, chunks)
+	assert.Equal(t, `{"score":8}`, resp.Content)
+	assert.Equal(t, map[string]interface{}{"score": 8}, resp.Structured)
+}
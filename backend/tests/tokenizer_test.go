@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/prompt"
+	"github.com/zibianqu/novel-study/internal/ai/tokenizer"
+)
+
+// byteRanks 构造包含全部单字节的测试词表，merges 依次追加为更高的 rank
+func byteRanks(merges ...string) map[string]int {
+	ranks := make(map[string]int, 256+len(merges))
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	for i, m := range merges {
+		ranks[m] = 256 + i
+	}
+	return ranks
+}
+
+func TestEncoding_SplitMatchesTiktokenPatterns(t *testing.T) {
+	cl100k, err := tokenizer.NewEncoding(tokenizer.CL100KBase, byteRanks())
+	require.NoError(t, err)
+	o200k, err := tokenizer.NewEncoding(tokenizer.O200KBase, byteRanks())
+	require.NoError(t, err)
+
+	tests := []struct {
+		text   string
+		cl100k []string
+		o200k  []string
+	}{
+		{"Hello world", []string{"Hello", " world"}, []string{"Hello", " world"}},
+		{"I'm fine", []string{"I", "'m", " fine"}, []string{"I'm", " fine"}},
+		{"HelloWorld", []string{"HelloWorld"}, []string{"Hello", "World"}},
+		{"12345", []string{"123", "45"}, []string{"123", "45"}},
+		{"a  b", []string{"a", " ", " b"}, []string{"a", " ", " b"}},
+		{"hi!!\n\nthere", []string{"hi", "!!\n\n", "there"}, []string{"hi", "!!\n\n", "there"}},
+		{"你好，世界", []string{"你好", "，世界"}, []string{"你好", "，世界"}},
+		{"end  ", []string{"end", "  "}, []string{"end", "  "}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.cl100k, cl100k.Split(tt.text), "cl100k: %q", tt.text)
+		assert.Equal(t, tt.o200k, o200k.Split(tt.text), "o200k: %q", tt.text)
+	}
+}
+
+func TestEncoding_BytePairMergeOrder(t *testing.T) {
+	enc, err := tokenizer.NewEncoding(tokenizer.CL100KBase, byteRanks("ab", "bc", "abc", "cd"))
+	require.NoError(t, err)
+
+	// 先合并优先级最高的 ab，再合并 abc
+	assert.Equal(t, []int{258}, enc.Encode("abc"))
+	// ab 合并后 bc 失效，abc 的优先级高于 cd
+	assert.Equal(t, []int{258, 'd'}, enc.Encode("abcd"))
+	// 没有可用合并时按字节输出，中文每字 3 个字节
+	assert.Equal(t, 6, enc.Count("你好"))
+	assert.Equal(t, 0, enc.Count(""))
+}
+
+func TestParseRanks(t *testing.T) {
+	ranks, err := tokenizer.ParseRanks([]byte("IQ== 0\nIg== 1\naGVsbG8= 2\n"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"!": 0, "\"": 1, "hello": 2}, ranks)
+
+	_, err = tokenizer.ParseRanks([]byte("not-base64! 0\n"))
+	assert.Error(t, err)
+}
+
+func TestEncodingForModel(t *testing.T) {
+	assert.Equal(t, tokenizer.O200KBase, tokenizer.EncodingForModel("gpt-4o-mini"))
+	assert.Equal(t, tokenizer.O200KBase, tokenizer.EncodingForModel("backup:gpt-4o"))
+	assert.Equal(t, tokenizer.CL100KBase, tokenizer.EncodingForModel("gpt-4"))
+	assert.Equal(t, tokenizer.CL100KBase, tokenizer.EncodingForModel("gpt-3.5-turbo"))
+	assert.Equal(t, tokenizer.CL100KBase, tokenizer.EncodingForModel("local:qwen2.5"))
+}
+
+func TestEstimator_MixedChineseAndEnglish(t *testing.T) {
+	estimator := &tokenizer.Estimator{Encoding: tokenizer.CL100KBase}
+
+	// 英文按单词计数，而不是按字符数折算
+	english := strings.Repeat("the quick brown fox ", 50)
+	assert.InDelta(t, 200, estimator.Count(english), 20)
+
+	// 汉字在 cl100k 中多于一个 Token，o200k 中少于一个
+	chinese := strings.Repeat("天色渐晚", 25)
+	assert.Greater(t, estimator.Count(chinese), 100)
+	assert.Less(t, (&tokenizer.Estimator{Encoding: tokenizer.O200KBase}).Count(chinese), 100)
+}
+
+func TestPromptBuilder_TruncatesSectionWithinBudget(t *testing.T) {
+	counter := &tokenizer.Estimator{Encoding: tokenizer.O200KBase}
+	builder := prompt.NewPromptBuilder(300).SetTokenCounter(counter)
+	builder.SetSystemPrompt("你是小说作者")
+	builder.SetUserPrompt("请续写")
+	builder.AddSection("writing_guidelines", "### 写作要求\n保持第三人称\n", 10)
+	builder.AddRecentContent(strings.Repeat("夜色渐深，城门已闭。", 200), 5000)
+
+	result := builder.Build()
+	assert.Contains(t, result, "保持第三人称")
+	assert.Contains(t, result, "...")
+	assert.LessOrEqual(t, counter.Count(result), 300+10)
+}
+
+func TestForModel_CountsMatchTiktoken(t *testing.T) {
+	// 词表已嵌入，不应退回到估算
+	_, estimated := tokenizer.ForModel("gpt-4").(*tokenizer.Estimator)
+	require.False(t, estimated, "cl100k_base 词表未嵌入")
+	_, estimated = tokenizer.ForModel("gpt-4o").(*tokenizer.Estimator)
+	require.False(t, estimated, "o200k_base 词表未嵌入")
+
+	cl100k, err := tokenizer.GetEncoding(tokenizer.CL100KBase)
+	require.NoError(t, err)
+	o200k, err := tokenizer.GetEncoding(tokenizer.O200KBase)
+	require.NoError(t, err)
+
+	// 与 tiktoken 官方实现的输出一致
+	assert.Equal(t, []int{15339, 1917}, cl100k.Encode("hello world"))
+	assert.Equal(t, []int{83, 1609, 5963, 374, 2294, 0}, cl100k.Encode("tiktoken is great!"))
+	assert.Equal(t, []int{24912, 2375}, o200k.Encode("hello world"))
+	assert.Equal(t, []int{83, 8251, 2488, 382, 2212, 0}, o200k.Encode("tiktoken is great!"))
+
+	tests := []struct {
+		text   string
+		cl100k int
+		o200k  int
+	}{
+		{"天色渐晚，城门已闭。", 12, 10},
+		{"I'm fine, thanks.\n\n  12345 HelloWorld", 11, 11},
+		{"林动握紧拳头，低声道：“三年之约，我一定会赢。”", 28, 20},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.cl100k, tokenizer.ForModel("gpt-4").Count(tt.text), "cl100k: %q", tt.text)
+		assert.Equal(t, tt.o200k, tokenizer.ForModel("gpt-4o").Count(tt.text), "o200k: %q", tt.text)
+	}
+}
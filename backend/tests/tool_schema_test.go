@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/tools"
+)
+
+func searchSchema() *tools.Schema {
+	return tools.ObjectSchema(map[string]*tools.Schema{
+		"query":      tools.StringParam("搜索查询"),
+		"project_id": tools.IntegerParam("项目ID"),
+		"top_k":      tools.IntegerParam("返回数量").WithDefault(3).WithRange(1, 20),
+		"mode":       tools.StringParam("模式", "fast", "exact"),
+	}, "query", "project_id")
+}
+
+func TestSchema_ValidateCoercesArguments(t *testing.T) {
+	params, err := searchSchema().Validate(map[string]interface{}{
+		"query":      "主角",
+		"project_id": float64(7),
+		"mode":       "exact",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 7, params["project_id"])
+	assert.Equal(t, 3, params["top_k"], "缺省参数填充默认值")
+	assert.Equal(t, "exact", params["mode"])
+
+	// 字符串形式的数字也会被转换
+	params, err = searchSchema().Validate(map[string]interface{}{
+		"query":      "主角",
+		"project_id": "12",
+		"top_k":      json.Number("5"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 12, params["project_id"])
+	assert.Equal(t, 5, params["top_k"])
+}
+
+func TestSchema_ValidateRejectsMalformedArguments(t *testing.T) {
+	_, err := searchSchema().Validate(map[string]interface{}{
+		"project_id": 1.5,
+		"top_k":      float64(50),
+		"mode":       "slow",
+		"unknown":    true,
+	})
+	require.Error(t, err)
+
+	var validationErr *tools.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []string{
+		"query: missing required parameter",
+		"mode: must be one of [fast, exact], got slow",
+		"project_id: expected integer, got number",
+		"top_k: must be <= 20, got 50",
+		"unknown: unknown parameter",
+	}, validationErr.Problems)
+}
+
+// countingTool 记录执行次数的测试工具
+type countingTool struct {
+	calls int
+}
+
+func (t *countingTool) GetName() string        { return "counting" }
+func (t *countingTool) GetDescription() string { return "计数工具" }
+func (t *countingTool) GetParameters() *tools.Schema {
+	return searchSchema()
+}
+func (t *countingTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	t.calls++
+	return params["top_k"], nil
+}
+
+func TestToolRegistry_ExecuteValidatesBeforeRunning(t *testing.T) {
+	tool := &countingTool{}
+	registry := tools.NewToolRegistry(nil)
+	registry.Register(tool)
+
+	_, err := registry.Execute(context.Background(), 1, "counting", map[string]interface{}{"query": "主角"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid arguments for tool counting")
+	assert.Contains(t, err.Error(), "project_id: missing required parameter")
+	assert.Equal(t, 0, tool.calls)
+
+	result, err := registry.Execute(context.Background(), 1, "counting", map[string]interface{}{"query": "主角", "project_id": float64(1)})
+	require.NoError(t, err)
+	assert.Equal(t, 3, result)
+	assert.Equal(t, 1, tool.calls)
+}
+
+func TestToolRegistry_ListToolsIncludesSchemas(t *testing.T) {
+	registry := tools.NewToolRegistry(nil)
+	registry.Register(&countingTool{})
+	registry.Register(&echoTool{})
+
+	list := registry.ListTools()
+	require.Len(t, list, 2)
+	assert.Equal(t, "counting", list[0].Name)
+	assert.Equal(t, "echo", list[1].Name)
+
+	data, err := json.Marshal(list[0].Parameters)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"query": {"type": "string", "description": "搜索查询"},
+			"project_id": {"type": "integer", "description": "项目ID"},
+			"top_k": {"type": "integer", "description": "返回数量", "default": 3, "minimum": 1, "maximum": 20},
+			"mode": {"type": "string", "description": "模式", "enum": ["fast", "exact"]}
+		},
+		"required": ["query", "project_id"],
+		"additionalProperties": false
+	}`, string(data))
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/agents"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/ai/openai"
+	"github.com/zibianqu/novel-study/internal/util"
+)
+
+func TestBaseAgent_UsesProviderFromContext(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"model": "gpt-4o",
+			"choices": []map[string]interface{}{
+				{"index": 0, "message": map[string]string{"role": "assistant", "content": "好的"}, "finish_reason": "stop"},
+			},
+			"usage": map[string]int{"prompt_tokens": 5, "completion_tokens": 2, "total_tokens": 7},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	// 未配置系统密钥时，使用上下文中用户自己的密钥
+	agent := agents.NewBaseAgent(&llm.AgentConfig{
+		AgentKey:     "agent_0_director",
+		Name:         "总导演",
+		SystemPrompt: "你是总导演",
+		Model:        "gpt-4o",
+	}, nil, nil, 0)
+
+	ctx := llm.WithProvider(context.Background(), openai.NewClientWithBaseURL("user-key", server.URL+"/v1"))
+	resp, err := agent.Execute(ctx, &llm.AgentRequest{Prompt: "你好"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "好的", resp.Content)
+	assert.Equal(t, "Bearer user-key", authorization)
+}
+
+func TestOpenAIClient_VerifyDoesNotLeakKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/models", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]string{"message": "Incorrect API key provided: sk-secret-value", "type": "invalid_request_error"},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	err := openai.NewClientWithBaseURL("sk-secret-value", server.URL+"/v1").Verify(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "401")
+	assert.NotContains(t, err.Error(), "sk-secret-value")
+}
+
+func TestEncryptAPIKey_RoundTrip(t *testing.T) {
+	key := "0123456789abcdef0123456789abcdef"
+	encrypted, err := util.EncryptAPIKey("sk-test-123", key)
+	require.NoError(t, err)
+	assert.NotContains(t, encrypted, "sk-test-123")
+
+	decrypted, err := util.DecryptAPIKey(encrypted, key)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-test-123", decrypted)
+
+	// 每次加密使用随机 nonce，密文不同
+	again, err := util.EncryptAPIKey("sk-test-123", key)
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, again)
+}
+
+func TestDecryptAPIKey_RejectsWrongKey(t *testing.T) {
+	encrypted, err := util.EncryptAPIKey("sk-test-123", "0123456789abcdef0123456789abcdef")
+	require.NoError(t, err)
+
+	_, err = util.DecryptAPIKey(encrypted, "fedcba9876543210fedcba9876543210")
+	assert.Error(t, err)
+
+	_, err = util.DecryptAPIKey("c2hvcnQ=", "0123456789abcdef0123456789abcdef")
+	assert.Error(t, err)
+}
@@ -0,0 +1,391 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/collaboration"
+)
+
+const editorPipelineYAML = `
+name: 编辑流水线
+description: 草稿 → 对话 → 润色 → 审核
+tasks:
+  - id: draft
+    agent: narrator
+  - id: dialogue
+    agent: character
+    input: "为以下草稿补充对话：\n{{tasks.draft.output}}"
+  - id: polish
+    agent: narrator
+    type: revise
+    input: "润色：{{tasks.dialogue.output}}"
+    review:
+      reviewer: reviewer
+      max_iterations: 2
+`
+
+var testAgentKeys = map[string]bool{"narrator": true, "character": true, "reviewer": true}
+
+func resolveTestAgent(key string) (string, error) {
+	if testAgentKeys[key] {
+		return key, nil
+	}
+	return "", fmt.Errorf("agent %s not found", key)
+}
+
+func TestParseWorkflowDefinition_YAMLAndJSON(t *testing.T) {
+	def, err := collaboration.ParseWorkflowDefinition(editorPipelineYAML, "")
+	require.NoError(t, err)
+	assert.Equal(t, "编辑流水线", def.Name)
+	assert.Len(t, def.Tasks, 3)
+	assert.Equal(t, []string{"narrator", "character", "reviewer"}, def.AgentKeys())
+
+	jsonDef := `{"name": "单步", "tasks": [{"id": "draft", "agent": "narrator"}]}`
+	def, err = collaboration.ParseWorkflowDefinition(jsonDef, "")
+	require.NoError(t, err)
+	assert.Equal(t, "单步", def.Name)
+	assert.Equal(t, collaboration.DefinitionJSON, collaboration.DefinitionFormat(jsonDef, ""))
+}
+
+func TestParseWorkflowDefinition_RejectsInvalidDefinitions(t *testing.T) {
+	cases := map[string]string{
+		"unknown field":       "name: x\ntasks:\n  - id: a\n    agnet: narrator\n",
+		"missing name":        "tasks:\n  - id: a\n    agent: narrator\n",
+		"no tasks":            "name: x\ntasks: []\n",
+		"missing agent":       "name: x\ntasks:\n  - id: a\n",
+		"invalid task id":     "name: x\ntasks:\n  - id: 1a\n    agent: narrator\n",
+		"duplicate task":      "name: x\ntasks:\n  - id: a\n    agent: narrator\n  - id: a\n    agent: narrator\n",
+		"unknown dependency":  "name: x\ntasks:\n  - id: a\n    agent: narrator\n    depends_on: [b]\n",
+		"unknown output ref":  "name: x\ntasks:\n  - id: a\n    agent: narrator\n    input: '{{tasks.b.output}}'\n",
+		"unknown placeholder": "name: x\ntasks:\n  - id: a\n    agent: narrator\n    input: '{{chapter}}'\n",
+		"cycle":               "name: x\ntasks:\n  - id: a\n    agent: narrator\n    input: '{{tasks.b.output}}'\n  - id: b\n    agent: narrator\n    depends_on: [a]\n",
+		"missing reviewer":    "name: x\ntasks:\n  - id: a\n    agent: narrator\n    review:\n      min_score: 90\n",
+		"bad failure policy":  "name: x\nfailure_policy: retry\ntasks:\n  - id: a\n    agent: narrator\n",
+	}
+	for name, source := range cases {
+		_, err := collaboration.ParseWorkflowDefinition(source, "")
+		assert.Error(t, err, name)
+	}
+}
+
+func TestWorkflowDefinition_Build(t *testing.T) {
+	def, err := collaboration.ParseWorkflowDefinition(editorPipelineYAML, collaboration.DefinitionYAML)
+	require.NoError(t, err)
+
+	workflow, err := def.Build("主角初到京城", map[string]interface{}{"project_id": 1}, resolveTestAgent)
+	require.NoError(t, err)
+	require.Len(t, workflow.Tasks, 3)
+
+	draft, dialogue, polish := workflow.Tasks[0], workflow.Tasks[1], workflow.Tasks[2]
+	assert.Equal(t, "主角初到京城", draft.Input)
+	assert.Equal(t, "generate", draft.Type)
+	assert.Equal(t, "character", dialogue.AgentKey)
+	assert.Equal(t, []string{"draft"}, dialogue.DependsOn)
+	assert.Equal(t, []string{"dialogue"}, polish.DependsOn)
+	require.NotNil(t, polish.Review)
+	assert.Equal(t, "reviewer", polish.Review.ReviewerKey)
+	assert.Equal(t, 2, polish.Review.MaxIterations)
+	assert.Equal(t, 80.0, polish.Review.MinScore)
+
+	_, err = def.Build("", nil, func(key string) (string, error) {
+		if key == "reviewer" {
+			return "", fmt.Errorf("agent %s not found", key)
+		}
+		return key, nil
+	})
+	assert.Error(t, err)
+}
+
+func TestScheduler_RunsDefinitionWithReviewLoop(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		inputs = make(map[string][]string)
+	)
+	reviews := 0
+	executor := collaboration.AgentExecutorFunc(func(ctx context.Context, agent collaboration.AgentRef, input string, _ map[string]interface{}) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		inputs[agent.Key] = append(inputs[agent.Key], input)
+
+		switch agent.Key {
+		case "narrator":
+			if strings.HasPrefix(input, "请根据以下反馈修改内容") {
+				return "润色修改稿", nil
+			}
+			if strings.HasPrefix(input, "润色") {
+				return "润色稿", nil
+			}
+			return "草稿", nil
+		case "character":
+			return "带对话的草稿", nil
+		default:
+			// 第一次审核不通过，第二次通过
+			reviews++
+			if reviews == 1 {
+				return `{"total_score": 60, "passed": false, "issues": ["节奏拖沓"]}`, nil
+			}
+			return `{"total_score": 88, "passed": true}`, nil
+		}
+	})
+
+	def, err := collaboration.ParseWorkflowDefinition(editorPipelineYAML, "")
+	require.NoError(t, err)
+	workflow, err := def.Build("主角初到京城", map[string]interface{}{}, resolveTestAgent)
+	require.NoError(t, err)
+
+	result, err := collaboration.NewScheduler(executor).ExecuteWorkflow(context.Background(), workflow)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	// 上游输出替换到输入模板中
+	assert.Equal(t, []string{"为以下草稿补充对话：\n草稿"}, inputs["character"])
+	assert.Contains(t, inputs["narrator"], "润色：带对话的草稿")
+
+	// 审核不通过后修改，最终结果为通过审核的修改稿
+	assert.Equal(t, 2, reviews)
+	assert.Equal(t, "润色修改稿", result.FinalContent)
+}
+
+// eventCollector 收集调度器推送的运行事件
+type eventCollector struct {
+	mu     sync.Mutex
+	events []*collaboration.RunEvent
+}
+
+func (c *eventCollector) OnRunEvent(event *collaboration.RunEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, event)
+}
+
+func (c *eventCollector) ofType(eventType string) []*collaboration.RunEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var events []*collaboration.RunEvent
+	for _, e := range c.events {
+		if e.Type == eventType {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func TestScheduler_EmitsRunEvents(t *testing.T) {
+	reviews := 0
+	executor := collaboration.AgentExecutorFunc(func(ctx context.Context, agent collaboration.AgentRef, input string, _ map[string]interface{}) (string, error) {
+		if agent.Key == "reviewer" {
+			reviews++
+			if reviews == 1 {
+				return `{"total_score": 55, "passed": false, "issues": ["对话生硬"]}`, nil
+			}
+			return `{"total_score": 90, "passed": true}`, nil
+		}
+		// 有订阅者时按片段输出
+		if callback := collaboration.OutputCallback(ctx); callback != nil {
+			callback("片段1")
+			callback("片段2")
+		}
+		return "片段1片段2", nil
+	})
+
+	def, err := collaboration.ParseWorkflowDefinition(editorPipelineYAML, "")
+	require.NoError(t, err)
+	workflow, err := def.Build("开篇", map[string]interface{}{}, resolveTestAgent)
+	require.NoError(t, err)
+
+	scheduler := collaboration.NewScheduler(executor)
+	collector := &eventCollector{}
+	scheduler.SetObserver(collector)
+	_, err = scheduler.ExecuteWorkflow(context.Background(), workflow)
+	require.NoError(t, err)
+
+	// 每个任务开始与结束各一次，最后一个事件时全部任务已结束
+	statuses := collector.ofType(collaboration.EventTaskStatus)
+	require.Len(t, statuses, 6)
+	last := statuses[len(statuses)-1]
+	assert.Equal(t, "polish", last.TaskID)
+	assert.Equal(t, collaboration.TaskCompleted, last.Status)
+	assert.Equal(t, 3, last.Finished)
+	assert.Equal(t, 3, last.Total)
+
+	outputs := collector.ofType(collaboration.EventTaskOutput)
+	assert.NotEmpty(t, outputs)
+	assert.Equal(t, "draft", outputs[0].TaskID)
+	assert.Equal(t, "片段1", outputs[0].Chunk)
+
+	reviewEvents := collector.ofType(collaboration.EventReview)
+	require.Len(t, reviewEvents, 2)
+	assert.Equal(t, 1, reviewEvents[0].Iteration)
+	assert.Equal(t, 55.0, reviewEvents[0].Score)
+	assert.False(t, reviewEvents[0].Approved)
+	assert.Equal(t, []string{"对话生硬"}, reviewEvents[0].Issues)
+	assert.Equal(t, 90.0, reviewEvents[1].Score)
+	assert.True(t, reviewEvents[1].Approved)
+}
+
+func TestScheduler_RecordsTaskUsage(t *testing.T) {
+	reviews := 0
+	executor := collaboration.AgentExecutorFunc(func(ctx context.Context, agent collaboration.AgentRef, input string, _ map[string]interface{}) (string, error) {
+		collaboration.RecordUsage(ctx, 100)
+		if agent.Key == "reviewer" {
+			reviews++
+			if reviews == 1 {
+				return `{"total_score": 60, "passed": false}`, nil
+			}
+			return `{"total_score": 90, "passed": true}`, nil
+		}
+		return "正文", nil
+	})
+
+	def, err := collaboration.ParseWorkflowDefinition(editorPipelineYAML, "")
+	require.NoError(t, err)
+	workflow, err := def.Build("开篇", map[string]interface{}{}, resolveTestAgent)
+	require.NoError(t, err)
+
+	scheduler := collaboration.NewScheduler(executor)
+	collector := &eventCollector{}
+	scheduler.SetObserver(collector)
+	_, err = scheduler.ExecuteWorkflow(context.Background(), workflow)
+	require.NoError(t, err)
+
+	// 审核-修改循环中的调用 (审核、修改、再审核) 计入所属任务
+	assert.Equal(t, 100, workflow.Tasks[0].TokensUsed)
+	assert.Equal(t, 100, workflow.Tasks[1].TokensUsed)
+	assert.Equal(t, 400, workflow.Tasks[2].TokensUsed)
+	assert.Greater(t, workflow.Tasks[2].Duration(), time.Duration(0))
+
+	statuses := collector.ofType(collaboration.EventTaskStatus)
+	last := statuses[len(statuses)-1]
+	assert.Equal(t, "polish", last.TaskID)
+	assert.Equal(t, 400, last.TokensUsed)
+}
+
+const approvalPipelineYAML = `
+name: 先审故事线再写正文
+tasks:
+  - id: plan
+    agent: narrator
+    input: "规划故事线：{{input}}"
+  - id: confirm
+    type: approval
+    input: 请确认故事线规划
+    depends_on: [plan]
+  - id: write
+    agent: character
+    input: "按故事线写正文：{{tasks.plan.output}}"
+    depends_on: [confirm]
+`
+
+func TestParseWorkflowDefinition_ValidatesApprovalTasks(t *testing.T) {
+	def, err := collaboration.ParseWorkflowDefinition(approvalPipelineYAML, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"narrator", "character"}, def.AgentKeys())
+
+	cases := map[string]string{
+		"approval with agent":  "name: x\ntasks:\n  - id: a\n    agent: narrator\n  - id: b\n    type: approval\n    agent: narrator\n    depends_on: [a]\n",
+		"approval without dep": "name: x\ntasks:\n  - id: b\n    type: approval\n",
+		"approval two deps":    "name: x\ntasks:\n  - id: a\n    agent: narrator\n  - id: c\n    agent: narrator\n  - id: b\n    type: approval\n    depends_on: [a, c]\n",
+		"approval with review": "name: x\ntasks:\n  - id: a\n    agent: narrator\n  - id: b\n    type: approval\n    depends_on: [a]\n    review:\n      reviewer: reviewer\n",
+	}
+	for name, source := range cases {
+		_, err := collaboration.ParseWorkflowDefinition(source, "")
+		assert.Error(t, err, name)
+	}
+}
+
+func TestScheduler_PausesAtApprovalGate(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		inputs = make(map[string][]string)
+	)
+	executor := collaboration.AgentExecutorFunc(func(ctx context.Context, agent collaboration.AgentRef, input string, _ map[string]interface{}) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		inputs[agent.Key] = append(inputs[agent.Key], input)
+		if agent.Key == "narrator" {
+			return fmt.Sprintf("故事线v%d", len(inputs["narrator"])), nil
+		}
+		return "正文：" + strings.TrimPrefix(input, "按故事线写正文："), nil
+	})
+
+	def, err := collaboration.ParseWorkflowDefinition(approvalPipelineYAML, "")
+	require.NoError(t, err)
+	workflow, err := def.Build("主角初到京城", map[string]interface{}{}, resolveTestAgent)
+	require.NoError(t, err)
+	plan, confirm, write := workflow.Tasks[0], workflow.Tasks[1], workflow.Tasks[2]
+	assert.Empty(t, confirm.AgentKey)
+
+	scheduler := collaboration.NewScheduler(executor)
+	result, err := scheduler.ExecuteWorkflow(context.Background(), workflow)
+	require.NoError(t, err)
+	assert.True(t, result.Paused)
+	assert.False(t, result.Success)
+	assert.Equal(t, collaboration.TaskAwaitingApproval, confirm.Status)
+	assert.Equal(t, collaboration.TaskPending, write.Status)
+	assert.Empty(t, inputs["character"])
+
+	// 不在等待状态的任务不能处理
+	_, err = workflow.ResolveApproval("plan", &collaboration.ApprovalDecision{Action: collaboration.ApprovalApprove})
+	assert.Error(t, err)
+	_, err = workflow.ResolveApproval("confirm", &collaboration.ApprovalDecision{Action: collaboration.ApprovalReject})
+	assert.Error(t, err, "驳回需要修改意见")
+
+	// 驳回：上游 Agent 收到原内容与意见后重新生成，再次等待审批
+	changed, err := workflow.ResolveApproval("confirm", &collaboration.ApprovalDecision{
+		Action:   collaboration.ApprovalReject,
+		Feedback: "节奏太慢",
+	})
+	require.NoError(t, err)
+	assert.Len(t, changed, 2)
+	result, err = scheduler.ExecuteWorkflow(context.Background(), workflow)
+	require.NoError(t, err)
+	assert.True(t, result.Paused)
+	require.Len(t, inputs["narrator"], 2)
+	assert.Contains(t, inputs["narrator"][1], "规划故事线：主角初到京城", "驳回后保留原始任务说明")
+	assert.Contains(t, inputs["narrator"][1], "故事线v1")
+	assert.Contains(t, inputs["narrator"][1], "节奏太慢")
+	assert.Equal(t, "故事线v2", plan.Result)
+
+	// 再次驳回：基于原始输入重新构建，只带上一版内容与本次意见，不层层嵌套
+	_, err = workflow.ResolveApproval("confirm", &collaboration.ApprovalDecision{
+		Action:   collaboration.ApprovalReject,
+		Feedback: "冲突不够",
+	})
+	require.NoError(t, err)
+	result, err = scheduler.ExecuteWorkflow(context.Background(), workflow)
+	require.NoError(t, err)
+	assert.True(t, result.Paused)
+	require.Len(t, inputs["narrator"], 3)
+	retry := inputs["narrator"][2]
+	assert.Equal(t, 1, strings.Count(retry, "规划故事线：主角初到京城"))
+	assert.Equal(t, 1, strings.Count(retry, "审批意见:"))
+	assert.Contains(t, retry, "故事线v2")
+	assert.Contains(t, retry, "冲突不够")
+	assert.NotContains(t, retry, "故事线v1")
+	assert.NotContains(t, retry, "节奏太慢")
+	assert.Equal(t, "故事线v3", plan.Result)
+
+	// 修改上游输出后通过：下游任务使用修改后的内容
+	_, err = workflow.ResolveApproval("confirm", &collaboration.ApprovalDecision{
+		Action:  collaboration.ApprovalEdit,
+		Content: "修改后的故事线",
+	})
+	require.NoError(t, err)
+	_, err = workflow.ResolveApproval("confirm", &collaboration.ApprovalDecision{Action: collaboration.ApprovalApprove})
+	assert.ErrorIs(t, err, collaboration.ErrApprovalNotPending)
+
+	result, err = scheduler.ExecuteWorkflow(context.Background(), workflow)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.False(t, result.Paused)
+	assert.Len(t, inputs["narrator"], 3, "通过后不再重新生成")
+	assert.Equal(t, []string{"按故事线写正文：修改后的故事线"}, inputs["character"])
+	assert.Equal(t, "正文：修改后的故事线", result.FinalContent)
+}
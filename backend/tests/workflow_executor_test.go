@@ -0,0 +1,207 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai"
+	"github.com/zibianqu/novel-study/internal/ai/agents"
+	"github.com/zibianqu/novel-study/internal/ai/collaboration"
+	"github.com/zibianqu/novel-study/internal/ai/llm"
+	"github.com/zibianqu/novel-study/internal/config"
+	"github.com/zibianqu/novel-study/internal/model"
+	"github.com/zibianqu/novel-study/internal/service"
+)
+
+// promptEchoProvider 记录每次请求，回复中带上系统提示词的第一行，用于判断执行的是哪个 Agent
+type promptEchoProvider struct {
+	mu       sync.Mutex
+	requests []*llm.CompletionRequest
+}
+
+func (p *promptEchoProvider) CreateCompletion(ctx context.Context, req *llm.CompletionRequest) (*llm.CompletionResponse, error) {
+	p.mu.Lock()
+	p.requests = append(p.requests, req)
+	p.mu.Unlock()
+
+	system := ""
+	if len(req.Messages) > 0 && req.Messages[0].Role == "system" {
+		system = strings.SplitN(req.Messages[0].Content, "\n", 2)[0]
+	}
+	return &llm.CompletionResponse{
+		Content: system + "的输出",
+		Model:   req.Model,
+		Usage:   llm.TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}, nil
+}
+
+// newTestEngine 创建不连接数据库的引擎，并注册给定的 Agent 定义
+func newTestEngine(t *testing.T, provider llm.LLMProvider, rows ...*model.Agent) *ai.Engine {
+	engine := ai.NewEngine(&config.Config{}, nil, provider, nil, nil, nil, nil, nil, nil)
+	for _, row := range rows {
+		require.NoError(t, engine.RegisterAgentModel(row))
+	}
+	return engine
+}
+
+func TestWorkflowAgentResolver_RunsExtensionAgentThroughEngine(t *testing.T) {
+	ownerID, otherID := 7, 8
+	rows := map[string]*model.Agent{
+		"agent_1_narrator": {ID: 2, AgentKey: "agent_1_narrator", Type: "core", SystemPrompt: "你是旁白叙述者", Model: "gpt-4o", IsActive: true},
+		"my_poet":          {ID: 42, UserID: &ownerID, AgentKey: "my_poet", Type: "extension", SystemPrompt: "你是诗人", Model: "gpt-4o", IsActive: true},
+		"their_agent":      {ID: 43, UserID: &otherID, AgentKey: "their_agent", Type: "extension", SystemPrompt: "你是别人的Agent", Model: "gpt-4o", IsActive: true},
+	}
+	lookup := func(key string) (*model.Agent, error) {
+		if row, ok := rows[key]; ok {
+			return row, nil
+		}
+		return nil, sql.ErrNoRows
+	}
+
+	provider := &promptEchoProvider{}
+	engine := newTestEngine(t, provider, rows["agent_1_narrator"], rows["my_poet"], rows["their_agent"])
+	resolve := service.WorkflowAgentResolver(lookup, ownerID)
+
+	def, err := collaboration.ParseWorkflowDefinition(`
+name: 诗化
+tasks:
+  - id: draft
+    agent: agent_1_narrator
+  - id: poem
+    agent: my_poet
+    input: "改写为诗：{{tasks.draft.output}}"
+`, "")
+	require.NoError(t, err)
+	workflow, err := def.Build("月夜", map[string]interface{}{}, resolve)
+	require.NoError(t, err)
+
+	result, err := collaboration.NewScheduler(engine.WorkflowExecutor()).ExecuteWorkflow(context.Background(), workflow)
+	require.NoError(t, err)
+	require.True(t, result.Success)
+
+	// 扩展 Agent 按 agent_key 执行，而不是把 agents.id (42) 当作核心 Agent 编号
+	assert.Equal(t, "你是旁白叙述者的输出", workflow.Tasks[0].Result)
+	assert.Equal(t, "你是诗人的输出", workflow.Tasks[1].Result)
+	require.Len(t, provider.requests, 2)
+
+	// 其他用户的扩展 Agent 与不存在的 Agent 都不可用
+	_, err = resolve("their_agent")
+	assert.ErrorIs(t, err, service.ErrInvalidWorkflow)
+	_, err = resolve("missing")
+	assert.ErrorIs(t, err, service.ErrInvalidWorkflow)
+}
+
+// streamingEchoProvider 在 promptEchoProvider 的基础上支持流式输出，记录流式调用次数
+type streamingEchoProvider struct {
+	promptEchoProvider
+	streamCalls int
+}
+
+func (p *streamingEchoProvider) CreateCompletionStream(ctx context.Context, req *llm.CompletionRequest, onDelta func(string)) (*llm.CompletionResponse, error) {
+	resp, err := p.CreateCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.streamCalls++
+	p.mu.Unlock()
+	for _, r := range resp.Content {
+		onDelta(string(r))
+	}
+	return resp, nil
+}
+
+// userMessage 返回第 i 次请求的用户消息
+func (p *promptEchoProvider) userMessage(i int) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	messages := p.requests[i].Messages
+	return messages[len(messages)-1].Content
+}
+
+// recordingBudget 记录每次预算检查的用户与项目
+type recordingBudget struct {
+	mu    sync.Mutex
+	calls [][2]int
+}
+
+func (b *recordingBudget) CheckBudget(userID, projectID int) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, [2]int{userID, projectID})
+	return nil, nil
+}
+
+func newWorkflowTestEngine(t *testing.T, provider llm.LLMProvider) *ai.Engine {
+	engine := newTestEngine(t, provider,
+		&model.Agent{ID: 2, AgentKey: "agent_1_narrator", Type: "core", SystemPrompt: "你是旁白叙述者", Model: "gpt-4o", IsActive: true})
+	// 内置模板按核心 Agent 编号引用
+	reviewer, err := agents.NewAgentFromModel(&model.Agent{AgentKey: "agent_3_reviewer", Type: "core", SystemPrompt: "你是审核导演", Model: "gpt-4o", IsActive: true}, provider, engine.GetToolRegistry())
+	require.NoError(t, err)
+	engine.RegisterAgent("agent_3_reviewer", 3, reviewer)
+	return engine
+}
+
+func TestWorkflowExecutor_UsesRestoredContextAndDependencyOutputs(t *testing.T) {
+	provider := &streamingEchoProvider{}
+	engine := newWorkflowTestEngine(t, provider)
+	budget := &recordingBudget{}
+	engine.SetBudgetGuard(budget)
+
+	// 从数据库恢复的运行中，上下文的数字反序列化为 float64
+	taskContext := map[string]interface{}{"project_id": float64(3), "user_id": float64(7)}
+	workflow := collaboration.NewWorkflow("wf_restored", "恢复的运行", "")
+	workflow.AddTask(&collaboration.AgentTask{ID: "b", AgentKey: "agent_1_narrator", Input: "写支线", Context: taskContext, Status: collaboration.TaskPending})
+	workflow.AddTask(&collaboration.AgentTask{ID: "a", AgentKey: "agent_1_narrator", Input: "写主线", Context: taskContext, Status: collaboration.TaskPending})
+	workflow.AddTask(&collaboration.AgentTask{ID: "merge", AgentID: 3, Context: taskContext, Status: collaboration.TaskPending, DependsOn: []string{"b", "a"}})
+
+	result, err := collaboration.NewScheduler(engine.WorkflowExecutor()).ExecuteWorkflow(context.Background(), workflow)
+	require.NoError(t, err)
+	require.True(t, result.Success)
+
+	// 没有事件接收者时不流式执行
+	assert.Zero(t, provider.streamCalls)
+	require.Len(t, provider.requests, 3)
+	assert.Equal(t, [][2]int{{7, 3}, {7, 3}, {7, 3}}, budget.calls)
+
+	// 输入为空的任务按任务 ID 顺序拼接依赖任务的输出，按核心 Agent 编号执行
+	assert.True(t, strings.HasPrefix(provider.userMessage(2),
+		"请基于以下上游任务的输出完成本任务。\n\n### a\n你是旁白叙述者的输出\n\n### b\n你是旁白叙述者的输出\n"), provider.userMessage(2))
+	assert.Equal(t, "你是审核导演的输出", result.FinalContent)
+	for _, task := range workflow.Tasks {
+		assert.Equal(t, 15, task.TokensUsed, task.ID)
+	}
+}
+
+func TestWorkflowExecutor_StreamsOnlyWithOutputCallback(t *testing.T) {
+	provider := &streamingEchoProvider{}
+	executor := newWorkflowTestEngine(t, provider).WorkflowExecutor()
+
+	var chunks []string
+	streamCtx := collaboration.WithOutputCallback(context.Background(), func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+
+	for _, agent := range []collaboration.AgentRef{{Key: "agent_1_narrator"}, {ID: 3}} {
+		chunks = nil
+		output, err := executor.Execute(streamCtx, agent, "写开头", nil)
+		require.NoError(t, err, agent.String())
+		assert.Equal(t, output, strings.Join(chunks, ""), agent.String())
+	}
+	assert.Equal(t, 2, provider.streamCalls)
+
+	output, err := executor.Execute(context.Background(), collaboration.AgentRef{ID: 3}, "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "你是审核导演的输出", output)
+	assert.Equal(t, 2, provider.streamCalls, "没有输出回调时不流式执行")
+	// 没有输入与依赖时使用通用提示
+	assert.Equal(t, "请根据上下文完成本任务。", provider.userMessage(2))
+
+	_, err = executor.Execute(context.Background(), collaboration.AgentRef{ID: 99}, "写开头", nil)
+	assert.Error(t, err)
+}
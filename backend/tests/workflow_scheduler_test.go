@@ -0,0 +1,361 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zibianqu/novel-study/internal/ai/collaboration"
+)
+
+// fakeAgentExecutor 记录并发数的执行器，failAgents 中的 Agent 返回错误
+type fakeAgentExecutor struct {
+	delay      time.Duration
+	failAgents map[int]bool
+
+	running    int32
+	maxRunning int32
+
+	mu       sync.Mutex
+	contexts map[int]map[string]interface{}
+}
+
+func (e *fakeAgentExecutor) Execute(ctx context.Context, agent collaboration.AgentRef, input string, taskContext map[string]interface{}) (string, error) {
+	n := atomic.AddInt32(&e.running, 1)
+	defer atomic.AddInt32(&e.running, -1)
+	for {
+		max := atomic.LoadInt32(&e.maxRunning)
+		if n <= max || atomic.CompareAndSwapInt32(&e.maxRunning, max, n) {
+			break
+		}
+	}
+
+	e.mu.Lock()
+	if e.contexts == nil {
+		e.contexts = make(map[int]map[string]interface{})
+	}
+	e.contexts[agent.ID] = taskContext
+	e.mu.Unlock()
+
+	select {
+	case <-time.After(e.delay):
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	if e.failAgents[agent.ID] {
+		return "", errors.New("agent failed")
+	}
+	return fmt.Sprintf("agent_%d 的输出", agent.ID), nil
+}
+
+func newTask(id string, agentID int, dependsOn ...string) *collaboration.AgentTask {
+	return &collaboration.AgentTask{ID: id, AgentID: agentID, Status: collaboration.TaskPending, DependsOn: dependsOn}
+}
+
+func TestScheduler_RunsIndependentTasksConcurrently(t *testing.T) {
+	executor := &fakeAgentExecutor{delay: 50 * time.Millisecond}
+	scheduler := collaboration.NewScheduler(executor)
+	workflow := collaboration.BuildStorylinePlanningWorkflow("规划第二卷", map[string]interface{}{"project_id": 1})
+
+	result, err := scheduler.ExecuteWorkflow(context.Background(), workflow)
+	require.NoError(t, err)
+
+	assert.True(t, result.Success)
+	assert.Equal(t, int32(3), executor.maxRunning)
+	assert.Equal(t, "agent_0 的输出", result.FinalContent)
+
+	// 整合任务收到三个掌控者的结果，共用的上下文 map 不被修改
+	integrate := executor.contexts[0]
+	assert.Equal(t, "agent_4 的输出", integrate["dependency_task_skyline"])
+	assert.Equal(t, "agent_5 的输出", integrate["dependency_task_groundline"])
+	assert.Equal(t, "agent_6 的输出", integrate["dependency_task_plotline"])
+	assert.Equal(t, 1, integrate["project_id"])
+	assert.NotContains(t, executor.contexts[4], "dependency_task_skyline")
+}
+
+func TestScheduler_BoundsConcurrency(t *testing.T) {
+	executor := &fakeAgentExecutor{delay: 20 * time.Millisecond}
+	scheduler := collaboration.NewScheduler(executor)
+	scheduler.SetMaxConcurrency(2)
+
+	workflow := collaboration.NewWorkflow("wf_bounded", "并发上限", "")
+	for i := 0; i < 6; i++ {
+		workflow.AddTask(newTask(fmt.Sprintf("task_%d", i), i))
+	}
+
+	_, err := scheduler.ExecuteWorkflow(context.Background(), workflow)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), executor.maxRunning)
+}
+
+func TestScheduler_DetectsCycles(t *testing.T) {
+	workflow := collaboration.NewWorkflow("wf_cycle", "循环依赖", "")
+	workflow.AddTask(newTask("a", 1, "c"))
+	workflow.AddTask(newTask("b", 2, "a"))
+	workflow.AddTask(newTask("c", 3, "b"))
+	workflow.AddTask(newTask("d", 4))
+
+	_, err := workflow.TopologicalOrder()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cycle")
+
+	executor := &fakeAgentExecutor{}
+	_, err = collaboration.NewScheduler(executor).ExecuteWorkflow(context.Background(), workflow)
+	require.Error(t, err)
+	assert.Equal(t, int32(0), executor.maxRunning)
+
+	unknown := collaboration.NewWorkflow("wf_unknown", "依赖不存在", "")
+	unknown.AddTask(newTask("a", 1, "missing"))
+	_, err = unknown.TopologicalOrder()
+	assert.Error(t, err)
+}
+
+func TestWorkflow_TopologicalOrderPutsDependenciesFirst(t *testing.T) {
+	workflow := collaboration.NewWorkflow("wf_order", "排序", "")
+	workflow.AddTask(newTask("review", 3, "narration", "dialogue"))
+	workflow.AddTask(newTask("narration", 1, "plan"))
+	workflow.AddTask(newTask("dialogue", 2, "plan"))
+	workflow.AddTask(newTask("plan", 0))
+
+	order, err := workflow.TopologicalOrder()
+	require.NoError(t, err)
+
+	var ids []string
+	for _, task := range order {
+		ids = append(ids, task.ID)
+	}
+	assert.Equal(t, []string{"plan", "narration", "dialogue", "review"}, ids)
+}
+
+func TestScheduler_FailFastCancelsRemainingTasks(t *testing.T) {
+	executor := &fakeAgentExecutor{delay: 20 * time.Millisecond, failAgents: map[int]bool{1: true}}
+	scheduler := collaboration.NewScheduler(executor)
+
+	workflow := collaboration.NewWorkflow("wf_fail_fast", "失败即停止", "")
+	workflow.AddTask(newTask("narration", 1))
+	workflow.AddTask(newTask("review", 3, "narration"))
+
+	result, err := scheduler.ExecuteWorkflow(context.Background(), workflow)
+	require.Error(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, collaboration.TaskFailed, workflow.Tasks[0].Status)
+	assert.Equal(t, collaboration.TaskSkipped, workflow.Tasks[1].Status)
+	assert.Equal(t, []string{"narration"}, failedIDs(result))
+}
+
+func TestScheduler_ContinueOnErrorRunsUnaffectedTasks(t *testing.T) {
+	executor := &fakeAgentExecutor{delay: 5 * time.Millisecond, failAgents: map[int]bool{4: true}}
+	scheduler := collaboration.NewScheduler(executor)
+	scheduler.SetMaxConcurrency(1)
+
+	workflow := collaboration.NewWorkflow("wf_continue", "继续执行", "")
+	workflow.FailurePolicy = collaboration.ContinueOnError
+	workflow.AddTask(newTask("skyline", 4))
+	workflow.AddTask(newTask("groundline", 5))
+	workflow.AddTask(newTask("integrate", 0, "skyline", "groundline"))
+	workflow.AddTask(newTask("polish", 1, "groundline"))
+
+	result, err := scheduler.ExecuteWorkflow(context.Background(), workflow)
+	require.Error(t, err)
+	assert.False(t, result.Success)
+
+	statuses := map[string]string{}
+	for _, task := range workflow.Tasks {
+		statuses[task.ID] = task.Status
+	}
+	assert.Equal(t, map[string]string{
+		"skyline":    collaboration.TaskFailed,
+		"groundline": collaboration.TaskCompleted,
+		"integrate":  collaboration.TaskSkipped,
+		"polish":     collaboration.TaskCompleted,
+	}, statuses)
+	assert.Equal(t, "agent_1 的输出", result.FinalContent)
+	assert.Equal(t, []string{"integrate"}, result.Metadata["skipped_tasks"])
+}
+
+func failedIDs(result *collaboration.WorkflowResult) []string {
+	ids, _ := result.Metadata["failed_tasks"].([]string)
+	return ids
+}
+
+// taskRecorder 记录调度器上报的任务状态
+type taskRecorder struct {
+	mu       sync.Mutex
+	statuses map[string][]string
+}
+
+func (r *taskRecorder) RecordTask(workflowID string, task *collaboration.AgentTask) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.statuses == nil {
+		r.statuses = make(map[string][]string)
+	}
+	r.statuses[task.ID] = append(r.statuses[task.ID], task.Status)
+}
+
+func TestScheduler_ResumesFromCompletedTasks(t *testing.T) {
+	executor := &fakeAgentExecutor{}
+	scheduler := collaboration.NewScheduler(executor)
+	recorder := &taskRecorder{}
+	scheduler.SetRecorder(recorder)
+
+	// 模拟重启前已完成 draft，review 执行中被中断
+	draft := newTask("draft", 1)
+	draft.Status = collaboration.TaskCompleted
+	draft.Result = "已保存的草稿"
+	review := newTask("review", 2, "draft")
+	review.Status = collaboration.TaskRunning
+
+	workflow := &collaboration.Workflow{ID: "wf_resume"}
+	workflow.AddTask(draft)
+	workflow.AddTask(review)
+
+	result, err := scheduler.ExecuteWorkflow(context.Background(), workflow)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	// draft 不再执行，review 收到保存的结果
+	assert.NotContains(t, executor.contexts, 1)
+	assert.Equal(t, "已保存的草稿", executor.contexts[2]["dependency_draft"])
+	assert.Equal(t, "已保存的草稿", draft.Result)
+
+	assert.NotContains(t, recorder.statuses, "draft")
+	assert.Equal(t, []string{collaboration.TaskRunning, collaboration.TaskCompleted}, recorder.statuses["review"])
+}
+
+func TestScheduler_TracksRunningWorkflowsByIDAndForgetsFinishedOnes(t *testing.T) {
+	var started sync.WaitGroup
+	started.Add(2)
+	release := make(chan struct{})
+	executor := collaboration.AgentExecutorFunc(func(ctx context.Context, agent collaboration.AgentRef, input string, _ map[string]interface{}) (string, error) {
+		started.Done()
+		<-release
+		return input + "的输出", nil
+	})
+	scheduler := collaboration.NewScheduler(executor)
+
+	// 两个工作流使用相同的任务 ID
+	newWorkflow := func(id string) *collaboration.Workflow {
+		workflow := collaboration.NewWorkflow(id, id, "")
+		task := newTask("draft", 1)
+		task.Input = id
+		workflow.AddTask(task)
+		return workflow
+	}
+	workflows := []*collaboration.Workflow{newWorkflow("wf_a"), newWorkflow("wf_b")}
+
+	var wg sync.WaitGroup
+	for _, workflow := range workflows {
+		wg.Add(1)
+		go func(workflow *collaboration.Workflow) {
+			defer wg.Done()
+			_, err := scheduler.ExecuteWorkflow(context.Background(), workflow)
+			assert.NoError(t, err)
+		}(workflow)
+	}
+	started.Wait()
+
+	for _, workflow := range workflows {
+		task, err := scheduler.GetTaskStatus(workflow.ID, "draft")
+		require.NoError(t, err)
+		assert.Same(t, workflow.Tasks[0], task)
+		assert.Equal(t, collaboration.TaskRunning, task.Status)
+	}
+
+	close(release)
+	wg.Wait()
+
+	// 运行结束后不再保留工作流与任务
+	for _, workflow := range workflows {
+		assert.Equal(t, workflow.ID+"的输出", workflow.Tasks[0].Result)
+		_, err := scheduler.GetWorkflowStatus(workflow.ID)
+		assert.Error(t, err)
+		_, err = scheduler.GetTaskStatus(workflow.ID, "draft")
+		assert.Error(t, err)
+	}
+}
+
+// runEventCounter 统计调度器发出的任务状态事件
+type runEventCounter struct{ statuses int32 }
+
+func (c *runEventCounter) OnRunEvent(event *collaboration.RunEvent) {
+	if event.Type == collaboration.EventTaskStatus {
+		atomic.AddInt32(&c.statuses, 1)
+	}
+}
+
+// 需配合 go test -race 运行，检查并行任务对任务字段的读写
+func TestScheduler_ParallelDAGUpdatesTasksSafely(t *testing.T) {
+	var mu sync.Mutex
+	inputs := make(map[int]string)
+	executor := collaboration.AgentExecutorFunc(func(ctx context.Context, agent collaboration.AgentRef, input string, taskContext map[string]interface{}) (string, error) {
+		mu.Lock()
+		inputs[agent.ID] = input
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		return fmt.Sprintf("agent_%d 的输出", agent.ID), nil
+	})
+	scheduler := collaboration.NewScheduler(executor)
+	scheduler.SetMaxConcurrency(4)
+	recorder := &taskRecorder{}
+	scheduler.SetRecorder(recorder)
+	observer := &runEventCounter{}
+	scheduler.SetObserver(observer)
+
+	// outline 之后四个分支并行执行，共用同一个上下文 map，merge 汇总全部分支
+	shared := map[string]interface{}{"project_id": 1}
+	workflow := collaboration.NewWorkflow("wf_dag", "并行 DAG", "")
+	workflow.AddTask(newTask("outline", 1))
+	branches := []string{"branch_2", "branch_3", "branch_4", "branch_5"}
+	for i, id := range branches {
+		task := newTask(id, i+2, "outline")
+		task.Input = "根据 {{tasks.outline.output}} 展开"
+		task.Context = shared
+		workflow.AddTask(task)
+	}
+	merge := newTask("merge", 6, branches...)
+	merge.Input = "{{tasks.branch_2.output}} / {{tasks.branch_5.output}}"
+	merge.Context = shared
+	workflow.AddTask(merge)
+
+	// 执行期间持续查询运行状态
+	done := make(chan struct{})
+	var polling sync.WaitGroup
+	polling.Add(1)
+	go func() {
+		defer polling.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				scheduler.GetWorkflowStatus("wf_dag")
+				scheduler.GetTaskStatus("wf_dag", "merge")
+			}
+		}
+	}()
+
+	result, err := scheduler.ExecuteWorkflow(context.Background(), workflow)
+	close(done)
+	polling.Wait()
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	assert.Equal(t, "根据 agent_1 的输出 展开", inputs[3])
+	assert.Equal(t, "agent_2 的输出 / agent_5 的输出", inputs[6])
+	assert.Equal(t, "agent_6 的输出", result.FinalContent)
+	assert.Equal(t, map[string]interface{}{"project_id": 1}, shared)
+
+	for _, task := range workflow.Tasks {
+		assert.False(t, task.StartTime.IsZero(), task.ID)
+		assert.Equal(t, []string{collaboration.TaskRunning, collaboration.TaskCompleted}, recorder.statuses[task.ID])
+	}
+	assert.Equal(t, int32(2*len(workflow.Tasks)), atomic.LoadInt32(&observer.statuses))
+}